@@ -5,21 +5,32 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"fowergram/config"
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
 	"fowergram/internal/core/services"
 	"fowergram/internal/handlers"
+	"fowergram/internal/jobs"
+	"fowergram/internal/middleware"
 	"fowergram/internal/repositories/postgres"
 	"fowergram/internal/repositories/redis"
 	"fowergram/pkg/email"
 	"fowergram/pkg/geolocation"
+	"fowergram/pkg/identity"
+	"fowergram/pkg/imaging"
+	"fowergram/pkg/security"
+	"fowergram/pkg/storage"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 func main() {
@@ -29,20 +40,151 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Load JWT signing keys
+	jwtKeys, err := security.LoadKeyRing(cfg.JWT.KeysDir, cfg.JWT.SigningKeyID, cfg.JWT.Secret)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	// Password policy, optionally backed by a local breached-password corpus
+	var breachedPasswords security.BreachChecker
+	if cfg.Password.BreachedCorpusPath != "" {
+		corpus, err := security.LoadBreachedPasswords(cfg.Password.BreachedCorpusPath)
+		if err != nil {
+			log.Fatalf("Failed to load breached password corpus: %v", err)
+		}
+		defer corpus.Close()
+		breachedPasswords = corpus
+	}
+	passwordPolicy := security.NewPasswordPolicy(cfg.Password.MinLength, cfg.Password.MinEntropyBits, breachedPasswords)
+
+	// WebAuthn relying party for passkeys
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.WebAuthn.RPOrigins,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure WebAuthn: %v", err)
+	}
+
+	// External identity providers for social login
+	identityProviders := make(map[string]identity.Provider)
+	redirectURL := strings.TrimSuffix(cfg.Social.RedirectURL, "/") + "/"
+	if cfg.Social.GoogleClientID != "" {
+		identityProviders[identity.ProviderGoogle] = identity.NewGoogleProvider(cfg.Social.GoogleClientID, cfg.Social.GoogleClientSecret, redirectURL+identity.ProviderGoogle)
+	}
+	if cfg.Social.AppleServicesID != "" {
+		apple, err := identity.NewAppleProvider(cfg.Social.AppleServicesID, cfg.Social.AppleTeamID, cfg.Social.AppleKeyID, cfg.Social.ApplePrivateKeyPath, redirectURL+identity.ProviderApple)
+		if err != nil {
+			log.Fatalf("Failed to configure Sign in with Apple: %v", err)
+		}
+		identityProviders[identity.ProviderApple] = apple
+	}
+	if cfg.Social.LINEChannelID != "" {
+		identityProviders[identity.ProviderLINE] = identity.NewLINEProvider(cfg.Social.LINEChannelID, cfg.Social.LINEChannelSecret, redirectURL+identity.ProviderLINE)
+	}
+	if cfg.Social.FacebookAppID != "" {
+		identityProviders[identity.ProviderFacebook] = identity.NewFacebookProvider(cfg.Social.FacebookAppID, cfg.Social.FacebookAppSecret, redirectURL+identity.ProviderFacebook)
+	}
+
+	// TOTP secrets are encrypted at rest, a key derived from an empty passphrase
+	// would protect nothing
+	if cfg.TwoFactor.EncryptionKey == "" {
+		log.Fatalf("TWO_FACTOR_ENCRYPTION_KEY must be set")
+	}
+
+	// Key for the data export download links. Every replica has to share it, or links
+	// already emailed would stop working on the others and after a restart.
+	if cfg.Export.SigningKey == "" {
+		log.Fatalf("EXPORT_SIGNING_KEY must be set")
+	}
+	exportSigningKey := security.DeriveEncryptionKey(cfg.Export.SigningKey)
+
+	// Storage for uploaded media
+	var blobStore ports.BlobStore
+	switch cfg.Media.Storage {
+	case "local":
+		blobStore = storage.NewLocalStore(cfg.Media.Dir)
+	case "s3":
+		blobStore = storage.NewS3Store(storage.S3Config{
+			Endpoint:        cfg.Media.S3Endpoint,
+			Region:          cfg.Media.S3Region,
+			Bucket:          cfg.Media.S3Bucket,
+			AccessKeyID:     cfg.Media.S3AccessKeyID,
+			SecretAccessKey: cfg.Media.S3SecretAccessKey,
+			PathStyle:       cfg.Media.S3PathStyle,
+		})
+	default:
+		log.Fatalf("Unknown MEDIA_STORAGE %q, use local or s3", cfg.Media.Storage)
+	}
+
+	// WebP is encoded and decoded with the libwebp command line tools
+	var webpCodec imaging.WebPCodec
+	if tools, err := imaging.FindWebPTools(cfg.Media.WebPToolsDir); err != nil {
+		log.Printf("WebP tools not found, photos get JPEG renditions only and WebP uploads fail: %v", err)
+	} else {
+		webpCodec = tools
+	}
+
 	// Setup repositories
 	userRepo := postgres.NewUserRepository(cfg.DB)
 	authRepo := postgres.NewAuthRepository(cfg.DB)
 	cacheRepo := redis.NewCacheRepository(cfg.Redis)
+	revocationRepo := redis.NewSessionRevocationRepository(cfg.Redis)
+	passkeyRepo := postgres.NewPasskeyRepository(cfg.DB)
+	challengeRepo := redis.NewChallengeRepository(cfg.Redis)
+	identityRepo := postgres.NewIdentityRepository(cfg.DB)
+	oauthRepo := postgres.NewOAuthRepository(cfg.DB)
+	adminActionRepo := postgres.NewAdminActionRepository(cfg.DB)
+	auditRepo := postgres.NewAuditRepository(cfg.DB)
+	rateLimitRepo := redis.NewRateLimitRepository(cfg.Redis)
+	apiKeyRepo := postgres.NewAPIKeyRepository(cfg.DB)
+	dataExportRepo := postgres.NewDataExportRepository(cfg.DB)
+	postRepo := postgres.NewPostRepository(cfg.DB)
+	mediaRepo := postgres.NewMediaRepository(cfg.DB)
 
 	// Setup services
-	emailService := email.NewEmailService(cfg.Email.APIKey, cfg.Email.SenderEmail, cfg.Email.SenderName)
+	emailService := email.NewEmailService(cfg.Email.APIKey, cfg.Email.SenderEmail, cfg.Email.SenderName, cfg.Email.MagicLinkURL)
 	geoService := geolocation.NewGeoService(cfg.Geo.APIKey)
 	userService := services.NewUserService(userRepo, cacheRepo)
-	authService := services.NewAuthService(authRepo, emailService, geoService, cacheRepo, cfg.JWT.Secret)
+	auditService := services.NewAuditService(auditRepo)
+	mediaService := services.NewMediaService(mediaRepo, blobStore, webpCodec, cfg.Media.PublicURL, cfg.Media.Workers)
+	postService := services.NewPostService(postRepo, userRepo, cacheRepo, mediaService, adminActionRepo, auditService)
+	rateLimitService := services.NewRateLimitService(rateLimitRepo)
+	twoFactorService := services.NewTwoFactorService(authRepo, auditService, security.DeriveEncryptionKey(cfg.TwoFactor.EncryptionKey), cfg.TwoFactor.Issuer)
+	passkeyService := services.NewPasskeyService(authRepo, passkeyRepo, challengeRepo, webAuthn)
+	oauthService := services.NewOAuthService(oauthRepo, challengeRepo, jwtKeys)
+	socialAuthService := services.NewSocialAuthService(authRepo, identityRepo, challengeRepo, identityProviders, security.DefaultPasswordHasher())
+	authService := services.NewAuthService(authRepo, emailService, geoService, cacheRepo, revocationRepo, twoFactorService, passkeyService, socialAuthService, auditService, rateLimitService, jwtKeys, security.DefaultPasswordHasher(), passwordPolicy)
+	adminService := services.NewAdminService(userRepo, authRepo, adminActionRepo, authService, auditService, rateLimitService)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, authRepo, auditService)
+	dataExportService := services.NewDataExportService(dataExportRepo, emailService, auditService, blobStore, cfg.Export.Dir, cfg.Export.DownloadURL, exportSigningKey)
+	accountService := services.NewAccountService(authRepo, userRepo, authService, twoFactorService, emailService, cacheRepo, auditService, rateLimitService, security.DefaultPasswordHasher())
+
+	// Background jobs
+	go jobs.StartRecoveryExpiry(cfg.DB)
+	go jobs.StartAccountPurge(accountService)
+	go jobs.StartDataExports(dataExportService)
+	go jobs.StartMediaCleanup(mediaService)
+	go jobs.StartMediaProcessing(mediaService)
 
 	// Setup handlers
 	userHandler := handlers.NewUserHandler(userService)
 	authHandler := handlers.NewAuthHandler(authService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService)
+	passkeyHandler := handlers.NewPasskeyHandler(passkeyService, authService)
+	socialAuthHandler := handlers.NewSocialAuthHandler(socialAuthService, authService)
+	oauthHandler := handlers.NewOAuthHandler(oauthService, userService)
+	adminHandler := handlers.NewAdminHandler(adminService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	deviceHandler := handlers.NewDeviceHandler(authService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+	dataExportHandler := handlers.NewDataExportHandler(dataExportService)
+	postHandler := handlers.NewPostHandler(postService)
+	mediaHandler := handlers.NewMediaHandler(mediaService)
+	jwksHandler := handlers.NewJWKSHandler(jwtKeys)
 
 	// Setup Fiber app with custom config
 	app := fiber.New(fiber.Config{
@@ -50,10 +192,19 @@ func main() {
 		ReadTimeout:           10 * time.Second,
 		WriteTimeout:          10 * time.Second,
 		IdleTimeout:           120 * time.Second,
+		// The client address is only read from the proxy header on requests that come
+		// through a trusted proxy, anyone else could pick their own address
+		ProxyHeader:             cfg.Server.ProxyHeader,
+		EnableTrustedProxyCheck: cfg.Server.ProxyHeader != "",
+		TrustedProxies:          cfg.Server.TrustedProxies,
+		EnableIPValidation:      true,
+		// Room for a multipart image upload, larger files are sent in chunks
+		BodyLimit: domain.MaxImageSize + 1<<20,
 	})
 
 	// Middleware
 	app.Use(recover.New())
+	app.Use(requestid.New())
 	app.Use(logger.New())
 	app.Use(cors.New())
 
@@ -77,14 +228,145 @@ func main() {
 		})
 	})
 
+	// Uploaded files. Their URLs contain the content hash and cannot be guessed.
+	app.Get("/media/:hash", mediaHandler.Serve)
+
+	// Public keys for services that verify Fowergram tokens
+	app.Get("/.well-known/jwks.json", jwksHandler.GetJWKS)
+
 	// API routes
-	api := app.Group("/api/v1")
+	rateLimit := func(policy domain.RateLimitPolicy, key middleware.RateLimitKey) fiber.Handler {
+		return middleware.RateLimit(rateLimitService, policy, key)
+	}
+	api := app.Group("/api/v1", rateLimit(middleware.APIPerIP, middleware.ByIP), middleware.TrackSessionActivity(authService))
+	// API keys are only accepted on routes that check their scopes, account settings
+	// need a signed in session
+	requireAuth := middleware.ValidateAuth(jwtKeys, revocationRepo, apiKeyService)
+	requireSession := middleware.RequireSession(jwtKeys, revocationRepo)
+	requireScope := func(scopes ...string) fiber.Handler {
+		return middleware.RequireScope(jwtKeys, revocationRepo, apiKeyService, oauthService, scopes...)
+	}
+	requirePermission := func(permission domain.Permission) fiber.Handler {
+		return middleware.RequirePermission(userService, permission)
+	}
+	verificationPolicy := middleware.NewVerificationPolicy(userService, cfg.Account.UnverifiedRestrictions)
 
 	// Auth routes
 	auth := api.Group("/auth")
-	auth.Post("/register", authHandler.Register)
-	auth.Post("/login", authHandler.Login)
-	auth.Post("/logout", authHandler.Logout)
+	limitEmailIP := rateLimit(middleware.EmailPerIP, middleware.ByIP)
+	limitEmailAddress := rateLimit(middleware.EmailPerAddress, middleware.ByEmail)
+	limitCode := rateLimit(middleware.CodePerIP, middleware.ByIP)
+	limitSecurity := rateLimit(middleware.SecurityPerUser, middleware.ByUser)
+	auth.Post("/register", rateLimit(middleware.RegisterPerIP, middleware.ByIP), authHandler.Register)
+	auth.Post("/verify-email", limitCode, authHandler.VerifyEmail)
+	auth.Post("/verify-email/resend", limitEmailIP, limitEmailAddress, authHandler.ResendVerification)
+	auth.Post("/password/forgot", limitEmailIP, limitEmailAddress, authHandler.ForgotPassword)
+	auth.Post("/password/verify", limitCode, authHandler.VerifyResetCode)
+	auth.Post("/password/reset", limitCode, authHandler.ResetPassword)
+	auth.Post("/password/change", requireSession, limitSecurity, authHandler.ChangePassword)
+	auth.Post("/login", rateLimit(middleware.LoginPerIP, middleware.ByIP), rateLimit(middleware.LoginPerEmail, middleware.ByEmail), authHandler.Login)
+	auth.Post("/login/2fa", limitCode, authHandler.LoginTwoFactor)
+	auth.Post("/login/verify", limitCode, authHandler.VerifyLogin)
+	auth.Post("/magic-link", limitEmailIP, limitEmailAddress, authHandler.RequestMagicLink)
+	auth.Post("/magic-link/verify", limitCode, authHandler.ConsumeMagicLink)
+	auth.Post("/refresh", authHandler.Refresh)
+	auth.Post("/logout", requireSession, authHandler.Logout)
+	auth.Post("/logout/others", requireSession, authHandler.LogoutOthers)
+	auth.Post("/logout/all", requireSession, authHandler.LogoutAll)
+
+	// Two-factor authentication routes
+	twoFactor := auth.Group("/2fa", requireSession, limitSecurity)
+	twoFactor.Post("/setup", twoFactorHandler.Setup)
+	twoFactor.Post("/enable", twoFactorHandler.Enable)
+	twoFactor.Post("/disable", twoFactorHandler.Disable)
+	twoFactor.Post("/backup-codes", twoFactorHandler.RegenerateBackupCodes)
+
+	// Passkey routes
+	passkeys := auth.Group("/passkeys")
+	passkeys.Post("/login/begin", passkeyHandler.BeginLogin)
+	passkeys.Post("/login/finish", limitCode, passkeyHandler.FinishLogin)
+	passkeys.Post("/register/begin", requireSession, passkeyHandler.BeginRegistration)
+	passkeys.Post("/register/finish", requireSession, passkeyHandler.FinishRegistration)
+	passkeys.Get("/", requireSession, passkeyHandler.List)
+	passkeys.Delete("/:id", requireSession, passkeyHandler.Delete)
+
+	// Social login routes
+	oauth := auth.Group("/oauth")
+	oauth.Get("/providers", socialAuthHandler.Providers)
+	oauth.Post("/:provider/start", socialAuthHandler.Start)
+	oauth.Post("/:provider/callback", socialAuthHandler.Callback)
+	oauth.Post("/:provider/link/start", requireSession, socialAuthHandler.StartLink)
+	oauth.Post("/:provider/link", requireSession, socialAuthHandler.Link)
+	auth.Get("/identities", requireSession, socialAuthHandler.ListIdentities)
+	auth.Delete("/identities/:provider", requireSession, socialAuthHandler.Unlink)
+	auth.Get("/audit-log", requireSession, auditHandler.ListMine)
+
+	// Signed in devices
+	devices := auth.Group("/devices", requireSession)
+	devices.Get("/", deviceHandler.List)
+	devices.Patch("/:id", limitSecurity, deviceHandler.Update)
+	devices.Delete("/:id", deviceHandler.Revoke)
+
+	// API keys for automation
+	apiKeys := auth.Group("/api-keys", requireSession)
+	apiKeys.Post("/", limitSecurity, apiKeyHandler.Create)
+	apiKeys.Get("/", apiKeyHandler.List)
+	apiKeys.Delete("/:id", apiKeyHandler.Revoke)
+
+	// Deleting the account, after a grace period
+	auth.Post("/account/deletion-code", requireSession, limitSecurity, accountHandler.SendDeletionCode)
+	auth.Delete("/account", requireSession, limitSecurity, accountHandler.Delete)
+
+	// Copies of the user's personal data. The download link is signed and works without
+	// a session, it is opened from an email.
+	auth.Post("/data-export", requireSession, limitSecurity, dataExportHandler.Request)
+	auth.Get("/data-export", requireSession, dataExportHandler.Status)
+	api.Get("/exports/:id/download", limitCode, dataExportHandler.Download)
+
+	// OAuth2 authorization server for third-party apps
+	oauth2 := api.Group("/oauth")
+	oauth2.Post("/clients", requireSession, oauthHandler.RegisterClient)
+	oauth2.Get("/clients", requireSession, oauthHandler.ListClients)
+	oauth2.Delete("/clients/:client_id", requireSession, oauthHandler.DeleteClient)
+	oauth2.Get("/authorize", requireSession, oauthHandler.Authorize)
+	oauth2.Post("/authorize", requireSession, oauthHandler.Consent)
+	oauth2.Post("/token", limitCode, oauthHandler.Token)
+	oauth2.Post("/introspect", oauthHandler.Introspect)
+	oauth2.Post("/revoke", oauthHandler.Revoke)
+	oauth2.Get("/userinfo", requireScope(domain.ScopeProfileRead), oauthHandler.UserInfo)
+
+	// Admin routes, every request is recorded in the admin action log
+	admin := api.Group("/admin", requireAuth)
+	admin.Get("/users", requirePermission(domain.PermissionUsersRead), adminHandler.SearchUsers)
+	admin.Get("/users/:id", requirePermission(domain.PermissionUsersRead), adminHandler.GetUser)
+	admin.Post("/users/:id/lock", requirePermission(domain.PermissionUsersLock), adminHandler.LockUser)
+	admin.Post("/users/:id/unlock", requirePermission(domain.PermissionUsersLock), adminHandler.UnlockUser)
+	admin.Post("/users/:id/force-password-reset", requirePermission(domain.PermissionUsersResetPassword), adminHandler.ForcePasswordReset)
+	admin.Get("/users/:id/login-history", requirePermission(domain.PermissionLoginHistoryRead), adminHandler.GetLoginHistory)
+	admin.Put("/users/:id/role", requirePermission(domain.PermissionRolesManage), adminHandler.ChangeRole)
+	admin.Get("/actions", requirePermission(domain.PermissionAdminActionsRead), adminHandler.ListActions)
+	admin.Get("/audit", requirePermission(domain.PermissionAuditRead), auditHandler.Search)
+	admin.Get("/audit/verify", requirePermission(domain.PermissionAuditRead), auditHandler.Verify)
+	admin.Patch("/posts/:id", requirePermission(domain.PermissionPostsModerate), postHandler.UpdatePost)
+	admin.Delete("/posts/:id", requirePermission(domain.PermissionPostsModerate), postHandler.DeletePost)
+
+	// Post routes. Authors can only change their own posts, moderators use the admin
+	// routes above.
+	posts := api.Group("/posts")
+	posts.Get("/", requireScope(domain.ScopePostsRead), postHandler.GetPosts)
+	posts.Get("/:id", requireScope(domain.ScopePostsRead), postHandler.GetPost)
+	posts.Get("/:id/comments", requireScope(domain.ScopePostsRead), postHandler.GetComments)
+	posts.Post("/", requireScope(domain.ScopePostsWrite), verificationPolicy.RequireVerifiedEmail(middleware.ActionPost), postHandler.CreatePost)
+	posts.Patch("/:id", requireScope(domain.ScopePostsWrite), postHandler.UpdatePost)
+	posts.Delete("/:id", requireScope(domain.ScopePostsWrite), postHandler.DeletePost)
+
+	// Media uploads, which posts refer to by ID. Large files use resumable uploads.
+	media := api.Group("/media", requireScope(domain.ScopePostsWrite))
+	media.Post("/", verificationPolicy.RequireVerifiedEmail(middleware.ActionPost), mediaHandler.Upload)
+	media.Post("/uploads", verificationPolicy.RequireVerifiedEmail(middleware.ActionPost), mediaHandler.StartUpload)
+	media.Get("/uploads/:id", mediaHandler.GetUpload)
+	media.Patch("/uploads/:id", mediaHandler.UploadChunk)
+	media.Get("/:id", mediaHandler.Get)
 
 	// User routes
 	users := api.Group("/users")
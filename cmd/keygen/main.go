@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"fowergram/pkg/security"
+)
+
+// keygen writes a new JWT signing key to <dir>/<kid>.pem, or retires an existing
+// key by replacing its private key with the public half
+func main() {
+	dir := flag.String("dir", "keys", "directory holding JWT keys")
+	kid := flag.String("kid", "", "key ID written to the kid header")
+	alg := flag.String("alg", security.AlgorithmEdDSA, "signing algorithm (RS256 or EdDSA)")
+	retire := flag.Bool("retire", false, "retire the key instead of generating a new one")
+	flag.Parse()
+
+	if *kid == "" {
+		log.Fatal("-kid is required")
+	}
+
+	path := filepath.Join(*dir, *kid+".pem")
+
+	if *retire {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read key: %v", err)
+		}
+		key, err := security.ParseSigningKeyPEM(*kid, data)
+		if err != nil {
+			log.Fatalf("Failed to parse key: %v", err)
+		}
+		public, err := key.MarshalPublicKeyPEM()
+		if err != nil {
+			log.Fatalf("Failed to encode public key: %v", err)
+		}
+		if err := os.WriteFile(path, public, 0o644); err != nil {
+			log.Fatalf("Failed to write key: %v", err)
+		}
+		fmt.Printf("Retired %s, it now only verifies existing tokens\n", path)
+		return
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		log.Fatalf("Key %s already exists", path)
+	}
+
+	key, err := security.GenerateSigningKey(*kid, *alg)
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+	private, err := key.MarshalPrivateKeyPEM()
+	if err != nil {
+		log.Fatalf("Failed to encode private key: %v", err)
+	}
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		log.Fatalf("Failed to create key directory: %v", err)
+	}
+	if err := os.WriteFile(path, private, 0o600); err != nil {
+		log.Fatalf("Failed to write key: %v", err)
+	}
+	fmt.Printf("Wrote %s key %s\n", *alg, path)
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -11,32 +12,125 @@ import (
 )
 
 type Config struct {
-	Server ServerConfig
-	DB     *gorm.DB
-	Redis  *redis.Client
-	JWT    JWTConfig
-	Email  EmailConfig
-	Geo    GeoConfig
+	Server    ServerConfig
+	DB        *gorm.DB
+	Redis     *redis.Client
+	JWT       JWTConfig
+	Email     EmailConfig
+	Geo       GeoConfig
+	TwoFactor TwoFactorConfig
+	Account   AccountConfig
+	Password  PasswordConfig
+	WebAuthn  WebAuthnConfig
+	Social    SocialConfig
+	Export    ExportConfig
+	Media     MediaConfig
 }
 
 type ServerConfig struct {
 	Port string
+	// Header the load balancer puts the client address in, e.g. X-Real-IP. Empty when
+	// clients connect directly. Rate limits per IP depend on it behind a proxy.
+	ProxyHeader string
+	// Addresses or CIDR ranges of the proxies whose ProxyHeader is believed
+	TrustedProxies []string
 }
 
 type JWTConfig struct {
-	Secret string
+	Secret       string
+	KeysDir      string
+	SigningKeyID string
 }
 
 type EmailConfig struct {
-	APIKey      string
-	SenderEmail string
-	SenderName  string
+	APIKey       string
+	SenderEmail  string
+	SenderName   string
+	MagicLinkURL string
 }
 
 type GeoConfig struct {
 	APIKey string
 }
 
+type TwoFactorConfig struct {
+	EncryptionKey string
+	Issuer        string
+}
+
+type AccountConfig struct {
+	// Actions (post, comment, message) blocked until the email address is verified
+	UnverifiedRestrictions []string
+}
+
+type PasswordConfig struct {
+	MinLength      int
+	MinEntropyBits float64
+	// Sorted SHA-1 hash file; empty disables the breached-password check
+	BreachedCorpusPath string
+}
+
+type WebAuthnConfig struct {
+	// Relying party ID, the registrable domain passkeys are scoped to
+	RPID          string
+	RPDisplayName string
+	// Origins allowed to run ceremonies, e.g. https://fowergram.online
+	RPOrigins []string
+}
+
+// SocialConfig holds the identity provider credentials. A provider is offered only when
+// its client ID is set.
+type SocialConfig struct {
+	// Base URL the providers redirect back to, the provider name is appended
+	RedirectURL string
+
+	GoogleClientID     string
+	GoogleClientSecret string
+
+	AppleServicesID     string
+	AppleTeamID         string
+	AppleKeyID          string
+	ApplePrivateKeyPath string
+
+	LINEChannelID     string
+	LINEChannelSecret string
+
+	FacebookAppID     string
+	FacebookAppSecret string
+}
+
+// ExportConfig sets where personal data exports are kept and how they are downloaded
+type ExportConfig struct {
+	Dir string
+	// Public base URL of the download route, e.g. https://api.fowergram.online/api/v1/exports
+	DownloadURL string
+	// Secret for the download link signatures; links stop working when it changes
+	SigningKey string
+}
+
+// MediaConfig sets where uploaded media is stored and served from
+type MediaConfig struct {
+	// Storage is "local" or "s3"
+	Storage string
+	// Dir holds the files when Storage is local
+	Dir string
+	// Public base URL of the media route, e.g. https://api.fowergram.online/media
+	PublicURL string
+
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	// S3PathStyle is needed by MinIO and most other self-hosted services
+	S3PathStyle bool
+
+	// Workers is how many photos are processed at a time
+	Workers int
+	// WebPToolsDir holds cwebp and dwebp, they are looked up on the PATH when empty
+	WebPToolsDir string
+}
+
 type RedisConfig struct {
 	Host     string
 	Port     string
@@ -45,6 +139,21 @@ type RedisConfig struct {
 
 func Load() (*Config, error) {
 	viper.AutomaticEnv()
+	viper.SetDefault("TWO_FACTOR_ISSUER", "Fowergram")
+	viper.SetDefault("UNVERIFIED_ACCOUNT_RESTRICTIONS", "post,comment,message")
+	viper.SetDefault("MAGIC_LINK_URL", "https://fowergram.online/auth/magic")
+	viper.SetDefault("PASSWORD_MIN_LENGTH", 8)
+	viper.SetDefault("PASSWORD_MIN_ENTROPY_BITS", 28)
+	viper.SetDefault("WEBAUTHN_RP_ID", "fowergram.online")
+	viper.SetDefault("WEBAUTHN_RP_NAME", "Fowergram")
+	viper.SetDefault("WEBAUTHN_RP_ORIGINS", "https://fowergram.online")
+	viper.SetDefault("OAUTH_REDIRECT_URL", "https://fowergram.online/auth/callback")
+	viper.SetDefault("EXPORT_DIR", "data/exports")
+	viper.SetDefault("EXPORT_DOWNLOAD_URL", "https://api.fowergram.online/api/v1/exports")
+	viper.SetDefault("MEDIA_STORAGE", "local")
+	viper.SetDefault("MEDIA_DIR", "data/media")
+	viper.SetDefault("MEDIA_PUBLIC_URL", "https://api.fowergram.online/media")
+	viper.SetDefault("MEDIA_WORKERS", 2)
 
 	// Setup Database
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=5432 sslmode=disable",
@@ -81,20 +190,84 @@ func Load() (*Config, error) {
 
 	return &Config{
 		Server: ServerConfig{
-			Port: viper.GetString("PORT"),
+			Port:           viper.GetString("PORT"),
+			ProxyHeader:    viper.GetString("PROXY_HEADER"),
+			TrustedProxies: splitList(viper.GetString("TRUSTED_PROXIES")),
 		},
 		DB:    db,
 		Redis: rdb,
 		JWT: JWTConfig{
-			Secret: viper.GetString("JWT_SECRET"),
+			Secret:       viper.GetString("JWT_SECRET"),
+			KeysDir:      viper.GetString("JWT_KEYS_DIR"),
+			SigningKeyID: viper.GetString("JWT_SIGNING_KEY_ID"),
 		},
 		Email: EmailConfig{
-			APIKey:      viper.GetString("EMAIL_API_KEY"),
-			SenderEmail: viper.GetString("EMAIL_SENDER_EMAIL"),
-			SenderName:  viper.GetString("EMAIL_SENDER_NAME"),
+			APIKey:       viper.GetString("EMAIL_API_KEY"),
+			SenderEmail:  viper.GetString("EMAIL_SENDER_EMAIL"),
+			SenderName:   viper.GetString("EMAIL_SENDER_NAME"),
+			MagicLinkURL: viper.GetString("MAGIC_LINK_URL"),
 		},
 		Geo: GeoConfig{
 			APIKey: viper.GetString("GEO_API_KEY"),
 		},
+		TwoFactor: TwoFactorConfig{
+			EncryptionKey: viper.GetString("TWO_FACTOR_ENCRYPTION_KEY"),
+			Issuer:        viper.GetString("TWO_FACTOR_ISSUER"),
+		},
+		Account: AccountConfig{
+			UnverifiedRestrictions: splitList(viper.GetString("UNVERIFIED_ACCOUNT_RESTRICTIONS")),
+		},
+		Password: PasswordConfig{
+			MinLength:          viper.GetInt("PASSWORD_MIN_LENGTH"),
+			MinEntropyBits:     viper.GetFloat64("PASSWORD_MIN_ENTROPY_BITS"),
+			BreachedCorpusPath: viper.GetString("PASSWORD_BREACHED_CORPUS"),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:          viper.GetString("WEBAUTHN_RP_ID"),
+			RPDisplayName: viper.GetString("WEBAUTHN_RP_NAME"),
+			RPOrigins:     splitList(viper.GetString("WEBAUTHN_RP_ORIGINS")),
+		},
+		Social: SocialConfig{
+			RedirectURL:         viper.GetString("OAUTH_REDIRECT_URL"),
+			GoogleClientID:      viper.GetString("GOOGLE_CLIENT_ID"),
+			GoogleClientSecret:  viper.GetString("GOOGLE_CLIENT_SECRET"),
+			AppleServicesID:     viper.GetString("APPLE_SERVICES_ID"),
+			AppleTeamID:         viper.GetString("APPLE_TEAM_ID"),
+			AppleKeyID:          viper.GetString("APPLE_KEY_ID"),
+			ApplePrivateKeyPath: viper.GetString("APPLE_PRIVATE_KEY_PATH"),
+			LINEChannelID:       viper.GetString("LINE_CHANNEL_ID"),
+			LINEChannelSecret:   viper.GetString("LINE_CHANNEL_SECRET"),
+			FacebookAppID:       viper.GetString("FACEBOOK_APP_ID"),
+			FacebookAppSecret:   viper.GetString("FACEBOOK_APP_SECRET"),
+		},
+		Export: ExportConfig{
+			Dir:         viper.GetString("EXPORT_DIR"),
+			DownloadURL: viper.GetString("EXPORT_DOWNLOAD_URL"),
+			SigningKey:  viper.GetString("EXPORT_SIGNING_KEY"),
+		},
+		Media: MediaConfig{
+			Storage:           viper.GetString("MEDIA_STORAGE"),
+			Dir:               viper.GetString("MEDIA_DIR"),
+			PublicURL:         viper.GetString("MEDIA_PUBLIC_URL"),
+			S3Endpoint:        viper.GetString("S3_ENDPOINT"),
+			S3Region:          viper.GetString("S3_REGION"),
+			S3Bucket:          viper.GetString("S3_BUCKET"),
+			S3AccessKeyID:     viper.GetString("S3_ACCESS_KEY_ID"),
+			S3SecretAccessKey: viper.GetString("S3_SECRET_ACCESS_KEY"),
+			S3PathStyle:       viper.GetBool("S3_PATH_STYLE"),
+			Workers:           viper.GetInt("MEDIA_WORKERS"),
+			WebPToolsDir:      viper.GetString("WEBP_TOOLS_DIR"),
+		},
 	}, nil
 }
+
+// splitList parses a comma separated environment value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognise, e.g. by
+// secret scanners
+const APIKeyPrefix = "fgk_"
+
+// ScopeAdmin lets an API key use the admin API with the permissions of its owner's role
+const ScopeAdmin = "admin"
+
+// APIKeyScopes describes each scope an API key can be given. Keys can do what
+// third-party apps can, and may also be let into the admin API.
+var APIKeyScopes = map[string]string{
+	ScopeProfileRead: OAuthScopes[ScopeProfileRead],
+	ScopePostsRead:   OAuthScopes[ScopePostsRead],
+	ScopePostsWrite:  OAuthScopes[ScopePostsWrite],
+	ScopeAdmin:       "Use the admin API with the permissions of your role",
+}
+
+// APIKey is a long-lived credential for automation such as bots and CI jobs. The key
+// is "fgk_<id>_<secret>"; Prefix keeps the "fgk_<id>" part to find the key and to tell
+// keys apart in lists, the secret is stored as a hash.
+type APIKey struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	UserID     uint   `json:"-"`
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix" gorm:"unique;not null"`
+	SecretHash string `json:"-"`
+	// Space separated, like OAuth scopes
+	Scopes     string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.ScopeList() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key can still be used
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
+
+// IsAPIKey tells an API key apart from a JWT in the Authorization header
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// APIKeyCredentials is returned once when a key is created. The key cannot be
+// retrieved again.
+type APIKeyCredentials struct {
+	APIKey *APIKey `json:"api_key"`
+	Key    string  `json:"key"`
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Security events recorded in the audit log
+const (
+	AuditEventLoginSucceeded         = "login.succeeded"
+	AuditEventLoginFailed            = "login.failed"
+	AuditEventLoginChallenged        = "login.challenged"
+	AuditEventLoginBlocked           = "login.blocked"
+	AuditEventAccountLocked          = "account.locked"
+	AuditEventDeletionRequested      = "account.deletion_requested"
+	AuditEventDeletionCancelled      = "account.deletion_cancelled"
+	AuditEventAccountDeleted         = "account.deleted"
+	AuditEventPasswordChanged        = "password.changed"
+	AuditEventPasswordReset          = "password.reset"
+	AuditEventSessionRevoked         = "session.revoked"
+	AuditEventSessionsRevoked        = "sessions.revoked"
+	AuditEventDeviceUpdated          = "device.updated"
+	AuditEventTwoFactorEnabled       = "two_factor.enabled"
+	AuditEventTwoFactorDisabled      = "two_factor.disabled"
+	AuditEventBackupCodesRegenerated = "two_factor.backup_codes_regenerated"
+	AuditEventAPIKeyCreated          = "api_key.created"
+	AuditEventAPIKeyRevoked          = "api_key.revoked"
+	AuditEventDataExportRequested    = "data_export.requested"
+	AuditEventDataExportDownloaded   = "data_export.downloaded"
+
+	// Admin actions are recorded as "admin." followed by the admin action name
+	AuditEventAdminPrefix = "admin."
+)
+
+// AuditEntry is one event in the append-only audit log. Each entry includes the hash of
+// the entry before it, so changing or removing an entry breaks the chain after it.
+type AuditEntry struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Event        string    `json:"event"`
+	ActorID      *uint     `json:"actor_id,omitempty"`
+	TargetUserID *uint     `json:"target_user_id,omitempty"`
+	IPAddress    string    `json:"ip_address,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Details      string    `json:"details,omitempty"`
+	PrevHash     string    `json:"prev_hash"`
+	Hash         string    `json:"hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// Link chains the entry to the previous one. prev is nil for the first entry.
+func (e *AuditEntry) Link(prev *AuditEntry) {
+	e.PrevHash = ""
+	if prev != nil {
+		e.PrevHash = prev.Hash
+	}
+	e.Hash = e.ComputeHash()
+}
+
+// ComputeHash hashes every recorded field together with the previous hash
+func (e *AuditEntry) ComputeHash() string {
+	payload, _ := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.Event,
+		e.ActorID,
+		e.TargetUserID,
+		e.IPAddress,
+		e.UserAgent,
+		e.RequestID,
+		e.Details,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter narrows an admin search of the audit log. Zero values match everything.
+type AuditFilter struct {
+	Event        string
+	ActorID      *uint
+	TargetUserID *uint
+	IPAddress    string
+	RequestID    string
+	From         *time.Time
+	To           *time.Time
+	Page         int
+	Limit        int
+}
+
+// AuditVerification is the result of checking the hash chain
+type AuditVerification struct {
+	Valid    bool  `json:"valid"`
+	Checked  int   `json:"checked"`
+	BrokenAt *uint `json:"broken_at,omitempty"`
+}
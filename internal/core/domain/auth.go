@@ -9,12 +9,25 @@ type DeviceSession struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
 	UserID     uint      `json:"user_id"`
 	DeviceID   string    `json:"device_id"`
+	DeviceName string    `json:"device_name"`
 	DeviceType string    `json:"device_type"`
 	IPAddress  string    `json:"ip_address"`
 	UserAgent  string    `json:"user_agent"`
 	Location   string    `json:"location"`
 	LastActive time.Time `json:"last_active"`
-	mu         sync.RWMutex
+	// Trusted devices skip the emailed code of an unusual login
+	Trusted bool `json:"trusted"`
+	// Active is false once the session was logged out or replaced by a newer login
+	// from the same device
+	Active bool `json:"-" gorm:"column:is_current;default:true"`
+	// Current marks the session of the request that listed the sessions
+	Current   bool      `json:"current" gorm:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	// RequestID of the login request, for the audit log
+	RequestID string `json:"-" gorm:"-"`
+	// Geo is looked up once per login and reused for the risk check and the history
+	Geo *GeoLocation `json:"-" gorm:"-"`
+	mu  sync.RWMutex
 }
 
 func (d *DeviceSession) GetLocation() string {
@@ -29,15 +42,26 @@ func (d *DeviceSession) SetLocation(location string) {
 	d.Location = location
 }
 
+// Login history statuses
+const (
+	LoginStatusSuccess    = "success"
+	LoginStatusFailed     = "failed"
+	LoginStatusChallenged = "challenged"
+	LoginStatusBlocked    = "blocked"
+)
+
 type LoginHistory struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	UserID    uint      `json:"user_id"`
-	DeviceID  string    `json:"device_id"`
-	IPAddress string    `json:"ip_address"`
-	Location  string    `json:"location"`
-	UserAgent string    `json:"user_agent"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id"`
+	DeviceID    string    `json:"device_id"`
+	IPAddress   string    `json:"ip_address"`
+	Location    string    `json:"location"`
+	CountryCode string    `json:"country_code"`
+	Latitude    *float64  `json:"-"`
+	Longitude   *float64  `json:"-"`
+	UserAgent   string    `json:"user_agent"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type AuthCode struct {
@@ -50,11 +74,91 @@ type AuthCode struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Account recovery moves from pending to verified once the code is checked, then to
+// completed when the password is reset. Requests that run out of time become expired and
+// requests replaced by a newer one become cancelled.
+const (
+	RecoveryStatusPending   = "pending"
+	RecoveryStatusVerified  = "verified"
+	RecoveryStatusCompleted = "completed"
+	RecoveryStatusExpired   = "expired"
+	RecoveryStatusCancelled = "cancelled"
+)
+
 type AccountRecovery struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	UserID      uint      `json:"user_id"`
-	RequestType string    `json:"request_type"`
-	Status      string    `json:"status"`
-	ExpiresAt   time.Time `json:"expires_at"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id"`
+	RequestType string     `json:"request_type"`
+	Status      string     `json:"status"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	VerifiedAt  *time.Time `json:"verified_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"column:initiated_at"`
+}
+
+func (AccountRecovery) TableName() string {
+	return "account_recovery"
+}
+
+type RefreshToken struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"user_id"`
+	DeviceSessionID uint       `json:"device_session_id"`
+	FamilyID        string     `json:"family_id"`
+	TokenID         string     `json:"-" gorm:"unique"`
+	RotatedAt       *time.Time `json:"rotated_at"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type BackupCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"otpauth_url"`
+}
+
+type LoginChallenge struct {
+	Type      string `json:"status"`
+	Token     string `json:"challenge_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// LoginResult carries either issued tokens or a challenge that must be completed first
+type LoginResult struct {
+	User      *User
+	Tokens    *TokenPair
+	Challenge *LoginChallenge
+}
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SocialLoginStart is returned when a provider sign-in begins. The client sends the user
+// to AuthorizationURL and returns the state and code from the callback.
+type SocialLoginStart struct {
+	Provider         string `json:"provider"`
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
 }
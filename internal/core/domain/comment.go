@@ -2,12 +2,13 @@ package domain
 
 import "time"
 
+// Comment is shown with its author's public profile, never the full account
 type Comment struct {
-	ID        uint      `json:"id"`
-	PostID    uint      `json:"post_id"`
-	UserID    uint      `json:"user_id"`
-	User      User      `json:"user"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uint          `json:"id"`
+	PostID    uint          `json:"post_id"`
+	UserID    uint          `json:"user_id"`
+	User      PublicProfile `json:"user" gorm:"foreignKey:UserID"`
+	Content   string        `json:"content"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
 }
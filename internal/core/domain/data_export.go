@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+const (
+	DataExportPending    = "pending"
+	DataExportProcessing = "processing"
+	DataExportReady      = "ready"
+	DataExportFailed     = "failed"
+)
+
+// DataExport is a user's request for a copy of their personal data. The archive is
+// built in the background and can be downloaded until ExpiresAt.
+type DataExport struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID uint   `json:"-"`
+	Status string `json:"status" gorm:"default:pending;not null"`
+	// FileName of the archive in the export directory, set once it is ready
+	FileName    string     `json:"-"`
+	SizeBytes   int64      `json:"size_bytes,omitempty"`
+	Error       string     `json:"-"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"-"`
+}
+
+func (DataExport) TableName() string {
+	return "data_exports"
+}
+
+// PersonalData is everything an export archive holds about a user
+type PersonalData struct {
+	User         *User
+	Posts        []*Post
+	Media        []*Media
+	Comments     []*Comment
+	LoginHistory []*LoginHistory
+	Devices      []*DeviceSession
+	Identities   []*UserIdentity
+	Passkeys     []*WebAuthnCredential
+	APIKeys      []*APIKey
+}
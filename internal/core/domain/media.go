@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MaxImageSize = 20 << 20
+	MaxVideoSize = 200 << 20
+	// MediaChunkSize is the size of every chunk of a resumable upload but the last
+	MediaChunkSize = 5 << 20
+)
+
+const (
+	MediaPending    = "pending"
+	MediaProcessing = "processing"
+	MediaReady      = "ready"
+	MediaFailed     = "failed"
+)
+
+// MediaRenditionWidths are the widths photos are resized to. Photos narrower than the
+// largest also get a rendition at their own width.
+var MediaRenditionWidths = []int{150, 320, 640, 1080}
+
+// MediaTypes are the content types that can be uploaded, with their size limit. The
+// type is sniffed from the content, what the client claims is ignored.
+var MediaTypes = map[string]int64{
+	"image/jpeg": MaxImageSize,
+	"image/png":  MaxImageSize,
+	"image/gif":  MaxImageSize,
+	"image/webp": MaxImageSize,
+	"video/mp4":  MaxVideoSize,
+}
+
+// MediaBlob is a stored file. Blobs are content addressed: the key is derived from
+// the SHA-256 of the content, so identical uploads share one blob.
+type MediaBlob struct {
+	Hash        string `gorm:"primaryKey"`
+	ContentType string
+	SizeBytes   int64
+	// LastUsedAt is touched whenever an upload reuses the blob, unused blobs are
+	// only removed some time after that
+	LastUsedAt time.Time
+	CreatedAt  time.Time
+}
+
+func (MediaBlob) TableName() string {
+	return "media_blobs"
+}
+
+// Key is where the blob is kept in the blob store
+func (b *MediaBlob) Key() string {
+	return MediaBlobKey(b.Hash)
+}
+
+// MediaBlobKey spreads blobs over directories by the first byte of the hash
+func MediaBlobKey(hash string) string {
+	return "media/" + hash[:2] + "/" + hash
+}
+
+// Media is a file uploaded by a user, which posts refer to. Photos are processed in
+// the background, they are pending until their renditions exist.
+type Media struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	UserID      uint   `json:"-"`
+	Hash        string `json:"-"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Status      string `json:"status" gorm:"default:ready;not null"`
+	// Width and Height of the upright photo
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Blurhash and DominantColor are shown while the photo loads
+	Blurhash      string           `json:"blurhash,omitempty"`
+	DominantColor string           `json:"dominant_color,omitempty"`
+	Renditions    []MediaRendition `json:"renditions,omitempty" gorm:"foreignKey:MediaID"`
+	Error         string           `json:"-"`
+	// URL is where the file is served as uploaded, it is not stored
+	URL       string    `json:"url" gorm:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+func (Media) TableName() string {
+	return "media"
+}
+
+// IsPhoto reports whether the media gets renditions. GIFs are kept as uploaded, a
+// rendition would lose the animation.
+func (m *Media) IsPhoto() bool {
+	return strings.HasPrefix(m.ContentType, "image/") && m.ContentType != "image/gif"
+}
+
+// MediaRendition is a photo resized to one width, in one format
+type MediaRendition struct {
+	ID        uint   `json:"-" gorm:"primaryKey"`
+	MediaID   uint   `json:"-"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Format    string `json:"format"`
+	Hash      string `json:"-"`
+	SizeBytes int64  `json:"size_bytes"`
+	// URL is where the rendition is served, it is not stored
+	URL       string    `json:"url" gorm:"-"`
+	CreatedAt time.Time `json:"-"`
+}
+
+func (MediaRendition) TableName() string {
+	return "media_renditions"
+}
+
+// MediaUpload is a resumable upload. The client sends the file in chunks of
+// MediaChunkSize, the media is created once all bytes arrived.
+type MediaUpload struct {
+	ID            string    `json:"id" gorm:"primaryKey"`
+	UserID        uint      `json:"-"`
+	SizeBytes     int64     `json:"size_bytes"`
+	ReceivedBytes int64     `json:"offset"`
+	MediaID       *uint     `json:"media_id,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"-"`
+}
+
+func (MediaUpload) TableName() string {
+	return "media_uploads"
+}
+
+// Complete reports whether every byte of the file was received
+func (u *MediaUpload) Complete() bool {
+	return u.ReceivedBytes == u.SizeBytes
+}
+
+// ChunkKey is where a received chunk waits in the blob store until the upload is
+// complete
+func (u *MediaUpload) ChunkKey(index int64) string {
+	return "uploads/" + u.ID + "/" + strconv.FormatInt(index, 10)
+}
@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// Scopes third-party apps can request
+const (
+	ScopeProfileRead = "profile:read"
+	ScopePostsRead   = "posts:read"
+	ScopePostsWrite  = "posts:write"
+)
+
+// OAuthScopes describes each scope for the consent screen
+var OAuthScopes = map[string]string{
+	ScopeProfileRead: "See your username and profile",
+	ScopePostsRead:   "See your posts",
+	ScopePostsWrite:  "Create, edit and delete posts for you",
+}
+
+// OAuthClient is a third-party app registered by a Fowergram user. Public clients (mobile
+// and single page apps) have no secret and rely on PKCE alone.
+type OAuthClient struct {
+	ID         uint   `json:"-" gorm:"primaryKey"`
+	ClientID   string `json:"client_id" gorm:"unique;not null"`
+	SecretHash string `json:"-"`
+	OwnerID    uint   `json:"owner_id"`
+	Name       string `json:"name"`
+	// Space separated, like the scope parameter
+	RedirectURIs string    `json:"-"`
+	Scopes       string    `json:"-"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+func (c *OAuthClient) ScopeList() []string {
+	return strings.Fields(c.Scopes)
+}
+
+// OAuthToken is a grant issued to a client. The access token is a JWT carrying TokenID,
+// the refresh token is stored as a hash. Refreshing replaces the row.
+type OAuthToken struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	TokenID  string `json:"-" gorm:"unique;not null"`
+	ClientID string `json:"client_id"`
+	UserID   uint   `json:"user_id"`
+	// FamilyID is shared by every token refreshed from the same authorization
+	FamilyID         string     `json:"-"`
+	Scope            string     `json:"scope"`
+	RefreshTokenHash string     `json:"-" gorm:"unique"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RefreshExpiresAt time.Time  `json:"refresh_expires_at"`
+	RotatedAt        *time.Time `json:"-"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+func (OAuthToken) TableName() string {
+	return "oauth_tokens"
+}
+
+func (t *OAuthToken) HasScope(scope string) bool {
+	for _, granted := range strings.Fields(t.Scope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthAuthorization is what an authorization code stands for until it is exchanged
+type OAuthAuthorization struct {
+	ClientID      string `json:"client_id"`
+	UserID        uint   `json:"user_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	CodeChallenge string `json:"code_challenge"`
+}
+
+// OAuthClientCredentials is returned once when a client is registered. The secret
+// cannot be retrieved again.
+type OAuthClientCredentials struct {
+	Client       *OAuthClient `json:"client"`
+	ClientSecret string       `json:"client_secret,omitempty"`
+}
+
+type OAuthScopeDescription struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// OAuthConsentScreen is everything the frontend needs to ask the user for consent
+type OAuthConsentScreen struct {
+	ClientID    string                  `json:"client_id"`
+	ClientName  string                  `json:"client_name"`
+	Scopes      []OAuthScopeDescription `json:"scopes"`
+	RedirectURI string                  `json:"redirect_uri"`
+	State       string                  `json:"state,omitempty"`
+}
+
+// OAuthTokenResponse follows RFC 6749 section 5.1
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospection follows RFC 7662. Only Active is set for tokens that are not active.
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
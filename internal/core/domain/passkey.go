@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// WebAuthnCredential is a passkey registered by a user
+type WebAuthnCredential struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"user_id"`
+	CredentialID    []byte     `json:"-" gorm:"unique;not null"`
+	PublicKey       []byte     `json:"-" gorm:"not null"`
+	AttestationType string     `json:"-"`
+	Transports      string     `json:"transports"`
+	AAGUID          []byte     `json:"-" gorm:"column:aaguid"`
+	SignCount       uint32     `json:"-"`
+	CloneWarning    bool       `json:"clone_warning"`
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backup_state"`
+	Name            string     `json:"name"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// PasskeyCeremony is handed to the browser to start a registration or login. The
+// ceremony ID must be sent back with the authenticator response.
+type PasskeyCeremony struct {
+	ID      string      `json:"ceremony_id"`
+	Options interface{} `json:"options"`
+}
@@ -2,13 +2,54 @@ package domain
 
 import "time"
 
+// MaxPostItems is how many photos and videos a carousel post can have
+const MaxPostItems = 10
+
 type Post struct {
-	ID        uint      `json:"id"`
-	UserID    uint      `json:"user_id"`
-	User      User      `json:"user"`
-	Caption   string    `json:"caption"`
-	ImageURL  string    `json:"image_url"`
-	Likes     int       `json:"likes"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID     uint `json:"id"`
+	UserID uint `json:"user_id"`
+	// User is the author, loaded with the post
+	User    PublicProfile `json:"user" gorm:"foreignKey:UserID"`
+	Caption string        `json:"caption"`
+	// Items are the photos and videos of the post, by position
+	Items     []PostItem `json:"items" gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	Likes     int        `json:"likes"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// PostItem is one photo or video of a post
+type PostItem struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	PostID   uint   `json:"-"`
+	Position int    `json:"position"`
+	MediaID  *uint  `json:"media_id,omitempty"`
+	Media    *Media `json:"media,omitempty" gorm:"foreignKey:MediaID"`
+	// ImageURL is only set on items of posts made before uploads existed
+	ImageURL string `json:"image_url,omitempty"`
+	AltText  string `json:"alt_text,omitempty"`
+	// AspectRatio is width divided by height, the shape the item is shown in. It is
+	// the shape of the media unless the author picked a crop.
+	AspectRatio float64       `json:"aspect_ratio,omitempty"`
+	Tags        []PostItemTag `json:"tags" gorm:"foreignKey:PostItemID;constraint:OnDelete:CASCADE"`
+	CreatedAt   time.Time     `json:"-"`
+	UpdatedAt   time.Time     `json:"-"`
+}
+
+func (PostItem) TableName() string {
+	return "post_items"
+}
+
+// PostItemTag places a user on an item. X and Y go from 0 to 1, from the top left.
+type PostItemTag struct {
+	ID         uint          `json:"-" gorm:"primaryKey"`
+	PostItemID uint          `json:"-"`
+	UserID     uint          `json:"user_id"`
+	User       PublicProfile `json:"user" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	X          float64       `json:"x"`
+	Y          float64       `json:"y"`
+}
+
+func (PostItemTag) TableName() string {
+	return "post_item_tags"
 }
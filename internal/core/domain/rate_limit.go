@@ -0,0 +1,58 @@
+package domain
+
+import "time"
+
+// RateLimitPolicy allows Limit requests per identity in any sliding Window. The name
+// keeps the counters of different policies apart.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitResult is the state of one identity's window after a request was counted
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the oldest counted request leaves the window
+	Reset time.Duration
+}
+
+// LockoutPolicy locks an identity out once Threshold failures have been counted with
+// no more than Window between them. Every further failure doubles the lockout, starting
+// at BaseLockout and capped at MaxLockout.
+type LockoutPolicy struct {
+	Name        string
+	Threshold   int64
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+// LockoutFor returns how long the identity is locked out after the given number of
+// consecutive failures
+func (p LockoutPolicy) LockoutFor(failures int64) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	lockout := p.BaseLockout
+	for i := p.Threshold; i < failures; i++ {
+		lockout *= 2
+		if lockout >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	return lockout
+}
+
+// LockoutStatus is the failure count of an identity and how long it is still locked out
+type LockoutStatus struct {
+	Failures  int64
+	LockedFor time.Duration
+}
+
+func (s *LockoutStatus) Locked() bool {
+	return s.LockedFor > 0
+}
@@ -1,5 +1,10 @@
 package domain
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type RegisterRequest struct {
 	Username string `json:"username" validate:"required,min=3,max=32"`
 	Email    string `json:"email" validate:"required,email"`
@@ -11,15 +16,194 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type MagicLinkRequest struct {
+	Email      string `json:"email" validate:"required,email"`
+	BindDevice bool   `json:"bind_device"`
+}
+
+type ConsumeMagicLinkRequest struct {
+	Token         string `json:"token" validate:"required"`
+	DeviceBinding string `json:"device_binding"`
+}
+
+type PasskeyRegistrationRequest struct {
+	CeremonyID string          `json:"ceremony_id" validate:"required"`
+	Name       string          `json:"name" validate:"max=64"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+type PasskeyLoginRequest struct {
+	CeremonyID string          `json:"ceremony_id" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type VerifyResetCodeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Email       string `json:"email" validate:"required,email"`
+	Code        string `json:"code" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+// UpdateUserRequest changes profile settings. Passwords are changed with
+// ChangePasswordRequest so they always pass the password policy.
 type UpdateUserRequest struct {
 	Username            string `json:"username" validate:"omitempty,min=3,max=32"`
 	Email               string `json:"email" validate:"omitempty,email"`
-	CurrentPassword     string `json:"current_password" validate:"required_with=NewPassword"`
-	NewPassword         string `json:"new_password" validate:"omitempty,min=8"`
 	NotificationEnabled *bool  `json:"notification_enabled"`
 }
 
+// CreatePostRequest publishes media the author uploaded before, in the order given
 type CreatePostRequest struct {
-	Caption  string `json:"caption" validate:"required"`
-	ImageURL string `json:"image_url" validate:"required,url"`
+	Caption string            `json:"caption" validate:"required,max=2200"`
+	Items   []PostItemRequest `json:"items" validate:"required,min=1,max=10,unique=MediaID,dive"`
+}
+
+type PostItemRequest struct {
+	MediaID uint   `json:"media_id" validate:"required"`
+	AltText string `json:"alt_text" validate:"max=1000"`
+	// AspectRatio crops the item, from 4:5 portrait to 1.91:1 landscape
+	AspectRatio float64              `json:"aspect_ratio" validate:"omitempty,min=0.8,max=1.91"`
+	Tags        []PostItemTagRequest `json:"tags" validate:"max=20,unique=UserID,dive"`
+}
+
+type PostItemTagRequest struct {
+	UserID uint    `json:"user_id" validate:"required"`
+	X      float64 `json:"x" validate:"min=0,max=1"`
+	Y      float64 `json:"y" validate:"min=0,max=1"`
+}
+
+// MediaUploadRequest starts a resumable upload of a file of the given size
+type MediaUploadRequest struct {
+	SizeBytes int64 `json:"size_bytes" validate:"required,min=1"`
+}
+
+// UpdatePostRequest changes the caption. Items, when given, replace the items of the
+// post: they can be reordered, removed and added, and their alt text and tags changed.
+type UpdatePostRequest struct {
+	Caption *string           `json:"caption" validate:"omitempty,max=2200"`
+	Items   []PostItemRequest `json:"items" validate:"omitempty,min=1,max=10,unique=MediaID,dive"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+// LoginVerificationRequest confirms an unusual login with the code sent by email
+type LoginVerificationRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required,len=6"`
+}
+
+// SocialCallbackRequest carries the code and state the provider redirected back with
+type SocialCallbackRequest struct {
+	State string `json:"state" form:"state" validate:"required"`
+	Code  string `json:"code" form:"code" validate:"required"`
+}
+
+type OAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=64"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1,max=10,dive,url"`
+	Scopes       []string `json:"scopes" validate:"required,min=1"`
+	// Public clients cannot keep a secret, e.g. mobile apps
+	Public bool `json:"public"`
+}
+
+// OAuthAuthorizeRequest holds the authorization request parameters of RFC 6749 and PKCE
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `json:"response_type" query:"response_type"`
+	ClientID            string `json:"client_id" query:"client_id"`
+	RedirectURI         string `json:"redirect_uri" query:"redirect_uri"`
+	Scope               string `json:"scope" query:"scope"`
+	State               string `json:"state" query:"state"`
+	CodeChallenge       string `json:"code_challenge" query:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" query:"code_challenge_method"`
+}
+
+// OAuthConsentRequest repeats the authorization request with the user's decision
+type OAuthConsentRequest struct {
+	OAuthAuthorizeRequest
+	Approve bool `json:"approve"`
+}
+
+// OAuthTokenRequest is the token endpoint body, normally form encoded
+type OAuthTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	Code         string `json:"code" form:"code"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	Scope        string `json:"scope" form:"scope"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+// OAuthTokenActionRequest is the body of the introspection and revocation endpoints
+type OAuthTokenActionRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	ClientID      string `json:"client_id" form:"client_id"`
+	ClientSecret  string `json:"client_secret" form:"client_secret"`
+}
+
+// AdminLockRequest locks an account until the given time
+type AdminLockRequest struct {
+	Until  time.Time `json:"until" validate:"required"`
+	Reason string    `json:"reason" validate:"required,max=255"`
+}
+
+type AdminRoleRequest struct {
+	Role Role `json:"role" validate:"required,oneof=user moderator support admin"`
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name" validate:"required,max=64"`
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+	// Keys always expire, after a year at the latest
+	ExpiresInDays int `json:"expires_in_days" validate:"required,min=1,max=365"`
+}
+
+// DeviceUpdateRequest renames or (un)trusts a device, fields left out are unchanged
+type DeviceUpdateRequest struct {
+	Name    *string `json:"name" validate:"omitempty,max=64"`
+	Trusted *bool   `json:"trusted"`
+}
+
+// AccountDeletionRequest confirms the deletion with the password or, for accounts that
+// never chose one such as those created by social login, a code emailed for the purpose.
+// A two-factor or backup code is needed as well when two-factor authentication is on.
+type AccountDeletionRequest struct {
+	Password  string `json:"password" validate:"required_without=EmailCode"`
+	EmailCode string `json:"email_code"`
+	Code      string `json:"code"`
 }
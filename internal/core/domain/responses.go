@@ -11,6 +11,16 @@ type UserDTO struct {
 	Email    string `json:"email"`
 }
 
+// PublicProfile is the part of a user anyone can see, e.g. as the author of a post
+type PublicProfile struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+func (PublicProfile) TableName() string {
+	return "users"
+}
+
 type ErrorResponse struct {
 	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+)
+
+// GeoLocation is where an IP address is, as far as the geolocation service knows.
+// Coordinates are nil when the service could not place the address.
+type GeoLocation struct {
+	City        string
+	Country     string
+	CountryCode string
+	Latitude    *float64
+	Longitude   *float64
+}
+
+func (l *GeoLocation) String() string {
+	return fmt.Sprintf("%s, %s", l.City, l.Country)
+}
+
+const earthRadiusKm = 6371.0
+
+// DistanceKm is the great-circle distance between two coordinates
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+type RiskLevel string
+
+const (
+	RiskLow    RiskLevel = "low"
+	RiskMedium RiskLevel = "medium"
+	RiskHigh   RiskLevel = "high"
+)
+
+// Signals that raise the risk of a login
+const (
+	RiskSignalNewDevice         = "new_device"
+	RiskSignalNewCountry        = "new_country"
+	RiskSignalImpossibleTravel  = "impossible_travel"
+	RiskSignalFailureBurst      = "failure_burst"
+	RiskSignalNoSuccessfulLogin = "no_successful_login"
+)
+
+// LoginRisk is the assessment of a login whose credentials were correct
+type LoginRisk struct {
+	Score   int
+	Level   RiskLevel
+	Signals []string
+}
+
+func (r *LoginRisk) Add(signal string, points int) {
+	r.Score += points
+	r.Signals = append(r.Signals, signal)
+}
@@ -0,0 +1,149 @@
+package domain
+
+import "time"
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleSupport   Role = "support"
+	RoleAdmin     Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermissionUsersRead          Permission = "users:read"
+	PermissionUsersLock          Permission = "users:lock"
+	PermissionUsersResetPassword Permission = "users:reset_password"
+	PermissionLoginHistoryRead   Permission = "login_history:read"
+	PermissionPostsModerate      Permission = "posts:moderate"
+	PermissionRolesManage        Permission = "roles:manage"
+	PermissionAdminActionsRead   Permission = "admin_actions:read"
+	PermissionAuditRead          Permission = "audit:read"
+)
+
+// rolePermissions lists what each staff role may do. Regular users have no staff
+// permissions, admins have all of them.
+var rolePermissions = map[Role][]Permission{
+	RoleModerator: {
+		PermissionUsersRead,
+		PermissionUsersLock,
+		PermissionPostsModerate,
+	},
+	RoleSupport: {
+		PermissionUsersRead,
+		PermissionUsersResetPassword,
+		PermissionLoginHistoryRead,
+	},
+	RoleAdmin: {
+		PermissionUsersRead,
+		PermissionUsersLock,
+		PermissionUsersResetPassword,
+		PermissionLoginHistoryRead,
+		PermissionPostsModerate,
+		PermissionRolesManage,
+		PermissionAdminActionsRead,
+		PermissionAuditRead,
+	},
+}
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleModerator, RoleSupport, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (r Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the role's permissions, for clients that hide what staff cannot use
+func (r Role) Permissions() []Permission {
+	return append([]Permission{}, rolePermissions[r]...)
+}
+
+// Admin actions recorded in the admin action log
+const (
+	AdminActionSearchUsers        = "users.search"
+	AdminActionViewUser           = "users.view"
+	AdminActionLockUser           = "users.lock"
+	AdminActionUnlockUser         = "users.unlock"
+	AdminActionForcePasswordReset = "users.force_password_reset"
+	AdminActionViewLoginHistory   = "login_history.view"
+	AdminActionChangeRole         = "users.change_role"
+	AdminActionEditPost           = "posts.edit"
+	AdminActionDeletePost         = "posts.delete"
+)
+
+// Actor is whoever makes a request that changes an account: the user themselves or a
+// staff member. UserID is zero for requests that are not signed in.
+type Actor struct {
+	UserID    uint
+	Role      Role
+	IPAddress string
+	UserAgent string
+	RequestID string
+}
+
+// AdminAction records something a staff member did through the admin API
+type AdminAction struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ActorID      uint      `json:"actor_id"`
+	Action       string    `json:"action"`
+	TargetUserID *uint     `json:"target_user_id,omitempty"`
+	Details      string    `json:"details,omitempty"`
+	IPAddress    string    `json:"ip_address"`
+	UserAgent    string    `json:"user_agent"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AdminUserView is a user as shown to staff, including the security state that is
+// hidden from the public user JSON
+type AdminUserView struct {
+	ID                    uint       `json:"id"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	Role                  Role       `json:"role"`
+	IsEmailVerified       bool       `json:"is_email_verified"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled"`
+	FailedLoginAttempts   int64      `json:"failed_login_attempts"`
+	LockedOutUntil        *time.Time `json:"locked_out_until,omitempty"`
+	AccountLockedUntil    *time.Time `json:"account_locked_until"`
+	LockReason            string     `json:"lock_reason,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// NewAdminUserView builds the view. lockout is the automatic lockout state and may be
+// nil when it could not be loaded.
+func NewAdminUserView(user *User, lockout *LockoutStatus) *AdminUserView {
+	view := &AdminUserView{
+		ID:                    user.ID,
+		Username:              user.Username,
+		Email:                 user.Email,
+		Role:                  user.Role,
+		IsEmailVerified:       user.IsEmailVerified,
+		TwoFactorEnabled:      user.TwoFactorEnabled,
+		AccountLockedUntil:    user.AccountLockedUntil,
+		LockReason:            user.LockReason,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+	}
+	if lockout != nil {
+		view.FailedLoginAttempts = lockout.Failures
+		if lockout.Locked() {
+			until := time.Now().Add(lockout.LockedFor)
+			view.LockedOutUntil = &until
+		}
+	}
+	return view
+}
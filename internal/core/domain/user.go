@@ -3,15 +3,22 @@ package domain
 import "time"
 
 type User struct {
-	ID                  uint       `json:"id" gorm:"primaryKey"`
-	Username            string     `json:"username" gorm:"unique;not null"`
-	Email               string     `json:"email" gorm:"unique;not null"`
-	PasswordHash        string     `json:"-" gorm:"not null"`
-	IsEmailVerified     bool       `json:"is_email_verified" gorm:"default:false"`
-	RecoveryEmail       string     `json:"recovery_email,omitempty"`
-	FailedLoginAttempts int        `json:"-" gorm:"default:0"`
-	LastFailedLogin     *time.Time `json:"-"`
-	AccountLockedUntil  *time.Time `json:"-"`
+	ID                    uint       `json:"id" gorm:"primaryKey"`
+	Username              string     `json:"username" gorm:"unique;not null"`
+	Email                 string     `json:"email" gorm:"unique;not null"`
+	PasswordHash          string     `json:"-" gorm:"not null"`
+	IsEmailVerified       bool       `json:"is_email_verified" gorm:"default:false"`
+	RecoveryEmail         string     `json:"recovery_email,omitempty"`
+	AccountLockedUntil    *time.Time `json:"-"`
+	LockReason            string     `json:"-"` // Set when staff locked the account
+	PasswordResetRequired bool       `json:"-" gorm:"default:false"`
+	Role                  Role       `json:"role" gorm:"default:user;not null"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled" gorm:"default:false"`
+	TwoFactorSecret       string     `json:"-"`
+	TwoFactorLastStep     int64      `json:"-" gorm:"default:0"`
+	// DeletionScheduledAt is when a deletion the user asked for is carried out. Signing
+	// in before then cancels it.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
 	CreatedAt           time.Time  `json:"created_at"`
 	UpdatedAt           time.Time  `json:"updated_at"`
 }
@@ -2,6 +2,8 @@ package ports
 
 import (
 	"fowergram/internal/core/domain"
+	"fowergram/pkg/pagination"
+	"io"
 	"time"
 )
 
@@ -9,16 +11,26 @@ type UserRepository interface {
 	Create(user *domain.User) error
 	FindByID(id uint) (*domain.User, error)
 	FindByEmail(email string) (*domain.User, error)
-	FindAll(page, limit int) ([]*domain.User, error)
+	FindAll(page pagination.Page) (*pagination.List[*domain.User], error)
+	// Search matches the query against usernames and emails
+	Search(query string, page pagination.Page) (*pagination.List[*domain.User], error)
 	Update(user *domain.User) error
+	// Delete removes the user and everything that belongs to them
 	Delete(id uint) error
+	// FindScheduledForDeletion returns users whose deletion grace period ended before now
+	FindScheduledForDeletion(now time.Time, limit int) ([]*domain.User, error)
+	// DeleteIfScheduled deletes the user unless the deletion was cancelled meanwhile
+	DeleteIfScheduled(id uint, now time.Time) error
 }
 
+// PostRepository loads posts and comments with their author
 type PostRepository interface {
 	Create(post *domain.Post) error
 	FindByID(id uint) (*domain.Post, error)
-	FindAll() ([]*domain.Post, error)
+	FindAll(page pagination.Page) (*pagination.List[*domain.Post], error)
+	FindComments(postID uint, page pagination.Page) (*pagination.List[*domain.Comment], error)
 	Update(post *domain.Post) error
+	// Delete removes the post and its comments
 	Delete(id uint) error
 }
 
@@ -35,10 +47,168 @@ type AuthRepository interface {
 	UpdateUser(user *domain.User) error
 	CreateDeviceSession(session *domain.DeviceSession) error
 	GetActiveSessions(userID uint) ([]*domain.DeviceSession, error)
+	// UpdateDeviceSession saves the name and trust of a session
+	UpdateDeviceSession(session *domain.DeviceSession) error
+	TouchDeviceSession(sessionID uint, at time.Time) error
 	RevokeSession(userID uint, deviceID string) error
+	RevokeSessionsByID(userID uint, sessionIDs []uint) error
 	CreateAuthCode(code *domain.AuthCode) error
 	ValidateAuthCode(userID uint, code string, purpose string) error
+	FindAuthCode(userID uint, code string, purpose string) (*domain.AuthCode, error)
+	ConsumeAuthCode(code string, purpose string) (*domain.AuthCode, error)
+	CountAuthCodesSince(userID uint, purpose string, since time.Time) (int64, error)
 	LogLogin(history *domain.LoginHistory) error
+	CountFailedLoginsFromIP(ip string, since time.Time) (int64, error)
 	GetLoginHistory(userID uint) ([]*domain.LoginHistory, error)
+	FindLoginHistory(userID uint, page pagination.Page) (*pagination.List[*domain.LoginHistory], error)
+	FindSuccessfulLogins(userID uint, limit int) ([]*domain.LoginHistory, error)
+	CountLoginAttempts(userID uint) (int64, error)
 	CreateAccountRecovery(recovery *domain.AccountRecovery) error
+	FindActiveAccountRecovery(userID uint, requestType string) (*domain.AccountRecovery, error)
+	UpdateAccountRecovery(recovery *domain.AccountRecovery) error
+	CreateRefreshToken(token *domain.RefreshToken) error
+	FindRefreshToken(tokenID string) (*domain.RefreshToken, error)
+	RotateRefreshToken(oldTokenID string, next *domain.RefreshToken) error
+	RevokeRefreshTokenFamily(familyID string) error
+	ReplaceBackupCodes(userID uint, codes []*domain.BackupCode) error
+	UseBackupCode(userID uint, codeHash string) error
+	// RecordTOTPStep stores the step of an accepted TOTP code. It returns
+	// errors.ErrInvalidTwoFactorCode unless the step is newer than the stored one.
+	RecordTOTPStep(userID uint, step int64) error
+}
+
+// SessionRevocationRepository tracks revoked device sessions until their access tokens expire
+type SessionRevocationRepository interface {
+	RevokeSession(sessionID uint, ttl time.Duration) error
+	IsSessionRevoked(sessionID uint) (bool, error)
+}
+
+type PasskeyRepository interface {
+	Create(credential *domain.WebAuthnCredential) error
+	FindByCredentialID(credentialID []byte) (*domain.WebAuthnCredential, error)
+	FindByUserID(userID uint) ([]*domain.WebAuthnCredential, error)
+	Update(credential *domain.WebAuthnCredential) error
+	Delete(userID, id uint) error
+}
+
+type IdentityRepository interface {
+	Create(identity *domain.UserIdentity) error
+	// CreateUserWithIdentity creates a user and their first linked identity together
+	CreateUserWithIdentity(user *domain.User, identity *domain.UserIdentity) error
+	FindByProviderSubject(provider, subject string) (*domain.UserIdentity, error)
+	FindByUserID(userID uint) ([]*domain.UserIdentity, error)
+	Update(identity *domain.UserIdentity) error
+	Delete(userID uint, provider string) error
+}
+
+type OAuthRepository interface {
+	CreateClient(client *domain.OAuthClient) error
+	FindClientByClientID(clientID string) (*domain.OAuthClient, error)
+	FindClientsByOwner(ownerID uint) ([]*domain.OAuthClient, error)
+	// DeleteClient removes the client and revokes every token issued to it
+	DeleteClient(ownerID uint, clientID string) error
+	CreateToken(token *domain.OAuthToken) error
+	FindTokenByTokenID(tokenID string) (*domain.OAuthToken, error)
+	FindTokenByRefreshHash(hash string) (*domain.OAuthToken, error)
+	RevokeToken(id uint) error
+	// RotateToken revokes the token and stores its successor atomically. It returns
+	// errors.ErrRefreshTokenReused if the token was already rotated or revoked.
+	RotateToken(id uint, next *domain.OAuthToken) error
+	RevokeTokenFamily(familyID string) error
+}
+
+type APIKeyRepository interface {
+	Create(key *domain.APIKey) error
+	FindByPrefix(prefix string) (*domain.APIKey, error)
+	// FindByUserID returns the keys of a user that were not revoked, expired ones included
+	FindByUserID(userID uint) ([]*domain.APIKey, error)
+	Revoke(userID, id uint) error
+	TouchLastUsed(id uint, at time.Time) error
+}
+
+type DataExportRepository interface {
+	Create(export *domain.DataExport) error
+	FindByID(id uint) (*domain.DataExport, error)
+	FindLatestByUserID(userID uint) (*domain.DataExport, error)
+	// ClaimPending marks up to limit pending exports, and exports stuck in processing
+	// since before staleBefore, as processing and returns them
+	ClaimPending(limit int, staleBefore time.Time) ([]*domain.DataExport, error)
+	Update(export *domain.DataExport) error
+	// FindPurgeable returns exports that expired before now or whose user was deleted
+	FindPurgeable(now time.Time) ([]*domain.DataExport, error)
+	Delete(id uint) error
+	FindPersonalData(userID uint) (*domain.PersonalData, error)
+}
+
+// MediaRepository stores uploaded media, the blobs they point to and resumable uploads
+type MediaRepository interface {
+	// Create saves the media, and the blob unless it exists. An existing blob is marked
+	// as used.
+	Create(media *domain.Media, blob *domain.MediaBlob) error
+	FindByID(id uint) (*domain.Media, error)
+	FindBlob(hash string) (*domain.MediaBlob, error)
+	CreateUpload(upload *domain.MediaUpload) error
+	FindUpload(id string) (*domain.MediaUpload, error)
+	UpdateUpload(upload *domain.MediaUpload) error
+	DeleteUpload(id string) error
+	FindExpiredUploads(now time.Time, limit int) ([]*domain.MediaUpload, error)
+	// ClaimPendingMedia marks up to limit photos waiting for processing as processing
+	// and returns them. Photos left in processing since staleBefore are claimed again.
+	ClaimPendingMedia(limit int, staleBefore time.Time) ([]*domain.Media, error)
+	// SaveProcessed saves the media with its renditions, replacing earlier ones, and
+	// the blobs they point to
+	SaveProcessed(media *domain.Media, blobs []*domain.MediaBlob) error
+	Update(media *domain.Media) error
+	// DeleteUnattached removes media created before the given time that no post uses
+	DeleteUnattached(before time.Time) (int64, error)
+	// FindUnusedBlobs returns blobs no media or rendition points to and that were last
+	// used before the given time
+	FindUnusedBlobs(before time.Time, limit int) ([]*domain.MediaBlob, error)
+	// DeleteBlobIfUnused deletes the blob row unless it was used again meanwhile, and
+	// reports whether it did
+	DeleteBlobIfUnused(hash string, before time.Time) (bool, error)
+}
+
+// BlobStore keeps the content of uploaded files under string keys
+type BlobStore interface {
+	// Put stores size bytes read from r, replacing what the key held
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Exists(key string) (bool, error)
+	// Delete succeeds when the key does not exist
+	Delete(key string) error
+}
+
+type AdminActionRepository interface {
+	Create(action *domain.AdminAction) error
+	FindAll(page, limit int) ([]*domain.AdminAction, error)
+}
+
+// AuditRepository stores the audit log. Append links the entry to the last one, entries
+// are never updated or deleted.
+type AuditRepository interface {
+	Append(entry *domain.AuditEntry) error
+	FindByTarget(userID uint, page, limit int) ([]*domain.AuditEntry, error)
+	Search(filter *domain.AuditFilter) ([]*domain.AuditEntry, error)
+	FindAfter(id uint, limit int) ([]*domain.AuditEntry, error)
+}
+
+// ChallengeRepository keeps short-lived ceremony state between the two legs of a flow.
+// TakeChallenge returns the data at most once.
+type ChallengeRepository interface {
+	SaveChallenge(id string, data []byte, ttl time.Duration) error
+	TakeChallenge(id string) ([]byte, error)
+}
+
+// RateLimitRepository keeps limiter and lockout state where every replica sees it.
+// Each method is a single atomic step, concurrent requests cannot lose a count.
+type RateLimitRepository interface {
+	// Hit counts a request in the sliding window unless the limit is already reached
+	Hit(key string, limit int, window time.Duration) (*domain.RateLimitResult, error)
+	// AddFailure counts a failure and returns the new total. The count is forgotten
+	// once window passes without another failure.
+	AddFailure(key string, window time.Duration) (int64, error)
+	Lock(key string, duration time.Duration) error
+	Lockout(key string) (*domain.LockoutStatus, error)
+	ClearLockout(key string) error
 }
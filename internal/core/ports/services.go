@@ -1,6 +1,12 @@
 package ports
 
-import "fowergram/internal/core/domain"
+import (
+	"io"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/pagination"
+)
 
 type UserService interface {
 	CreateUser(user *domain.User) error
@@ -8,30 +14,186 @@ type UserService interface {
 	GetUserByEmail(email string) (*domain.User, error)
 	UpdateUser(user *domain.User) error
 	DeleteUser(id uint) error
-	GetUsers(page, limit int) ([]*domain.User, error)
-	GetUsersFromCache(cacheKey string) ([]*domain.User, error)
-	CacheUsers(cacheKey string, users []*domain.User) error
+	GetUsers(page pagination.Page) (*pagination.List[*domain.User], error)
+	GetUsersFromCache(cacheKey string) (*pagination.List[*domain.User], error)
+	CacheUsers(cacheKey string, users *pagination.List[*domain.User]) error
 }
 
+// PostService manages posts. Only the author, or staff with the posts:moderate
+// permission, can change a post.
 type PostService interface {
-	CreatePost(post *domain.Post) error
+	CreatePost(authorID uint, req *domain.CreatePostRequest) (*domain.Post, error)
 	GetPostByID(id uint) (*domain.Post, error)
-	GetAllPosts() ([]*domain.Post, error)
-	UpdatePost(post *domain.Post) error
-	DeletePost(id uint) error
+	// GetPosts pages through all posts, newest first
+	GetPosts(page pagination.Page) (*pagination.List[*domain.Post], error)
+	// GetComments pages through the comments on a post, newest first
+	GetComments(postID uint, page pagination.Page) (*pagination.List[*domain.Comment], error)
+	UpdatePost(id uint, req *domain.UpdatePostRequest, actor *domain.Actor) (*domain.Post, error)
+	DeletePost(id uint, actor *domain.Actor) error
 }
 
 type AuthService interface {
 	Register(user *domain.User) error
-	Login(email, password string, deviceInfo *domain.DeviceSession) (*domain.User, string, error)
+	VerifyEmail(email, code string) error
+	ResendVerificationEmail(email string) error
+	Login(email, password string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error)
+	RequestMagicLink(email string, bindDevice bool) (string, error)
+	ConsumeMagicLink(token, binding string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error)
+	LoginWithPasskey(ceremonyID string, response []byte, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error)
+	LoginWithProvider(provider, state, code string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error)
+	CompleteTwoFactorLogin(challengeToken, code string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error)
+	CompleteLoginVerification(challengeToken, code string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error)
 	ValidateToken(token string) (*domain.User, error)
-	RefreshToken(refreshToken string) (string, error)
+	RefreshToken(refreshToken string) (*domain.TokenPair, error)
 	ValidateLoginCode(userID uint, code string) error
-	GetActiveSessions(userID uint) ([]*domain.DeviceSession, error)
-	RevokeSession(userID uint, deviceID string) error
+	// GetActiveSessions lists the signed in devices and marks currentSessionID as current
+	GetActiveSessions(userID, currentSessionID uint) ([]*domain.DeviceSession, error)
+	UpdateDevice(userID, sessionID uint, req *domain.DeviceUpdateRequest, actor *domain.Actor) (*domain.DeviceSession, error)
+	// RevokeDevice signs out every session of the device the session belongs to
+	RevokeDevice(userID, sessionID uint, actor *domain.Actor) error
+	// TouchSession records that a session was just used
+	TouchSession(sessionID uint) error
+	RevokeSession(userID uint, deviceID string, actor *domain.Actor) error
+	LogoutSession(userID, sessionID uint, actor *domain.Actor) error
+	RevokeOtherSessions(userID, currentSessionID uint, actor *domain.Actor) error
+	RevokeAllSessions(userID uint, actor *domain.Actor) error
 	GetLoginHistory(userID uint) ([]*domain.LoginHistory, error)
 	InitiateAccountRecovery(email string) error
 	ValidateRecoveryCode(email, code string) error
-	ResetPassword(email, code, newPassword string) error
+	ResetPassword(email, code, newPassword string, actor *domain.Actor) error
+	ChangePassword(userID, sessionID uint, currentPassword, newPassword string, actor *domain.Actor) error
 	UpdateRecoveryEmail(userID uint, email string) error
 }
+
+type TwoFactorService interface {
+	GenerateTOTP(userID uint) (*domain.TwoFactorSetup, error)
+	ValidateTOTP(userID uint, code string) error
+	EnableTwoFactor(userID uint, code string, actor *domain.Actor) ([]string, error)
+	DisableTwoFactor(userID uint, code string, actor *domain.Actor) error
+	RegenerateBackupCodes(userID uint, code string, actor *domain.Actor) ([]string, error)
+}
+
+type PasskeyService interface {
+	BeginRegistration(userID uint) (*domain.PasskeyCeremony, error)
+	FinishRegistration(userID uint, ceremonyID, name string, response []byte) (*domain.WebAuthnCredential, error)
+	BeginLogin() (*domain.PasskeyCeremony, error)
+	FinishLogin(ceremonyID string, response []byte) (*domain.User, error)
+	ListCredentials(userID uint) ([]*domain.WebAuthnCredential, error)
+	DeleteCredential(userID, id uint) error
+}
+
+type SocialAuthService interface {
+	Providers() []string
+	// BeginLogin starts a sign-in; BeginLink starts linking a provider to a signed-in user
+	BeginLogin(provider string) (*domain.SocialLoginStart, error)
+	BeginLink(userID uint, provider string) (*domain.SocialLoginStart, error)
+	CompleteLogin(provider, state, code string) (*domain.User, error)
+	CompleteLink(userID uint, provider, state, code string) (*domain.UserIdentity, error)
+	ListIdentities(userID uint) ([]*domain.UserIdentity, error)
+	Unlink(userID uint, provider string) error
+}
+
+type OAuthService interface {
+	RegisterClient(ownerID uint, req *domain.OAuthClientRequest) (*domain.OAuthClientCredentials, error)
+	ListClients(ownerID uint) ([]*domain.OAuthClient, error)
+	DeleteClient(ownerID uint, clientID string) error
+	// Authorize validates an authorization request and describes it for the consent screen
+	Authorize(userID uint, req *domain.OAuthAuthorizeRequest) (*domain.OAuthConsentScreen, error)
+	// Consent records the user's decision and returns the URL to send the user back to
+	Consent(userID uint, req *domain.OAuthConsentRequest) (string, error)
+	Token(req *domain.OAuthTokenRequest) (*domain.OAuthTokenResponse, error)
+	Introspect(clientID, clientSecret, token string) (*domain.OAuthIntrospection, error)
+	Revoke(clientID, clientSecret, token string) error
+	// ValidateAccessToken returns the grant behind an access token that is still active
+	ValidateAccessToken(token string) (*domain.OAuthToken, error)
+}
+
+type APIKeyService interface {
+	// Create returns the key itself, which is not stored and cannot be shown again
+	Create(userID uint, req *domain.APIKeyRequest, actor *domain.Actor) (*domain.APIKeyCredentials, error)
+	List(userID uint) ([]*domain.APIKey, error)
+	Revoke(userID, id uint, actor *domain.Actor) error
+	// Authenticate returns the active key behind the value of an Authorization header
+	Authenticate(key string) (*domain.APIKey, error)
+}
+
+// MediaService stores files users upload for their posts
+type MediaService interface {
+	// Upload stores a file sent in one request
+	Upload(userID uint, r io.Reader, size int64) (*domain.Media, error)
+	// StartUpload begins a resumable upload, for files too large for a single request
+	StartUpload(userID uint, req *domain.MediaUploadRequest) (*domain.MediaUpload, error)
+	GetUpload(userID uint, uploadID string) (*domain.MediaUpload, error)
+	// AppendChunk adds the chunk that starts at offset. The media is returned with the
+	// last chunk.
+	AppendChunk(userID uint, uploadID string, offset int64, chunk []byte) (*domain.MediaUpload, *domain.Media, error)
+	// Get returns media uploaded by the user
+	Get(userID, id uint) (*domain.Media, error)
+	// Present sets the URLs the media and its renditions are served at
+	Present(media *domain.Media)
+	// Open returns the content of the blob with the given hash
+	Open(hash string) (io.ReadCloser, *domain.MediaBlob, error)
+	// ProcessPending strips uploaded photos of their metadata and resizes them, and
+	// returns how many were processed
+	ProcessPending() (int, error)
+	// PurgeUnused removes expired uploads, media no post uses and blobs no media uses,
+	// and returns how many blobs and uploads were removed
+	PurgeUnused() (int, error)
+}
+
+// DataExportService builds downloadable copies of a user's personal data
+type DataExportService interface {
+	// Request queues an export, or returns the one already in progress
+	Request(userID uint, actor *domain.Actor) (*domain.DataExport, error)
+	// Latest returns the user's most recent export and, once it is ready, its download URL
+	Latest(userID uint) (*domain.DataExport, string, error)
+	// ProcessPending builds the queued archives and returns how many were built
+	ProcessPending() (int, error)
+	// Open checks a signed download link and returns the export and the archive path
+	Open(id uint, expires int64, signature string, actor *domain.Actor) (*domain.DataExport, string, error)
+	// PurgeExpired removes expired archives and those of deleted users
+	PurgeExpired() (int, error)
+}
+
+// AccountService handles self-service account deletion
+type AccountService interface {
+	// SendDeletionCode emails a code that confirms RequestDeletion in place of the
+	// password
+	SendDeletionCode(userID uint) error
+	// RequestDeletion signs the user out everywhere and returns when the account will be
+	// deleted
+	RequestDeletion(userID uint, req *domain.AccountDeletionRequest, actor *domain.Actor) (time.Time, error)
+	// PurgeScheduledAccounts deletes the accounts whose grace period is over and returns
+	// how many were deleted
+	PurgeScheduledAccounts() (int, error)
+}
+
+// AdminService backs the staff API. Every method records an admin action for the actor.
+type AdminService interface {
+	SearchUsers(actor *domain.Actor, query string, page pagination.Page) (*pagination.List[*domain.AdminUserView], error)
+	GetUser(actor *domain.Actor, userID uint) (*domain.AdminUserView, error)
+	LockUser(actor *domain.Actor, userID uint, until time.Time, reason string) error
+	UnlockUser(actor *domain.Actor, userID uint) error
+	ForcePasswordReset(actor *domain.Actor, userID uint) error
+	GetLoginHistory(actor *domain.Actor, userID uint, page pagination.Page) (*pagination.List[*domain.LoginHistory], error)
+	ChangeRole(actor *domain.Actor, userID uint, role domain.Role) error
+	ListActions(page, limit int) ([]*domain.AdminAction, error)
+}
+
+type AuditService interface {
+	Record(event string, actor *domain.Actor, targetUserID uint, details string) error
+	// ListForUser returns the events about a user, newest first. Staff details are hidden.
+	ListForUser(userID uint, page, limit int) ([]*domain.AuditEntry, error)
+	Search(filter *domain.AuditFilter) ([]*domain.AuditEntry, error)
+	VerifyChain() (*domain.AuditVerification, error)
+}
+
+// RateLimitService applies rate limit and lockout policies to an identity such as an
+// IP address, an email address or a user ID
+type RateLimitService interface {
+	Allow(policy domain.RateLimitPolicy, identity string) (*domain.RateLimitResult, error)
+	Lockout(policy domain.LockoutPolicy, identity string) (*domain.LockoutStatus, error)
+	// RegisterFailure counts a failure and locks the identity out when the policy says so
+	RegisterFailure(policy domain.LockoutPolicy, identity string) (*domain.LockoutStatus, error)
+	ClearLockout(policy domain.LockoutPolicy, identity string) error
+}
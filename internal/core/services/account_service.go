@@ -0,0 +1,184 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/email"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+)
+
+const (
+	// accountDeletionGracePeriod is how long a user has to change their mind
+	accountDeletionGracePeriod = 30 * 24 * time.Hour
+	// Accounts deleted per run of the purge job
+	accountPurgeBatchSize = 100
+
+	accountDeletionPurpose = "account_deletion"
+	accountDeletionCodeTTL = 15 * time.Minute
+)
+
+type accountService struct {
+	authRepo         ports.AuthRepository
+	userRepo         ports.UserRepository
+	authService      ports.AuthService
+	twoFactorService ports.TwoFactorService
+	emailService     email.Service
+	cacheRepo        ports.CacheRepository
+	auditService     ports.AuditService
+	rateLimitService ports.RateLimitService
+	hasher           security.PasswordHasher
+}
+
+func NewAccountService(ar ports.AuthRepository, ur ports.UserRepository, as ports.AuthService, tfs ports.TwoFactorService, es email.Service, cr ports.CacheRepository, aus ports.AuditService, rls ports.RateLimitService, ph security.PasswordHasher) ports.AccountService {
+	return &accountService{
+		authRepo:         ar,
+		userRepo:         ur,
+		authService:      as,
+		twoFactorService: tfs,
+		emailService:     es,
+		cacheRepo:        cr,
+		auditService:     aus,
+		rateLimitService: rls,
+		hasher:           ph,
+	}
+}
+
+// SendDeletionCode emails a single-use code so users who never set a password, like
+// those who signed up with a social login, can still confirm a deletion
+func (s *accountService) SendDeletionCode(userID uint) error {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return errors.ErrUserNotFound
+	}
+
+	code, err := security.GenerateRandomCode(6)
+	if err != nil {
+		return fmt.Errorf("failed to generate deletion code: %w", err)
+	}
+
+	authCode := &domain.AuthCode{
+		UserID:    user.ID,
+		Code:      security.HashToken(code),
+		Purpose:   accountDeletionPurpose,
+		ExpiresAt: time.Now().Add(accountDeletionCodeTTL),
+	}
+	if err := s.authRepo.CreateAuthCode(authCode); err != nil {
+		return fmt.Errorf("failed to create auth code: %w", err)
+	}
+
+	return s.emailService.SendAccountDeletionCodeEmail(user.Email, code)
+}
+
+// RequestDeletion re-checks the user's credentials, schedules the deletion and signs the
+// user out everywhere. The account is only purged once the grace period is over.
+func (s *accountService) RequestDeletion(userID uint, req *domain.AccountDeletionRequest, actor *domain.Actor) (time.Time, error) {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return time.Time{}, errors.ErrUserNotFound
+	}
+
+	// Staff appear in the admin action log, demoting them first keeps it intact
+	if user.Role != domain.RoleUser && user.Role != "" {
+		return time.Time{}, errors.ErrStaffAccountDeletion
+	}
+
+	if err := s.reauthenticate(user, req); err != nil {
+		return time.Time{}, err
+	}
+	if user.TwoFactorEnabled {
+		if req.Code == "" {
+			return time.Time{}, errors.ErrInvalidTwoFactorCode
+		}
+		if err := s.twoFactorService.ValidateTOTP(user.ID, req.Code); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	deleteAt := time.Now().Add(accountDeletionGracePeriod)
+	user.DeletionScheduledAt = &deleteAt
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return time.Time{}, fmt.Errorf("failed to schedule account deletion: %w", err)
+	}
+	s.forgetCached(user)
+
+	s.audit(domain.AuditEventDeletionRequested, user.ID, actor, fmt.Sprintf("delete_at=%s", deleteAt.UTC().Format(time.RFC3339)))
+
+	if err := s.authService.RevokeAllSessions(user.ID, actor); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.emailService.SendAccountDeletionScheduledEmail(user.Email, deleteAt); err != nil {
+		fmt.Printf("failed to send account deletion email: %v\n", err)
+	}
+	return deleteAt, nil
+}
+
+// reauthenticate checks the password, or the emailed code when no password was sent
+func (s *accountService) reauthenticate(user *domain.User, req *domain.AccountDeletionRequest) error {
+	if req.Password == "" {
+		if req.EmailCode == "" {
+			return errors.ErrInvalidCredentials
+		}
+		if err := s.authRepo.ValidateAuthCode(user.ID, security.HashToken(req.EmailCode), accountDeletionPurpose); err != nil {
+			return errors.ErrInvalidCredentials
+		}
+		return nil
+	}
+
+	match, err := s.hasher.Verify(req.Password, user.PasswordHash)
+	if err != nil {
+		fmt.Printf("failed to verify password hash: %v\n", err)
+	}
+	if !match {
+		return errors.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (s *accountService) PurgeScheduledAccounts() (int, error) {
+	now := time.Now()
+	users, err := s.userRepo.FindScheduledForDeletion(now, accountPurgeBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find accounts to delete: %w", err)
+	}
+
+	purged := 0
+	for _, user := range users {
+		// Skips accounts whose owner signed in since they were loaded
+		if err := s.userRepo.DeleteIfScheduled(user.ID, now); err != nil {
+			fmt.Printf("failed to delete account %d: %v\n", user.ID, err)
+			continue
+		}
+		purged++
+
+		s.forgetCached(user)
+		if err := s.rateLimitService.ClearLockout(accountLockout, fmt.Sprintf("%d", user.ID)); err != nil {
+			fmt.Printf("failed to clear lockout of deleted account: %v\n", err)
+		}
+		s.audit(domain.AuditEventAccountDeleted, user.ID, nil, "")
+
+		if err := s.emailService.SendAccountDeletedEmail(user.Email); err != nil {
+			fmt.Printf("failed to send account deleted email: %v\n", err)
+		}
+	}
+	return purged, nil
+}
+
+// forgetCached drops the cached copies of the user so the next read sees the database
+func (s *accountService) forgetCached(user *domain.User) {
+	for _, key := range []string{fmt.Sprintf("user:%d", user.ID), fmt.Sprintf("user:email:%s", user.Email)} {
+		if err := s.cacheRepo.Delete(key); err != nil {
+			fmt.Printf("failed to clear user cache: %v\n", err)
+		}
+	}
+}
+
+func (s *accountService) audit(event string, userID uint, actor *domain.Actor, details string) {
+	if err := s.auditService.Record(event, actor, userID, details); err != nil {
+		fmt.Printf("failed to record %s audit event: %v\n", event, err)
+	}
+}
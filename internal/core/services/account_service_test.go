@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/pagination"
+	"fowergram/pkg/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryUserRepo backs the purge job with the users of the auth repository mock
+type memoryUserRepo struct {
+	users   map[string]*domain.User
+	deleted []uint
+}
+
+func (r *memoryUserRepo) Create(user *domain.User) error { return nil }
+
+func (r *memoryUserRepo) FindByID(id uint) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *memoryUserRepo) FindByEmail(email string) (*domain.User, error) {
+	if user, ok := r.users[email]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *memoryUserRepo) FindAll(page pagination.Page) (*pagination.List[*domain.User], error) {
+	return nil, nil
+}
+
+func (r *memoryUserRepo) Search(query string, page pagination.Page) (*pagination.List[*domain.User], error) {
+	return nil, nil
+}
+
+func (r *memoryUserRepo) Update(user *domain.User) error { return nil }
+
+func (r *memoryUserRepo) Delete(id uint) error {
+	user, err := r.FindByID(id)
+	if err != nil {
+		return err
+	}
+	delete(r.users, user.Email)
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func (r *memoryUserRepo) FindScheduledForDeletion(now time.Time, limit int) ([]*domain.User, error) {
+	var users []*domain.User
+	for _, user := range r.users {
+		if user.DeletionScheduledAt != nil && !user.DeletionScheduledAt.After(now) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (r *memoryUserRepo) DeleteIfScheduled(id uint, now time.Time) error {
+	user, err := r.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if user.DeletionScheduledAt == nil || user.DeletionScheduledAt.After(now) {
+		return fmt.Errorf("account %d is not scheduled for deletion", id)
+	}
+	return r.Delete(id)
+}
+
+func newAccountTestService(env *adminTestEnv) (*accountService, *memoryUserRepo) {
+	users := &memoryUserRepo{users: env.repo.users}
+	accounts := NewAccountService(env.repo, users, env.auth, nil, env.email, env.auth.cacheRepo, env.auth.auditService, env.auth.rateLimitService, security.DefaultPasswordHasher())
+	return accounts.(*accountService), users
+}
+
+func TestAccountService_RequestDeletion(t *testing.T) {
+	user := testUser(t, 1, "user@example.com", domain.RoleUser)
+	moderator := testUser(t, 2, "mod@example.com", domain.RoleModerator)
+	env := newAdminTestEnv(t, user, moderator)
+	accounts, _ := newAccountTestService(env)
+	env.email.On("SendAccountDeletionScheduledEmail", user.Email, mock.AnythingOfType("time.Time")).Return(nil)
+
+	_, err := accounts.RequestDeletion(user.ID, &domain.AccountDeletionRequest{Password: "wrong-password"}, nil)
+	assert.Equal(t, errors.ErrInvalidCredentials, err)
+	_, err = accounts.RequestDeletion(moderator.ID, &domain.AccountDeletionRequest{Password: "Test123!"}, nil)
+	assert.Equal(t, errors.ErrStaffAccountDeletion, err)
+	assert.Nil(t, user.DeletionScheduledAt)
+
+	deleteAt, err := accounts.RequestDeletion(user.ID, &domain.AccountDeletionRequest{Password: "Test123!"}, &domain.Actor{UserID: user.ID})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(accountDeletionGracePeriod), deleteAt, time.Minute)
+	require.NotNil(t, user.DeletionScheduledAt)
+	env.repo.AssertCalled(t, "RevokeSessionsByID", user.ID, []uint{3})
+	env.email.AssertCalled(t, "SendAccountDeletionScheduledEmail", user.Email, deleteAt)
+	assert.Equal(t, []string{domain.AuditEventDeletionRequested, domain.AuditEventSessionsRevoked}, events(env.audit))
+}
+
+func TestAccountService_RequestDeletion_SocialOnlyAccount(t *testing.T) {
+	user := testUser(t, 1, "social@example.com", domain.RoleUser)
+	env := newAdminTestEnv(t, user)
+	accounts, _ := newAccountTestService(env)
+
+	// Social sign-ups get a random password the user never sees
+	unknown, err := randomToken()
+	require.NoError(t, err)
+	user.PasswordHash, err = security.DefaultPasswordHasher().Hash(unknown)
+	require.NoError(t, err)
+
+	var sentCode string
+	var storedCode *domain.AuthCode
+	env.repo.On("CreateAuthCode", mock.AnythingOfType("*domain.AuthCode")).
+		Run(func(args mock.Arguments) { storedCode = args.Get(0).(*domain.AuthCode) }).Return(nil)
+	env.email.On("SendAccountDeletionCodeEmail", user.Email, mock.Anything).
+		Run(func(args mock.Arguments) { sentCode = args.String(1) }).Return(nil)
+	env.email.On("SendAccountDeletionScheduledEmail", user.Email, mock.AnythingOfType("time.Time")).Return(nil)
+
+	require.NoError(t, accounts.SendDeletionCode(user.ID))
+	assert.Equal(t, accountDeletionPurpose, storedCode.Purpose)
+	assert.Equal(t, security.HashToken(sentCode), storedCode.Code, "deletion codes must be stored hashed")
+
+	env.repo.On("ValidateAuthCode", user.ID, storedCode.Code, accountDeletionPurpose).Return(nil).Once()
+	env.repo.On("ValidateAuthCode", user.ID, mock.Anything, accountDeletionPurpose).Return(fmt.Errorf("invalid or expired code"))
+
+	_, err = accounts.RequestDeletion(user.ID, &domain.AccountDeletionRequest{}, nil)
+	assert.Equal(t, errors.ErrInvalidCredentials, err)
+	_, err = accounts.RequestDeletion(user.ID, &domain.AccountDeletionRequest{EmailCode: "000000"}, nil)
+	assert.Equal(t, errors.ErrInvalidCredentials, err)
+	assert.Nil(t, user.DeletionScheduledAt)
+
+	_, err = accounts.RequestDeletion(user.ID, &domain.AccountDeletionRequest{EmailCode: sentCode}, &domain.Actor{UserID: user.ID})
+	require.NoError(t, err)
+	assert.NotNil(t, user.DeletionScheduledAt)
+
+	// The code is single-use
+	user.DeletionScheduledAt = nil
+	_, err = accounts.RequestDeletion(user.ID, &domain.AccountDeletionRequest{EmailCode: sentCode}, nil)
+	assert.Equal(t, errors.ErrInvalidCredentials, err)
+}
+
+func TestAccountService_LoginCancelsDeletion(t *testing.T) {
+	user := testUser(t, 1, "user@example.com", domain.RoleUser)
+	env := newAdminTestEnv(t, user)
+	env.repo.On("CreateDeviceSession", mock.AnythingOfType("*domain.DeviceSession")).Return(nil)
+	env.repo.On("CreateRefreshToken", mock.AnythingOfType("*domain.RefreshToken")).Return(nil)
+	env.email.On("SendLoginNotification", user.Email, mock.AnythingOfType("*domain.DeviceSession")).Return(nil)
+
+	deleteAt := time.Now().Add(time.Hour)
+	user.DeletionScheduledAt = &deleteAt
+
+	_, err := env.auth.Login(user.Email, "Test123!", &domain.DeviceSession{IPAddress: "127.0.0.1", DeviceID: "laptop"})
+	require.NoError(t, err)
+	assert.Nil(t, user.DeletionScheduledAt)
+	assert.Contains(t, events(env.audit), domain.AuditEventDeletionCancelled)
+}
+
+func TestAccountService_PurgeScheduledAccounts(t *testing.T) {
+	due := testUser(t, 1, "due@example.com", domain.RoleUser)
+	pending := testUser(t, 2, "pending@example.com", domain.RoleUser)
+	kept := testUser(t, 3, "kept@example.com", domain.RoleUser)
+	env := newAdminTestEnv(t, due, pending, kept)
+	accounts, users := newAccountTestService(env)
+	env.email.On("SendAccountDeletedEmail", due.Email).Return(nil)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	due.DeletionScheduledAt = &past
+	pending.DeletionScheduledAt = &future
+
+	purged, err := accounts.PurgeScheduledAccounts()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Equal(t, []uint{due.ID}, users.deleted)
+	env.email.AssertCalled(t, "SendAccountDeletedEmail", due.Email)
+	// The audit log outlives the account
+	assert.Equal(t, []string{domain.AuditEventAccountDeleted}, events(env.audit))
+	assert.Equal(t, due.ID, *env.audit.entries[0].TargetUserID)
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/pagination"
+)
+
+type adminService struct {
+	userRepo        ports.UserRepository
+	authRepo        ports.AuthRepository
+	adminActionRepo ports.AdminActionRepository
+	authService     ports.AuthService
+	auditService    ports.AuditService
+	rateLimits      ports.RateLimitService
+}
+
+func NewAdminService(ur ports.UserRepository, ar ports.AuthRepository, aar ports.AdminActionRepository, as ports.AuthService, aus ports.AuditService, rls ports.RateLimitService) ports.AdminService {
+	return &adminService{
+		userRepo:        ur,
+		authRepo:        ar,
+		adminActionRepo: aar,
+		authService:     as,
+		auditService:    aus,
+		rateLimits:      rls,
+	}
+}
+
+func (s *adminService) SearchUsers(actor *domain.Actor, query string, page pagination.Page) (*pagination.List[*domain.AdminUserView], error) {
+	if err := s.record(actor, domain.AdminActionSearchUsers, nil, fmt.Sprintf("query=%q", query)); err != nil {
+		return nil, err
+	}
+
+	users, err := s.userRepo.Search(query, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return pagination.Map(users, s.userView), nil
+}
+
+func (s *adminService) GetUser(actor *domain.Actor, userID uint) (*domain.AdminUserView, error) {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	if err := s.record(actor, domain.AdminActionViewUser, &user.ID, ""); err != nil {
+		return nil, err
+	}
+
+	return s.userView(user), nil
+}
+
+// userView adds the automatic lockout, which is kept in Redis rather than on the user row
+func (s *adminService) userView(user *domain.User) *domain.AdminUserView {
+	lockout, err := s.rateLimits.Lockout(accountLockout, fmt.Sprintf("%d", user.ID))
+	if err != nil {
+		fmt.Printf("failed to load lockout of user %d: %v\n", user.ID, err)
+	}
+	return domain.NewAdminUserView(user, lockout)
+}
+
+// LockUser blocks every sign-in method until the given time and signs the user out
+func (s *adminService) LockUser(actor *domain.Actor, userID uint, until time.Time, reason string) error {
+	if !until.After(time.Now()) {
+		return fmt.Errorf("lock must end in the future")
+	}
+
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return errors.ErrUserNotFound
+	}
+	if !canManage(actor, user) {
+		return errors.ErrPermissionDenied
+	}
+
+	details := fmt.Sprintf("until=%s reason=%q", until.UTC().Format(time.RFC3339), reason)
+	if err := s.record(actor, domain.AdminActionLockUser, &user.ID, details); err != nil {
+		return err
+	}
+
+	user.AccountLockedUntil = &until
+	user.LockReason = reason
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	return s.authService.RevokeAllSessions(user.ID, actor)
+}
+
+// UnlockUser lifts staff locks and automatic lockouts alike
+func (s *adminService) UnlockUser(actor *domain.Actor, userID uint) error {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return errors.ErrUserNotFound
+	}
+	if !canManage(actor, user) {
+		return errors.ErrPermissionDenied
+	}
+
+	if err := s.record(actor, domain.AdminActionUnlockUser, &user.ID, ""); err != nil {
+		return err
+	}
+
+	user.AccountLockedUntil = nil
+	user.LockReason = ""
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+	if err := s.rateLimits.ClearLockout(accountLockout, fmt.Sprintf("%d", user.ID)); err != nil {
+		return fmt.Errorf("failed to clear lockout: %w", err)
+	}
+	return nil
+}
+
+// ForcePasswordReset signs the user out everywhere and emails a reset code. No sign-in
+// method works until the password has been reset.
+func (s *adminService) ForcePasswordReset(actor *domain.Actor, userID uint) error {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return errors.ErrUserNotFound
+	}
+	if !canManage(actor, user) {
+		return errors.ErrPermissionDenied
+	}
+
+	if err := s.record(actor, domain.AdminActionForcePasswordReset, &user.ID, ""); err != nil {
+		return err
+	}
+
+	user.PasswordResetRequired = true
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+
+	if err := s.authService.RevokeAllSessions(user.ID, actor); err != nil {
+		return err
+	}
+
+	return s.authService.InitiateAccountRecovery(user.Email)
+}
+
+func (s *adminService) GetLoginHistory(actor *domain.Actor, userID uint, page pagination.Page) (*pagination.List[*domain.LoginHistory], error) {
+	if _, err := s.authRepo.FindUserByID(userID); err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	if err := s.record(actor, domain.AdminActionViewLoginHistory, &userID, ""); err != nil {
+		return nil, err
+	}
+
+	return s.authRepo.FindLoginHistory(userID, page)
+}
+
+// ChangeRole sets a user's role. Staff cannot change their own role, so at least one
+// other admin is always involved in granting or removing admin rights.
+func (s *adminService) ChangeRole(actor *domain.Actor, userID uint, role domain.Role) error {
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if userID == actor.UserID {
+		return errors.ErrPermissionDenied
+	}
+
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return errors.ErrUserNotFound
+	}
+
+	details := fmt.Sprintf("from=%s to=%s", user.Role, role)
+	if err := s.record(actor, domain.AdminActionChangeRole, &user.ID, details); err != nil {
+		return err
+	}
+
+	user.Role = role
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to change role: %w", err)
+	}
+	return nil
+}
+
+func (s *adminService) ListActions(page, limit int) ([]*domain.AdminAction, error) {
+	return s.adminActionRepo.FindAll(page, limit)
+}
+
+// canManage keeps staff from acting on themselves or, unless they are admins, on
+// other staff accounts
+func canManage(actor *domain.Actor, user *domain.User) bool {
+	if user.ID == actor.UserID {
+		return false
+	}
+	return user.Role == domain.RoleUser || user.Role == "" || actor.Role == domain.RoleAdmin
+}
+
+// record writes the admin action and its audit entry before the action takes effect.
+// Nothing happens if either cannot be written, so no staff action goes unaudited.
+func (s *adminService) record(actor *domain.Actor, action string, targetUserID *uint, details string) error {
+	entry := &domain.AdminAction{
+		ActorID:      actor.UserID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Details:      details,
+		IPAddress:    actor.IPAddress,
+		UserAgent:    actor.UserAgent,
+	}
+	if err := s.adminActionRepo.Create(entry); err != nil {
+		return fmt.Errorf("failed to record admin action: %w", err)
+	}
+
+	var target uint
+	if targetUserID != nil {
+		target = *targetUserID
+	}
+	return s.auditService.Record(domain.AuditEventAdminPrefix+action, actor, target, details)
+}
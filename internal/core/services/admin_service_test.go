@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryAdminActionRepo struct {
+	actions []*domain.AdminAction
+	err     error
+}
+
+func (r *memoryAdminActionRepo) Create(action *domain.AdminAction) error {
+	if r.err != nil {
+		return r.err
+	}
+	action.ID = uint(len(r.actions) + 1)
+	r.actions = append(r.actions, action)
+	return nil
+}
+
+func (r *memoryAdminActionRepo) FindAll(page, limit int) ([]*domain.AdminAction, error) {
+	return r.actions, nil
+}
+
+type adminTestEnv struct {
+	repo    *MockAuthRepo
+	email   *MockEmailService
+	actions *memoryAdminActionRepo
+	audit   *memoryAuditRepo
+	auth    *authService
+	admin   *adminService
+}
+
+func newAdminTestEnv(t *testing.T, users ...*domain.User) *adminTestEnv {
+	repo := NewMockAuthRepo()
+	for _, user := range users {
+		repo.users[user.Email] = user
+		repo.On("FindUserByEmail", user.Email).Return(user, nil)
+	}
+	repo.On("UpdateUser", mock.AnythingOfType("*domain.User")).Return(nil)
+	repo.On("GetActiveSessions", mock.Anything).Return([]*domain.DeviceSession{{ID: 3}}, nil)
+	repo.On("RevokeSessionsByID", mock.Anything, mock.Anything).Return(nil)
+	repo.On("LogLogin", mock.AnythingOfType("*domain.LoginHistory")).Return(nil)
+	repo.On("CountFailedLoginsFromIP", mock.Anything, mock.Anything).Return(int64(0), nil)
+	repo.On("FindLoginHistory", mock.Anything, mock.Anything).Return([]*domain.LoginHistory{}, nil)
+	repo.On("FindSuccessfulLogins", mock.Anything, riskHistorySize).Return([]*domain.LoginHistory{}, nil)
+	repo.On("CountLoginAttempts", mock.Anything).Return(int64(0), nil)
+
+	cache := new(MockCacheRepo)
+	cache.On("Get", mock.Anything).Return(nil, redis.Nil)
+	cache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	cache.On("Delete", mock.Anything).Return(nil)
+	revocations := new(MockRevocationRepo)
+	revocations.On("RevokeSession", mock.Anything, accessTokenTTL).Return(nil)
+	emailService := new(MockEmailService)
+	geo := new(MockGeoService)
+	geo.On("Lookup", mock.Anything).Return(nil, fmt.Errorf("lookup unavailable"))
+
+	audit := &memoryAuditRepo{}
+	auditService := NewAuditService(audit)
+	limits := NewRateLimitService(newMemoryRateLimitRepo())
+	auth := NewAuthService(repo, emailService, geo, cache, revocations, nil, nil, nil, auditService, limits, newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil)).(*authService)
+	actions := &memoryAdminActionRepo{}
+	return &adminTestEnv{
+		repo:    repo,
+		email:   emailService,
+		actions: actions,
+		audit:   audit,
+		auth:    auth,
+		admin:   NewAdminService(nil, repo, actions, auth, auditService, limits).(*adminService),
+	}
+}
+
+func testUser(t *testing.T, id uint, email string, role domain.Role) *domain.User {
+	hash, err := security.DefaultPasswordHasher().Hash("Test123!")
+	require.NoError(t, err)
+	return &domain.User{ID: id, Email: email, Role: role, PasswordHash: hash}
+}
+
+func TestAdminService_LockUser(t *testing.T) {
+	staff := testUser(t, 1, "mod@example.com", domain.RoleModerator)
+	user := testUser(t, 2, "user@example.com", domain.RoleUser)
+	env := newAdminTestEnv(t, staff, user)
+	actor := &domain.Actor{UserID: staff.ID, Role: staff.Role, IPAddress: "10.0.0.1", UserAgent: "test"}
+
+	until := time.Now().Add(24 * time.Hour)
+	require.NoError(t, env.admin.LockUser(actor, user.ID, until, "spam"))
+
+	require.Len(t, env.actions.actions, 1)
+	recorded := env.actions.actions[0]
+	assert.Equal(t, domain.AdminActionLockUser, recorded.Action)
+	assert.Equal(t, staff.ID, recorded.ActorID)
+	assert.Equal(t, user.ID, *recorded.TargetUserID)
+	assert.Equal(t, "10.0.0.1", recorded.IPAddress)
+	assert.Contains(t, recorded.Details, `reason="spam"`)
+	env.repo.AssertCalled(t, "RevokeSessionsByID", user.ID, []uint{3})
+
+	// A staff lock is reported differently from the automatic lockout
+	_, err := env.auth.Login(user.Email, "Test123!", &domain.DeviceSession{IPAddress: "127.0.0.1"})
+	assert.Equal(t, errors.ErrAccountSuspended, err)
+
+	assert.Equal(t, []string{"admin.users.lock", domain.AuditEventSessionsRevoked, domain.AuditEventLoginFailed}, events(env.audit))
+	assert.Equal(t, staff.ID, *env.audit.entries[1].ActorID)
+
+	require.NoError(t, env.admin.UnlockUser(actor, user.ID))
+	assert.Nil(t, user.AccountLockedUntil)
+	assert.Empty(t, user.LockReason)
+	assert.Len(t, env.actions.actions, 2)
+}
+
+func TestAdminService_CannotManageStaff(t *testing.T) {
+	moderator := testUser(t, 1, "mod@example.com", domain.RoleModerator)
+	admin := testUser(t, 2, "admin@example.com", domain.RoleAdmin)
+	env := newAdminTestEnv(t, moderator, admin)
+	actor := &domain.Actor{UserID: moderator.ID, Role: moderator.Role}
+
+	until := time.Now().Add(time.Hour)
+	assert.Equal(t, errors.ErrPermissionDenied, env.admin.LockUser(actor, admin.ID, until, "revenge"))
+	assert.Equal(t, errors.ErrPermissionDenied, env.admin.LockUser(actor, moderator.ID, until, "self"))
+	assert.Equal(t, errors.ErrPermissionDenied, env.admin.ChangeRole(actor, moderator.ID, domain.RoleAdmin))
+	assert.Nil(t, admin.AccountLockedUntil)
+	assert.Empty(t, env.actions.actions)
+
+	// Admins can act on other staff
+	adminActor := &domain.Actor{UserID: admin.ID, Role: admin.Role}
+	require.NoError(t, env.admin.ChangeRole(adminActor, moderator.ID, domain.RoleSupport))
+	assert.Equal(t, domain.RoleSupport, moderator.Role)
+	assert.Equal(t, "from=moderator to=support", env.actions.actions[0].Details)
+}
+
+func TestAdminService_ForcePasswordReset(t *testing.T) {
+	staff := testUser(t, 1, "support@example.com", domain.RoleSupport)
+	user := testUser(t, 2, "user@example.com", domain.RoleUser)
+	env := newAdminTestEnv(t, staff, user)
+	actor := &domain.Actor{UserID: staff.ID, Role: staff.Role}
+
+	env.repo.On("CreateAccountRecovery", mock.AnythingOfType("*domain.AccountRecovery")).Return(nil)
+	env.repo.On("CreateAuthCode", mock.AnythingOfType("*domain.AuthCode")).Return(nil)
+	env.email.On("SendPasswordResetEmail", user.Email, mock.Anything).Return(nil)
+
+	require.NoError(t, env.admin.ForcePasswordReset(actor, user.ID))
+	assert.True(t, user.PasswordResetRequired)
+	env.email.AssertCalled(t, "SendPasswordResetEmail", user.Email, mock.Anything)
+	env.repo.AssertCalled(t, "RevokeSessionsByID", user.ID, []uint{3})
+
+	// The old password no longer signs the user in
+	_, err := env.auth.Login(user.Email, "Test123!", &domain.DeviceSession{IPAddress: "127.0.0.1"})
+	assert.Equal(t, errors.ErrPasswordResetRequired, err)
+}
+
+func TestAdminService_FailsClosedWithoutAuditRecord(t *testing.T) {
+	staff := testUser(t, 1, "mod@example.com", domain.RoleModerator)
+	user := testUser(t, 2, "user@example.com", domain.RoleUser)
+	env := newAdminTestEnv(t, staff, user)
+	env.actions.err = fmt.Errorf("database unavailable")
+	actor := &domain.Actor{UserID: staff.ID, Role: staff.Role}
+
+	assert.Error(t, env.admin.LockUser(actor, user.ID, time.Now().Add(time.Hour), "spam"))
+	assert.Nil(t, user.AccountLockedUntil)
+	env.repo.AssertNotCalled(t, "RevokeSessionsByID", mock.Anything, mock.Anything)
+}
+
+func TestAdminService_UnlockClearsLockout(t *testing.T) {
+	staff := testUser(t, 1, "support@example.com", domain.RoleSupport)
+	user := testUser(t, 2, "user@example.com", domain.RoleUser)
+	env := newAdminTestEnv(t, staff, user)
+	actor := &domain.Actor{UserID: staff.ID, Role: staff.Role}
+
+	device := &domain.DeviceSession{IPAddress: "10.0.0.5"}
+	for i := 0; i < 5; i++ {
+		_, err := env.auth.Login(user.Email, "wrong-password", device)
+		assert.Error(t, err)
+	}
+	_, err := env.auth.Login(user.Email, "Test123!", device)
+	assert.Equal(t, errors.ErrAccountLocked, err)
+
+	view, err := env.admin.GetUser(actor, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), view.FailedLoginAttempts)
+	require.NotNil(t, view.LockedOutUntil)
+	assert.Nil(t, view.AccountLockedUntil, "an automatic lockout is not a staff lock")
+
+	require.NoError(t, env.admin.UnlockUser(actor, user.ID))
+	view, err = env.admin.GetUser(actor, user.ID)
+	require.NoError(t, err)
+	assert.Zero(t, view.FailedLoginAttempts)
+	assert.Nil(t, view.LockedOutUntil)
+}
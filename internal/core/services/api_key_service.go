@@ -0,0 +1,153 @@
+package services
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+)
+
+const (
+	maxAPIKeysPerUser = 20
+	// The last-used time is written at most once a minute per key, not on every request
+	apiKeyTouchInterval = time.Minute
+)
+
+type apiKeyService struct {
+	apiKeyRepo   ports.APIKeyRepository
+	authRepo     ports.AuthRepository
+	auditService ports.AuditService
+}
+
+func NewAPIKeyService(akr ports.APIKeyRepository, ar ports.AuthRepository, aus ports.AuditService) ports.APIKeyService {
+	return &apiKeyService{
+		apiKeyRepo:   akr,
+		authRepo:     ar,
+		auditService: aus,
+	}
+}
+
+func (s *apiKeyService) Create(userID uint, req *domain.APIKeyRequest, actor *domain.Actor) (*domain.APIKeyCredentials, error) {
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if _, ok := domain.APIKeyScopes[scope]; !ok {
+			return nil, errors.ErrInvalidAPIKeyScope
+		}
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	existing, err := s.apiKeyRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+	now := time.Now()
+	active := 0
+	for _, key := range existing {
+		if key.Active(now) {
+			active++
+		}
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, errors.ErrTooManyAPIKeys
+	}
+
+	id, err := security.GenerateRandomBytes(6)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key := &domain.APIKey{
+		UserID:     userID,
+		Name:       req.Name,
+		Prefix:     domain.APIKeyPrefix + hex.EncodeToString(id),
+		SecretHash: security.HashToken(secret),
+		Scopes:     strings.Join(scopes, " "),
+		ExpiresAt:  now.AddDate(0, 0, req.ExpiresInDays),
+	}
+	if err := s.apiKeyRepo.Create(key); err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	s.audit(domain.AuditEventAPIKeyCreated, userID, actor, fmt.Sprintf("key=%s scopes=%q", key.Prefix, key.Scopes))
+	return &domain.APIKeyCredentials{
+		APIKey: key,
+		Key:    key.Prefix + "_" + secret,
+	}, nil
+}
+
+func (s *apiKeyService) List(userID uint) ([]*domain.APIKey, error) {
+	return s.apiKeyRepo.FindByUserID(userID)
+}
+
+func (s *apiKeyService) Revoke(userID, id uint, actor *domain.Actor) error {
+	if err := s.apiKeyRepo.Revoke(userID, id); err != nil {
+		return errors.ErrAPIKeyNotFound
+	}
+
+	s.audit(domain.AuditEventAPIKeyRevoked, userID, actor, fmt.Sprintf("key_id=%d", id))
+	return nil
+}
+
+func (s *apiKeyService) Authenticate(key string) (*domain.APIKey, error) {
+	// The secret is base64url and may itself contain underscores
+	parts := strings.SplitN(strings.TrimPrefix(key, domain.APIKeyPrefix), "_", 2)
+	if !domain.IsAPIKey(key) || len(parts) != 2 {
+		return nil, errors.ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.apiKeyRepo.FindByPrefix(domain.APIKeyPrefix + parts[0])
+	if err != nil {
+		return nil, errors.ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(security.HashToken(parts[1])), []byte(apiKey.SecretHash)) != 1 {
+		return nil, errors.ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if !apiKey.Active(now) {
+		return nil, errors.ErrInvalidAPIKey
+	}
+
+	// A key acts for its owner and is shut out whenever the owner could not sign in
+	owner, err := s.authRepo.FindUserByID(apiKey.UserID)
+	if err != nil {
+		return nil, errors.ErrInvalidAPIKey
+	}
+	if err := lockError(owner); err != nil {
+		return nil, err
+	}
+	if owner.PasswordResetRequired {
+		return nil, errors.ErrPasswordResetRequired
+	}
+	// Unlike a sign-in, using a key does not cancel a pending deletion
+	if owner.DeletionScheduledAt != nil {
+		return nil, errors.ErrInvalidAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.apiKeyRepo.TouchLastUsed(apiKey.ID, now); err != nil {
+			fmt.Printf("failed to update API key last use: %v\n", err)
+		} else {
+			apiKey.LastUsedAt = &now
+		}
+	}
+	return apiKey, nil
+}
+
+func (s *apiKeyService) audit(event string, userID uint, actor *domain.Actor, details string) {
+	if err := s.auditService.Record(event, actor, userID, details); err != nil {
+		fmt.Printf("failed to record %s audit event: %v\n", event, err)
+	}
+}
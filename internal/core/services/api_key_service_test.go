@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryAPIKeyRepo struct {
+	keys []*domain.APIKey
+}
+
+func (r *memoryAPIKeyRepo) Create(key *domain.APIKey) error {
+	key.ID = uint(len(r.keys) + 1)
+	key.CreatedAt = time.Now()
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *memoryAPIKeyRepo) FindByPrefix(prefix string) (*domain.APIKey, error) {
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *memoryAPIKeyRepo) FindByUserID(userID uint) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	for _, key := range r.keys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *memoryAPIKeyRepo) Revoke(userID, id uint) error {
+	for _, key := range r.keys {
+		if key.ID == id && key.UserID == userID && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			return nil
+		}
+	}
+	return fmt.Errorf("api key not found")
+}
+
+func (r *memoryAPIKeyRepo) TouchLastUsed(id uint, at time.Time) error {
+	r.keys[id-1].LastUsedAt = &at
+	return nil
+}
+
+// newAPIKeyOwners stores the users keys are created for in the tests
+func newAPIKeyOwners(users ...*domain.User) *MockAuthRepo {
+	repo := NewMockAuthRepo()
+	for _, user := range users {
+		repo.users[user.Email] = user
+	}
+	return repo
+}
+
+func TestAPIKeyService_Lifecycle(t *testing.T) {
+	repo := &memoryAPIKeyRepo{}
+	auditRepo := &memoryAuditRepo{}
+	service := NewAPIKeyService(repo, newAPIKeyOwners(&domain.User{ID: 1, Email: "owner@example.com"}), NewAuditService(auditRepo))
+
+	_, err := service.Create(1, &domain.APIKeyRequest{Name: "ci", Scopes: []string{"everything"}, ExpiresInDays: 30}, nil)
+	assert.Equal(t, errors.ErrInvalidAPIKeyScope, err)
+
+	credentials, err := service.Create(1, &domain.APIKeyRequest{
+		Name:          "ci",
+		Scopes:        []string{domain.ScopePostsWrite, domain.ScopePostsWrite, domain.ScopeAdmin},
+		ExpiresInDays: 30,
+	}, &domain.Actor{UserID: 1})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(credentials.Key, credentials.APIKey.Prefix+"_"))
+	assert.Equal(t, []string{domain.ScopePostsWrite, domain.ScopeAdmin}, credentials.APIKey.ScopeList())
+	// Only a hash of the secret is stored
+	assert.Equal(t, security.HashToken(strings.TrimPrefix(credentials.Key, credentials.APIKey.Prefix+"_")), credentials.APIKey.SecretHash)
+
+	key, err := service.Authenticate(credentials.Key)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), key.UserID)
+	assert.True(t, key.HasScope(domain.ScopeAdmin))
+	assert.NotNil(t, repo.keys[0].LastUsedAt)
+
+	for _, invalid := range []string{
+		credentials.Key + "x",
+		credentials.APIKey.Prefix,
+		domain.APIKeyPrefix + "000000000000_" + strings.TrimPrefix(credentials.Key, credentials.APIKey.Prefix+"_"),
+	} {
+		_, err := service.Authenticate(invalid)
+		assert.Equal(t, errors.ErrInvalidAPIKey, err, invalid)
+	}
+
+	// Expired keys stop working
+	repo.keys[0].ExpiresAt = time.Now().Add(-time.Minute)
+	_, err = service.Authenticate(credentials.Key)
+	assert.Equal(t, errors.ErrInvalidAPIKey, err)
+	repo.keys[0].ExpiresAt = time.Now().Add(time.Hour)
+
+	// Only the owner can revoke a key
+	assert.Equal(t, errors.ErrAPIKeyNotFound, service.Revoke(2, credentials.APIKey.ID, nil))
+	require.NoError(t, service.Revoke(1, credentials.APIKey.ID, &domain.Actor{UserID: 1}))
+	_, err = service.Authenticate(credentials.Key)
+	assert.Equal(t, errors.ErrInvalidAPIKey, err)
+
+	keys, err := service.List(1)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Equal(t, []string{domain.AuditEventAPIKeyCreated, domain.AuditEventAPIKeyRevoked}, events(auditRepo))
+}
+
+func TestAPIKeyService_LimitsActiveKeys(t *testing.T) {
+	repo := &memoryAPIKeyRepo{}
+	service := NewAPIKeyService(repo, newAPIKeyOwners(), newTestAuditService())
+	req := &domain.APIKeyRequest{Name: "bot", Scopes: []string{domain.ScopePostsRead}, ExpiresInDays: 1}
+
+	for i := 0; i < maxAPIKeysPerUser; i++ {
+		_, err := service.Create(1, req, nil)
+		require.NoError(t, err)
+	}
+	_, err := service.Create(1, req, nil)
+	assert.Equal(t, errors.ErrTooManyAPIKeys, err)
+
+	// Expired keys do not count
+	repo.keys[0].ExpiresAt = time.Now().Add(-time.Minute)
+	_, err = service.Create(1, req, nil)
+	assert.NoError(t, err)
+}
+
+func TestAPIKeyService_RefusesKeysOfBlockedAccounts(t *testing.T) {
+	owner := &domain.User{ID: 1, Email: "owner@example.com"}
+	service := NewAPIKeyService(&memoryAPIKeyRepo{}, newAPIKeyOwners(owner), newTestAuditService())
+	credentials, err := service.Create(1, &domain.APIKeyRequest{Name: "ci", Scopes: []string{domain.ScopePostsRead}, ExpiresInDays: 30}, nil)
+	require.NoError(t, err)
+
+	lockedUntil := time.Now().Add(time.Hour)
+	deleteAt := time.Now().Add(30 * 24 * time.Hour)
+	tests := []struct {
+		name    string
+		block   func()
+		wantErr error
+	}{
+		{"locked by staff", func() { owner.AccountLockedUntil, owner.LockReason = &lockedUntil, "spam" }, errors.ErrAccountSuspended},
+		{"password reset forced", func() { owner.PasswordResetRequired = true }, errors.ErrPasswordResetRequired},
+		{"deletion scheduled", func() { owner.DeletionScheduledAt = &deleteAt }, errors.ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*owner = domain.User{ID: 1, Email: "owner@example.com"}
+			_, err := service.Authenticate(credentials.Key)
+			require.NoError(t, err)
+
+			tt.block()
+			_, err = service.Authenticate(credentials.Key)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+)
+
+// Entries are read in batches when the chain is verified
+const auditVerifyBatchSize = 500
+
+type auditService struct {
+	auditRepo ports.AuditRepository
+}
+
+func NewAuditService(ar ports.AuditRepository) ports.AuditService {
+	return &auditService{
+		auditRepo: ar,
+	}
+}
+
+// Record appends an event to the audit log. actor may be nil for events without a
+// request, and a zero targetUserID means the event is not about a known user.
+func (s *auditService) Record(event string, actor *domain.Actor, targetUserID uint, details string) error {
+	entry := &domain.AuditEntry{
+		Event:   event,
+		Details: details,
+		// Postgres keeps microseconds, the hash must match what is read back
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if targetUserID != 0 {
+		entry.TargetUserID = &targetUserID
+	}
+	if actor != nil {
+		if actor.UserID != 0 {
+			actorID := actor.UserID
+			entry.ActorID = &actorID
+		}
+		entry.IPAddress = actor.IPAddress
+		entry.UserAgent = actor.UserAgent
+		entry.RequestID = actor.RequestID
+	}
+
+	if err := s.auditRepo.Append(entry); err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *auditService) ListForUser(userID uint, page, limit int) ([]*domain.AuditEntry, error) {
+	entries, err := s.auditRepo.FindByTarget(userID, page, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load audit log: %w", err)
+	}
+
+	// Users see what staff did to their account but not who did it or from where
+	for _, entry := range entries {
+		if entry.ActorID != nil && *entry.ActorID != userID {
+			entry.ActorID = nil
+			entry.IPAddress = ""
+			entry.UserAgent = ""
+		}
+	}
+	return entries, nil
+}
+
+func (s *auditService) Search(filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	entries, err := s.auditRepo.Search(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// VerifyChain walks the whole log and reports the first entry that does not match the
+// hash chain
+func (s *auditService) VerifyChain() (*domain.AuditVerification, error) {
+	result := &domain.AuditVerification{Valid: true}
+
+	var prev *domain.AuditEntry
+	var lastID uint
+	for {
+		entries, err := s.auditRepo.FindAfter(lastID, auditVerifyBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		for _, entry := range entries {
+			expectedPrev := ""
+			if prev != nil {
+				expectedPrev = prev.Hash
+			}
+			if entry.PrevHash != expectedPrev || entry.ComputeHash() != entry.Hash {
+				brokenAt := entry.ID
+				result.Valid = false
+				result.BrokenAt = &brokenAt
+				return result, nil
+			}
+			result.Checked++
+			prev = entry
+			lastID = entry.ID
+		}
+
+		if len(entries) < auditVerifyBatchSize {
+			return result, nil
+		}
+	}
+}
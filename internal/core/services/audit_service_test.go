@@ -0,0 +1,148 @@
+package services
+
+import (
+	"testing"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryAuditRepo struct {
+	entries []*domain.AuditEntry
+}
+
+func (r *memoryAuditRepo) Append(entry *domain.AuditEntry) error {
+	var prev *domain.AuditEntry
+	if len(r.entries) > 0 {
+		prev = r.entries[len(r.entries)-1]
+	}
+	entry.Link(prev)
+	entry.ID = uint(len(r.entries) + 1)
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *memoryAuditRepo) FindByTarget(userID uint, page, limit int) ([]*domain.AuditEntry, error) {
+	var entries []*domain.AuditEntry
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if target := r.entries[i].TargetUserID; target != nil && *target == userID {
+			copied := *r.entries[i]
+			entries = append(entries, &copied)
+		}
+	}
+	return entries, nil
+}
+
+func (r *memoryAuditRepo) Search(filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	var entries []*domain.AuditEntry
+	for _, entry := range r.entries {
+		if filter.Event == "" || entry.Event == filter.Event {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (r *memoryAuditRepo) FindAfter(id uint, limit int) ([]*domain.AuditEntry, error) {
+	var entries []*domain.AuditEntry
+	for _, entry := range r.entries {
+		if entry.ID > id && len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func newTestAuditService() ports.AuditService {
+	return NewAuditService(&memoryAuditRepo{})
+}
+
+func events(repo *memoryAuditRepo) []string {
+	var names []string
+	for _, entry := range repo.entries {
+		names = append(names, entry.Event)
+	}
+	return names
+}
+
+func TestAuditService_HashChain(t *testing.T) {
+	repo := &memoryAuditRepo{}
+	service := NewAuditService(repo)
+	actor := &domain.Actor{UserID: 1, IPAddress: "10.0.0.1", UserAgent: "test", RequestID: "req-1"}
+
+	require.NoError(t, service.Record(domain.AuditEventLoginSucceeded, actor, 1, "session=4"))
+	require.NoError(t, service.Record(domain.AuditEventPasswordChanged, actor, 1, ""))
+	require.NoError(t, service.Record(domain.AuditEventLoginFailed, nil, 0, "reason=unknown_account"))
+
+	assert.Empty(t, repo.entries[0].PrevHash)
+	assert.Equal(t, repo.entries[0].Hash, repo.entries[1].PrevHash)
+	assert.Equal(t, "req-1", repo.entries[0].RequestID)
+	assert.Nil(t, repo.entries[2].ActorID)
+	assert.Nil(t, repo.entries[2].TargetUserID)
+
+	result, err := service.VerifyChain()
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, 3, result.Checked)
+
+	// Editing an entry breaks the chain at that entry
+	repo.entries[1].IPAddress = "192.168.0.1"
+	result, err = service.VerifyChain()
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint(2), *result.BrokenAt)
+
+	// So does removing one, even with the edited entry restored
+	repo.entries[1].IPAddress = "10.0.0.1"
+	repo.entries = append(repo.entries[:1], repo.entries[2:]...)
+	result, err = service.VerifyChain()
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint(3), *result.BrokenAt)
+}
+
+func TestAuditService_ListForUserHidesStaff(t *testing.T) {
+	repo := &memoryAuditRepo{}
+	service := NewAuditService(repo)
+
+	require.NoError(t, service.Record(domain.AuditEventPasswordChanged, &domain.Actor{UserID: 2, IPAddress: "10.0.0.2"}, 2, ""))
+	require.NoError(t, service.Record(domain.AuditEventAdminPrefix+domain.AdminActionLockUser, &domain.Actor{UserID: 9, IPAddress: "10.0.0.9"}, 2, ""))
+	require.NoError(t, service.Record(domain.AuditEventPasswordChanged, &domain.Actor{UserID: 3}, 3, ""))
+
+	entries, err := service.ListForUser(2, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "admin.users.lock", entries[0].Event)
+	assert.Nil(t, entries[0].ActorID)
+	assert.Empty(t, entries[0].IPAddress)
+	assert.Equal(t, "10.0.0.2", entries[1].IPAddress)
+
+	// The stored entries keep the staff details
+	assert.Equal(t, "10.0.0.9", repo.entries[1].IPAddress)
+}
+
+func TestAuthService_AuditsFailedLoginsAndLockout(t *testing.T) {
+	user := testUser(t, 1, "user@example.com", domain.RoleUser)
+	env := newAdminTestEnv(t, user)
+	device := &domain.DeviceSession{IPAddress: "10.0.0.5", UserAgent: "curl", RequestID: "req-7"}
+
+	for i := 0; i < 5; i++ {
+		_, err := env.auth.Login(user.Email, "wrong-password", device)
+		assert.Error(t, err)
+	}
+
+	recorded := events(env.audit)
+	require.Len(t, recorded, 6)
+	assert.Equal(t, domain.AuditEventLoginFailed, recorded[0])
+	assert.Equal(t, domain.AuditEventAccountLocked, recorded[5])
+
+	locked := env.audit.entries[5]
+	assert.Equal(t, user.ID, *locked.TargetUserID)
+	assert.Nil(t, locked.ActorID, "an unauthenticated client is not an actor")
+	assert.Equal(t, "10.0.0.5", locked.IPAddress)
+	assert.Equal(t, "req-7", locked.RequestID)
+}
@@ -11,37 +11,94 @@ import (
 	"fowergram/pkg/errors"
 	"fowergram/pkg/geolocation"
 	"fowergram/pkg/security"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+	mfaChallengeTTL = 5 * time.Minute
+
+	mfaPendingPurpose = "mfa_pending"
+
+	// Medium-risk logins are confirmed with a code sent by email
+	loginVerificationPurpose = "login_verification"
+	loginVerificationTTL     = 10 * time.Minute
+
+	// LastActive of a session is written at most once a minute
+	sessionTouchInterval = time.Minute
+
+	// Geolocation is waited on longer when it feeds the risk check
+	locationLookupTimeout = 100 * time.Millisecond
+	riskLookupTimeout     = 500 * time.Millisecond
+
+	passwordResetPurpose   = "password_reset"
+	passwordResetTTL       = time.Hour
+	passwordResetCodeBytes = 24
+
+	magicLoginPurpose   = "magic_login"
+	magicLinkTTL        = 15 * time.Minute
+	magicLinkCooldown   = time.Minute
+	magicLinkTokenBytes = 24
 
-	"golang.org/x/crypto/bcrypt"
+	emailVerificationPurpose = "email_verification"
+	emailVerificationTTL     = 24 * time.Hour
+
+	// A new verification email can be requested once a minute, at most five times an hour
+	verificationResendCooldown = time.Minute
+	verificationResendWindow   = time.Hour
+	maxVerificationResends     = 5
 )
 
 type authService struct {
-	authRepo     ports.AuthRepository
-	emailService email.Service
-	geoService   geolocation.Service
-	cacheRepo    ports.CacheRepository
-	jwtSecret    string
+	authRepo         ports.AuthRepository
+	emailService     email.Service
+	geoService       geolocation.Service
+	cacheRepo        ports.CacheRepository
+	revocationRepo   ports.SessionRevocationRepository
+	twoFactorService ports.TwoFactorService
+	passkeyService   ports.PasskeyService
+	socialService    ports.SocialAuthService
+	auditService     ports.AuditService
+	rateLimitService ports.RateLimitService
+	riskScorer       *loginRiskScorer
+	keys             *security.KeyRing
+	hasher           security.PasswordHasher
+	passwordPolicy   *security.PasswordPolicy
 }
 
-func NewAuthService(ar ports.AuthRepository, es email.Service, gs geolocation.Service, cr ports.CacheRepository, secret string) ports.AuthService {
+func NewAuthService(ar ports.AuthRepository, es email.Service, gs geolocation.Service, cr ports.CacheRepository, rr ports.SessionRevocationRepository, tfs ports.TwoFactorService, pks ports.PasskeyService, sas ports.SocialAuthService, aus ports.AuditService, rls ports.RateLimitService, keys *security.KeyRing, ph security.PasswordHasher, pp *security.PasswordPolicy) ports.AuthService {
 	return &authService{
-		authRepo:     ar,
-		emailService: es,
-		geoService:   gs,
-		cacheRepo:    cr,
-		jwtSecret:    secret,
+		authRepo:         ar,
+		emailService:     es,
+		geoService:       gs,
+		cacheRepo:        cr,
+		revocationRepo:   rr,
+		twoFactorService: tfs,
+		passkeyService:   pks,
+		socialService:    sas,
+		auditService:     aus,
+		rateLimitService: rls,
+		riskScorer:       &loginRiskScorer{authRepo: ar},
+		keys:             keys,
+		hasher:           ph,
+		passwordPolicy:   pp,
 	}
 }
 
 func (s *authService) Register(user *domain.User) error {
 	startTime := time.Now()
 
-	// Hash password with lower cost for faster registration
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.PasswordHash), security.HashCost)
+	// PasswordHash still holds the plaintext password at this point
+	if err := s.passwordPolicy.Validate(user.PasswordHash, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	// Hash password
+	hashedPassword, err := s.hasher.Hash(user.PasswordHash)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
-	user.PasswordHash = string(hashedPassword)
+	user.PasswordHash = hashedPassword
 	hashTime := time.Since(startTime)
 	fmt.Printf("Password hashing took: %v\n", hashTime)
 
@@ -70,28 +127,8 @@ func (s *authService) Register(user *domain.User) error {
 			fmt.Printf("failed to cache user data: %v\n", err)
 		}
 
-		// Generate verification code
-		code, err := security.GenerateRandomCode(6)
-		if err != nil {
-			fmt.Printf("failed to generate verification code: %v\n", err)
-			return
-		}
-
-		// Create auth code
-		authCode := &domain.AuthCode{
-			UserID:    user.ID,
-			Code:      code,
-			Purpose:   "email_verification",
-			ExpiresAt: time.Now().Add(24 * time.Hour),
-		}
-		if err := s.authRepo.CreateAuthCode(authCode); err != nil {
-			fmt.Printf("failed to create auth code: %v\n", err)
-			return
-		}
-
-		// Send verification email
-		if err := s.emailService.SendVerificationEmail(user.Email, code); err != nil {
-			fmt.Printf("failed to send verification email: %v\n", err)
+		if err := s.sendVerificationCode(user); err != nil {
+			fmt.Printf("failed to send verification code: %v\n", err)
 		}
 	}()
 
@@ -101,9 +138,91 @@ func (s *authService) Register(user *domain.User) error {
 	return nil
 }
 
-func (s *authService) Login(email, password string, deviceInfo *domain.DeviceSession) (*domain.User, string, error) {
+// VerifyEmail consumes the email_verification code sent at registration
+func (s *authService) VerifyEmail(email, code string) error {
+	user, err := s.authRepo.FindUserByEmail(email)
+	if err != nil {
+		return errors.ErrInvalidVerificationCode
+	}
+
+	if user.IsEmailVerified {
+		return nil
+	}
+
+	if err := s.authRepo.ValidateAuthCode(user.ID, code, emailVerificationPurpose); err != nil {
+		return errors.ErrInvalidVerificationCode
+	}
+
+	user.IsEmailVerified = true
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to mark email as verified: %w", err)
+	}
+
+	if err := s.cacheRepo.Delete(fmt.Sprintf("user:%d", user.ID)); err != nil {
+		fmt.Printf("failed to clear user cache: %v\n", err)
+	}
+
+	return nil
+}
+
+// ResendVerificationEmail replaces the pending verification code. Unknown, already
+// verified and throttled addresses succeed silently so the endpoint cannot be used to
+// probe accounts.
+func (s *authService) ResendVerificationEmail(email string) error {
+	user, err := s.authRepo.FindUserByEmail(email)
+	if err != nil || user.IsEmailVerified {
+		return nil
+	}
+
+	now := time.Now()
+	recent, err := s.authRepo.CountAuthCodesSince(user.ID, emailVerificationPurpose, now.Add(-verificationResendCooldown))
+	if err != nil {
+		return fmt.Errorf("failed to check verification throttle: %w", err)
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	sent, err := s.authRepo.CountAuthCodesSince(user.ID, emailVerificationPurpose, now.Add(-verificationResendWindow))
+	if err != nil {
+		return fmt.Errorf("failed to check verification throttle: %w", err)
+	}
+	if sent >= maxVerificationResends {
+		return nil
+	}
+
+	return s.sendVerificationCode(user)
+}
+
+// sendVerificationCode issues a new code, invalidating any earlier one, and emails it
+func (s *authService) sendVerificationCode(user *domain.User) error {
+	code, err := security.GenerateRandomCode(6)
+	if err != nil {
+		return fmt.Errorf("failed to generate verification code: %w", err)
+	}
+
+	authCode := &domain.AuthCode{
+		UserID:    user.ID,
+		Code:      code,
+		Purpose:   emailVerificationPurpose,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}
+	if err := s.authRepo.CreateAuthCode(authCode); err != nil {
+		return fmt.Errorf("failed to create auth code: %w", err)
+	}
+
+	return s.emailService.SendVerificationEmail(user.Email, code)
+}
+
+func (s *authService) Login(email, password string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error) {
 	startTime := time.Now()
 
+	// An address that keeps failing against accounts is stopped before any account is looked at
+	if s.ipLockedOut(deviceInfo.IPAddress) {
+		s.audit(domain.AuditEventLoginFailed, 0, deviceActor(0, deviceInfo), "method=password reason=ip_locked")
+		return nil, errors.ErrTooManyRequests
+	}
+
 	// Try to get user from cache first with shorter timeout
 	cacheKey := fmt.Sprintf("user:email:%s", email)
 	var user *domain.User
@@ -134,7 +253,9 @@ func (s *authService) Login(email, password string, deviceInfo *domain.DeviceSes
 		var err error
 		user, err = s.authRepo.FindUserByEmail(email)
 		if err != nil {
-			return nil, "", &errors.AuthError{
+			s.audit(domain.AuditEventLoginFailed, 0, deviceActor(0, deviceInfo), "method=password reason=unknown_account")
+			s.registerIPFailure(deviceInfo.IPAddress)
+			return nil, &errors.AuthError{
 				Code:    "AUTH001",
 				Message: "Invalid email or password",
 			}
@@ -151,77 +272,429 @@ func (s *authService) Login(email, password string, deviceInfo *domain.DeviceSes
 	fmt.Printf("Database operations took: %v\n", dbTime)
 
 	// Check if account is locked
-	if user.AccountLockedUntil != nil && user.AccountLockedUntil.After(time.Now()) {
-		return nil, "", &errors.AuthError{
-			Code:    "AUTH002",
-			Message: "Account is locked due to too many failed attempts",
-		}
+	if err := s.checkLockout(user); err != nil {
+		s.audit(domain.AuditEventLoginFailed, user.ID, deviceActor(0, deviceInfo), "method=password reason=account_locked")
+		return nil, err
 	}
 
-	// Verify password with lower cost
+	// Verify password
 	pwStart := time.Now()
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		// Increment failed login attempts
-		user.FailedLoginAttempts++
-		now := time.Now()
-		user.LastFailedLogin = &now
+	match, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		fmt.Printf("failed to verify password hash: %v\n", err)
+	}
+	if !match {
+		return nil, s.registerFailedAttempt(user, deviceInfo, "method=password")
+	}
 
-		// Lock account if too many failed attempts
-		if user.FailedLoginAttempts >= 5 {
-			lockUntil := time.Now().Add(15 * time.Minute)
-			user.AccountLockedUntil = &lockUntil
+	// Upgrade hashes made with an older algorithm or weaker parameters while the
+	// plaintext is available
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		if rehashed, err := s.hasher.Hash(password); err != nil {
+			fmt.Printf("failed to rehash password: %v\n", err)
+		} else {
+			user.PasswordHash = rehashed
 		}
+	}
 
-		// Update user in database
-		if err := s.authRepo.UpdateUser(user); err != nil {
-			fmt.Printf("failed to update user failed attempts: %v\n", err)
+	// The password is right, but the login may still not come from the user
+	deviceInfo.Geo = s.lookupLocation(deviceInfo.IPAddress, riskLookupTimeout)
+	risk, err := s.riskScorer.Assess(user, deviceInfo, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if risk.Level == domain.RiskHigh {
+		return nil, s.blockLogin(user, deviceInfo, risk)
+	}
+	// A second factor already confirms a medium-risk login, and so does a device the
+	// user trusts. High-risk logins are blocked either way.
+	if risk.Level == domain.RiskMedium && !user.TwoFactorEnabled && !s.trustedDevice(user.ID, deviceInfo.DeviceID) {
+		return s.loginVerificationChallenge(user, deviceInfo, risk)
+	}
+
+	user.AccountLockedUntil = nil
+	user.LockReason = ""
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		fmt.Printf("failed to update user after login: %v\n", err)
+	}
+
+	pwTime := time.Since(pwStart)
+	fmt.Printf("Password verification took: %v\n", pwTime)
+
+	// Hold back tokens until the second factor is verified. Failures are only reset
+	// once it is, or the password alone would reset the count before every code guess.
+	if user.TwoFactorEnabled {
+		return s.twoFactorChallenge(user)
+	}
+
+	// Reset failed login attempts on successful login
+	s.clearFailures(user.ID)
+
+	result, err := s.completeLogin(user, deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	totalTime := time.Since(startTime)
+	fmt.Printf("Total auth service time: %v\n", totalTime)
+
+	return result, nil
+}
+
+// CompleteTwoFactorLogin finishes a login that was answered with an mfa_pending challenge
+func (s *authService) CompleteTwoFactorLogin(challengeToken, code string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error) {
+	userID, err := security.ValidateChallengeToken(challengeToken, mfaPendingPurpose, s.keys)
+	if err != nil {
+		return nil, errors.ErrInvalidToken
+	}
+
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactorService.ValidateTOTP(user.ID, code); err != nil {
+		if authErr := s.registerFailedAttempt(user, deviceInfo, "method=totp"); authErr == errors.ErrAccountLocked {
+			return nil, authErr
 		}
+		return nil, errors.ErrInvalidTwoFactorCode
+	}
 
-		// Update cache
-		go func() {
-			if err := s.cacheRepo.Set(cacheKey, user, 24*time.Hour); err != nil {
-				fmt.Printf("failed to update user cache: %v\n", err)
-			}
-		}()
+	// Reload the user since validating the code updates the stored TOTP step
+	user, err = s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
 
-		if user.AccountLockedUntil != nil {
-			return nil, "", &errors.AuthError{
-				Code:    "AUTH002",
-				Message: "Account is locked due to too many failed attempts",
-			}
+	s.clearFailures(user.ID)
+
+	return s.completeLogin(user, deviceInfo)
+}
+
+// CompleteLoginVerification finishes a login that was answered with a login_verification
+// challenge because it looked unusual
+func (s *authService) CompleteLoginVerification(challengeToken, code string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error) {
+	userID, err := security.ValidateChallengeToken(challengeToken, loginVerificationPurpose, s.keys)
+	if err != nil {
+		return nil, errors.ErrInvalidToken
+	}
+
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.ValidateLoginCode(user.ID, code); err != nil {
+		if authErr := s.registerFailedAttempt(user, deviceInfo, "method=email_code"); authErr == errors.ErrAccountLocked {
+			return nil, authErr
 		}
+		return nil, errors.ErrInvalidLoginCode
+	}
+
+	s.clearFailures(user.ID)
+
+	return s.completeLogin(user, deviceInfo)
+}
+
+// loginVerificationChallenge emails a code the user has to enter before the login
+// completes
+func (s *authService) loginVerificationChallenge(user *domain.User, deviceInfo *domain.DeviceSession, risk *domain.LoginRisk) (*domain.LoginResult, error) {
+	code, err := security.GenerateRandomCode(6)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate login verification code: %w", err)
+	}
+
+	authCode := &domain.AuthCode{
+		UserID:    user.ID,
+		Code:      code,
+		Purpose:   loginVerificationPurpose,
+		ExpiresAt: time.Now().Add(loginVerificationTTL),
+	}
+	if err := s.authRepo.CreateAuthCode(authCode); err != nil {
+		return nil, fmt.Errorf("failed to create auth code: %w", err)
+	}
+
+	challengeToken, err := security.GenerateChallengeToken(user.ID, loginVerificationPurpose, s.keys, loginVerificationTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge token: %w", err)
+	}
+
+	s.recordRiskyLogin(user, deviceInfo, risk, domain.LoginStatusChallenged, domain.AuditEventLoginChallenged)
+	if err := s.emailService.SendLoginVerificationEmail(user.Email, code, deviceInfo); err != nil {
+		return nil, fmt.Errorf("failed to send login verification email: %w", err)
+	}
+
+	return &domain.LoginResult{
+		User: user,
+		Challenge: &domain.LoginChallenge{
+			Type:      loginVerificationPurpose,
+			Token:     challengeToken,
+			ExpiresIn: int64(loginVerificationTTL.Seconds()),
+		},
+	}, nil
+}
+
+// blockLogin refuses a high-risk login and warns the user. The password was right, so
+// the email tells them to change it if the login was not theirs.
+func (s *authService) blockLogin(user *domain.User, deviceInfo *domain.DeviceSession, risk *domain.LoginRisk) error {
+	s.recordRiskyLogin(user, deviceInfo, risk, domain.LoginStatusBlocked, domain.AuditEventLoginBlocked)
+	if err := s.emailService.SendLoginBlockedEmail(user.Email, deviceInfo); err != nil {
+		fmt.Printf("failed to send login blocked email: %v\n", err)
+	}
+	return errors.ErrLoginBlocked
+}
+
+func (s *authService) recordRiskyLogin(user *domain.User, deviceInfo *domain.DeviceSession, risk *domain.LoginRisk, status, event string) {
+	s.logLogin(user.ID, deviceInfo, status)
+	details := fmt.Sprintf("score=%d signals=%s", risk.Score, strings.Join(risk.Signals, ","))
+	s.audit(event, user.ID, deviceActor(0, deviceInfo), details)
+}
 
-		return nil, "", &errors.AuthError{
-			Code:    "AUTH001",
-			Message: "Invalid email or password",
+func (s *authService) twoFactorChallenge(user *domain.User) (*domain.LoginResult, error) {
+	challengeToken, err := security.GenerateChallengeToken(user.ID, mfaPendingPurpose, s.keys, mfaChallengeTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge token: %w", err)
+	}
+	return &domain.LoginResult{
+		User: user,
+		Challenge: &domain.LoginChallenge{
+			Type:      mfaPendingPurpose,
+			Token:     challengeToken,
+			ExpiresIn: int64(mfaChallengeTTL.Seconds()),
+		},
+	}, nil
+}
+
+// RequestMagicLink emails a single-use login link. With bindDevice the returned binding
+// secret must be presented together with the link, so only the requesting device can use
+// it. Unknown emails get a binding too and no error, so the response reveals nothing.
+func (s *authService) RequestMagicLink(email string, bindDevice bool) (string, error) {
+	var binding string
+	if bindDevice {
+		var err error
+		if binding, err = security.GenerateRandomString(magicLinkTokenBytes); err != nil {
+			return "", fmt.Errorf("failed to generate device binding: %w", err)
 		}
 	}
 
-	// Reset failed login attempts on successful login
-	user.FailedLoginAttempts = 0
-	user.LastFailedLogin = nil
-	user.AccountLockedUntil = nil
-	if err := s.authRepo.UpdateUser(user); err != nil {
-		fmt.Printf("failed to reset failed attempts: %v\n", err)
+	user, err := s.authRepo.FindUserByEmail(email)
+	if err != nil {
+		return binding, nil
 	}
 
-	pwTime := time.Since(pwStart)
-	fmt.Printf("Password verification took: %v\n", pwTime)
+	recent, err := s.authRepo.CountAuthCodesSince(user.ID, magicLoginPurpose, time.Now().Add(-magicLinkCooldown))
+	if err != nil {
+		return "", fmt.Errorf("failed to check magic link throttle: %w", err)
+	}
+	if recent > 0 {
+		fmt.Printf("magic link for user %d throttled\n", user.ID)
+		return binding, nil
+	}
 
-	// Create a channel to receive location
-	locationChan := make(chan string, 1)
+	token, err := security.GenerateRandomString(magicLinkTokenBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate magic link token: %w", err)
+	}
 
-	// Get location from IP fully async
-	deviceInfo.SetLocation("Unknown") // Set default
-	go func() {
-		location, err := s.geoService.GetLocation(deviceInfo.IPAddress)
-		if err != nil {
-			fmt.Printf("failed to get location: %v\n", err)
-			locationChan <- "Unknown"
-			return
+	authCode := &domain.AuthCode{
+		UserID:    user.ID,
+		Code:      magicLinkHash(token, binding),
+		Purpose:   magicLoginPurpose,
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+	}
+	if err := s.authRepo.CreateAuthCode(authCode); err != nil {
+		return "", fmt.Errorf("failed to create magic link: %w", err)
+	}
+
+	if err := s.emailService.SendMagicLinkEmail(user.Email, token); err != nil {
+		fmt.Printf("failed to send magic link email: %v\n", err)
+	}
+	return binding, nil
+}
+
+// ConsumeMagicLink redeems a magic link and logs the user in exactly like Login does
+func (s *authService) ConsumeMagicLink(token, binding string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error) {
+	authCode, err := s.authRepo.ConsumeAuthCode(magicLinkHash(token, binding), magicLoginPurpose)
+	if err != nil {
+		return nil, errors.ErrInvalidMagicLink
+	}
+
+	user, err := s.authRepo.FindUserByID(authCode.UserID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+
+	// Following the link proves the user controls the address
+	if !user.IsEmailVerified {
+		user.IsEmailVerified = true
+		if err := s.authRepo.UpdateUser(user); err != nil {
+			fmt.Printf("failed to mark email as verified: %v\n", err)
 		}
-		locationChan <- location
-	}()
+	}
+
+	// The link replaces the password, not the second factor
+	if user.TwoFactorEnabled {
+		return s.twoFactorChallenge(user)
+	}
+
+	return s.completeLogin(user, deviceInfo)
+}
+
+// LoginWithPasskey finishes a passkey login. The passkey requires user verification on
+// the authenticator, so it already counts as two factors and no TOTP challenge follows.
+func (s *authService) LoginWithPasskey(ceremonyID string, response []byte, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error) {
+	user, err := s.passkeyService.FinishLogin(ceremonyID, response)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(user, deviceInfo)
+}
+
+// LoginWithProvider finishes a sign in with an external identity provider. The provider
+// only replaces the password, so two-factor authentication still applies.
+func (s *authService) LoginWithProvider(provider, state, code string, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error) {
+	user, err := s.socialService.CompleteLogin(provider, state, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return s.twoFactorChallenge(user)
+	}
+
+	return s.completeLogin(user, deviceInfo)
+}
+
+// magicLinkHash binds the stored hash to the device secret when there is one
+func magicLinkHash(token, binding string) string {
+	if binding == "" {
+		return security.HashToken(token)
+	}
+	return security.HashToken(token + ":" + binding)
+}
+
+// lockError reports why a locked account cannot sign in, or nil if it is not locked
+func lockError(user *domain.User) error {
+	if user.AccountLockedUntil == nil || !user.AccountLockedUntil.After(time.Now()) {
+		return nil
+	}
+	if user.LockReason != "" {
+		return errors.ErrAccountSuspended
+	}
+	return errors.ErrAccountLocked
+}
+
+// checkLockout reports why the user cannot sign in right now: a lock placed by staff,
+// or an automatic lockout after repeated failures
+func (s *authService) checkLockout(user *domain.User) error {
+	if err := lockError(user); err != nil {
+		return err
+	}
+
+	status, err := s.rateLimitService.Lockout(accountLockout, fmt.Sprintf("%d", user.ID))
+	if err != nil {
+		// Losing Redis must not stop every sign-in
+		fmt.Printf("failed to check account lockout: %v\n", err)
+		return nil
+	}
+	if status.Locked() {
+		return errors.ErrAccountLocked
+	}
+	return nil
+}
+
+// registerFailedAttempt counts a failed credential check against the account and the
+// client address, and locks the account out when needed
+func (s *authService) registerFailedAttempt(user *domain.User, deviceInfo *domain.DeviceSession, details string) error {
+	s.logLogin(user.ID, deviceInfo, domain.LoginStatusFailed)
+	s.audit(domain.AuditEventLoginFailed, user.ID, deviceActor(0, deviceInfo), details)
+	s.registerIPFailure(deviceInfo.IPAddress)
+
+	status, err := s.rateLimitService.RegisterFailure(accountLockout, fmt.Sprintf("%d", user.ID))
+	if err != nil {
+		fmt.Printf("failed to count failed attempt: %v\n", err)
+		return errors.ErrInvalidCredentials
+	}
+
+	if status.Locked() {
+		s.audit(domain.AuditEventAccountLocked, user.ID, deviceActor(0, deviceInfo), fmt.Sprintf("failed_attempts=%d locked_for=%s", status.Failures, status.LockedFor))
+		return errors.ErrAccountLocked
+	}
+
+	return errors.ErrInvalidCredentials
+}
+
+func (s *authService) registerIPFailure(ip string) {
+	if _, err := s.rateLimitService.RegisterFailure(ipLockout, ip); err != nil {
+		fmt.Printf("failed to count failed attempt from %s: %v\n", ip, err)
+	}
+}
+
+func (s *authService) ipLockedOut(ip string) bool {
+	status, err := s.rateLimitService.Lockout(ipLockout, ip)
+	if err != nil {
+		fmt.Printf("failed to check lockout of %s: %v\n", ip, err)
+		return false
+	}
+	return status.Locked()
+}
+
+// clearFailures forgets the account's failures after a successful sign-in. The address
+// keeps its count, one good login must not reset a credential stuffing run.
+func (s *authService) clearFailures(userID uint) {
+	if err := s.rateLimitService.ClearLockout(accountLockout, fmt.Sprintf("%d", userID)); err != nil {
+		fmt.Printf("failed to clear failed attempts: %v\n", err)
+	}
+}
+
+// completeLogin creates the device session, issues tokens and records the login
+func (s *authService) completeLogin(user *domain.User, deviceInfo *domain.DeviceSession) (*domain.LoginResult, error) {
+	// Staff forced a reset: no sign-in method works until the password is replaced
+	if user.PasswordResetRequired {
+		return nil, errors.ErrPasswordResetRequired
+	}
+
+	// Signing in during the grace period keeps the account
+	if user.DeletionScheduledAt != nil {
+		user.DeletionScheduledAt = nil
+		if err := s.authRepo.UpdateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to cancel account deletion: %w", err)
+		}
+		if err := s.cacheRepo.Delete(fmt.Sprintf("user:%d", user.ID)); err != nil {
+			fmt.Printf("failed to clear user cache: %v\n", err)
+		}
+		s.audit(domain.AuditEventDeletionCancelled, user.ID, deviceActor(user.ID, deviceInfo), "reason=login")
+	}
+
+	// The password flow already looked the location up for the risk check
+	if deviceInfo.Geo == nil {
+		deviceInfo.Geo = s.lookupLocation(deviceInfo.IPAddress, locationLookupTimeout)
+	}
+	deviceInfo.SetLocation("Unknown")
+	if deviceInfo.Geo != nil {
+		deviceInfo.SetLocation(deviceInfo.Geo.String())
+	}
 
 	// Generate device ID if not provided
 	if deviceInfo.DeviceID == "" {
@@ -234,37 +707,28 @@ func (s *authService) Login(email, password string, deviceInfo *domain.DeviceSes
 		}
 	}
 
-	// Generate JWT token
+	// Persist the device session so the refresh token family can be bound to it
+	deviceInfo.UserID = user.ID
+	deviceInfo.LastActive = time.Now()
+	if err := s.authRepo.CreateDeviceSession(deviceInfo); err != nil {
+		return nil, fmt.Errorf("failed to create device session: %w", err)
+	}
+
+	// Generate access and refresh tokens
 	tokenStart := time.Now()
-	token, err := s.generateJWT(user)
+	tokens, err := s.issueTokenPair(user, deviceInfo)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
 	}
 	tokenTime := time.Since(tokenStart)
 	fmt.Printf("Token generation took: %v\n", tokenTime)
 
-	// Wait for location with timeout
-	select {
-	case location := <-locationChan:
-		deviceInfo.SetLocation(location)
-	case <-time.After(100 * time.Millisecond):
-		// Use default "Unknown" if timeout
-	}
+	s.audit(domain.AuditEventLoginSucceeded, user.ID, deviceActor(user.ID, deviceInfo), fmt.Sprintf("session=%d", deviceInfo.ID))
 
 	// Log login and send notifications fully async
 	go func() {
 		// Log login
-		loginHistory := &domain.LoginHistory{
-			UserID:    user.ID,
-			DeviceID:  deviceInfo.DeviceID,
-			IPAddress: deviceInfo.IPAddress,
-			Location:  deviceInfo.GetLocation(), // Safe to access now
-			UserAgent: deviceInfo.UserAgent,
-			Status:    "success",
-		}
-		if err := s.authRepo.LogLogin(loginHistory); err != nil {
-			fmt.Printf("failed to log login: %v\n", err)
-		}
+		s.logLogin(user.ID, deviceInfo, domain.LoginStatusSuccess)
 
 		// Send notification
 		if err := s.emailService.SendLoginNotification(user.Email, deviceInfo); err != nil {
@@ -272,15 +736,15 @@ func (s *authService) Login(email, password string, deviceInfo *domain.DeviceSes
 		}
 	}()
 
-	totalTime := time.Since(startTime)
-	fmt.Printf("Total auth service time: %v\n", totalTime)
-
-	return user, token, nil
+	return &domain.LoginResult{
+		User:   user,
+		Tokens: tokens,
+	}, nil
 }
 
 func (s *authService) ValidateToken(token string) (*domain.User, error) {
 	// Validate JWT token
-	userID, err := security.ValidateJWT(token, s.jwtSecret)
+	userID, err := security.ValidateJWT(token, s.keys)
 	if err != nil {
 		return nil, errors.ErrInvalidToken
 	}
@@ -294,112 +758,538 @@ func (s *authService) ValidateToken(token string) (*domain.User, error) {
 	return user, nil
 }
 
-// RefreshToken creates a new access token if the refresh token is valid
-func (s *authService) RefreshToken(refreshToken string) (string, error) {
+// RefreshToken rotates a refresh token and returns a new access/refresh pair.
+// Presenting a token that was already rotated revokes its whole family.
+func (s *authService) RefreshToken(refreshToken string) (*domain.TokenPair, error) {
 	// Validate refresh token
-	userID, err := security.ValidateRefreshToken(refreshToken, s.jwtSecret)
+	claims, err := security.ValidateRefreshToken(refreshToken, s.keys)
 	if err != nil {
-		return "", errors.ErrInvalidRefreshToken
+		return nil, errors.ErrInvalidRefreshToken
+	}
+
+	stored, err := s.authRepo.FindRefreshToken(claims.Id)
+	if err != nil || stored.UserID != claims.UserID {
+		return nil, errors.ErrInvalidRefreshToken
+	}
+
+	if stored.RevokedAt != nil || stored.ExpiresAt.Before(time.Now()) {
+		return nil, errors.ErrInvalidRefreshToken
+	}
+
+	if stored.RotatedAt != nil {
+		s.revokeRefreshFamily(stored.FamilyID)
+		return nil, errors.ErrRefreshTokenReused
 	}
 
 	// Get user from database
-	user, err := s.authRepo.FindUserByID(userID)
+	user, err := s.authRepo.FindUserByID(stored.UserID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	next, err := newRefreshToken(user.ID, stored.DeviceSessionID, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authRepo.RotateRefreshToken(stored.TokenID, next); err != nil {
+		if err == errors.ErrRefreshTokenReused {
+			// Lost a race against another use of the same token
+			s.revokeRefreshFamily(stored.FamilyID)
+			return nil, errors.ErrRefreshTokenReused
+		}
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return s.signTokenPair(user, next)
+}
+
+func (s *authService) revokeRefreshFamily(familyID string) {
+	if err := s.authRepo.RevokeRefreshTokenFamily(familyID); err != nil {
+		fmt.Printf("failed to revoke refresh token family: %v\n", err)
+	}
+}
+
+// issueTokenPair starts a new refresh token family for the device session
+func (s *authService) issueTokenPair(user *domain.User, session *domain.DeviceSession) (*domain.TokenPair, error) {
+	familyID, err := security.GenerateRandomString(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token family: %w", err)
+	}
+
+	refresh, err := newRefreshToken(user.ID, session.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authRepo.CreateRefreshToken(refresh); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return s.signTokenPair(user, refresh)
+}
+
+func (s *authService) signTokenPair(user *domain.User, refresh *domain.RefreshToken) (*domain.TokenPair, error) {
+	accessToken, err := s.generateJWT(user, refresh.DeviceSessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	refreshToken, err := security.GenerateRefreshToken(user.ID, refresh.TokenID, s.keys, time.Until(refresh.ExpiresAt))
 	if err != nil {
-		return "", errors.ErrUserNotFound
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
-	// Generate new access token
-	newToken, err := s.generateJWT(user)
+	return &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func newRefreshToken(userID, sessionID uint, familyID string) (*domain.RefreshToken, error) {
+	tokenID, err := security.GenerateRandomString(32)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, fmt.Errorf("failed to generate refresh token ID: %w", err)
 	}
 
-	return newToken, nil
+	return &domain.RefreshToken{
+		UserID:          userID,
+		DeviceSessionID: sessionID,
+		FamilyID:        familyID,
+		TokenID:         tokenID,
+		ExpiresAt:       time.Now().Add(refreshTokenTTL),
+	}, nil
 }
 
-func (s *authService) generateJWT(user *domain.User) (string, error) {
+func (s *authService) generateJWT(user *domain.User, sessionID uint) (string, error) {
 	// Generate access token with 15 minutes expiration
-	return security.GenerateJWT(user.ID, s.jwtSecret, 15*time.Minute)
+	return security.GenerateJWT(user.ID, sessionID, s.keys, accessTokenTTL)
 }
 
 func (s *authService) ValidateLoginCode(userID uint, code string) error {
-	return s.authRepo.ValidateAuthCode(userID, code, "login_verification")
+	return s.authRepo.ValidateAuthCode(userID, code, loginVerificationPurpose)
+}
+
+func (s *authService) GetActiveSessions(userID, currentSessionID uint) ([]*domain.DeviceSession, error) {
+	sessions, err := s.authRepo.GetActiveSessions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+func (s *authService) UpdateDevice(userID, sessionID uint, req *domain.DeviceUpdateRequest, actor *domain.Actor) (*domain.DeviceSession, error) {
+	session, err := s.activeSession(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		session.DeviceName = strings.TrimSpace(*req.Name)
+	}
+	if req.Trusted != nil {
+		session.Trusted = *req.Trusted
+	}
+	if err := s.authRepo.UpdateDeviceSession(session); err != nil {
+		return nil, fmt.Errorf("failed to update device: %w", err)
+	}
+
+	s.audit(domain.AuditEventDeviceUpdated, userID, actor, fmt.Sprintf("device=%q name=%q trusted=%t", session.DeviceID, session.DeviceName, session.Trusted))
+	return session, nil
+}
+
+func (s *authService) RevokeDevice(userID, sessionID uint, actor *domain.Actor) error {
+	session, err := s.activeSession(userID, sessionID)
+	if err != nil {
+		return err
+	}
+	return s.RevokeSession(userID, session.DeviceID, actor)
 }
 
-func (s *authService) GetActiveSessions(userID uint) ([]*domain.DeviceSession, error) {
-	return s.authRepo.GetActiveSessions(userID)
+// TouchSession updates LastActive at most once per sessionTouchInterval, the cache
+// remembers recent updates so most requests do not write to the database
+func (s *authService) TouchSession(sessionID uint) error {
+	cacheKey := fmt.Sprintf("session:active:%d", sessionID)
+	if _, err := s.cacheRepo.Get(cacheKey); err == nil {
+		return nil
+	}
+
+	if err := s.authRepo.TouchDeviceSession(sessionID, time.Now()); err != nil {
+		return fmt.Errorf("failed to update session activity: %w", err)
+	}
+	if err := s.cacheRepo.Set(cacheKey, true, sessionTouchInterval); err != nil {
+		fmt.Printf("failed to cache session activity: %v\n", err)
+	}
+	return nil
+}
+
+// activeSession finds a signed in session of the user
+func (s *authService) activeSession(userID, sessionID uint) (*domain.DeviceSession, error) {
+	sessions, err := s.authRepo.GetActiveSessions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			return session, nil
+		}
+	}
+	return nil, errors.ErrDeviceNotFound
+}
+
+// trustedDevice reports whether the device the client identified itself as is signed in
+// and trusted. Devices without an ID are never trusted.
+func (s *authService) trustedDevice(userID uint, deviceID string) bool {
+	if deviceID == "" {
+		return false
+	}
+
+	sessions, err := s.authRepo.GetActiveSessions(userID)
+	if err != nil {
+		fmt.Printf("failed to check trusted devices: %v\n", err)
+		return false
+	}
+	for _, session := range sessions {
+		if session.DeviceID == deviceID && session.Trusted {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *authService) RevokeSession(userID uint, deviceID string, actor *domain.Actor) error {
+	sessions, err := s.authRepo.GetActiveSessions(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get active sessions: %w", err)
+	}
+
+	var sessionIDs []uint
+	for _, session := range sessions {
+		if session.DeviceID == deviceID {
+			sessionIDs = append(sessionIDs, session.ID)
+		}
+	}
+
+	if err := s.authRepo.RevokeSession(userID, deviceID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	s.markSessionsRevoked(userID, sessionIDs)
+	s.audit(domain.AuditEventSessionRevoked, userID, actor, fmt.Sprintf("device=%q", deviceID))
+	return nil
+}
+
+// LogoutSession revokes the session the caller is currently authenticated with
+func (s *authService) LogoutSession(userID, sessionID uint, actor *domain.Actor) error {
+	if err := s.revokeSessions(userID, []uint{sessionID}); err != nil {
+		return err
+	}
+
+	s.audit(domain.AuditEventSessionRevoked, userID, actor, fmt.Sprintf("session=%d", sessionID))
+	return nil
 }
 
-func (s *authService) RevokeSession(userID uint, deviceID string) error {
-	// Do the session revocation async since it's not critical for immediate logout
+// RevokeOtherSessions logs out every device except the current one
+func (s *authService) RevokeOtherSessions(userID, currentSessionID uint, actor *domain.Actor) error {
+	if err := s.revokeOtherSessions(userID, currentSessionID); err != nil {
+		return err
+	}
+
+	s.audit(domain.AuditEventSessionsRevoked, userID, actor, "scope=others")
+	return nil
+}
+
+// RevokeAllSessions logs out every device including the current one
+func (s *authService) RevokeAllSessions(userID uint, actor *domain.Actor) error {
+	if err := s.revokeOtherSessions(userID, 0); err != nil {
+		return err
+	}
+
+	s.audit(domain.AuditEventSessionsRevoked, userID, actor, "scope=all")
+	return nil
+}
+
+// revokeOtherSessions revokes every session except currentSessionID, or all of them
+// when it is zero
+func (s *authService) revokeOtherSessions(userID, currentSessionID uint) error {
+	sessions, err := s.authRepo.GetActiveSessions(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get active sessions: %w", err)
+	}
+
+	var sessionIDs []uint
+	for _, session := range sessions {
+		if session.ID != currentSessionID {
+			sessionIDs = append(sessionIDs, session.ID)
+		}
+	}
+
+	return s.revokeSessions(userID, sessionIDs)
+}
+
+func (s *authService) revokeSessions(userID uint, sessionIDs []uint) error {
+	if err := s.authRepo.RevokeSessionsByID(userID, sessionIDs); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.markSessionsRevoked(userID, sessionIDs)
+	return nil
+}
+
+// logLogin writes a login history row, which the risk check compares later logins with
+func (s *authService) logLogin(userID uint, deviceInfo *domain.DeviceSession, status string) {
+	history := &domain.LoginHistory{
+		UserID:    userID,
+		DeviceID:  deviceInfo.DeviceID,
+		IPAddress: deviceInfo.IPAddress,
+		Location:  deviceInfo.GetLocation(),
+		UserAgent: deviceInfo.UserAgent,
+		Status:    status,
+	}
+	if geo := deviceInfo.Geo; geo != nil {
+		history.CountryCode = geo.CountryCode
+		history.Latitude = geo.Latitude
+		history.Longitude = geo.Longitude
+	}
+	if err := s.authRepo.LogLogin(history); err != nil {
+		fmt.Printf("failed to log login: %v\n", err)
+	}
+}
+
+// lookupLocation gives up on the geolocation service after timeout, a slow service
+// must not hold up logins
+func (s *authService) lookupLocation(ip string, timeout time.Duration) *domain.GeoLocation {
+	result := make(chan *domain.GeoLocation, 1)
 	go func() {
-		if err := s.authRepo.RevokeSession(userID, deviceID); err != nil {
-			fmt.Printf("failed to revoke session: %v\n", err)
+		location, err := s.geoService.Lookup(ip)
+		if err != nil {
+			fmt.Printf("failed to get location: %v\n", err)
 		}
+		result <- location
 	}()
 
+	select {
+	case location := <-result:
+		return location
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// audit records a security event. A failure is logged rather than returned, an audit
+// outage must not lock users out of their accounts.
+func (s *authService) audit(event string, targetUserID uint, actor *domain.Actor, details string) {
+	if err := s.auditService.Record(event, actor, targetUserID, details); err != nil {
+		fmt.Printf("failed to record %s audit event: %v\n", event, err)
+	}
+}
+
+// deviceActor describes the client behind a login attempt. userID stays zero until the
+// client has proven who it is.
+func deviceActor(userID uint, deviceInfo *domain.DeviceSession) *domain.Actor {
+	return &domain.Actor{
+		UserID:    userID,
+		IPAddress: deviceInfo.IPAddress,
+		UserAgent: deviceInfo.UserAgent,
+		RequestID: deviceInfo.RequestID,
+	}
+}
+
+// markSessionsRevoked makes already issued access tokens of the sessions unusable
+func (s *authService) markSessionsRevoked(userID uint, sessionIDs []uint) {
+	for _, sessionID := range sessionIDs {
+		if err := s.revocationRepo.RevokeSession(sessionID, accessTokenTTL); err != nil {
+			fmt.Printf("failed to add session %d to revocation set: %v\n", sessionID, err)
+		}
+	}
+
 	// Clear user cache immediately
 	cacheKey := fmt.Sprintf("user:%d", userID)
 	if err := s.cacheRepo.Delete(cacheKey); err != nil {
 		fmt.Printf("failed to clear user cache: %v\n", err)
 	}
-
-	return nil
 }
 
 func (s *authService) GetLoginHistory(userID uint) ([]*domain.LoginHistory, error) {
 	return s.authRepo.GetLoginHistory(userID)
 }
 
+// InitiateAccountRecovery emails a single-use reset code. It succeeds for unknown
+// addresses too so the response does not reveal which emails are registered.
 func (s *authService) InitiateAccountRecovery(email string) error {
 	user, err := s.authRepo.FindUserByEmail(email)
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return nil
 	}
 
-	code, err := security.GenerateRandomCode(6)
+	code, err := security.GenerateRandomString(passwordResetCodeBytes)
 	if err != nil {
 		return fmt.Errorf("failed to generate recovery code: %w", err)
 	}
+
 	recovery := &domain.AccountRecovery{
 		UserID:      user.ID,
-		RequestType: "password_reset",
-		Status:      "pending",
-		ExpiresAt:   time.Now().Add(7 * 24 * time.Hour),
+		RequestType: passwordResetPurpose,
+		Status:      domain.RecoveryStatusPending,
+		ExpiresAt:   time.Now().Add(passwordResetTTL),
 	}
-
 	if err := s.authRepo.CreateAccountRecovery(recovery); err != nil {
 		return fmt.Errorf("failed to create recovery request: %w", err)
 	}
 
-	return s.emailService.SendPasswordResetEmail(email, code)
+	// Only the hash is stored, the code itself exists solely in the email
+	authCode := &domain.AuthCode{
+		UserID:    user.ID,
+		Code:      security.HashToken(code),
+		Purpose:   passwordResetPurpose,
+		ExpiresAt: recovery.ExpiresAt,
+	}
+	if err := s.authRepo.CreateAuthCode(authCode); err != nil {
+		return fmt.Errorf("failed to create recovery code: %w", err)
+	}
+
+	if err := s.emailService.SendPasswordResetEmail(user.Email, code); err != nil {
+		fmt.Printf("failed to send password reset email: %v\n", err)
+	}
+	return nil
 }
 
+// ValidateRecoveryCode checks the code without consuming it and marks the request verified
 func (s *authService) ValidateRecoveryCode(email, code string) error {
-	user, err := s.authRepo.FindUserByEmail(email)
+	user, recovery, err := s.activeRecovery(email)
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return err
 	}
-	return s.authRepo.ValidateAuthCode(user.ID, code, "password_reset")
+
+	if _, err := s.authRepo.FindAuthCode(user.ID, security.HashToken(code), passwordResetPurpose); err != nil {
+		return errors.ErrInvalidResetCode
+	}
+
+	if recovery.Status == domain.RecoveryStatusPending {
+		now := time.Now()
+		recovery.Status = domain.RecoveryStatusVerified
+		recovery.VerifiedAt = &now
+		if err := s.authRepo.UpdateAccountRecovery(recovery); err != nil {
+			return fmt.Errorf("failed to update recovery request: %w", err)
+		}
+	}
+
+	return nil
 }
 
-func (s *authService) ResetPassword(email, code, newPassword string) error {
-	user, err := s.authRepo.FindUserByEmail(email)
+// ResetPassword consumes the code, sets the new password and signs out every device
+func (s *authService) ResetPassword(email, code, newPassword string, actor *domain.Actor) error {
+	user, recovery, err := s.activeRecovery(email)
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return err
 	}
 
-	if err := s.authRepo.ValidateAuthCode(user.ID, code, "password_reset"); err != nil {
+	// Check the policy first so a rejected password does not burn the code
+	if err := s.passwordPolicy.Validate(newPassword, user.Username, user.Email); err != nil {
 		return err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err := s.authRepo.ValidateAuthCode(user.ID, security.HashToken(code), passwordResetPurpose); err != nil {
+		return errors.ErrInvalidResetCode
+	}
+
+	hashedPassword, err := s.hasher.Hash(newPassword)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	user.PasswordHash = string(hashedPassword)
-	return s.authRepo.UpdateUser(user)
+	user.PasswordHash = hashedPassword
+	user.PasswordResetRequired = false
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	// A reset ends an automatic lockout but not a lock placed by staff
+	s.clearFailures(user.ID)
+
+	now := time.Now()
+	if recovery.VerifiedAt == nil {
+		recovery.VerifiedAt = &now
+	}
+	recovery.Status = domain.RecoveryStatusCompleted
+	recovery.CompletedAt = &now
+	if err := s.authRepo.UpdateAccountRecovery(recovery); err != nil {
+		fmt.Printf("failed to complete recovery request: %v\n", err)
+	}
+
+	// Anyone who knew the old password must lose access
+	if err := s.revokeOtherSessions(user.ID, 0); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.audit(domain.AuditEventPasswordReset, user.ID, actor, "sessions=all_revoked")
+	return nil
+}
+
+// ChangePassword replaces the password of a signed-in user and signs out their other devices
+func (s *authService) ChangePassword(userID, sessionID uint, currentPassword, newPassword string, actor *domain.Actor) error {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return errors.ErrUserNotFound
+	}
+
+	match, err := s.hasher.Verify(currentPassword, user.PasswordHash)
+	if err != nil {
+		fmt.Printf("failed to verify password hash: %v\n", err)
+	}
+	if !match {
+		return errors.ErrInvalidCredentials
+	}
+
+	if err := s.passwordPolicy.Validate(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user.PasswordHash = hashedPassword
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err := s.revokeOtherSessions(user.ID, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.audit(domain.AuditEventPasswordChanged, user.ID, actor, "sessions=others_revoked")
+	return nil
+}
+
+// activeRecovery loads the open password reset request for the email. Every failure maps
+// to the same error so callers cannot tell unknown accounts from wrong codes.
+func (s *authService) activeRecovery(email string) (*domain.User, *domain.AccountRecovery, error) {
+	user, err := s.authRepo.FindUserByEmail(email)
+	if err != nil {
+		return nil, nil, errors.ErrInvalidResetCode
+	}
+
+	recovery, err := s.authRepo.FindActiveAccountRecovery(user.ID, passwordResetPurpose)
+	if err != nil {
+		return nil, nil, errors.ErrInvalidResetCode
+	}
+
+	if time.Now().After(recovery.ExpiresAt) {
+		recovery.Status = domain.RecoveryStatusExpired
+		if err := s.authRepo.UpdateAccountRecovery(recovery); err != nil {
+			fmt.Printf("failed to expire recovery request: %v\n", err)
+		}
+		return nil, nil, errors.ErrInvalidResetCode
+	}
+
+	return user, recovery, nil
 }
 
 func (s *authService) UpdateRecoveryEmail(userID uint, email string) error {
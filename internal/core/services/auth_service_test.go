@@ -2,10 +2,14 @@ package services
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/pagination"
+	"fowergram/pkg/security"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -66,12 +70,41 @@ func (m *MockCacheRepo) Delete(key string) error {
 	return args.Error(0)
 }
 
+type MockRevocationRepo struct {
+	mock.Mock
+}
+
+func (m *MockRevocationRepo) RevokeSession(sessionID uint, ttl time.Duration) error {
+	args := m.Called(sessionID, ttl)
+	return args.Error(0)
+}
+
+func (m *MockRevocationRepo) IsSessionRevoked(sessionID uint) (bool, error) {
+	args := m.Called(sessionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func newTestKeyRing(t *testing.T) *security.KeyRing {
+	keys := security.NewKeyRing()
+	key, err := security.GenerateSigningKey("test", security.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.AddKey(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetSigningKey("test"); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
 func TestAuthService_Register(t *testing.T) {
 	mockRepo := new(MockAuthRepo)
 	mockEmail := new(MockEmailService)
 	mockGeo := new(MockGeoService)
 	mockCache := new(MockCacheRepo)
-	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, "secret")
+	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
 
 	tests := []struct {
 		name    string
@@ -84,7 +117,7 @@ func TestAuthService_Register(t *testing.T) {
 			user: &domain.User{
 				Username:     "testuser",
 				Email:        "test@example.com",
-				PasswordHash: "Test123!",
+				PasswordHash: "Vq7#mLp2!xR9",
 			},
 			wantErr: false,
 			setup: func() {
@@ -99,13 +132,23 @@ func TestAuthService_Register(t *testing.T) {
 			user: &domain.User{
 				Username:     "testuser2",
 				Email:        "existing@example.com",
-				PasswordHash: "Test123!",
+				PasswordHash: "Vq7#mLp2!xR9",
 			},
 			wantErr: true,
 			setup: func() {
 				mockRepo.On("CreateUser", mock.AnythingOfType("*domain.User")).Return(fmt.Errorf("duplicate key value"))
 			},
 		},
+		{
+			name: "weak password",
+			user: &domain.User{
+				Username:     "testuser3",
+				Email:        "weak@example.com",
+				PasswordHash: "Test123!",
+			},
+			wantErr: true,
+			setup:   func() {},
+		},
 	}
 
 	for _, tt := range tests {
@@ -135,7 +178,7 @@ func TestAuthService_Login(t *testing.T) {
 	mockEmail := new(MockEmailService)
 	mockGeo := new(MockGeoService)
 	mockCache := new(MockCacheRepo)
-	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, "secret")
+	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
 
 	// Create test user with hashed password
 	password := "Test123!"
@@ -169,9 +212,13 @@ func TestAuthService_Login(t *testing.T) {
 				mockRepo.On("CreateLoginHistory", mock.AnythingOfType("*domain.LoginHistory")).Return(nil)
 				mockRepo.On("LogLogin", mock.AnythingOfType("*domain.LoginHistory")).Return(nil)
 				mockRepo.On("CreateDeviceSession", mock.AnythingOfType("*domain.DeviceSession")).Return(nil)
+				mockRepo.On("CreateRefreshToken", mock.AnythingOfType("*domain.RefreshToken")).Return(nil)
+				mockRepo.On("CountFailedLoginsFromIP", "127.0.0.1", mock.Anything).Return(int64(0), nil)
+				mockRepo.On("FindSuccessfulLogins", uint(1), riskHistorySize).Return([]*domain.LoginHistory{}, nil)
+				mockRepo.On("CountLoginAttempts", uint(1)).Return(int64(0), nil)
 
 				// Setup geo service mock
-				mockGeo.On("GetLocation", mock.AnythingOfType("string")).Return("Test Location", nil)
+				mockGeo.On("Lookup", mock.AnythingOfType("string")).Return(&domain.GeoLocation{City: "Test", Country: "Location"}, nil)
 
 				// Setup email service mock
 				mockEmail.On("SendLoginNotification", mock.AnythingOfType("string"), mock.AnythingOfType("*domain.DeviceSession")).Return(nil)
@@ -188,7 +235,7 @@ func TestAuthService_Login(t *testing.T) {
 			mockGeo.ExpectedCalls = nil
 			tt.setup()
 
-			_, _, err := service.Login(tt.email, tt.pass, &domain.DeviceSession{
+			result, err := service.Login(tt.email, tt.pass, &domain.DeviceSession{
 				DeviceType: "Browser",
 				IPAddress:  "127.0.0.1",
 			})
@@ -196,9 +243,60 @@ func TestAuthService_Login(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
+				assert.NotEmpty(t, result.Tokens.AccessToken)
+				assert.NotEmpty(t, result.Tokens.RefreshToken)
 			}
 		})
 	}
+
+	// The legacy bcrypt hash is upgraded in place after a successful login
+	assert.True(t, strings.HasPrefix(testUser.PasswordHash, "$argon2id$"))
+	assert.NoError(t, security.VerifyPassword(password, testUser.PasswordHash))
+}
+
+func TestAuthService_Login_PasswordKeepsTwoFactorFailures(t *testing.T) {
+	mockRepo := NewMockAuthRepo()
+	mockCache := new(MockCacheRepo)
+	mockGeo := new(MockGeoService)
+	limits := newTestRateLimitService()
+	service := NewAuthService(mockRepo, new(MockEmailService), mockGeo, mockCache, new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), limits, newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	hash, err := security.DefaultPasswordHasher().Hash("Test123!")
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: hash, TwoFactorEnabled: true}
+	mockRepo.users[user.Email] = user
+
+	mockCache.On("Get", "user:email:test@example.com").Return(user, nil)
+	mockRepo.On("UpdateUser", user).Return(nil)
+	mockRepo.On("FindSuccessfulLogins", uint(1), riskHistorySize).Return([]*domain.LoginHistory{}, nil)
+	mockRepo.On("CountLoginAttempts", uint(1)).Return(int64(0), nil)
+	mockRepo.On("LogLogin", mock.AnythingOfType("*domain.LoginHistory")).Return(nil)
+	mockRepo.On("CountFailedLoginsFromIP", "127.0.0.1", mock.Anything).Return(int64(0), nil)
+	mockRepo.On("UseBackupCode", uint(1), mock.Anything).Return(fmt.Errorf("invalid backup code"))
+	mockGeo.On("Lookup", mock.AnythingOfType("string")).Return(&domain.GeoLocation{City: "Test", Country: "Location"}, nil)
+
+	device := func() *domain.DeviceSession {
+		return &domain.DeviceSession{DeviceType: "Browser", IPAddress: "127.0.0.1"}
+	}
+
+	// Each guess is preceded by a fresh password login, which must not reset the count
+	for i := int64(1); i < accountLockout.Threshold; i++ {
+		result, err := service.Login("test@example.com", "Test123!", device())
+		assert.NoError(t, err)
+		assert.Equal(t, mfaPendingPurpose, result.Challenge.Type)
+
+		_, err = service.CompleteTwoFactorLogin(result.Challenge.Token, "wrong-code", device())
+		assert.Equal(t, errors.ErrInvalidTwoFactorCode, err)
+
+		lockout, err := limits.Lockout(accountLockout, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, i, lockout.Failures)
+	}
+
+	result, err := service.Login("test@example.com", "Test123!", device())
+	assert.NoError(t, err)
+	_, err = service.CompleteTwoFactorLogin(result.Challenge.Token, "wrong-code", device())
+	assert.Equal(t, errors.ErrAccountLocked, err)
 }
 
 func TestAuthService_ValidateLoginCode(t *testing.T) {
@@ -206,7 +304,7 @@ func TestAuthService_ValidateLoginCode(t *testing.T) {
 	mockEmail := new(MockEmailService)
 	mockGeo := new(MockGeoService)
 	mockCache := new(MockCacheRepo)
-	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, "secret")
+	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
 
 	tests := []struct {
 		name    string
@@ -251,12 +349,96 @@ func TestAuthService_ValidateLoginCode(t *testing.T) {
 	}
 }
 
+func TestAuthService_VerifyEmail(t *testing.T) {
+	mockRepo := new(MockAuthRepo)
+	mockCache := new(MockCacheRepo)
+	service := NewAuthService(mockRepo, new(MockEmailService), new(MockGeoService), mockCache, new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	user := &domain.User{ID: 1, Email: "test@example.com"}
+	mockRepo.On("FindUserByEmail", "test@example.com").Return(user, nil)
+	mockRepo.On("ValidateAuthCode", uint(1), "000000", "email_verification").Return(fmt.Errorf("invalid or expired code"))
+	mockRepo.On("ValidateAuthCode", uint(1), "a1b2c3", "email_verification").Return(nil)
+	mockRepo.On("UpdateUser", user).Return(nil)
+	mockCache.On("Delete", "user:1").Return(nil)
+
+	err := service.VerifyEmail("test@example.com", "000000")
+	assert.Equal(t, errors.ErrInvalidVerificationCode, err)
+	assert.False(t, user.IsEmailVerified)
+
+	assert.NoError(t, service.VerifyEmail("test@example.com", "a1b2c3"))
+	assert.True(t, user.IsEmailVerified)
+
+	// Verifying again is a no-op
+	assert.NoError(t, service.VerifyEmail("test@example.com", "a1b2c3"))
+	mockRepo.AssertNumberOfCalls(t, "UpdateUser", 1)
+}
+
+func TestAuthService_ResendVerificationEmail(t *testing.T) {
+	mockRepo := new(MockAuthRepo)
+	mockEmail := new(MockEmailService)
+	service := NewAuthService(mockRepo, mockEmail, new(MockGeoService), new(MockCacheRepo), new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	tests := []struct {
+		name     string
+		cooldown int64
+		window   int64
+		wantSent bool
+	}{
+		{name: "sends new code", cooldown: 0, window: 1, wantSent: true},
+		{name: "within cooldown", cooldown: 1, window: 1},
+		{name: "hourly limit reached", cooldown: 0, window: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+			mockEmail.ExpectedCalls = nil
+			mockEmail.Calls = nil
+
+			now := time.Now()
+			isCooldown := mock.MatchedBy(func(since time.Time) bool { return since.After(now.Add(-2 * time.Minute)) })
+			isWindow := mock.MatchedBy(func(since time.Time) bool { return since.Before(now.Add(-2 * time.Minute)) })
+
+			mockRepo.On("FindUserByEmail", "test@example.com").Return(&domain.User{ID: 1, Email: "test@example.com"}, nil)
+			mockRepo.On("CountAuthCodesSince", uint(1), "email_verification", isCooldown).Return(tt.cooldown, nil)
+			mockRepo.On("CountAuthCodesSince", uint(1), "email_verification", isWindow).Return(tt.window, nil)
+			mockRepo.On("CreateAuthCode", mock.AnythingOfType("*domain.AuthCode")).Return(nil)
+			mockEmail.On("SendVerificationEmail", "test@example.com", mock.Anything).Return(nil)
+
+			assert.NoError(t, service.ResendVerificationEmail("test@example.com"))
+
+			if tt.wantSent {
+				mockEmail.AssertCalled(t, "SendVerificationEmail", "test@example.com", mock.Anything)
+			} else {
+				mockEmail.AssertNotCalled(t, "SendVerificationEmail", "test@example.com", mock.Anything)
+			}
+		})
+	}
+
+	// A throttled account must answer exactly like an unknown address, or a second
+	// resend would reveal that an unverified account exists
+	t.Run("unknown and throttled emails look the same", func(t *testing.T) {
+		mockRepo.ExpectedCalls = nil
+		mockEmail.Calls = nil
+		mockRepo.On("FindUserByEmail", "nobody@example.com").Return(nil, fmt.Errorf("user not found"))
+		mockRepo.On("FindUserByEmail", "test@example.com").Return(&domain.User{ID: 1, Email: "test@example.com"}, nil)
+		mockRepo.On("CountAuthCodesSince", uint(1), "email_verification", mock.Anything).Return(int64(1), nil)
+
+		unknown := service.ResendVerificationEmail("nobody@example.com")
+		throttled := service.ResendVerificationEmail("test@example.com")
+		assert.NoError(t, unknown)
+		assert.Equal(t, unknown, throttled)
+		mockEmail.AssertNotCalled(t, "SendVerificationEmail", mock.Anything, mock.Anything)
+	})
+}
+
 func TestAuthService_InitiateAccountRecovery(t *testing.T) {
 	mockRepo := new(MockAuthRepo)
 	mockEmail := new(MockEmailService)
 	mockGeo := new(MockGeoService)
 	mockCache := new(MockCacheRepo)
-	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, "secret")
+	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
 
 	tests := []struct {
 		name    string
@@ -274,13 +456,15 @@ func TestAuthService_InitiateAccountRecovery(t *testing.T) {
 					Email: "test@example.com",
 				}, nil)
 				mockRepo.On("CreateAccountRecovery", mock.AnythingOfType("*domain.AccountRecovery")).Return(nil)
+				mockRepo.On("CreateAuthCode", mock.AnythingOfType("*domain.AuthCode")).Return(nil)
 				mockEmail.On("SendPasswordResetEmail", "test@example.com", mock.Anything).Return(nil)
 			},
 		},
 		{
+			// Unknown emails must look exactly like registered ones
 			name:    "user not found",
 			email:   "nonexistent@example.com",
-			wantErr: true,
+			wantErr: false,
 			setup: func() {
 				mockRepo.On("FindUserByEmail", "nonexistent@example.com").
 					Return(nil, fmt.Errorf("user not found"))
@@ -304,6 +488,306 @@ func TestAuthService_InitiateAccountRecovery(t *testing.T) {
 	}
 }
 
+func TestAuthService_ResetPassword(t *testing.T) {
+	mockRepo := new(MockAuthRepo)
+	mockEmail := new(MockEmailService)
+	mockCache := new(MockCacheRepo)
+	mockRevocations := new(MockRevocationRepo)
+	limits := newTestRateLimitService()
+	service := NewAuthService(mockRepo, mockEmail, new(MockGeoService), mockCache, mockRevocations, NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), limits, newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	user := &domain.User{ID: 1, Email: "test@example.com"}
+	for i := int64(0); i < accountLockout.Threshold; i++ {
+		_, err := limits.RegisterFailure(accountLockout, "1")
+		assert.NoError(t, err)
+	}
+
+	var sentCode string
+	var storedCode *domain.AuthCode
+	var recovery *domain.AccountRecovery
+	mockRepo.On("FindUserByEmail", "test@example.com").Return(user, nil)
+	mockRepo.On("CreateAccountRecovery", mock.AnythingOfType("*domain.AccountRecovery")).
+		Run(func(args mock.Arguments) { recovery = args.Get(0).(*domain.AccountRecovery) }).Return(nil)
+	mockRepo.On("CreateAuthCode", mock.AnythingOfType("*domain.AuthCode")).
+		Run(func(args mock.Arguments) { storedCode = args.Get(0).(*domain.AuthCode) }).Return(nil)
+	mockEmail.On("SendPasswordResetEmail", "test@example.com", mock.Anything).
+		Run(func(args mock.Arguments) { sentCode = args.String(1) }).Return(nil)
+
+	assert.NoError(t, service.InitiateAccountRecovery("test@example.com"))
+	assert.Equal(t, domain.RecoveryStatusPending, recovery.Status)
+	assert.NotEqual(t, sentCode, storedCode.Code, "reset codes must be stored hashed")
+	assert.Equal(t, security.HashToken(sentCode), storedCode.Code)
+
+	mockRepo.On("FindActiveAccountRecovery", uint(1), "password_reset").Return(recovery, nil)
+	mockRepo.On("FindAuthCode", uint(1), storedCode.Code, "password_reset").Return(storedCode, nil)
+	mockRepo.On("FindAuthCode", uint(1), mock.Anything, "password_reset").Return(nil, fmt.Errorf("invalid or expired code"))
+	mockRepo.On("UpdateAccountRecovery", recovery).Return(nil)
+
+	assert.Equal(t, errors.ErrInvalidResetCode, service.ValidateRecoveryCode("test@example.com", "wrong"))
+	assert.NoError(t, service.ValidateRecoveryCode("test@example.com", sentCode))
+	assert.Equal(t, domain.RecoveryStatusVerified, recovery.Status)
+
+	mockRepo.On("ValidateAuthCode", uint(1), storedCode.Code, "password_reset").Return(nil).Once()
+	mockRepo.On("UpdateUser", user).Return(nil)
+	mockRepo.On("GetActiveSessions", uint(1)).Return([]*domain.DeviceSession{{ID: 7, UserID: 1}, {ID: 8, UserID: 1}}, nil)
+	mockRepo.On("RevokeSessionsByID", uint(1), []uint{7, 8}).Return(nil)
+	mockRevocations.On("RevokeSession", mock.Anything, accessTokenTTL).Return(nil)
+	mockCache.On("Delete", "user:1").Return(nil)
+
+	assert.NoError(t, service.ResetPassword("test@example.com", sentCode, "new-password-123", nil))
+	assert.Equal(t, domain.RecoveryStatusCompleted, recovery.Status)
+	assert.NotNil(t, recovery.CompletedAt)
+	lockout, err := limits.Lockout(accountLockout, "1")
+	assert.NoError(t, err)
+	assert.False(t, lockout.Locked())
+	assert.NoError(t, security.VerifyPassword("new-password-123", user.PasswordHash))
+	mockRepo.AssertCalled(t, "RevokeSessionsByID", uint(1), []uint{7, 8})
+	mockRevocations.AssertNumberOfCalls(t, "RevokeSession", 2)
+
+	// The code is single-use
+	mockRepo.On("ValidateAuthCode", uint(1), storedCode.Code, "password_reset").Return(fmt.Errorf("invalid or expired code"))
+	assert.Equal(t, errors.ErrInvalidResetCode, service.ResetPassword("test@example.com", sentCode, "another-password", nil))
+}
+
+func TestAuthService_ResetPassword_ExpiredRequest(t *testing.T) {
+	mockRepo := new(MockAuthRepo)
+	service := NewAuthService(mockRepo, new(MockEmailService), new(MockGeoService), new(MockCacheRepo), new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	recovery := &domain.AccountRecovery{ID: 1, UserID: 1, Status: domain.RecoveryStatusPending, ExpiresAt: time.Now().Add(-time.Minute)}
+	mockRepo.On("FindUserByEmail", "test@example.com").Return(&domain.User{ID: 1, Email: "test@example.com"}, nil)
+	mockRepo.On("FindActiveAccountRecovery", uint(1), "password_reset").Return(recovery, nil)
+	mockRepo.On("UpdateAccountRecovery", recovery).Return(nil)
+
+	err := service.ResetPassword("test@example.com", "code", "new-password-123", nil)
+	assert.Equal(t, errors.ErrInvalidResetCode, err)
+	assert.Equal(t, domain.RecoveryStatusExpired, recovery.Status)
+	mockRepo.AssertNotCalled(t, "ValidateAuthCode", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAuthService_MagicLink(t *testing.T) {
+	mockRepo := NewMockAuthRepo()
+	mockEmail := new(MockEmailService)
+	mockGeo := new(MockGeoService)
+	mockCache := new(MockCacheRepo)
+	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	user := &domain.User{ID: 1, Email: "test@example.com"}
+	mockRepo.users[user.Email] = user
+
+	var token string
+	var stored *domain.AuthCode
+	mockRepo.On("FindUserByEmail", "test@example.com").Return(user, nil)
+	mockRepo.On("FindUserByEmail", "nobody@example.com").Return(nil, fmt.Errorf("user not found"))
+	mockRepo.On("CountAuthCodesSince", uint(1), "magic_login", mock.Anything).Return(int64(0), nil)
+	mockRepo.On("CreateAuthCode", mock.AnythingOfType("*domain.AuthCode")).
+		Run(func(args mock.Arguments) { stored = args.Get(0).(*domain.AuthCode) }).Return(nil)
+	mockEmail.On("SendMagicLinkEmail", "test@example.com", mock.Anything).
+		Run(func(args mock.Arguments) { token = args.String(1) }).Return(nil)
+
+	binding, err := service.RequestMagicLink("test@example.com", true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, binding)
+	assert.GreaterOrEqual(t, len(token), 32, "magic link tokens must be high entropy")
+	assert.Equal(t, "magic_login", stored.Purpose)
+	assert.NotContains(t, stored.Code, token)
+
+	// Unknown emails look the same from the outside
+	unknownBinding, err := service.RequestMagicLink("nobody@example.com", true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, unknownBinding)
+	mockEmail.AssertNumberOfCalls(t, "SendMagicLinkEmail", 1)
+
+	// The link only works together with the binding of the requesting device
+	mockRepo.On("ConsumeAuthCode", stored.Code, "magic_login").Return(stored, nil).Once()
+	mockRepo.On("ConsumeAuthCode", mock.Anything, "magic_login").Return(nil, fmt.Errorf("invalid or expired code"))
+
+	_, err = service.ConsumeMagicLink(token, "", &domain.DeviceSession{IPAddress: "127.0.0.1"})
+	assert.Equal(t, errors.ErrInvalidMagicLink, err)
+
+	var session *domain.DeviceSession
+	var history *domain.LoginHistory
+	mockRepo.On("UpdateUser", user).Return(nil)
+	mockGeo.On("Lookup", mock.Anything).Return(&domain.GeoLocation{City: "Bangkok", Country: "Thailand"}, nil)
+	mockRepo.On("CreateDeviceSession", mock.AnythingOfType("*domain.DeviceSession")).
+		Run(func(args mock.Arguments) {
+			session = args.Get(0).(*domain.DeviceSession)
+			session.ID = 42
+		}).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.AnythingOfType("*domain.RefreshToken")).Return(nil)
+	mockRepo.On("LogLogin", mock.AnythingOfType("*domain.LoginHistory")).
+		Run(func(args mock.Arguments) { history = args.Get(0).(*domain.LoginHistory) }).Return(nil)
+	mockEmail.On("SendLoginNotification", "test@example.com", mock.AnythingOfType("*domain.DeviceSession")).Return(nil)
+
+	result, err := service.ConsumeMagicLink(token, binding, &domain.DeviceSession{IPAddress: "127.0.0.1"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.Tokens.AccessToken)
+	assert.True(t, user.IsEmailVerified)
+	assert.Equal(t, uint(1), session.UserID)
+
+	time.Sleep(50 * time.Millisecond)
+	if assert.NotNil(t, history) {
+		assert.Equal(t, session.DeviceID, history.DeviceID)
+	}
+
+	// Single use
+	_, err = service.ConsumeMagicLink(token, binding, &domain.DeviceSession{IPAddress: "127.0.0.1"})
+	assert.Equal(t, errors.ErrInvalidMagicLink, err)
+}
+
+func TestAuthService_RefreshToken(t *testing.T) {
+	mockRepo := NewMockAuthRepo()
+	mockEmail := new(MockEmailService)
+	mockGeo := new(MockGeoService)
+	mockCache := new(MockCacheRepo)
+	keys := newTestKeyRing(t)
+	service := NewAuthService(mockRepo, mockEmail, mockGeo, mockCache, new(MockRevocationRepo), NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram"), nil, nil, newTestAuditService(), newTestRateLimitService(), keys, security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	mockRepo.users["test@example.com"] = &domain.User{ID: 1, Email: "test@example.com"}
+
+	rotatedAt := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name    string
+		stored  *domain.RefreshToken
+		wantErr error
+		setup   func()
+	}{
+		{
+			name: "successful rotation",
+			stored: &domain.RefreshToken{
+				UserID:    1,
+				FamilyID:  "family-1",
+				TokenID:   "token-1",
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			setup: func() {
+				mockRepo.On("RotateRefreshToken", "token-1", mock.AnythingOfType("*domain.RefreshToken")).Return(nil)
+			},
+		},
+		{
+			name: "reused token revokes family",
+			stored: &domain.RefreshToken{
+				UserID:    1,
+				FamilyID:  "family-2",
+				TokenID:   "token-2",
+				RotatedAt: &rotatedAt,
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			wantErr: errors.ErrRefreshTokenReused,
+			setup: func() {
+				mockRepo.On("RevokeRefreshTokenFamily", "family-2").Return(nil)
+			},
+		},
+		{
+			name: "concurrent reuse revokes family",
+			stored: &domain.RefreshToken{
+				UserID:    1,
+				FamilyID:  "family-3",
+				TokenID:   "token-3",
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			wantErr: errors.ErrRefreshTokenReused,
+			setup: func() {
+				mockRepo.On("RotateRefreshToken", "token-3", mock.AnythingOfType("*domain.RefreshToken")).Return(errors.ErrRefreshTokenReused)
+				mockRepo.On("RevokeRefreshTokenFamily", "family-3").Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.On("FindRefreshToken", tt.stored.TokenID).Return(tt.stored, nil)
+			tt.setup()
+
+			refreshToken, err := security.GenerateRefreshToken(1, tt.stored.TokenID, keys, time.Hour)
+			assert.NoError(t, err)
+
+			tokens, err := service.RefreshToken(refreshToken)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEqual(t, refreshToken, tokens.RefreshToken)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_RevokeOtherSessions(t *testing.T) {
+	mockRepo := NewMockAuthRepo()
+	mockCache := new(MockCacheRepo)
+	mockRevocations := new(MockRevocationRepo)
+	service := NewAuthService(mockRepo, new(MockEmailService), new(MockGeoService), mockCache, mockRevocations, nil, nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	mockRepo.On("GetActiveSessions", uint(1)).Return([]*domain.DeviceSession{
+		{ID: 10, UserID: 1, DeviceID: "phone"},
+		{ID: 11, UserID: 1, DeviceID: "laptop"},
+		{ID: 12, UserID: 1, DeviceID: "tablet"},
+	}, nil)
+	mockRepo.On("RevokeSessionsByID", uint(1), []uint{10, 12}).Return(nil)
+	mockRevocations.On("RevokeSession", uint(10), accessTokenTTL).Return(nil)
+	mockRevocations.On("RevokeSession", uint(12), accessTokenTTL).Return(nil)
+	mockCache.On("Delete", "user:1").Return(nil)
+
+	assert.NoError(t, service.RevokeOtherSessions(1, 11, nil))
+	mockRepo.AssertExpectations(t)
+	mockRevocations.AssertExpectations(t)
+}
+
+func TestAuthService_Devices(t *testing.T) {
+	mockRepo := NewMockAuthRepo()
+	mockCache := new(MockCacheRepo)
+	mockRevocations := new(MockRevocationRepo)
+	service := NewAuthService(mockRepo, new(MockEmailService), new(MockGeoService), mockCache, mockRevocations, nil, nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	mockRepo.On("GetActiveSessions", uint(1)).Return([]*domain.DeviceSession{
+		{ID: 10, UserID: 1, DeviceID: "phone"},
+		{ID: 11, UserID: 1, DeviceID: "laptop"},
+	}, nil)
+
+	sessions, err := service.GetActiveSessions(1, 11)
+	assert.NoError(t, err)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+
+	name, trusted := "  Work laptop ", true
+	mockRepo.On("UpdateDeviceSession", mock.AnythingOfType("*domain.DeviceSession")).Return(nil)
+	session, err := service.UpdateDevice(1, 11, &domain.DeviceUpdateRequest{Name: &name, Trusted: &trusted}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Work laptop", session.DeviceName)
+	assert.True(t, session.Trusted)
+
+	// Sessions of other users cannot be found
+	_, err = service.UpdateDevice(1, 99, &domain.DeviceUpdateRequest{Trusted: &trusted}, nil)
+	assert.Equal(t, errors.ErrDeviceNotFound, err)
+	assert.Equal(t, errors.ErrDeviceNotFound, service.RevokeDevice(1, 99, nil))
+
+	mockRepo.On("RevokeSession", uint(1), "phone").Return(nil)
+	mockRevocations.On("RevokeSession", uint(10), accessTokenTTL).Return(nil)
+	mockCache.On("Delete", "user:1").Return(nil)
+	assert.NoError(t, service.RevokeDevice(1, 10, nil))
+	mockRepo.AssertExpectations(t)
+	mockRevocations.AssertExpectations(t)
+}
+
+func TestAuthService_TouchSession(t *testing.T) {
+	mockRepo := NewMockAuthRepo()
+	mockCache := new(MockCacheRepo)
+	service := NewAuthService(mockRepo, new(MockEmailService), new(MockGeoService), mockCache, new(MockRevocationRepo), nil, nil, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	mockCache.On("Get", "session:active:7").Return(nil, redis.Nil).Once()
+	mockRepo.On("TouchDeviceSession", uint(7), mock.AnythingOfType("time.Time")).Return(nil).Once()
+	mockCache.On("Set", "session:active:7", true, sessionTouchInterval).Return(nil)
+	assert.NoError(t, service.TouchSession(7))
+
+	// Within the interval the database is left alone
+	mockCache.On("Get", "session:active:7").Return(true, nil)
+	assert.NoError(t, service.TouchSession(7))
+	mockRepo.AssertNumberOfCalls(t, "TouchDeviceSession", 1)
+}
+
 // Add more test functions for other methods
 
 // MockEmailService methods
@@ -317,17 +801,60 @@ func (m *MockEmailService) SendLoginNotification(to string, device *domain.Devic
 	return args.Error(0)
 }
 
+func (m *MockEmailService) SendMagicLinkEmail(to, token string) error {
+	args := m.Called(to, token)
+	return args.Error(0)
+}
+
 func (m *MockEmailService) SendPasswordResetEmail(to, code string) error {
 	args := m.Called(to, code)
 	return args.Error(0)
 }
 
+func (m *MockEmailService) SendLoginVerificationEmail(to, code string, device *domain.DeviceSession) error {
+	args := m.Called(to, code, device)
+	return args.Error(0)
+}
+
+func (m *MockEmailService) SendLoginBlockedEmail(to string, device *domain.DeviceSession) error {
+	args := m.Called(to, device)
+	return args.Error(0)
+}
+
+func (m *MockEmailService) SendAccountDeletionCodeEmail(to, code string) error {
+	args := m.Called(to, code)
+	return args.Error(0)
+}
+
+func (m *MockEmailService) SendAccountDeletionScheduledEmail(to string, deleteAt time.Time) error {
+	args := m.Called(to, deleteAt)
+	return args.Error(0)
+}
+
+func (m *MockEmailService) SendAccountDeletedEmail(to string) error {
+	args := m.Called(to)
+	return args.Error(0)
+}
+
+func (m *MockEmailService) SendDataExportReadyEmail(to, downloadURL string, expiresAt time.Time) error {
+	args := m.Called(to, downloadURL, expiresAt)
+	return args.Error(0)
+}
+
 // MockGeoService methods
 func (m *MockGeoService) GetLocation(ip string) (string, error) {
 	args := m.Called(ip)
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockGeoService) Lookup(ip string) (*domain.GeoLocation, error) {
+	args := m.Called(ip)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.GeoLocation), args.Error(1)
+}
+
 func (m *MockGeoService) GetLocationFromIP(ip string) (string, error) {
 	args := m.Called(ip)
 	return args.String(0), args.Error(1)
@@ -363,6 +890,16 @@ func (m *MockAuthRepo) GetActiveSessions(userID uint) ([]*domain.DeviceSession,
 	return args.Get(0).([]*domain.DeviceSession), args.Error(1)
 }
 
+func (m *MockAuthRepo) UpdateDeviceSession(session *domain.DeviceSession) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepo) TouchDeviceSession(sessionID uint, at time.Time) error {
+	args := m.Called(sessionID, at)
+	return args.Error(0)
+}
+
 func (m *MockAuthRepo) RevokeSession(userID uint, deviceID string) error {
 	args := m.Called(userID, deviceID)
 	return args.Error(0)
@@ -397,3 +934,109 @@ func (m *MockAuthRepo) UpdateAccountRecovery(recovery *domain.AccountRecovery) e
 	args := m.Called(recovery)
 	return args.Error(0)
 }
+
+func (m *MockAuthRepo) CreateRefreshToken(token *domain.RefreshToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepo) FindRefreshToken(tokenID string) (*domain.RefreshToken, error) {
+	args := m.Called(tokenID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RefreshToken), args.Error(1)
+}
+
+func (m *MockAuthRepo) RotateRefreshToken(oldTokenID string, next *domain.RefreshToken) error {
+	args := m.Called(oldTokenID, next)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepo) RevokeRefreshTokenFamily(familyID string) error {
+	args := m.Called(familyID)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepo) ReplaceBackupCodes(userID uint, codes []*domain.BackupCode) error {
+	args := m.Called(userID, codes)
+	return args.Error(0)
+}
+
+// RecordTOTPStep updates the stored users like the conditional update in the database
+func (m *MockAuthRepo) RecordTOTPStep(userID uint, step int64) error {
+	for _, user := range m.users {
+		if user.ID == userID && user.TwoFactorLastStep < step {
+			user.TwoFactorLastStep = step
+			return nil
+		}
+	}
+	return errors.ErrInvalidTwoFactorCode
+}
+
+func (m *MockAuthRepo) UseBackupCode(userID uint, codeHash string) error {
+	args := m.Called(userID, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepo) RevokeSessionsByID(userID uint, sessionIDs []uint) error {
+	args := m.Called(userID, sessionIDs)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepo) CountAuthCodesSince(userID uint, purpose string, since time.Time) (int64, error) {
+	args := m.Called(userID, purpose, since)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthRepo) FindAuthCode(userID uint, code string, purpose string) (*domain.AuthCode, error) {
+	args := m.Called(userID, code, purpose)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AuthCode), args.Error(1)
+}
+
+func (m *MockAuthRepo) FindActiveAccountRecovery(userID uint, requestType string) (*domain.AccountRecovery, error) {
+	args := m.Called(userID, requestType)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AccountRecovery), args.Error(1)
+}
+
+func (m *MockAuthRepo) ConsumeAuthCode(code string, purpose string) (*domain.AuthCode, error) {
+	args := m.Called(code, purpose)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AuthCode), args.Error(1)
+}
+
+func (m *MockAuthRepo) FindLoginHistory(userID uint, page pagination.Page) (*pagination.List[*domain.LoginHistory], error) {
+	args := m.Called(userID, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return pagination.NewList(args.Get(0).([]*domain.LoginHistory), page, func(login *domain.LoginHistory) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: login.CreatedAt, ID: login.ID}
+	}), args.Error(1)
+}
+
+func (m *MockAuthRepo) FindSuccessfulLogins(userID uint, limit int) ([]*domain.LoginHistory, error) {
+	args := m.Called(userID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.LoginHistory), args.Error(1)
+}
+
+func (m *MockAuthRepo) CountLoginAttempts(userID uint) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthRepo) CountFailedLoginsFromIP(ip string, since time.Time) (int64, error) {
+	args := m.Called(ip, since)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"fowergram/internal/core/domain"
+)
+
+// exportArchive is the content of a data export. Each part is written as its own JSON
+// file, index.html shows all of them in a browser.
+type exportArchive struct {
+	GeneratedAt  time.Time
+	Profile      *domain.User
+	Settings     exportSettings
+	Posts        []exportPost
+	Comments     []exportComment
+	LoginHistory []*domain.LoginHistory
+	Devices      []*domain.DeviceSession
+	Media        []exportMedia
+	// files are the uploaded media copied into the archive
+	files []exportFile
+	// openBlob reads an uploaded file by its hash
+	openBlob func(hash string) (io.ReadCloser, error)
+}
+
+type exportSettings struct {
+	TwoFactorEnabled bool                         `json:"two_factor_enabled"`
+	RecoveryEmail    string                       `json:"recovery_email,omitempty"`
+	TrustedDevices   []string                     `json:"trusted_devices"`
+	LinkedAccounts   []*domain.UserIdentity       `json:"linked_accounts"`
+	Passkeys         []*domain.WebAuthnCredential `json:"passkeys"`
+	APIKeys          []*domain.APIKey             `json:"api_keys"`
+}
+
+// Posts and comments without the embedded author, who is the user
+type exportPost struct {
+	ID        uint             `json:"id"`
+	Caption   string           `json:"caption"`
+	Items     []exportPostItem `json:"items"`
+	Likes     int              `json:"likes"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+type exportPostItem struct {
+	// Media is the path of the uploaded file in the archive
+	Media    string `json:"media,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	AltText  string `json:"alt_text,omitempty"`
+}
+
+type exportComment struct {
+	ID        uint      `json:"id"`
+	PostID    uint      `json:"post_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Uploaded files are in the archive at File, posts made before uploads existed only
+// link to their image
+type exportMedia struct {
+	PostID      uint       `json:"post_id,omitempty"`
+	File        string     `json:"file,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	UploadedAt  *time.Time `json:"uploaded_at,omitempty"`
+}
+
+type exportFile struct {
+	name string
+	hash string
+}
+
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"video/mp4":  ".mp4",
+}
+
+func newExportArchive(data *domain.PersonalData, generatedAt time.Time, openBlob func(hash string) (io.ReadCloser, error)) *exportArchive {
+	archive := &exportArchive{
+		GeneratedAt:  generatedAt,
+		Profile:      data.User,
+		LoginHistory: data.LoginHistory,
+		Devices:      data.Devices,
+		Settings: exportSettings{
+			TwoFactorEnabled: data.User.TwoFactorEnabled,
+			RecoveryEmail:    data.User.RecoveryEmail,
+			TrustedDevices:   []string{},
+			LinkedAccounts:   data.Identities,
+			Passkeys:         data.Passkeys,
+			APIKeys:          data.APIKeys,
+		},
+		Posts:    []exportPost{},
+		Comments: []exportComment{},
+		Media:    []exportMedia{},
+		openBlob: openBlob,
+	}
+
+	for _, device := range data.Devices {
+		if device.Trusted && device.Active {
+			archive.Settings.TrustedDevices = append(archive.Settings.TrustedDevices, device.DeviceID)
+		}
+	}
+	files := make(map[uint]string)
+	postOf := make(map[uint]uint)
+	for _, post := range data.Posts {
+		for _, item := range post.Items {
+			if item.MediaID != nil {
+				postOf[*item.MediaID] = post.ID
+			}
+		}
+	}
+	for _, media := range data.Media {
+		name := fmt.Sprintf("media/%d%s", media.ID, mediaExtensions[media.ContentType])
+		uploadedAt := media.CreatedAt
+		files[media.ID] = name
+		archive.files = append(archive.files, exportFile{name: name, hash: media.Hash})
+		archive.Media = append(archive.Media, exportMedia{
+			PostID:      postOf[media.ID],
+			File:        name,
+			ContentType: media.ContentType,
+			UploadedAt:  &uploadedAt,
+		})
+	}
+
+	for _, post := range data.Posts {
+		exported := exportPost{
+			ID:        post.ID,
+			Caption:   post.Caption,
+			Items:     []exportPostItem{},
+			Likes:     post.Likes,
+			CreatedAt: post.CreatedAt,
+			UpdatedAt: post.UpdatedAt,
+		}
+		for _, item := range post.Items {
+			exportedItem := exportPostItem{ImageURL: item.ImageURL, AltText: item.AltText}
+			if item.MediaID != nil {
+				exportedItem.Media = files[*item.MediaID]
+			} else if item.ImageURL != "" {
+				archive.Media = append(archive.Media, exportMedia{PostID: post.ID, URL: item.ImageURL})
+			}
+			exported.Items = append(exported.Items, exportedItem)
+		}
+		archive.Posts = append(archive.Posts, exported)
+	}
+	for _, comment := range data.Comments {
+		archive.Comments = append(archive.Comments, exportComment{
+			ID:        comment.ID,
+			PostID:    comment.PostID,
+			Content:   comment.Content,
+			CreatedAt: comment.CreatedAt,
+			UpdatedAt: comment.UpdatedAt,
+		})
+	}
+	return archive
+}
+
+// writeTo writes the archive as a ZIP file
+func (a *exportArchive) writeTo(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	parts := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", a.Profile},
+		{"settings.json", a.Settings},
+		{"posts.json", a.Posts},
+		{"comments.json", a.Comments},
+		{"login_history.json", a.LoginHistory},
+		{"devices.json", a.Devices},
+		{"media.json", a.Media},
+	}
+	for _, part := range parts {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: part.name, Method: zip.Deflate, Modified: a.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(part.content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", part.name, err)
+		}
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate, Modified: a.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	if err := exportIndexTemplate.Execute(f, a); err != nil {
+		return fmt.Errorf("failed to write index.html: %w", err)
+	}
+
+	// A file that cannot be read does not keep the user from getting the rest
+	for _, file := range a.files {
+		content, err := a.openBlob(file.hash)
+		if err != nil {
+			fmt.Printf("failed to read %s for data export: %v\n", file.name, err)
+			continue
+		}
+		err = a.writeFile(zw, file.name, content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeFile copies an uploaded file into the archive. Images and videos are already
+// compressed, so they are stored as they are.
+func (a *exportArchive) writeFile(zw *zip.Writer, name string, content io.Reader) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: a.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	return err
+}
+
+// writeExportArchive writes the archive to path and returns its size. The file only
+// appears once it is complete.
+func writeExportArchive(path string, archive *exportArchive) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	if err := archive.writeTo(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+var exportIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Your Fowergram data</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 960px; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>Your Fowergram data</h1>
+<p>Made on {{.GeneratedAt.Format "2 January 2006 15:04 MST"}}. The same data is in the JSON files next to this page.</p>
+
+<h2>Profile</h2>
+<table>
+<tr><th>Username</th><td>{{.Profile.Username}}</td></tr>
+<tr><th>Email</th><td>{{.Profile.Email}}</td></tr>
+<tr><th>Email verified</th><td>{{.Profile.IsEmailVerified}}</td></tr>
+<tr><th>Joined</th><td>{{.Profile.CreatedAt.Format "2006-01-02"}}</td></tr>
+</table>
+
+<h2>Settings</h2>
+<table>
+<tr><th>Two-factor authentication</th><td>{{.Settings.TwoFactorEnabled}}</td></tr>
+<tr><th>Recovery email</th><td>{{.Settings.RecoveryEmail}}</td></tr>
+<tr><th>Trusted devices</th><td>{{range .Settings.TrustedDevices}}{{.}}<br>{{else}}None{{end}}</td></tr>
+<tr><th>Linked accounts</th><td>{{range .Settings.LinkedAccounts}}{{.Provider}} ({{.Email}})<br>{{else}}None{{end}}</td></tr>
+<tr><th>Passkeys</th><td>{{range .Settings.Passkeys}}{{.Name}}<br>{{else}}None{{end}}</td></tr>
+<tr><th>API keys</th><td>{{range .Settings.APIKeys}}{{.Name}} ({{.Prefix}})<br>{{else}}None{{end}}</td></tr>
+</table>
+
+<h2>Posts</h2>
+<table>
+<tr><th>Date</th><th>Caption</th><th>Images</th><th>Likes</th></tr>
+{{range .Posts}}<tr><td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td><td>{{.Caption}}</td><td>{{range .Items}}{{if .Media}}<a href="{{.Media}}">{{.Media}}</a>{{else if .ImageURL}}<a href="{{.ImageURL}}">{{.ImageURL}}</a>{{end}}<br>{{end}}</td><td>{{.Likes}}</td></tr>
+{{else}}<tr><td colspan="4">No posts</td></tr>
+{{end}}</table>
+
+<h2>Comments</h2>
+<table>
+<tr><th>Date</th><th>Post</th><th>Comment</th></tr>
+{{range .Comments}}<tr><td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td><td>{{.PostID}}</td><td>{{.Content}}</td></tr>
+{{else}}<tr><td colspan="3">No comments</td></tr>
+{{end}}</table>
+
+<h2>Devices</h2>
+<table>
+<tr><th>Device</th><th>Name</th><th>Location</th><th>IP address</th><th>Last active</th></tr>
+{{range .Devices}}<tr><td>{{.DeviceID}}</td><td>{{.DeviceName}}</td><td>{{.Location}}</td><td>{{.IPAddress}}</td><td>{{.LastActive.Format "2006-01-02 15:04"}}</td></tr>
+{{else}}<tr><td colspan="5">No devices</td></tr>
+{{end}}</table>
+
+<h2>Login history</h2>
+<table>
+<tr><th>Date</th><th>Status</th><th>Location</th><th>IP address</th><th>Browser</th></tr>
+{{range .LoginHistory}}<tr><td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td><td>{{.Status}}</td><td>{{.Location}}</td><td>{{.IPAddress}}</td><td>{{.UserAgent}}</td></tr>
+{{else}}<tr><td colspan="5">No logins</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/email"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+)
+
+const (
+	// dataExportTTL is how long an archive and its download link are kept
+	dataExportTTL = 7 * 24 * time.Hour
+	// A user can ask for a new copy once a day
+	dataExportInterval = 24 * time.Hour
+	// Archives built per run of the export job
+	dataExportBatchSize = 5
+	// Exports left in processing this long were abandoned by a crashed worker
+	dataExportStaleAfter = time.Hour
+)
+
+type dataExportService struct {
+	exportRepo   ports.DataExportRepository
+	emailService email.Service
+	auditService ports.AuditService
+	blobs        ports.BlobStore
+	dir          string
+	downloadURL  string
+	signingKey   []byte
+}
+
+// NewDataExportService stores archives in dir. Uploaded media is copied into them
+// from blobs. Download links point to downloadURL followed by "/<id>/download" and are
+// signed with signingKey.
+func NewDataExportService(der ports.DataExportRepository, es email.Service, aus ports.AuditService, blobs ports.BlobStore, dir, downloadURL string, signingKey []byte) ports.DataExportService {
+	return &dataExportService{
+		exportRepo:   der,
+		emailService: es,
+		auditService: aus,
+		blobs:        blobs,
+		dir:          dir,
+		downloadURL:  strings.TrimSuffix(downloadURL, "/"),
+		signingKey:   signingKey,
+	}
+}
+
+func (s *dataExportService) Request(userID uint, actor *domain.Actor) (*domain.DataExport, error) {
+	if latest, err := s.exportRepo.FindLatestByUserID(userID); err == nil {
+		switch latest.Status {
+		case domain.DataExportPending, domain.DataExportProcessing:
+			return latest, nil
+		case domain.DataExportReady:
+			if time.Since(latest.CreatedAt) < dataExportInterval {
+				return nil, errors.ErrDataExportTooSoon
+			}
+		}
+	}
+
+	export := &domain.DataExport{
+		UserID: userID,
+		Status: domain.DataExportPending,
+	}
+	if err := s.exportRepo.Create(export); err != nil {
+		return nil, fmt.Errorf("failed to create data export: %w", err)
+	}
+
+	s.audit(domain.AuditEventDataExportRequested, userID, actor, fmt.Sprintf("export=%d", export.ID))
+	return export, nil
+}
+
+func (s *dataExportService) Latest(userID uint) (*domain.DataExport, string, error) {
+	export, err := s.exportRepo.FindLatestByUserID(userID)
+	if err != nil {
+		return nil, "", errors.ErrDataExportNotFound
+	}
+
+	if export.Status != domain.DataExportReady || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		return export, "", nil
+	}
+	return export, s.signedURL(export), nil
+}
+
+func (s *dataExportService) ProcessPending() (int, error) {
+	exports, err := s.exportRepo.ClaimPending(dataExportBatchSize, time.Now().Add(-dataExportStaleAfter))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim data exports: %w", err)
+	}
+
+	built := 0
+	for _, export := range exports {
+		if err := s.build(export); err != nil {
+			fmt.Printf("failed to build data export %d: %v\n", export.ID, err)
+			// Failed exports are purged like expired ones
+			expiresAt := time.Now().Add(dataExportTTL)
+			export.Status = domain.DataExportFailed
+			export.Error = err.Error()
+			export.ExpiresAt = &expiresAt
+			if err := s.exportRepo.Update(export); err != nil {
+				fmt.Printf("failed to mark data export %d as failed: %v\n", export.ID, err)
+			}
+			continue
+		}
+		built++
+	}
+	return built, nil
+}
+
+func (s *dataExportService) build(export *domain.DataExport) error {
+	data, err := s.exportRepo.FindPersonalData(export.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load personal data: %w", err)
+	}
+
+	now := time.Now()
+	fileName := fmt.Sprintf("export-%d.zip", export.ID)
+	size, err := writeExportArchive(filepath.Join(s.dir, fileName), newExportArchive(data, now, s.openBlob))
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	expiresAt := now.Add(dataExportTTL)
+	export.Status = domain.DataExportReady
+	export.FileName = fileName
+	export.SizeBytes = size
+	export.Error = ""
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	if err := s.exportRepo.Update(export); err != nil {
+		return fmt.Errorf("failed to save data export: %w", err)
+	}
+
+	if err := s.emailService.SendDataExportReadyEmail(data.User.Email, s.signedURL(export), expiresAt); err != nil {
+		fmt.Printf("failed to send data export email: %v\n", err)
+	}
+	return nil
+}
+
+func (s *dataExportService) openBlob(hash string) (io.ReadCloser, error) {
+	return s.blobs.Get(domain.MediaBlobKey(hash))
+}
+
+func (s *dataExportService) Open(id uint, expires int64, signature string, actor *domain.Actor) (*domain.DataExport, string, error) {
+	if time.Now().Unix() > expires || !security.VerifySignature(s.signingKey, exportSignedMessage(id, expires), signature) {
+		return nil, "", errors.ErrDataExportNotFound
+	}
+
+	export, err := s.exportRepo.FindByID(id)
+	if err != nil || export.Status != domain.DataExportReady || export.FileName == "" {
+		return nil, "", errors.ErrDataExportNotFound
+	}
+
+	s.audit(domain.AuditEventDataExportDownloaded, export.UserID, actor, fmt.Sprintf("export=%d", export.ID))
+	return export, filepath.Join(s.dir, export.FileName), nil
+}
+
+func (s *dataExportService) PurgeExpired() (int, error) {
+	exports, err := s.exportRepo.FindPurgeable(time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired data exports: %w", err)
+	}
+
+	purged := 0
+	for _, export := range exports {
+		if export.FileName != "" {
+			if err := os.Remove(filepath.Join(s.dir, export.FileName)); err != nil && !os.IsNotExist(err) {
+				fmt.Printf("failed to remove data export %d: %v\n", export.ID, err)
+				continue
+			}
+		}
+		if err := s.exportRepo.Delete(export.ID); err != nil {
+			fmt.Printf("failed to delete data export %d: %v\n", export.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// signedURL is the download link of a ready export, valid until the export expires
+func (s *dataExportService) signedURL(export *domain.DataExport) string {
+	expires := export.ExpiresAt.Unix()
+	return fmt.Sprintf("%s/%d/download?expires=%d&signature=%s", s.downloadURL, export.ID, expires,
+		security.Sign(s.signingKey, exportSignedMessage(export.ID, expires)))
+}
+
+func exportSignedMessage(id uint, expires int64) string {
+	return fmt.Sprintf("data-export:%d:%d", id, expires)
+}
+
+func (s *dataExportService) audit(event string, userID uint, actor *domain.Actor, details string) {
+	if err := s.auditService.Record(event, actor, userID, details); err != nil {
+		fmt.Printf("failed to record %s audit event: %v\n", event, err)
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryDataExportRepo struct {
+	exports []*domain.DataExport
+	data    map[uint]*domain.PersonalData
+}
+
+func (r *memoryDataExportRepo) Create(export *domain.DataExport) error {
+	export.ID = uint(len(r.exports) + 1)
+	export.CreatedAt = time.Now()
+	r.exports = append(r.exports, export)
+	return nil
+}
+
+func (r *memoryDataExportRepo) FindByID(id uint) (*domain.DataExport, error) {
+	for _, export := range r.exports {
+		if export.ID == id {
+			copied := *export
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *memoryDataExportRepo) FindLatestByUserID(userID uint) (*domain.DataExport, error) {
+	for i := len(r.exports) - 1; i >= 0; i-- {
+		if r.exports[i].UserID == userID {
+			return r.exports[i], nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *memoryDataExportRepo) ClaimPending(limit int, staleBefore time.Time) ([]*domain.DataExport, error) {
+	var claimed []*domain.DataExport
+	for _, export := range r.exports {
+		if export.Status == domain.DataExportPending && len(claimed) < limit {
+			export.Status = domain.DataExportProcessing
+			claimed = append(claimed, export)
+		}
+	}
+	return claimed, nil
+}
+
+func (r *memoryDataExportRepo) Update(export *domain.DataExport) error { return nil }
+
+func (r *memoryDataExportRepo) FindPurgeable(now time.Time) ([]*domain.DataExport, error) {
+	var purgeable []*domain.DataExport
+	for _, export := range r.exports {
+		if export.ExpiresAt != nil && export.ExpiresAt.Before(now) {
+			purgeable = append(purgeable, export)
+		}
+	}
+	return purgeable, nil
+}
+
+func (r *memoryDataExportRepo) Delete(id uint) error {
+	for i, export := range r.exports {
+		if export.ID == id {
+			r.exports = append(r.exports[:i], r.exports[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("record not found")
+}
+
+func (r *memoryDataExportRepo) FindPersonalData(userID uint) (*domain.PersonalData, error) {
+	data, ok := r.data[userID]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	return data, nil
+}
+
+// openExport follows a download URL the way the download route does
+func openExport(t *testing.T, service *dataExportService, downloadURL string) (*domain.DataExport, string, error) {
+	link, err := url.Parse(downloadURL)
+	require.NoError(t, err)
+	parts := strings.Split(strings.Trim(link.Path, "/"), "/")
+	id, err := strconv.Atoi(parts[len(parts)-2])
+	require.NoError(t, err)
+	expires, err := strconv.ParseInt(link.Query().Get("expires"), 10, 64)
+	require.NoError(t, err)
+	return service.Open(uint(id), expires, link.Query().Get("signature"), nil)
+}
+
+func TestDataExportService_Lifecycle(t *testing.T) {
+	blobs := storage.NewLocalStore(t.TempDir())
+	photo := &domain.Media{ID: 4, UserID: 1, Hash: strings.Repeat("ab", 32), ContentType: "image/png"}
+	require.NoError(t, blobs.Put(domain.MediaBlobKey(photo.Hash), strings.NewReader("png bytes"), 9, photo.ContentType))
+
+	repo := &memoryDataExportRepo{data: map[uint]*domain.PersonalData{
+		1: {
+			User: &domain.User{ID: 1, Username: "somchai", Email: "somchai@example.com", TwoFactorEnabled: true},
+			Posts: []*domain.Post{
+				{ID: 7, UserID: 1, Caption: "<b>Doi Suthep</b>", Items: []domain.PostItem{{ImageURL: "https://cdn.example.com/7.jpg"}}},
+				{ID: 8, UserID: 1, Caption: "Wat Arun", Items: []domain.PostItem{{MediaID: &photo.ID, AltText: "Wat Arun at dusk"}}},
+			},
+			Media:    []*domain.Media{photo},
+			Comments: []*domain.Comment{{ID: 3, PostID: 9, UserID: 1, Content: "Beautiful"}},
+			Devices:  []*domain.DeviceSession{{ID: 5, DeviceID: "phone", Trusted: true, Active: true}},
+		},
+	}}
+	emailService := new(MockEmailService)
+	auditRepo := &memoryAuditRepo{}
+	dir := t.TempDir()
+	service := NewDataExportService(repo, emailService, NewAuditService(auditRepo), blobs, dir, "https://api.example.com/api/v1/exports/", []byte("secret")).(*dataExportService)
+
+	export, err := service.Request(1, &domain.Actor{UserID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, domain.DataExportPending, export.Status)
+	// Asking again while it is being built returns the same export
+	again, err := service.Request(1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, export.ID, again.ID)
+
+	var downloadURL string
+	emailService.On("SendDataExportReadyEmail", "somchai@example.com", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+		Run(func(args mock.Arguments) { downloadURL = args.String(1) }).
+		Return(nil)
+	built, err := service.ProcessPending()
+	require.NoError(t, err)
+	assert.Equal(t, 1, built)
+	assert.Equal(t, domain.DataExportReady, export.Status)
+	assert.True(t, strings.HasPrefix(downloadURL, fmt.Sprintf("https://api.example.com/api/v1/exports/%d/download?", export.ID)))
+
+	_, statusURL, err := service.Latest(1)
+	require.NoError(t, err)
+	assert.Equal(t, downloadURL, statusURL)
+
+	opened, path, err := openExport(t, service, downloadURL)
+	require.NoError(t, err)
+	assert.Equal(t, export.ID, opened.ID)
+
+	archive, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	files := make(map[string]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+	archive.Close()
+	for _, name := range []string{"profile.json", "settings.json", "posts.json", "comments.json", "login_history.json", "devices.json", "media.json", "index.html"} {
+		assert.Contains(t, files, name)
+	}
+	assert.Contains(t, files["profile.json"], `"username": "somchai"`)
+	assert.NotContains(t, files["profile.json"], "password")
+	assert.Contains(t, files["settings.json"], `"trusted_devices": [`)
+	assert.Contains(t, files["media.json"], "https://cdn.example.com/7.jpg")
+	// Uploaded files are copied into the archive
+	assert.Equal(t, "png bytes", files["media/4.png"])
+	assert.Contains(t, files["posts.json"], `"media": "media/4.png"`)
+	assert.Contains(t, files["posts.json"], `"alt_text": "Wat Arun at dusk"`)
+	// User content is escaped in the readable page
+	assert.Contains(t, files["index.html"], "&lt;b&gt;Doi Suthep&lt;/b&gt;")
+
+	// Links cannot be forged or extended
+	_, _, err = openExport(t, service, strings.Replace(downloadURL, "signature=", "signature=x", 1))
+	assert.Equal(t, errors.ErrDataExportNotFound, err)
+	_, _, err = service.Open(export.ID, export.ExpiresAt.Add(time.Hour).Unix(), "", nil)
+	assert.Equal(t, errors.ErrDataExportNotFound, err)
+
+	_, err = service.Request(1, nil)
+	assert.Equal(t, errors.ErrDataExportTooSoon, err)
+	assert.Equal(t, []string{domain.AuditEventDataExportRequested, domain.AuditEventDataExportDownloaded}, events(auditRepo))
+
+	// Expired archives are removed from disk
+	expired := time.Now().Add(-time.Minute)
+	export.ExpiresAt = &expired
+	purged, err := service.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = os.Stat(filepath.Join(dir, export.FileName))
+	assert.True(t, os.IsNotExist(err))
+	assert.Empty(t, repo.exports)
+}
+
+func TestDataExportService_FailedBuild(t *testing.T) {
+	repo := &memoryDataExportRepo{data: map[uint]*domain.PersonalData{}}
+	service := NewDataExportService(repo, new(MockEmailService), newTestAuditService(), storage.NewLocalStore(t.TempDir()), t.TempDir(), "https://api.example.com/api/v1/exports", []byte("secret"))
+
+	export, err := service.Request(2, nil)
+	require.NoError(t, err)
+
+	built, err := service.ProcessPending()
+	require.NoError(t, err)
+	assert.Equal(t, 0, built)
+	assert.Equal(t, domain.DataExportFailed, export.Status)
+	assert.NotNil(t, export.ExpiresAt)
+
+	// A failed export can be retried straight away
+	retry, err := service.Request(2, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, export.ID, retry.ID)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+)
+
+// Points each signal adds to the risk score. A login scoring riskMediumScore must be
+// confirmed with an emailed code, one scoring riskHighScore is blocked.
+const (
+	riskNewDevicePoints        = 30
+	riskNewCountryPoints       = 40
+	riskImpossibleTravelPoints = 60
+	riskFailureBurstPoints     = 50
+	// Attempts were made but none ever succeeded, the login has nothing to vouch for it
+	riskNoSuccessfulLoginPoints = riskMediumScore
+
+	riskMediumScore = 40
+	riskHighScore   = 80
+
+	// Successful logins compared against
+	riskHistorySize = 20
+
+	// Faster than an airliner between two logins counts as impossible travel
+	maxTravelSpeedKmh = 1000
+	// Closer than this is treated as the same place, IP geolocation is not precise
+	minTravelDistanceKm = 300
+
+	failureBurstWindow    = 15 * time.Minute
+	failureBurstThreshold = 10
+)
+
+// loginRiskScorer rates a login whose credentials were correct against the user's
+// earlier successful logins and recent failures from the same IP address
+type loginRiskScorer struct {
+	authRepo ports.AuthRepository
+}
+
+func (r *loginRiskScorer) Assess(user *domain.User, deviceInfo *domain.DeviceSession, now time.Time) (*domain.LoginRisk, error) {
+	risk := &domain.LoginRisk{Level: domain.RiskLow}
+
+	failures, err := r.authRepo.CountFailedLoginsFromIP(deviceInfo.IPAddress, now.Add(-failureBurstWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count failed logins: %w", err)
+	}
+	if failures >= failureBurstThreshold {
+		risk.Add(domain.RiskSignalFailureBurst, riskFailureBurstPoints)
+	}
+
+	successes, err := r.authRepo.FindSuccessfulLogins(user.ID, riskHistorySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load login history: %w", err)
+	}
+
+	if len(successes) == 0 {
+		// Only a real first login has nothing to compare with. Earlier attempts that
+		// never succeeded are exactly what someone probing the account leaves behind.
+		attempts, err := r.authRepo.CountLoginAttempts(user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count login attempts: %w", err)
+		}
+		if attempts > 0 {
+			risk.Add(domain.RiskSignalNoSuccessfulLogin, riskNoSuccessfulLoginPoints)
+		}
+	} else {
+		if !knownDevice(successes, deviceInfo) {
+			risk.Add(domain.RiskSignalNewDevice, riskNewDevicePoints)
+		}
+
+		geo := deviceInfo.Geo
+		if geo != nil && geo.CountryCode != "" && !knownCountry(successes, geo.CountryCode) {
+			risk.Add(domain.RiskSignalNewCountry, riskNewCountryPoints)
+		}
+
+		// History is newest first, so the first success is the previous login
+		if geo != nil && impossibleTravel(successes[0], geo, now) {
+			risk.Add(domain.RiskSignalImpossibleTravel, riskImpossibleTravelPoints)
+		}
+	}
+
+	switch {
+	case risk.Score >= riskHighScore:
+		risk.Level = domain.RiskHigh
+	case risk.Score >= riskMediumScore:
+		risk.Level = domain.RiskMedium
+	}
+	return risk, nil
+}
+
+// knownDevice matches on the device ID when the client sends one and falls back to
+// the user agent
+func knownDevice(history []*domain.LoginHistory, deviceInfo *domain.DeviceSession) bool {
+	for _, entry := range history {
+		if deviceInfo.DeviceID != "" && entry.DeviceID == deviceInfo.DeviceID {
+			return true
+		}
+		if deviceInfo.DeviceID == "" && entry.UserAgent == deviceInfo.UserAgent {
+			return true
+		}
+	}
+	return false
+}
+
+// knownCountry treats history without a country as unknown, not as a mismatch
+func knownCountry(history []*domain.LoginHistory, countryCode string) bool {
+	located := false
+	for _, entry := range history {
+		if entry.CountryCode == "" {
+			continue
+		}
+		located = true
+		if entry.CountryCode == countryCode {
+			return true
+		}
+	}
+	return !located
+}
+
+func impossibleTravel(previous *domain.LoginHistory, geo *domain.GeoLocation, now time.Time) bool {
+	if previous.Latitude == nil || previous.Longitude == nil || geo.Latitude == nil || geo.Longitude == nil {
+		return false
+	}
+
+	distance := domain.DistanceKm(*previous.Latitude, *previous.Longitude, *geo.Latitude, *geo.Longitude)
+	if distance < minTravelDistanceKm {
+		return false
+	}
+
+	hours := now.Sub(previous.CreatedAt).Hours()
+	if hours <= 0 {
+		return true
+	}
+	return distance/hours > maxTravelSpeedKmh
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func coords(lat, lon float64) (*float64, *float64) {
+	return &lat, &lon
+}
+
+func TestLoginRiskScorer_Assess(t *testing.T) {
+	now := time.Now()
+	bangkokLat, bangkokLon := coords(13.75, 100.50)
+	londonLat, londonLon := coords(51.51, -0.13)
+	chiangMaiLat, chiangMaiLon := coords(18.79, 98.98)
+
+	previous := []*domain.LoginHistory{
+		{
+			Status:      domain.LoginStatusSuccess,
+			DeviceID:    "phone",
+			UserAgent:   "Fowergram/1.0",
+			CountryCode: "TH",
+			Latitude:    bangkokLat,
+			Longitude:   bangkokLon,
+			CreatedAt:   now.Add(-2 * time.Hour),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		history  []*domain.LoginHistory
+		failures int64
+		attempts int64
+		device   *domain.DeviceSession
+		level    domain.RiskLevel
+		signals  []string
+	}{
+		{
+			name:    "first login",
+			history: nil,
+			device:  &domain.DeviceSession{DeviceID: "laptop", Geo: &domain.GeoLocation{CountryCode: "GB", Latitude: londonLat, Longitude: londonLon}},
+			level:   domain.RiskLow,
+		},
+		{
+			// Failed and challenged attempts must not pass for a first login
+			name:     "attempts on record but none succeeded",
+			history:  nil,
+			attempts: riskHistorySize,
+			device:   &domain.DeviceSession{DeviceID: "laptop"},
+			level:    domain.RiskMedium,
+			signals:  []string{domain.RiskSignalNoSuccessfulLogin},
+		},
+		{
+			name:    "known device at home",
+			history: previous,
+			device:  &domain.DeviceSession{DeviceID: "phone", Geo: &domain.GeoLocation{CountryCode: "TH", Latitude: bangkokLat, Longitude: bangkokLon}},
+			level:   domain.RiskLow,
+		},
+		{
+			name:    "new device in a nearby city",
+			history: previous,
+			device:  &domain.DeviceSession{DeviceID: "laptop", Geo: &domain.GeoLocation{CountryCode: "TH", Latitude: chiangMaiLat, Longitude: chiangMaiLon}},
+			level:   domain.RiskLow,
+			signals: []string{domain.RiskSignalNewDevice},
+		},
+		{
+			name:    "known device without geolocation falls back to the user agent",
+			history: previous,
+			device:  &domain.DeviceSession{UserAgent: "Fowergram/1.0"},
+			level:   domain.RiskLow,
+		},
+		{
+			name:    "new country a day later",
+			history: []*domain.LoginHistory{{Status: domain.LoginStatusSuccess, DeviceID: "phone", CountryCode: "TH", Latitude: bangkokLat, Longitude: bangkokLon, CreatedAt: now.Add(-24 * time.Hour)}},
+			device:  &domain.DeviceSession{DeviceID: "phone", Geo: &domain.GeoLocation{CountryCode: "GB", Latitude: londonLat, Longitude: londonLon}},
+			level:   domain.RiskMedium,
+			signals: []string{domain.RiskSignalNewCountry},
+		},
+		{
+			name:    "Bangkok to London in two hours",
+			history: previous,
+			device:  &domain.DeviceSession{DeviceID: "phone", Geo: &domain.GeoLocation{CountryCode: "GB", Latitude: londonLat, Longitude: londonLon}},
+			level:   domain.RiskHigh,
+			signals: []string{domain.RiskSignalNewCountry, domain.RiskSignalImpossibleTravel},
+		},
+		{
+			name:     "failure burst from a new device",
+			history:  previous,
+			failures: failureBurstThreshold,
+			device:   &domain.DeviceSession{DeviceID: "laptop", IPAddress: "198.51.100.4"},
+			level:    domain.RiskHigh,
+			signals:  []string{domain.RiskSignalFailureBurst, domain.RiskSignalNewDevice},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockAuthRepo()
+			repo.On("CountFailedLoginsFromIP", tt.device.IPAddress, mock.Anything).Return(tt.failures, nil)
+			repo.On("FindSuccessfulLogins", uint(1), riskHistorySize).Return(tt.history, nil)
+			repo.On("CountLoginAttempts", uint(1)).Return(tt.attempts, nil)
+			scorer := &loginRiskScorer{authRepo: repo}
+
+			risk, err := scorer.Assess(&domain.User{ID: 1}, tt.device, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.level, risk.Level)
+			assert.Equal(t, tt.signals, risk.Signals)
+		})
+	}
+}
+
+func TestAuthService_RiskBasedLogin(t *testing.T) {
+	lat, lon := coords(13.75, 100.50)
+	hash, err := security.DefaultPasswordHasher().Hash("Test123!")
+	require.NoError(t, err)
+	user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: hash}
+
+	repo := NewMockAuthRepo()
+	repo.users[user.Email] = user
+	repo.On("FindUserByEmail", user.Email).Return(user, nil)
+	repo.On("UpdateUser", user).Return(nil)
+	repo.On("LogLogin", mock.AnythingOfType("*domain.LoginHistory")).Return(nil)
+	repo.On("FindSuccessfulLogins", uint(1), riskHistorySize).Return([]*domain.LoginHistory{
+		{Status: domain.LoginStatusSuccess, DeviceID: "phone", CountryCode: "TH", Latitude: lat, Longitude: lon, CreatedAt: time.Now().Add(-48 * time.Hour)},
+	}, nil)
+	repo.On("CreateDeviceSession", mock.AnythingOfType("*domain.DeviceSession")).Return(nil)
+	repo.On("CreateRefreshToken", mock.AnythingOfType("*domain.RefreshToken")).Return(nil)
+	sessions := []*domain.DeviceSession{{ID: 5, UserID: 1, DeviceID: "phone"}}
+	repo.On("GetActiveSessions", uint(1)).Return(sessions, nil)
+
+	cache := new(MockCacheRepo)
+	cache.On("Get", mock.Anything).Return(nil, redis.Nil)
+	cache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	geo := new(MockGeoService)
+	geo.On("Lookup", mock.Anything).Return(&domain.GeoLocation{City: "Osaka", Country: "Japan", CountryCode: "JP"}, nil)
+	emailService := new(MockEmailService)
+	emailService.On("SendLoginNotification", user.Email, mock.Anything).Return(nil)
+
+	limits := newTestRateLimitService()
+	service := NewAuthService(repo, emailService, geo, cache, new(MockRevocationRepo), nil, nil, nil, newTestAuditService(), limits, newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	// A new country is challenged with an emailed code
+	var storedCode *domain.AuthCode
+	repo.On("CountFailedLoginsFromIP", "203.0.113.9", mock.Anything).Return(int64(0), nil)
+	repo.On("CreateAuthCode", mock.AnythingOfType("*domain.AuthCode")).
+		Run(func(args mock.Arguments) { storedCode = args.Get(0).(*domain.AuthCode) }).Return(nil)
+	emailService.On("SendLoginVerificationEmail", user.Email, mock.Anything, mock.Anything).Return(nil)
+
+	result, err := service.Login(user.Email, "Test123!", &domain.DeviceSession{DeviceID: "phone", IPAddress: "203.0.113.9"})
+	require.NoError(t, err)
+	require.NotNil(t, result.Challenge)
+	assert.Equal(t, loginVerificationPurpose, result.Challenge.Type)
+	assert.Nil(t, result.Tokens)
+	assert.Equal(t, loginVerificationPurpose, storedCode.Purpose)
+	emailService.AssertCalled(t, "SendLoginVerificationEmail", user.Email, storedCode.Code, mock.Anything)
+
+	repo.On("ValidateAuthCode", uint(1), "000000", loginVerificationPurpose).Return(errors.ErrInvalidLoginCode).Once()
+	_, err = service.CompleteLoginVerification(result.Challenge.Token, "000000", &domain.DeviceSession{IPAddress: "203.0.113.9"})
+	assert.Equal(t, errors.ErrInvalidLoginCode, err)
+
+	repo.On("ValidateAuthCode", uint(1), storedCode.Code, loginVerificationPurpose).Return(nil).Once()
+	result, err = service.CompleteLoginVerification(result.Challenge.Token, storedCode.Code, &domain.DeviceSession{IPAddress: "203.0.113.9"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Tokens.AccessToken)
+	// The wrong code counted as a failure until the right one was entered
+	lockout, err := limits.Lockout(accountLockout, "1")
+	require.NoError(t, err)
+	assert.Zero(t, lockout.Failures)
+
+	// A new country from an address with a burst of failures is blocked outright
+	repo.On("CountFailedLoginsFromIP", "198.51.100.4", mock.Anything).Return(int64(failureBurstThreshold), nil)
+	emailService.On("SendLoginBlockedEmail", user.Email, mock.Anything).Return(nil)
+
+	_, err = service.Login(user.Email, "Test123!", &domain.DeviceSession{DeviceID: "phone", IPAddress: "198.51.100.4"})
+	assert.Equal(t, errors.ErrLoginBlocked, err)
+	emailService.AssertCalled(t, "SendLoginBlockedEmail", user.Email, mock.Anything)
+
+	// A device the user trusts is not asked for a code
+	sessions[0].Trusted = true
+	repo.On("CountFailedLoginsFromIP", "203.0.113.10", mock.Anything).Return(int64(0), nil)
+	result, err = service.Login(user.Email, "Test123!", &domain.DeviceSession{DeviceID: "phone", IPAddress: "203.0.113.10"})
+	require.NoError(t, err)
+	assert.Nil(t, result.Challenge)
+	assert.NotEmpty(t, result.Tokens.AccessToken)
+}
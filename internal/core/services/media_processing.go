@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/imaging"
+)
+
+const (
+	// Photos processed per run of the processing job
+	mediaProcessBatchSize = 20
+	// Photos left in processing this long were abandoned by a crashed worker
+	mediaProcessStaleAfter = 10 * time.Minute
+	mediaJPEGQuality       = 82
+	mediaWebPQuality       = 80
+	// The placeholders are computed from a copy this wide
+	mediaPlaceholderWidth = 32
+)
+
+func (s *mediaService) ProcessPending() (int, error) {
+	pending, err := s.mediaRepo.ClaimPendingMedia(mediaProcessBatchSize, time.Now().Add(-mediaProcessStaleAfter))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim media: %w", err)
+	}
+
+	// A decoded photo takes up to 200MB, only a few are processed at a time
+	queue := make(chan *domain.Media)
+	var processed int64
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers && i < len(pending); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for media := range queue {
+				// Photos that failed for a reason that may pass, like the blob store
+				// being down, stay in processing and are claimed again later
+				if err := s.process(media); err != nil {
+					fmt.Printf("failed to process media %d: %v\n", media.ID, err)
+					continue
+				}
+				atomic.AddInt64(&processed, 1)
+			}
+		}()
+	}
+	for _, media := range pending {
+		queue <- media
+	}
+	close(queue)
+	wg.Wait()
+	return int(processed), nil
+}
+
+// process turns the photo upright and makes the renditions, each from the next larger
+// one, which is much faster than starting from the original every time
+func (s *mediaService) process(media *domain.Media) error {
+	data, err := s.readBlob(media.Hash)
+	if err != nil {
+		return err
+	}
+	img, err := imaging.Decode(data, s.webp)
+	if err != nil {
+		// Trying again would not help
+		media.Status = domain.MediaFailed
+		media.Error = err.Error()
+		return s.mediaRepo.Update(media)
+	}
+
+	var blobs []*domain.MediaBlob
+	// Photos uploaded before metadata was stripped at upload are stripped now
+	if stripped, err := imaging.StripMetadata(media.ContentType, data); err == nil && !bytes.Equal(stripped, data) {
+		blob := newBlob(stripped, media.ContentType)
+		if err := s.putBlob(blob, bytes.NewReader(stripped)); err != nil {
+			return err
+		}
+		blobs = append(blobs, blob)
+		media.Hash = blob.Hash
+		media.SizeBytes = blob.SizeBytes
+	}
+
+	photo := imaging.AutoOrient(img, imaging.Orientation(data))
+	media.Width, media.Height = photo.Rect.Dx(), photo.Rect.Dy()
+
+	formats := []string{"jpeg"}
+	if s.webp != nil {
+		formats = append(formats, "webp")
+	}
+	media.Renditions = nil
+	resized := photo
+	widths := renditionWidths(media.Width)
+	for i := len(widths) - 1; i >= 0; i-- {
+		resized = imaging.Resize(resized, widths[i])
+		for _, format := range formats {
+			encoded, err := s.encode(resized, format)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s rendition: %w", format, err)
+			}
+			blob := newBlob(encoded, "image/"+format)
+			if err := s.putBlob(blob, bytes.NewReader(encoded)); err != nil {
+				return err
+			}
+			blobs = append(blobs, blob)
+			media.Renditions = append(media.Renditions, domain.MediaRendition{
+				MediaID:   media.ID,
+				Width:     resized.Rect.Dx(),
+				Height:    resized.Rect.Dy(),
+				Format:    format,
+				Hash:      blob.Hash,
+				SizeBytes: blob.SizeBytes,
+			})
+		}
+	}
+
+	placeholder := imaging.Resize(resized, mediaPlaceholderWidth)
+	media.Blurhash = imaging.Blurhash(placeholder, 4, 3)
+	media.DominantColor = imaging.DominantColor(placeholder)
+	media.Status = domain.MediaReady
+	media.Error = ""
+	if err := s.mediaRepo.SaveProcessed(media, blobs); err != nil {
+		return fmt.Errorf("failed to save media: %w", err)
+	}
+	return nil
+}
+
+func (s *mediaService) readBlob(hash string) ([]byte, error) {
+	content, err := s.blobs.Get(domain.MediaBlobKey(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media: %w", err)
+	}
+	defer content.Close()
+	return io.ReadAll(io.LimitReader(content, domain.MaxImageSize))
+}
+
+func (s *mediaService) encode(img *image.RGBA, format string) ([]byte, error) {
+	if format == "webp" {
+		return s.webp.Encode(img, mediaWebPQuality)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, imaging.Flatten(img), &jpeg.Options{Quality: mediaJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renditionWidths are the widths smaller than the photo, and the width of the photo
+// when it is narrower than the largest rendition
+func renditionWidths(width int) []int {
+	var widths []int
+	for _, w := range domain.MediaRenditionWidths {
+		if w >= width {
+			return append(widths, width)
+		}
+		widths = append(widths, w)
+	}
+	return widths
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/imaging"
+	"fowergram/pkg/security"
+)
+
+const (
+	// mediaUploadTTL is how long a resumable upload can take
+	mediaUploadTTL = 24 * time.Hour
+	// Media that no post uses, and blobs no media uses, are removed after this long
+	mediaUnusedAfter = 24 * time.Hour
+	// Uploads and blobs removed per run of the cleanup job
+	mediaPurgeBatchSize = 100
+)
+
+type mediaService struct {
+	mediaRepo ports.MediaRepository
+	blobs     ports.BlobStore
+	webp      imaging.WebPCodec
+	publicURL string
+	chunkSize int64
+	workers   int
+}
+
+// NewMediaService keeps files in blobs. Media is served at publicURL followed by
+// "/<hash>". Photos are processed by up to workers at a time. Without a WebP codec,
+// WebP uploads cannot be processed and renditions are only made as JPEG.
+func NewMediaService(mr ports.MediaRepository, blobs ports.BlobStore, webp imaging.WebPCodec, publicURL string, workers int) ports.MediaService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &mediaService{
+		mediaRepo: mr,
+		blobs:     blobs,
+		webp:      webp,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		chunkSize: domain.MediaChunkSize,
+		workers:   workers,
+	}
+}
+
+func (s *mediaService) Upload(userID uint, r io.Reader, size int64) (*domain.Media, error) {
+	if size > domain.MaxVideoSize {
+		return nil, errors.ErrMediaTooLarge
+	}
+	return s.store(userID, r)
+}
+
+// store copies the file to disk while hashing it, so the type and size can be checked
+// before anything is kept. Identical files are only stored once. Photos are stripped
+// of their metadata first and processed in the background.
+func (s *mediaService) store(userID uint, r io.Reader) (*domain.Media, error) {
+	tmp, err := os.CreateTemp("", "fowergram-media-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, domain.MaxVideoSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	contentType, err := checkMediaType(head[:n], size)
+	if err != nil {
+		return nil, err
+	}
+
+	media := &domain.Media{
+		UserID:      userID,
+		ContentType: contentType,
+		Status:      domain.MediaReady,
+	}
+	var blob *domain.MediaBlob
+	if media.IsPhoto() {
+		// Photos are small enough to strip in memory. The hash is of the stripped
+		// photo, so copies with different metadata share a blob.
+		data, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upload: %w", err)
+		}
+		stripped, err := imaging.StripMetadata(contentType, data)
+		if err != nil {
+			return nil, errors.ErrUnsupportedMediaType
+		}
+		blob = newBlob(stripped, contentType)
+		if err := s.putBlob(blob, bytes.NewReader(stripped)); err != nil {
+			return nil, err
+		}
+		media.Status = domain.MediaPending
+	} else {
+		blob = &domain.MediaBlob{
+			Hash:        hex.EncodeToString(hash.Sum(nil)),
+			ContentType: contentType,
+			SizeBytes:   size,
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := s.putBlob(blob, tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	media.Hash = blob.Hash
+	media.SizeBytes = blob.SizeBytes
+	if err := s.mediaRepo.Create(media, blob); err != nil {
+		return nil, fmt.Errorf("failed to save media: %w", err)
+	}
+	s.Present(media)
+	return media, nil
+}
+
+func newBlob(data []byte, contentType string) *domain.MediaBlob {
+	sum := sha256.Sum256(data)
+	return &domain.MediaBlob{
+		Hash:        hex.EncodeToString(sum[:]),
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+	}
+}
+
+// putBlob stores the content unless the blob exists
+func (s *mediaService) putBlob(blob *domain.MediaBlob, r io.Reader) error {
+	if _, err := s.mediaRepo.FindBlob(blob.Hash); err == nil {
+		return nil
+	}
+	if err := s.blobs.Put(blob.Key(), r, blob.SizeBytes, blob.ContentType); err != nil {
+		return fmt.Errorf("failed to store media: %w", err)
+	}
+	return nil
+}
+
+// checkMediaType sniffs the content type from the first bytes of the file and checks
+// the size limit for that type
+func checkMediaType(head []byte, size int64) (string, error) {
+	contentType := http.DetectContentType(head)
+	limit, ok := domain.MediaTypes[contentType]
+	if !ok {
+		return "", errors.ErrUnsupportedMediaType
+	}
+	if size > limit {
+		return "", errors.ErrMediaTooLarge
+	}
+	return contentType, nil
+}
+
+func (s *mediaService) StartUpload(userID uint, req *domain.MediaUploadRequest) (*domain.MediaUpload, error) {
+	if req.SizeBytes > domain.MaxVideoSize {
+		return nil, errors.ErrMediaTooLarge
+	}
+
+	id, err := security.GenerateRandomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	upload := &domain.MediaUpload{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		SizeBytes: req.SizeBytes,
+		ExpiresAt: time.Now().Add(mediaUploadTTL),
+	}
+	if err := s.mediaRepo.CreateUpload(upload); err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	return upload, nil
+}
+
+func (s *mediaService) GetUpload(userID uint, uploadID string) (*domain.MediaUpload, error) {
+	upload, err := s.mediaRepo.FindUpload(uploadID)
+	if err != nil || upload.UserID != userID || time.Now().After(upload.ExpiresAt) {
+		return nil, errors.ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// AppendChunk only accepts the chunk at the current offset, so a client that lost a
+// response asks for the upload and continues from its offset. All chunks but the last
+// have the chunk size.
+func (s *mediaService) AppendChunk(userID uint, uploadID string, offset int64, chunk []byte) (*domain.MediaUpload, *domain.Media, error) {
+	upload, err := s.GetUpload(userID, uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if upload.Complete() || offset != upload.ReceivedBytes {
+		return upload, nil, errors.ErrUploadOffsetMismatch
+	}
+
+	size := int64(len(chunk))
+	remaining := upload.SizeBytes - offset
+	if size == 0 || size > s.chunkSize || size > remaining || (size < s.chunkSize && size != remaining) {
+		return upload, nil, errors.ErrInvalidChunk
+	}
+	// Files of the wrong type are turned away with the first chunk
+	if offset == 0 {
+		if _, err := checkMediaType(chunk, upload.SizeBytes); err != nil {
+			s.discardUpload(upload)
+			return nil, nil, err
+		}
+	}
+
+	if err := s.blobs.Put(upload.ChunkKey(offset/s.chunkSize), bytes.NewReader(chunk), size, "application/octet-stream"); err != nil {
+		return nil, nil, fmt.Errorf("failed to store chunk: %w", err)
+	}
+	if size < remaining {
+		upload.ReceivedBytes += size
+		if err := s.mediaRepo.UpdateUpload(upload); err != nil {
+			return nil, nil, fmt.Errorf("failed to save upload: %w", err)
+		}
+		return upload, nil, nil
+	}
+
+	// The offset only moves past the last chunk once the media is saved, so the
+	// client can send it again when that fails
+	chunks := &chunkReader{blobs: s.blobs, upload: upload, count: s.chunkCount(upload)}
+	defer chunks.Close()
+	media, err := s.store(userID, chunks)
+	if err != nil {
+		if _, ok := err.(*errors.AuthError); ok {
+			s.discardUpload(upload)
+		}
+		return nil, nil, err
+	}
+
+	upload.ReceivedBytes = upload.SizeBytes
+	upload.MediaID = &media.ID
+	if err := s.mediaRepo.UpdateUpload(upload); err != nil {
+		return nil, nil, fmt.Errorf("failed to save upload: %w", err)
+	}
+	s.deleteChunks(upload)
+	return upload, media, nil
+}
+
+func (s *mediaService) chunkCount(upload *domain.MediaUpload) int64 {
+	return (upload.SizeBytes + s.chunkSize - 1) / s.chunkSize
+}
+
+func (s *mediaService) deleteChunks(upload *domain.MediaUpload) {
+	for i := int64(0); i < s.chunkCount(upload); i++ {
+		if err := s.blobs.Delete(upload.ChunkKey(i)); err != nil {
+			fmt.Printf("failed to delete chunk %d of upload %s: %v\n", i, upload.ID, err)
+		}
+	}
+}
+
+func (s *mediaService) discardUpload(upload *domain.MediaUpload) {
+	s.deleteChunks(upload)
+	if err := s.mediaRepo.DeleteUpload(upload.ID); err != nil {
+		fmt.Printf("failed to delete upload %s: %v\n", upload.ID, err)
+	}
+}
+
+// chunkReader reads the chunks of an upload one after the other
+type chunkReader struct {
+	blobs   ports.BlobStore
+	upload  *domain.MediaUpload
+	count   int64
+	next    int64
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.next == r.count {
+				return 0, io.EOF
+			}
+			chunk, err := r.blobs.Get(r.upload.ChunkKey(r.next))
+			if err != nil {
+				return 0, fmt.Errorf("failed to read chunk %d: %w", r.next, err)
+			}
+			r.current = chunk
+			r.next++
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
+
+func (s *mediaService) Get(userID, id uint) (*domain.Media, error) {
+	media, err := s.mediaRepo.FindByID(id)
+	if err != nil || media.UserID != userID {
+		return nil, errors.ErrMediaNotFound
+	}
+	s.Present(media)
+	return media, nil
+}
+
+func (s *mediaService) Present(media *domain.Media) {
+	media.URL = s.publicURL + "/" + media.Hash
+	for i := range media.Renditions {
+		media.Renditions[i].URL = s.publicURL + "/" + media.Renditions[i].Hash
+	}
+}
+
+func (s *mediaService) Open(hash string) (io.ReadCloser, *domain.MediaBlob, error) {
+	if len(hash) != sha256.Size*2 {
+		return nil, nil, errors.ErrMediaNotFound
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return nil, nil, errors.ErrMediaNotFound
+	}
+
+	blob, err := s.mediaRepo.FindBlob(hash)
+	if err != nil {
+		return nil, nil, errors.ErrMediaNotFound
+	}
+	content, err := s.blobs.Get(blob.Key())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read media: %w", err)
+	}
+	return content, blob, nil
+}
+
+func (s *mediaService) PurgeUnused() (int, error) {
+	now := time.Now()
+	purged := 0
+
+	uploads, err := s.mediaRepo.FindExpiredUploads(now, mediaPurgeBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired uploads: %w", err)
+	}
+	for _, upload := range uploads {
+		s.discardUpload(upload)
+		purged++
+	}
+
+	before := now.Add(-mediaUnusedAfter)
+	if _, err := s.mediaRepo.DeleteUnattached(before); err != nil {
+		return purged, fmt.Errorf("failed to delete unused media: %w", err)
+	}
+
+	blobs, err := s.mediaRepo.FindUnusedBlobs(before, mediaPurgeBatchSize)
+	if err != nil {
+		return purged, fmt.Errorf("failed to find unused blobs: %w", err)
+	}
+	for _, blob := range blobs {
+		// The row goes first, a blob that was used again meanwhile is kept
+		deleted, err := s.mediaRepo.DeleteBlobIfUnused(blob.Hash, before)
+		if err != nil {
+			fmt.Printf("failed to delete blob %s: %v\n", blob.Hash, err)
+			continue
+		}
+		if !deleted {
+			continue
+		}
+		if err := s.blobs.Delete(blob.Key()); err != nil {
+			fmt.Printf("failed to delete blob %s from storage: %v\n", blob.Hash, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
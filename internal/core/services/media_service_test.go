@@ -0,0 +1,441 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryMediaRepo struct {
+	// mu guards the methods processing workers call
+	mu      sync.Mutex
+	media   map[uint]*domain.Media
+	blobs   map[string]*domain.MediaBlob
+	uploads map[string]*domain.MediaUpload
+	// attached media is used by a post
+	attached map[uint]bool
+}
+
+func newMemoryMediaRepo() *memoryMediaRepo {
+	return &memoryMediaRepo{
+		media:    make(map[uint]*domain.Media),
+		blobs:    make(map[string]*domain.MediaBlob),
+		uploads:  make(map[string]*domain.MediaUpload),
+		attached: make(map[uint]bool),
+	}
+}
+
+func (r *memoryMediaRepo) Create(media *domain.Media, blob *domain.MediaBlob) error {
+	blob.LastUsedAt = time.Now()
+	if existing, ok := r.blobs[blob.Hash]; ok {
+		existing.LastUsedAt = blob.LastUsedAt
+	} else {
+		r.blobs[blob.Hash] = blob
+	}
+	media.ID = uint(len(r.media) + 1)
+	media.CreatedAt = time.Now()
+	r.media[media.ID] = media
+	return nil
+}
+
+func (r *memoryMediaRepo) FindByID(id uint) (*domain.Media, error) {
+	media, ok := r.media[id]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	copied := *media
+	return &copied, nil
+}
+
+func (r *memoryMediaRepo) FindBlob(hash string) (*domain.MediaBlob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blob, ok := r.blobs[hash]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	return blob, nil
+}
+
+func (r *memoryMediaRepo) CreateUpload(upload *domain.MediaUpload) error {
+	r.uploads[upload.ID] = upload
+	return nil
+}
+
+func (r *memoryMediaRepo) FindUpload(id string) (*domain.MediaUpload, error) {
+	upload, ok := r.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	copied := *upload
+	return &copied, nil
+}
+
+func (r *memoryMediaRepo) UpdateUpload(upload *domain.MediaUpload) error {
+	r.uploads[upload.ID] = upload
+	return nil
+}
+
+func (r *memoryMediaRepo) DeleteUpload(id string) error {
+	delete(r.uploads, id)
+	return nil
+}
+
+func (r *memoryMediaRepo) FindExpiredUploads(now time.Time, limit int) ([]*domain.MediaUpload, error) {
+	var expired []*domain.MediaUpload
+	for _, upload := range r.uploads {
+		if upload.ExpiresAt.Before(now) {
+			expired = append(expired, upload)
+		}
+	}
+	return expired, nil
+}
+
+func (r *memoryMediaRepo) ClaimPendingMedia(limit int, staleBefore time.Time) ([]*domain.Media, error) {
+	var claimed []*domain.Media
+	for _, media := range r.media {
+		if media.Status == domain.MediaPending || (media.Status == domain.MediaProcessing && media.UpdatedAt.Before(staleBefore)) {
+			media.Status = domain.MediaProcessing
+			media.UpdatedAt = time.Now()
+			copied := *media
+			claimed = append(claimed, &copied)
+		}
+	}
+	return claimed, nil
+}
+
+func (r *memoryMediaRepo) SaveProcessed(media *domain.Media, blobs []*domain.MediaBlob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, blob := range blobs {
+		if _, ok := r.blobs[blob.Hash]; !ok {
+			r.blobs[blob.Hash] = blob
+		}
+		r.blobs[blob.Hash].LastUsedAt = time.Now()
+	}
+	r.media[media.ID] = media
+	return nil
+}
+
+func (r *memoryMediaRepo) Update(media *domain.Media) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.media[media.ID] = media
+	return nil
+}
+
+func (r *memoryMediaRepo) DeleteUnattached(before time.Time) (int64, error) {
+	var deleted int64
+	for id, media := range r.media {
+		if !r.attached[id] && media.CreatedAt.Before(before) {
+			delete(r.media, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *memoryMediaRepo) used(hash string) bool {
+	for _, media := range r.media {
+		if media.Hash == hash {
+			return true
+		}
+		for _, rendition := range media.Renditions {
+			if rendition.Hash == hash {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *memoryMediaRepo) FindUnusedBlobs(before time.Time, limit int) ([]*domain.MediaBlob, error) {
+	var unused []*domain.MediaBlob
+	for _, blob := range r.blobs {
+		if blob.LastUsedAt.Before(before) && !r.used(blob.Hash) {
+			unused = append(unused, blob)
+		}
+	}
+	return unused, nil
+}
+
+func (r *memoryMediaRepo) DeleteBlobIfUnused(hash string, before time.Time) (bool, error) {
+	blob, ok := r.blobs[hash]
+	if !ok || !blob.LastUsedAt.Before(before) || r.used(hash) {
+		return false, nil
+	}
+	delete(r.blobs, hash)
+	return true, nil
+}
+
+func newTestMediaService(t *testing.T) (*mediaService, *memoryMediaRepo, *storage.LocalStore) {
+	repo := newMemoryMediaRepo()
+	blobs := storage.NewLocalStore(t.TempDir())
+	service := NewMediaService(repo, blobs, fakeWebP{}, "https://api.example.com/media/", 2).(*mediaService)
+	return service, repo, blobs
+}
+
+// fakeWebP stands in for the libwebp tools, which are not installed everywhere the
+// tests run
+type fakeWebP struct{}
+
+func (fakeWebP) Encode(img image.Image, quality int) ([]byte, error) {
+	return []byte(fmt.Sprintf("RIFF\x00\x00\x00\x00WEBP%dx%d", img.Bounds().Dx(), img.Bounds().Dy())), nil
+}
+
+func (fakeWebP) Decode(data []byte) (image.Image, error) {
+	return nil, fmt.Errorf("cannot decode")
+}
+
+// testPNG returns a PNG of about the given size in bytes, noise keeps it from
+// compressing
+func testPNG(t *testing.T, size int) []byte {
+	side := 1
+	for side*side*4 < size {
+		side++
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, side, side))
+	noise := rand.New(rand.NewSource(int64(size)))
+	noise.Read(img.Pix)
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestMediaService_Upload(t *testing.T) {
+	service, repo, blobs := newTestMediaService(t)
+	content := testPNG(t, 1000)
+
+	media, err := service.Upload(1, bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", media.ContentType)
+	assert.Equal(t, int64(len(content)), media.SizeBytes)
+	assert.Equal(t, "https://api.example.com/media/"+media.Hash, media.URL)
+
+	// The same file uploaded again shares the blob
+	again, err := service.Upload(2, bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	assert.NotEqual(t, media.ID, again.ID)
+	assert.Equal(t, media.Hash, again.Hash)
+	assert.Len(t, repo.blobs, 1)
+
+	r, blob, err := service.Open(media.Hash)
+	require.NoError(t, err)
+	r.Close()
+	assert.Equal(t, "image/png", blob.ContentType)
+
+	// Only the uploader can use the media in a post
+	_, err = service.Get(2, media.ID)
+	assert.Equal(t, errors.ErrMediaNotFound, err)
+	_, _, err = service.Open("../../etc/passwd")
+	assert.Equal(t, errors.ErrMediaNotFound, err)
+
+	// The type is sniffed, a script named photo.png is still a script
+	_, err = service.Upload(1, strings.NewReader("<script>alert(1)</script>"), 25)
+	assert.Equal(t, errors.ErrUnsupportedMediaType, err)
+	_, err = service.Upload(1, bytes.NewReader(content), domain.MaxVideoSize+1)
+	assert.Equal(t, errors.ErrMediaTooLarge, err)
+	// Images have a lower limit than videos, whatever size the client claims
+	large := append(testPNG(t, 1000), make([]byte, domain.MaxImageSize)...)
+	_, err = service.Upload(1, bytes.NewReader(large), 10)
+	assert.Equal(t, errors.ErrMediaTooLarge, err)
+	assert.Len(t, repo.media, 2)
+
+	// Unused media and blobs are removed a day after the upload
+	repo.attached[media.ID] = true
+	for _, m := range repo.media {
+		m.CreatedAt = time.Now().Add(-25 * time.Hour)
+	}
+	repo.blobs[media.Hash].LastUsedAt = time.Now().Add(-25 * time.Hour)
+	purged, err := service.PurgeUnused()
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+	assert.Len(t, repo.media, 1)
+
+	repo.attached[media.ID] = false
+	purged, err = service.PurgeUnused()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	exists, err := blobs.Exists(domain.MediaBlobKey(media.Hash))
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestMediaService_ResumableUpload(t *testing.T) {
+	service, repo, blobs := newTestMediaService(t)
+	service.chunkSize = 1024
+	content := testPNG(t, 3000)
+
+	upload, err := service.StartUpload(1, &domain.MediaUploadRequest{SizeBytes: int64(len(content))})
+	require.NoError(t, err)
+
+	_, err = service.GetUpload(2, upload.ID)
+	assert.Equal(t, errors.ErrUploadNotFound, err)
+	// Chunks must have the chunk size and follow each other
+	_, _, err = service.AppendChunk(1, upload.ID, 0, content[:100])
+	assert.Equal(t, errors.ErrInvalidChunk, err)
+	_, _, err = service.AppendChunk(1, upload.ID, 1024, content[1024:2048])
+	assert.Equal(t, errors.ErrUploadOffsetMismatch, err)
+
+	var media *domain.Media
+	for offset := 0; offset < len(content); offset += 1024 {
+		end := offset + 1024
+		if end > len(content) {
+			end = len(content)
+		}
+		upload, media, err = service.AppendChunk(1, upload.ID, int64(offset), content[offset:end])
+		require.NoError(t, err)
+		assert.Equal(t, int64(end), upload.ReceivedBytes)
+		// A chunk sent twice is refused, the client continues at the offset
+		if end < len(content) {
+			_, _, err = service.AppendChunk(1, upload.ID, int64(offset), content[offset:end])
+			assert.Equal(t, errors.ErrUploadOffsetMismatch, err)
+		}
+	}
+	require.NotNil(t, media)
+	assert.Equal(t, media.ID, *upload.MediaID)
+	assert.Equal(t, "image/png", media.ContentType)
+
+	r, _, err := service.Open(media.Hash)
+	require.NoError(t, err)
+	var got bytes.Buffer
+	_, err = got.ReadFrom(r)
+	r.Close()
+	require.NoError(t, err)
+	assert.Equal(t, content, got.Bytes())
+
+	// The chunks are gone once the file is assembled
+	exists, err := blobs.Exists(upload.ChunkKey(0))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// Anything but media is turned away with the first chunk
+	text, err := service.StartUpload(1, &domain.MediaUploadRequest{SizeBytes: 12})
+	require.NoError(t, err)
+	_, _, err = service.AppendChunk(1, text.ID, 0, []byte("hello, world"))
+	assert.Equal(t, errors.ErrUnsupportedMediaType, err)
+	assert.NotContains(t, repo.uploads, text.ID)
+
+	// Abandoned uploads expire with their chunks
+	abandoned, err := service.StartUpload(1, &domain.MediaUploadRequest{SizeBytes: int64(len(content))})
+	require.NoError(t, err)
+	_, _, err = service.AppendChunk(1, abandoned.ID, 0, content[:1024])
+	require.NoError(t, err)
+	repo.uploads[abandoned.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	purged, err := service.PurgeUnused()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	exists, err = blobs.Exists(abandoned.ChunkKey(0))
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+// testJPEG returns a photo as a phone takes it: sideways with an EXIF orientation, and
+// with the location it was taken
+func testJPEG(t *testing.T, width, height, orientation int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 160, 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00")
+	exif[25] = byte(orientation)
+	exif = append(exif, "GPS 18.7883N 98.9853E"...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	return append(append(append([]byte{0xFF, 0xD8}, segment...), exif...), buf.Bytes()[2:]...)
+}
+
+func TestMediaService_ProcessPending(t *testing.T) {
+	service, repo, _ := newTestMediaService(t)
+	content := testJPEG(t, 1200, 800, 6)
+
+	photo, err := service.Upload(1, bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	assert.Equal(t, domain.MediaPending, photo.Status)
+	// The location is gone before the photo is stored, the orientation stays
+	r, _, err := service.Open(photo.Hash)
+	require.NoError(t, err)
+	var stored bytes.Buffer
+	_, err = stored.ReadFrom(r)
+	r.Close()
+	require.NoError(t, err)
+	assert.NotContains(t, stored.String(), "GPS")
+	assert.Less(t, photo.SizeBytes, int64(len(content)))
+
+	// PNG data that does not decode fails for good
+	broken := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	binary.BigEndian.PutUint32(broken[8:], 88)
+	failed, err := service.Upload(1, bytes.NewReader(broken), int64(len(broken)))
+	require.NoError(t, err)
+
+	processed, err := service.ProcessPending()
+	require.NoError(t, err)
+	assert.Equal(t, 2, processed)
+	assert.Equal(t, domain.MediaFailed, repo.media[failed.ID].Status)
+
+	media, err := service.Get(1, photo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.MediaReady, media.Status)
+	// Turned upright
+	assert.Equal(t, 800, media.Width)
+	assert.Equal(t, 1200, media.Height)
+	assert.Len(t, media.Blurhash, 28)
+	assert.Regexp(t, "^#[0-9a-f]{6}$", media.DominantColor)
+
+	// The photo is narrower than the largest width, which is left out
+	widths := make(map[string][]int)
+	for _, rendition := range media.Renditions {
+		widths[rendition.Format] = append(widths[rendition.Format], rendition.Width)
+		assert.Equal(t, rendition.Width*3/2, rendition.Height)
+		assert.Equal(t, "https://api.example.com/media/"+rendition.Hash, rendition.URL)
+
+		r, blob, err := service.Open(rendition.Hash)
+		require.NoError(t, err)
+		r.Close()
+		assert.Equal(t, "image/"+rendition.Format, blob.ContentType)
+	}
+	assert.ElementsMatch(t, []int{150, 320, 640, 800}, widths["jpeg"])
+	assert.ElementsMatch(t, []int{150, 320, 640, 800}, widths["webp"])
+
+	// Renditions keep their blobs from being removed
+	repo.attached[media.ID] = true
+	for _, blob := range repo.blobs {
+		blob.LastUsedAt = time.Now().Add(-25 * time.Hour)
+	}
+	_, err = service.PurgeUnused()
+	require.NoError(t, err)
+	for _, rendition := range media.Renditions {
+		assert.Contains(t, repo.blobs, rendition.Hash)
+	}
+
+	processed, err = service.ProcessPending()
+	require.NoError(t, err)
+	assert.Equal(t, 0, processed)
+}
+
+func TestRenditionWidths(t *testing.T) {
+	assert.Equal(t, []int{150, 320, 640, 1080}, renditionWidths(4000))
+	assert.Equal(t, []int{150, 320, 640}, renditionWidths(640))
+	assert.Equal(t, []int{100}, renditionWidths(100))
+}
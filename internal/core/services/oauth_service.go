@@ -0,0 +1,509 @@
+package services
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/identity"
+	"fowergram/pkg/security"
+)
+
+const (
+	oauthCodeTTL         = time.Minute
+	oauthAccessTokenTTL  = time.Hour
+	oauthRefreshTokenTTL = 30 * 24 * time.Hour
+
+	oauthCodePrefix = "oauth_code:"
+
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+
+	// Token type hints of RFC 7009
+	tokenTypeAccessToken  = "access_token"
+	tokenTypeRefreshToken = "refresh_token"
+)
+
+type oauthService struct {
+	oauthRepo     ports.OAuthRepository
+	challengeRepo ports.ChallengeRepository
+	keys          *security.KeyRing
+}
+
+func NewOAuthService(or ports.OAuthRepository, chr ports.ChallengeRepository, keys *security.KeyRing) ports.OAuthService {
+	return &oauthService{
+		oauthRepo:     or,
+		challengeRepo: chr,
+		keys:          keys,
+	}
+}
+
+// RegisterClient creates a client for a third-party app. The secret of a confidential
+// client is only returned here.
+func (s *oauthService) RegisterClient(ownerID uint, req *domain.OAuthClientRequest) (*domain.OAuthClientCredentials, error) {
+	for _, redirectURI := range req.RedirectURIs {
+		if !validRedirectURI(redirectURI, req.Public) {
+			return nil, errors.ErrOAuthInvalidRedirectURI
+		}
+	}
+
+	scopes, err := normalizeScopes(strings.Join(req.Scopes, " "), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := security.GenerateDeviceID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client ID: %w", err)
+	}
+
+	client := &domain.OAuthClient{
+		ClientID:     clientID,
+		OwnerID:      ownerID,
+		Name:         req.Name,
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+		Scopes:       scopes,
+		Public:       req.Public,
+	}
+
+	var secret string
+	if !req.Public {
+		if secret, err = randomToken(); err != nil {
+			return nil, err
+		}
+		client.SecretHash = security.HashToken(secret)
+	}
+
+	if err := s.oauthRepo.CreateClient(client); err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	return &domain.OAuthClientCredentials{
+		Client:       client,
+		ClientSecret: secret,
+	}, nil
+}
+
+func (s *oauthService) ListClients(ownerID uint) ([]*domain.OAuthClient, error) {
+	return s.oauthRepo.FindClientsByOwner(ownerID)
+}
+
+func (s *oauthService) DeleteClient(ownerID uint, clientID string) error {
+	if err := s.oauthRepo.DeleteClient(ownerID, clientID); err != nil {
+		return errors.ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+func (s *oauthService) Authorize(userID uint, req *domain.OAuthAuthorizeRequest) (*domain.OAuthConsentScreen, error) {
+	client, redirectURI, scope, err := s.validateAuthorization(req)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := make([]domain.OAuthScopeDescription, 0)
+	for _, name := range strings.Fields(scope) {
+		scopes = append(scopes, domain.OAuthScopeDescription{
+			Name:        name,
+			Description: domain.OAuthScopes[name],
+		})
+	}
+
+	return &domain.OAuthConsentScreen{
+		ClientID:    client.ClientID,
+		ClientName:  client.Name,
+		Scopes:      scopes,
+		RedirectURI: redirectURI,
+		State:       req.State,
+	}, nil
+}
+
+// Consent issues an authorization code when the user approved the request. The request
+// is validated again because the consent screen is rendered by the client.
+func (s *oauthService) Consent(userID uint, req *domain.OAuthConsentRequest) (string, error) {
+	client, redirectURI, scope, err := s.validateAuthorization(&req.OAuthAuthorizeRequest)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !req.Approve {
+		params.Set("error", "access_denied")
+		return appendQuery(redirectURI, params), nil
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(&domain.OAuthAuthorization{
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		CodeChallenge: req.CodeChallenge,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode authorization: %w", err)
+	}
+
+	// Only the hash is stored, a leaked Redis dump cannot be used to redeem codes
+	if err := s.challengeRepo.SaveChallenge(oauthCodePrefix+security.HashToken(code), data, oauthCodeTTL); err != nil {
+		return "", fmt.Errorf("failed to store authorization code: %w", err)
+	}
+
+	params.Set("code", code)
+	return appendQuery(redirectURI, params), nil
+}
+
+func (s *oauthService) Token(req *domain.OAuthTokenRequest) (*domain.OAuthTokenResponse, error) {
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case grantTypeAuthorizationCode:
+		return s.exchangeCode(client, req)
+	case grantTypeRefreshToken:
+		return s.refresh(client, req)
+	default:
+		return nil, errors.ErrOAuthUnsupportedGrantType
+	}
+}
+
+// Introspect describes a token to the client it was issued to. Tokens of other clients
+// are reported as inactive so clients cannot probe each other's tokens.
+func (s *oauthService) Introspect(clientID, clientSecret, token string) (*domain.OAuthIntrospection, error) {
+	client, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	grant, tokenType, err := s.findGrant(token)
+	if err != nil || grant.ClientID != client.ClientID || grant.RevokedAt != nil {
+		return &domain.OAuthIntrospection{Active: false}, nil
+	}
+
+	expiresAt := grant.ExpiresAt
+	if tokenType == tokenTypeRefreshToken {
+		expiresAt = grant.RefreshExpiresAt
+	}
+	if time.Now().After(expiresAt) {
+		return &domain.OAuthIntrospection{Active: false}, nil
+	}
+
+	return &domain.OAuthIntrospection{
+		Active:    true,
+		Scope:     grant.Scope,
+		ClientID:  grant.ClientID,
+		Subject:   strconv.FormatUint(uint64(grant.UserID), 10),
+		TokenType: tokenType,
+		ExpiresAt: expiresAt.Unix(),
+		IssuedAt:  grant.CreatedAt.Unix(),
+	}, nil
+}
+
+// Revoke revokes the grant behind an access or refresh token. Unknown tokens are not an
+// error, as required by RFC 7009.
+func (s *oauthService) Revoke(clientID, clientSecret, token string) error {
+	client, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	grant, _, err := s.findGrant(token)
+	if err != nil || grant.ClientID != client.ClientID {
+		return nil
+	}
+
+	if err := s.oauthRepo.RevokeToken(grant.ID); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func (s *oauthService) ValidateAccessToken(token string) (*domain.OAuthToken, error) {
+	claims, err := security.ParseOAuthAccessToken(token, s.keys)
+	if err != nil {
+		return nil, errors.ErrInvalidToken
+	}
+
+	grant, err := s.oauthRepo.FindTokenByTokenID(claims.Id)
+	if err != nil || grant.RevokedAt != nil {
+		return nil, errors.ErrInvalidToken
+	}
+
+	return grant, nil
+}
+
+func (s *oauthService) exchangeCode(client *domain.OAuthClient, req *domain.OAuthTokenRequest) (*domain.OAuthTokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, errors.ErrOAuthInvalidRequest
+	}
+
+	data, err := s.challengeRepo.TakeChallenge(oauthCodePrefix + security.HashToken(req.Code))
+	if err != nil {
+		return nil, errors.ErrOAuthInvalidGrant
+	}
+
+	var authorization domain.OAuthAuthorization
+	if err := json.Unmarshal(data, &authorization); err != nil {
+		return nil, errors.ErrOAuthInvalidGrant
+	}
+
+	if authorization.ClientID != client.ClientID || authorization.RedirectURI != req.RedirectURI {
+		return nil, errors.ErrOAuthInvalidGrant
+	}
+
+	challenge := identity.CodeChallengeS256(req.CodeVerifier)
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(authorization.CodeChallenge)) != 1 {
+		return nil, errors.ErrOAuthInvalidGrant
+	}
+
+	// Every token refreshed from this one joins its family
+	familyID, err := security.GenerateRandomString(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token family: %w", err)
+	}
+
+	grant, refreshToken, err := newOAuthToken(client.ClientID, authorization.UserID, authorization.Scope, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.oauthRepo.CreateToken(grant); err != nil {
+		return nil, fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return s.tokenResponse(grant, refreshToken)
+}
+
+// refresh rotates the refresh token. The scope can be narrowed but never widened.
+// Presenting a token that was already rotated revokes its whole family, since either
+// the client or an attacker is holding a stolen copy.
+func (s *oauthService) refresh(client *domain.OAuthClient, req *domain.OAuthTokenRequest) (*domain.OAuthTokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, errors.ErrOAuthInvalidRequest
+	}
+
+	grant, err := s.oauthRepo.FindTokenByRefreshHash(security.HashToken(req.RefreshToken))
+	if err != nil || grant.ClientID != client.ClientID {
+		return nil, errors.ErrOAuthInvalidGrant
+	}
+	if grant.RotatedAt != nil {
+		s.revokeTokenFamily(grant.FamilyID)
+		return nil, errors.ErrOAuthInvalidGrant
+	}
+	if grant.RevokedAt != nil || time.Now().After(grant.RefreshExpiresAt) {
+		return nil, errors.ErrOAuthInvalidGrant
+	}
+
+	scope := grant.Scope
+	if req.Scope != "" {
+		if scope, err = normalizeScopes(req.Scope, strings.Fields(grant.Scope)); err != nil {
+			return nil, err
+		}
+	}
+
+	next, refreshToken, err := newOAuthToken(client.ClientID, grant.UserID, scope, grant.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.oauthRepo.RotateToken(grant.ID, next); err != nil {
+		if err == errors.ErrRefreshTokenReused {
+			// Lost a race against another use of the same token
+			s.revokeTokenFamily(grant.FamilyID)
+			return nil, errors.ErrOAuthInvalidGrant
+		}
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return s.tokenResponse(next, refreshToken)
+}
+
+func (s *oauthService) revokeTokenFamily(familyID string) {
+	if err := s.oauthRepo.RevokeTokenFamily(familyID); err != nil {
+		fmt.Printf("failed to revoke OAuth token family: %v\n", err)
+	}
+}
+
+// newOAuthToken prepares a grant in the family and returns it with its refresh token
+func newOAuthToken(clientID string, userID uint, scope, familyID string) (*domain.OAuthToken, string, error) {
+	tokenID, err := security.GenerateDeviceID()
+	if err != nil {
+		return nil, "", err
+	}
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	grant := &domain.OAuthToken{
+		TokenID:          tokenID,
+		ClientID:         clientID,
+		UserID:           userID,
+		FamilyID:         familyID,
+		Scope:            scope,
+		RefreshTokenHash: security.HashToken(refreshToken),
+		ExpiresAt:        now.Add(oauthAccessTokenTTL),
+		RefreshExpiresAt: now.Add(oauthRefreshTokenTTL),
+	}
+	return grant, refreshToken, nil
+}
+
+func (s *oauthService) tokenResponse(grant *domain.OAuthToken, refreshToken string) (*domain.OAuthTokenResponse, error) {
+	accessToken, err := security.GenerateOAuthAccessToken(grant.UserID, grant.TokenID, grant.ClientID, grant.Scope, s.keys, oauthAccessTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return &domain.OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        grant.Scope,
+	}, nil
+}
+
+// authenticateClient checks the client secret. Public clients have none and must not
+// send one.
+func (s *oauthService) authenticateClient(clientID, clientSecret string) (*domain.OAuthClient, error) {
+	if clientID == "" {
+		return nil, errors.ErrOAuthInvalidClient
+	}
+
+	client, err := s.oauthRepo.FindClientByClientID(clientID)
+	if err != nil {
+		return nil, errors.ErrOAuthInvalidClient
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return nil, errors.ErrOAuthInvalidClient
+		}
+		return client, nil
+	}
+
+	if clientSecret == "" || subtle.ConstantTimeCompare([]byte(security.HashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, errors.ErrOAuthInvalidClient
+	}
+	return client, nil
+}
+
+// findGrant accepts either kind of token and reports which one it was
+func (s *oauthService) findGrant(token string) (*domain.OAuthToken, string, error) {
+	if claims, err := security.ParseOAuthAccessToken(token, s.keys); err == nil {
+		grant, err := s.oauthRepo.FindTokenByTokenID(claims.Id)
+		return grant, tokenTypeAccessToken, err
+	}
+
+	grant, err := s.oauthRepo.FindTokenByRefreshHash(security.HashToken(token))
+	return grant, tokenTypeRefreshToken, err
+}
+
+// validateAuthorization checks an authorization request against the registered client
+// and returns the redirect URI and scope to use
+func (s *oauthService) validateAuthorization(req *domain.OAuthAuthorizeRequest) (*domain.OAuthClient, string, string, error) {
+	client, err := s.oauthRepo.FindClientByClientID(req.ClientID)
+	if err != nil {
+		return nil, "", "", errors.ErrOAuthInvalidClient
+	}
+
+	// The redirect URI can only be left out when the client registered exactly one
+	registered := client.RedirectURIList()
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(registered) == 1 {
+		redirectURI = registered[0]
+	}
+	if !containsString(registered, redirectURI) {
+		return nil, "", "", errors.ErrOAuthInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return nil, "", "", errors.ErrOAuthUnsupportedResponseType
+	}
+
+	// RFC 7636 verifiers are 43 to 128 characters, so are their S256 challenges
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		return nil, "", "", errors.ErrOAuthPKCERequired
+	}
+
+	scope, err := normalizeScopes(req.Scope, client.ScopeList())
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return client, redirectURI, scope, nil
+}
+
+// normalizeScopes checks a space separated scope list against the known scopes and, if
+// given, the allowed ones. Duplicates are dropped.
+func normalizeScopes(scope string, allowed []string) (string, error) {
+	var scopes []string
+	for _, name := range strings.Fields(scope) {
+		if _, ok := domain.OAuthScopes[name]; !ok {
+			return "", errors.ErrOAuthInvalidScope
+		}
+		if allowed != nil && !containsString(allowed, name) {
+			return "", errors.ErrOAuthInvalidScope
+		}
+		if !containsString(scopes, name) {
+			scopes = append(scopes, name)
+		}
+	}
+
+	if len(scopes) == 0 {
+		return "", errors.ErrOAuthInvalidScope
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// validRedirectURI requires HTTPS except for loopback addresses. Public clients may also
+// use a custom scheme to return to a native app.
+func validRedirectURI(raw string, public bool) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Fragment != "" || parsed.Scheme == "" {
+		return false
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return parsed.Host != ""
+	case "http":
+		host := parsed.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return public && strings.Contains(parsed.Scheme, ".")
+	}
+}
+
+func appendQuery(redirectURI string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	return redirectURI + separator + params.Encode()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
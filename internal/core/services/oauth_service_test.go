@@ -0,0 +1,416 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/identity"
+	"fowergram/pkg/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryOAuthRepo struct {
+	clients []*domain.OAuthClient
+	tokens  []*domain.OAuthToken
+}
+
+func (r *memoryOAuthRepo) CreateClient(client *domain.OAuthClient) error {
+	client.ID = uint(len(r.clients) + 1)
+	r.clients = append(r.clients, client)
+	return nil
+}
+
+func (r *memoryOAuthRepo) FindClientByClientID(clientID string) (*domain.OAuthClient, error) {
+	for _, client := range r.clients {
+		if client.ClientID == clientID {
+			return client, nil
+		}
+	}
+	return nil, fmt.Errorf("client not found")
+}
+
+func (r *memoryOAuthRepo) FindClientsByOwner(ownerID uint) ([]*domain.OAuthClient, error) {
+	var clients []*domain.OAuthClient
+	for _, client := range r.clients {
+		if client.OwnerID == ownerID {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
+
+func (r *memoryOAuthRepo) DeleteClient(ownerID uint, clientID string) error {
+	for i, client := range r.clients {
+		if client.OwnerID == ownerID && client.ClientID == clientID {
+			r.clients = append(r.clients[:i], r.clients[i+1:]...)
+			for _, token := range r.tokens {
+				if token.ClientID == clientID {
+					_ = r.RevokeToken(token.ID)
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("client not found")
+}
+
+func (r *memoryOAuthRepo) CreateToken(token *domain.OAuthToken) error {
+	token.ID = uint(len(r.tokens) + 1)
+	token.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memoryOAuthRepo) FindTokenByTokenID(tokenID string) (*domain.OAuthToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenID == tokenID {
+			return token, nil
+		}
+	}
+	return nil, fmt.Errorf("token not found")
+}
+
+func (r *memoryOAuthRepo) FindTokenByRefreshHash(hash string) (*domain.OAuthToken, error) {
+	for _, token := range r.tokens {
+		if token.RefreshTokenHash == hash {
+			return token, nil
+		}
+	}
+	return nil, fmt.Errorf("token not found")
+}
+
+func (r *memoryOAuthRepo) RevokeToken(id uint) error {
+	for _, token := range r.tokens {
+		if token.ID == id && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *memoryOAuthRepo) RotateToken(id uint, next *domain.OAuthToken) error {
+	for _, token := range r.tokens {
+		if token.ID == id && token.RotatedAt == nil && token.RevokedAt == nil {
+			now := time.Now()
+			token.RotatedAt = &now
+			token.RevokedAt = &now
+			return r.CreateToken(next)
+		}
+	}
+	return errors.ErrRefreshTokenReused
+}
+
+func (r *memoryOAuthRepo) RevokeTokenFamily(familyID string) error {
+	for _, token := range r.tokens {
+		if token.FamilyID == familyID {
+			_ = r.RevokeToken(token.ID)
+		}
+	}
+	return nil
+}
+
+// staleOAuthRepo hands out copies of the tokens as they were when first read, like two
+// requests that looked the token up before either rotated it
+type staleOAuthRepo struct {
+	*memoryOAuthRepo
+	seen map[string]domain.OAuthToken
+}
+
+func (r *staleOAuthRepo) FindTokenByRefreshHash(hash string) (*domain.OAuthToken, error) {
+	if token, ok := r.seen[hash]; ok {
+		return &token, nil
+	}
+	token, err := r.memoryOAuthRepo.FindTokenByRefreshHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	r.seen[hash] = *token
+	snapshot := *token
+	return &snapshot, nil
+}
+
+const testRedirectURI = "https://scheduler.example.com/callback"
+
+func newTestOAuthService(t *testing.T) (*oauthService, *security.KeyRing) {
+	keys := newTestKeyRing(t)
+	service := NewOAuthService(&memoryOAuthRepo{}, &memoryChallengeRepo{challenges: map[string][]byte{}}, keys)
+	return service.(*oauthService), keys
+}
+
+func registerTestClient(t *testing.T, service *oauthService, public bool) *domain.OAuthClientCredentials {
+	credentials, err := service.RegisterClient(1, &domain.OAuthClientRequest{
+		Name:         "Scheduler",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{domain.ScopePostsRead, domain.ScopePostsWrite},
+		Public:       public,
+	})
+	require.NoError(t, err)
+	return credentials
+}
+
+func authorizeRequest(clientID, scope, verifier string) domain.OAuthAuthorizeRequest {
+	return domain.OAuthAuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               scope,
+		State:               "xyz",
+		CodeChallenge:       identity.CodeChallengeS256(verifier),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// approve runs the consent step and returns the code from the redirect
+func approve(t *testing.T, service *oauthService, userID uint, req domain.OAuthAuthorizeRequest) string {
+	redirectTo, err := service.Consent(userID, &domain.OAuthConsentRequest{OAuthAuthorizeRequest: req, Approve: true})
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(redirectTo)
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", parsed.Query().Get("state"))
+	require.NotEmpty(t, parsed.Query().Get("code"))
+	return parsed.Query().Get("code")
+}
+
+func TestOAuthService_AuthorizationCodeFlow(t *testing.T) {
+	service, keys := newTestOAuthService(t)
+	credentials := registerTestClient(t, service, false)
+	clientID := credentials.Client.ClientID
+	verifier, err := identity.GenerateCodeVerifier()
+	require.NoError(t, err)
+
+	req := authorizeRequest(clientID, "posts:read", verifier)
+	screen, err := service.Authorize(42, &req)
+	require.NoError(t, err)
+	assert.Equal(t, "Scheduler", screen.ClientName)
+	require.Len(t, screen.Scopes, 1)
+	assert.Equal(t, domain.OAuthScopes[domain.ScopePostsRead], screen.Scopes[0].Description)
+
+	code := approve(t, service, 42, req)
+	tokens, err := service.Token(&domain.OAuthTokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: verifier,
+		ClientID:     clientID,
+		ClientSecret: credentials.ClientSecret,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "posts:read", tokens.Scope)
+
+	grant, err := service.ValidateAccessToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint(42), grant.UserID)
+	assert.True(t, grant.HasScope(domain.ScopePostsRead))
+	assert.False(t, grant.HasScope(domain.ScopePostsWrite))
+
+	// Third-party tokens must not pass as first-party access tokens
+	_, err = security.ParseAccessToken(tokens.AccessToken, keys)
+	assert.Error(t, err)
+
+	// Codes are single use
+	_, err = service.Token(&domain.OAuthTokenRequest{
+		GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI, CodeVerifier: verifier,
+		ClientID: clientID, ClientSecret: credentials.ClientSecret,
+	})
+	assert.Equal(t, errors.ErrOAuthInvalidGrant, err)
+
+	introspection, err := service.Introspect(clientID, credentials.ClientSecret, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, "42", introspection.Subject)
+
+	// Refreshing rotates the refresh token
+	refreshed, err := service.Token(&domain.OAuthTokenRequest{
+		GrantType: "refresh_token", RefreshToken: tokens.RefreshToken,
+		ClientID: clientID, ClientSecret: credentials.ClientSecret,
+	})
+	require.NoError(t, err)
+	_, err = service.ValidateAccessToken(tokens.AccessToken)
+	assert.Equal(t, errors.ErrInvalidToken, err)
+	_, err = service.Token(&domain.OAuthTokenRequest{
+		GrantType: "refresh_token", RefreshToken: tokens.RefreshToken,
+		ClientID: clientID, ClientSecret: credentials.ClientSecret,
+	})
+	assert.Equal(t, errors.ErrOAuthInvalidGrant, err)
+
+	require.NoError(t, service.Revoke(clientID, credentials.ClientSecret, refreshed.RefreshToken))
+	_, err = service.ValidateAccessToken(refreshed.AccessToken)
+	assert.Equal(t, errors.ErrInvalidToken, err)
+
+	introspection, err = service.Introspect(clientID, credentials.ClientSecret, refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, introspection.Active)
+}
+
+// exchangeTestCode runs the authorization code flow and returns the first token pair
+func exchangeTestCode(t *testing.T, service *oauthService, credentials *domain.OAuthClientCredentials) *domain.OAuthTokenResponse {
+	verifier, err := identity.GenerateCodeVerifier()
+	require.NoError(t, err)
+	code := approve(t, service, 42, authorizeRequest(credentials.Client.ClientID, "posts:read", verifier))
+	tokens, err := service.Token(&domain.OAuthTokenRequest{
+		GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI, CodeVerifier: verifier,
+		ClientID: credentials.Client.ClientID, ClientSecret: credentials.ClientSecret,
+	})
+	require.NoError(t, err)
+	return tokens
+}
+
+func TestOAuthService_RefreshTokenReuseRevokesFamily(t *testing.T) {
+	service, _ := newTestOAuthService(t)
+	credentials := registerTestClient(t, service, false)
+	refresh := func(refreshToken string) (*domain.OAuthTokenResponse, error) {
+		return service.Token(&domain.OAuthTokenRequest{
+			GrantType: "refresh_token", RefreshToken: refreshToken,
+			ClientID: credentials.Client.ClientID, ClientSecret: credentials.ClientSecret,
+		})
+	}
+
+	first := exchangeTestCode(t, service, credentials)
+	other := exchangeTestCode(t, service, credentials)
+	second, err := refresh(first.RefreshToken)
+	require.NoError(t, err)
+	third, err := refresh(second.RefreshToken)
+	require.NoError(t, err)
+
+	// Replaying a rotated token kills every token refreshed from it
+	_, err = refresh(first.RefreshToken)
+	assert.Equal(t, errors.ErrOAuthInvalidGrant, err)
+	_, err = service.ValidateAccessToken(third.AccessToken)
+	assert.Equal(t, errors.ErrInvalidToken, err)
+	_, err = refresh(third.RefreshToken)
+	assert.Equal(t, errors.ErrOAuthInvalidGrant, err)
+
+	// Other authorizations of the same user and client are left alone
+	_, err = service.ValidateAccessToken(other.AccessToken)
+	assert.NoError(t, err)
+}
+
+func TestOAuthService_ConcurrentRefreshIssuesOnePair(t *testing.T) {
+	keys := newTestKeyRing(t)
+	repo := &staleOAuthRepo{memoryOAuthRepo: &memoryOAuthRepo{}, seen: map[string]domain.OAuthToken{}}
+	service := NewOAuthService(repo, &memoryChallengeRepo{challenges: map[string][]byte{}}, keys).(*oauthService)
+	credentials := registerTestClient(t, service, false)
+	tokens := exchangeTestCode(t, service, credentials)
+
+	req := &domain.OAuthTokenRequest{
+		GrantType: "refresh_token", RefreshToken: tokens.RefreshToken,
+		ClientID: credentials.Client.ClientID, ClientSecret: credentials.ClientSecret,
+	}
+	winner, err := service.Token(req)
+	require.NoError(t, err)
+
+	// The second request read the token before the first rotated it
+	_, err = service.Token(req)
+	assert.Equal(t, errors.ErrOAuthInvalidGrant, err)
+	_, err = service.ValidateAccessToken(winner.AccessToken)
+	assert.Equal(t, errors.ErrInvalidToken, err)
+}
+
+func TestOAuthService_RejectsInvalidAuthorization(t *testing.T) {
+	service, _ := newTestOAuthService(t)
+	clientID := registerTestClient(t, service, false).Client.ClientID
+	verifier, err := identity.GenerateCodeVerifier()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		modify  func(req *domain.OAuthAuthorizeRequest)
+		wantErr error
+	}{
+		{"unknown client", func(r *domain.OAuthAuthorizeRequest) { r.ClientID = "unknown" }, errors.ErrOAuthInvalidClient},
+		{"unregistered redirect", func(r *domain.OAuthAuthorizeRequest) { r.RedirectURI = "https://evil.example.com/cb" }, errors.ErrOAuthInvalidRedirectURI},
+		{"implicit grant", func(r *domain.OAuthAuthorizeRequest) { r.ResponseType = "token" }, errors.ErrOAuthUnsupportedResponseType},
+		{"plain PKCE", func(r *domain.OAuthAuthorizeRequest) { r.CodeChallengeMethod = "plain" }, errors.ErrOAuthPKCERequired},
+		{"missing PKCE", func(r *domain.OAuthAuthorizeRequest) { r.CodeChallenge = "" }, errors.ErrOAuthPKCERequired},
+		{"scope not allowed", func(r *domain.OAuthAuthorizeRequest) { r.Scope = "profile:read" }, errors.ErrOAuthInvalidScope},
+		{"unknown scope", func(r *domain.OAuthAuthorizeRequest) { r.Scope = "admin" }, errors.ErrOAuthInvalidScope},
+		{"no scope", func(r *domain.OAuthAuthorizeRequest) { r.Scope = "" }, errors.ErrOAuthInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := authorizeRequest(clientID, "posts:read", verifier)
+			tt.modify(&req)
+			_, err := service.Authorize(42, &req)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+
+	// Denying consent sends the user back with access_denied and no code
+	req := authorizeRequest(clientID, "posts:read", verifier)
+	redirectTo, err := service.Consent(42, &domain.OAuthConsentRequest{OAuthAuthorizeRequest: req})
+	require.NoError(t, err)
+	assert.Equal(t, testRedirectURI+"?error=access_denied&state=xyz", redirectTo)
+}
+
+func TestOAuthService_TokenRequiresMatchingGrant(t *testing.T) {
+	service, _ := newTestOAuthService(t)
+	credentials := registerTestClient(t, service, false)
+	public := registerTestClient(t, service, true)
+	verifier, err := identity.GenerateCodeVerifier()
+	require.NoError(t, err)
+
+	req := authorizeRequest(credentials.Client.ClientID, "posts:write", verifier)
+
+	// A wrong verifier burns the code
+	code := approve(t, service, 42, req)
+	_, err = service.Token(&domain.OAuthTokenRequest{
+		GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI, CodeVerifier: "wrong-verifier",
+		ClientID: credentials.Client.ClientID, ClientSecret: credentials.ClientSecret,
+	})
+	assert.Equal(t, errors.ErrOAuthInvalidGrant, err)
+
+	// A code cannot be redeemed by another client
+	code = approve(t, service, 42, req)
+	_, err = service.Token(&domain.OAuthTokenRequest{
+		GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI, CodeVerifier: verifier,
+		ClientID: public.Client.ClientID,
+	})
+	assert.Equal(t, errors.ErrOAuthInvalidGrant, err)
+
+	// Confidential clients need their secret, public clients must not send one
+	_, err = service.Token(&domain.OAuthTokenRequest{GrantType: "authorization_code", ClientID: credentials.Client.ClientID, ClientSecret: "guess"})
+	assert.Equal(t, errors.ErrOAuthInvalidClient, err)
+	_, err = service.Token(&domain.OAuthTokenRequest{GrantType: "authorization_code", ClientID: public.Client.ClientID, ClientSecret: "guess"})
+	assert.Equal(t, errors.ErrOAuthInvalidClient, err)
+
+	_, err = service.Token(&domain.OAuthTokenRequest{GrantType: "password", ClientID: public.Client.ClientID})
+	assert.Equal(t, errors.ErrOAuthUnsupportedGrantType, err)
+}
+
+func TestOAuthService_RegisterClientValidatesRedirectURIs(t *testing.T) {
+	service, _ := newTestOAuthService(t)
+
+	for _, tt := range []struct {
+		uri    string
+		public bool
+		valid  bool
+	}{
+		{"https://app.example.com/cb", false, true},
+		{"http://localhost:8080/cb", false, true},
+		{"http://app.example.com/cb", false, false},
+		{"https://app.example.com/cb#fragment", false, false},
+		{"com.example.scheduler:/oauth", true, true},
+		{"com.example.scheduler:/oauth", false, false},
+	} {
+		_, err := service.RegisterClient(1, &domain.OAuthClientRequest{
+			Name:         "App",
+			RedirectURIs: []string{tt.uri},
+			Scopes:       []string{domain.ScopePostsRead},
+			Public:       tt.public,
+		})
+		if tt.valid {
+			assert.NoError(t, err, tt.uri)
+		} else {
+			assert.Equal(t, errors.ErrOAuthInvalidRedirectURI, err, tt.uri)
+		}
+	}
+}
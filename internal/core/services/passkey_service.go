@@ -0,0 +1,324 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	passkeyCeremonyTTL = 5 * time.Minute
+
+	passkeyRegistrationPrefix = "passkey_registration:"
+	passkeyLoginPrefix        = "passkey_login:"
+
+	defaultPasskeyName = "Passkey"
+)
+
+type passkeyService struct {
+	authRepo      ports.AuthRepository
+	passkeyRepo   ports.PasskeyRepository
+	challengeRepo ports.ChallengeRepository
+	webAuthn      *webauthn.WebAuthn
+}
+
+func NewPasskeyService(ar ports.AuthRepository, pr ports.PasskeyRepository, chr ports.ChallengeRepository, wa *webauthn.WebAuthn) ports.PasskeyService {
+	return &passkeyService{
+		authRepo:      ar,
+		passkeyRepo:   pr,
+		challengeRepo: chr,
+		webAuthn:      wa,
+	}
+}
+
+// BeginRegistration returns the options for navigator.credentials.create. Passkeys the
+// user already has are excluded so the same authenticator is not registered twice.
+func (s *passkeyService) BeginRegistration(userID uint) (*domain.PasskeyCeremony, error) {
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	// Login looks the user up from the credential, so it has to be discoverable
+	options, session, err := s.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin passkey registration: %w", err)
+	}
+
+	return s.saveCeremony(passkeyRegistrationPrefix, session, options)
+}
+
+func (s *passkeyService) FinishRegistration(userID uint, ceremonyID, name string, response []byte) (*domain.WebAuthnCredential, error) {
+	session, err := s.takeCeremony(passkeyRegistrationPrefix, ceremonyID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ceremony must have been started by the same user
+	if !bytes.Equal(session.UserID, user.WebAuthnID()) {
+		return nil, errors.ErrInvalidPasskey
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, errors.ErrInvalidPasskey
+	}
+
+	credential, err := s.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		fmt.Printf("passkey registration failed: %v\n", err)
+		return nil, errors.ErrInvalidPasskey
+	}
+
+	if name == "" {
+		name = defaultPasskeyName
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	stored := &domain.WebAuthnCredential{
+		UserID:          user.ID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	}
+	if err := s.passkeyRepo.Create(stored); err != nil {
+		return nil, fmt.Errorf("failed to store passkey: %w", err)
+	}
+
+	return stored, nil
+}
+
+// BeginLogin starts a discoverable login: the authenticator picks the account
+func (s *passkeyService) BeginLogin() (*domain.PasskeyCeremony, error) {
+	options, session, err := s.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin passkey login: %w", err)
+	}
+
+	return s.saveCeremony(passkeyLoginPrefix, session, options)
+}
+
+// FinishLogin verifies the assertion and returns the owner of the passkey. A sign count
+// that does not increase means the key may have been copied; the passkey is then
+// disabled for good and the login refused.
+func (s *passkeyService) FinishLogin(ceremonyID string, response []byte) (*domain.User, error) {
+	session, err := s.takeCeremony(passkeyLoginPrefix, ceremonyID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, errors.ErrInvalidPasskey
+	}
+
+	var stored *domain.WebAuthnCredential
+	var owner *webAuthnUser
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		credential, err := s.passkeyRepo.FindByCredentialID(rawID)
+		if err != nil {
+			return nil, fmt.Errorf("unknown credential")
+		}
+		if !bytes.Equal(userHandle, webAuthnUserID(credential.UserID)) {
+			return nil, fmt.Errorf("credential does not belong to the user handle")
+		}
+
+		user, err := s.authRepo.FindUserByID(credential.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("unknown user")
+		}
+
+		stored = credential
+		owner = &webAuthnUser{User: user, credentials: []*domain.WebAuthnCredential{credential}}
+		return owner, nil
+	}
+
+	credential, err := s.webAuthn.ValidateDiscoverableLogin(lookup, *session, parsed)
+	if err != nil {
+		fmt.Printf("passkey login failed: %v\n", err)
+		return nil, errors.ErrInvalidPasskey
+	}
+
+	if stored.CloneWarning {
+		return nil, errors.ErrPasskeyCloned
+	}
+
+	if credential.Authenticator.CloneWarning {
+		stored.CloneWarning = true
+		if err := s.passkeyRepo.Update(stored); err != nil {
+			fmt.Printf("failed to flag cloned passkey: %v\n", err)
+		}
+		fmt.Printf("passkey %d of user %d reported a stale sign count\n", stored.ID, stored.UserID)
+		return nil, errors.ErrPasskeyCloned
+	}
+
+	now := time.Now()
+	stored.SignCount = credential.Authenticator.SignCount
+	stored.BackupState = credential.Flags.BackupState
+	stored.LastUsedAt = &now
+	if err := s.passkeyRepo.Update(stored); err != nil {
+		return nil, fmt.Errorf("failed to update passkey: %w", err)
+	}
+
+	return owner.User, nil
+}
+
+func (s *passkeyService) ListCredentials(userID uint) ([]*domain.WebAuthnCredential, error) {
+	return s.passkeyRepo.FindByUserID(userID)
+}
+
+func (s *passkeyService) DeleteCredential(userID, id uint) error {
+	if err := s.passkeyRepo.Delete(userID, id); err != nil {
+		return errors.ErrInvalidPasskey
+	}
+	return nil
+}
+
+func (s *passkeyService) loadUser(userID uint) (*webAuthnUser, error) {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	credentials, err := s.passkeyRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passkeys: %w", err)
+	}
+
+	return &webAuthnUser{User: user, credentials: credentials}, nil
+}
+
+func (s *passkeyService) saveCeremony(prefix string, session *webauthn.SessionData, options interface{}) (*domain.PasskeyCeremony, error) {
+	ceremonyID, err := security.GenerateRandomString(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ceremony ID: %w", err)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ceremony: %w", err)
+	}
+
+	if err := s.challengeRepo.SaveChallenge(prefix+ceremonyID, data, passkeyCeremonyTTL); err != nil {
+		return nil, fmt.Errorf("failed to store ceremony: %w", err)
+	}
+
+	return &domain.PasskeyCeremony{
+		ID:      ceremonyID,
+		Options: options,
+	}, nil
+}
+
+// takeCeremony loads and deletes the ceremony so each challenge is answered only once
+func (s *passkeyService) takeCeremony(prefix, ceremonyID string) (*webauthn.SessionData, error) {
+	data, err := s.challengeRepo.TakeChallenge(prefix + ceremonyID)
+	if err != nil {
+		return nil, errors.ErrInvalidPasskey
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, errors.ErrInvalidPasskey
+	}
+
+	if !session.Expires.IsZero() && time.Now().After(session.Expires) {
+		return nil, errors.ErrInvalidPasskey
+	}
+
+	return &session, nil
+}
+
+// webAuthnUser adapts a user and their stored passkeys to webauthn.User
+type webAuthnUser struct {
+	*domain.User
+	credentials []*domain.WebAuthnCredential
+}
+
+// webAuthnUserID is the user handle stored on the authenticator. It must not contain
+// personal data, so it is the numeric ID rather than the email.
+func webAuthnUserID(userID uint) []byte {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, uint64(userID))
+	return id
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return webAuthnUserID(u.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.Username
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, stored := range u.credentials {
+		var transports []protocol.AuthenticatorTransport
+		if stored.Transports != "" {
+			for _, transport := range strings.Split(stored.Transports, ",") {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              stored.CredentialID,
+			PublicKey:       stored.PublicKey,
+			AttestationType: stored.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: stored.BackupEligible,
+				BackupState:    stored.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       stored.AAGUID,
+				SignCount:    stored.SignCount,
+				CloneWarning: stored.CloneWarning,
+			},
+		})
+	}
+	return credentials
+}
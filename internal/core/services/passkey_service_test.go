@@ -0,0 +1,352 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "fowergram.test"
+	testOrigin = "https://fowergram.test"
+)
+
+// softwareAuthenticator is a passkey authenticator backed by an in-memory P-256 key
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialID, err := security.GenerateRandomBytes(16)
+	require.NoError(t, err)
+
+	return &softwareAuthenticator{key: key, credentialID: credentialID}
+}
+
+// authData builds rpIdHash || flags || signCount, followed by the attested credential
+// data when a credential is being created
+func (a *softwareAuthenticator) authData(t *testing.T, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+
+	flags := byte(protocol.FlagUserPresent | protocol.FlagUserVerified)
+	if attested {
+		flags |= byte(protocol.FlagAttestedCredentialData)
+	}
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{
+				KeyType:   int64(webauthncose.EllipticKey),
+				Algorithm: int64(webauthncose.AlgES256),
+			},
+			Curve:  1, // P-256
+			XCoord: a.key.X.FillBytes(make([]byte, 32)),
+			YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+		})
+		require.NoError(t, err)
+
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, publicKey...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, ceremony protocol.CeremonyType, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(protocol.CollectedClientData{
+		Type:      ceremony,
+		Challenge: challenge.String(),
+		Origin:    testOrigin,
+	})
+	require.NoError(t, err)
+	return data
+}
+
+// create answers navigator.credentials.create with "none" attestation
+func (a *softwareAuthenticator) create(t *testing.T, options *protocol.CredentialCreation) []byte {
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(t, true),
+	})
+	require.NoError(t, err)
+
+	response, err := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON(t, protocol.CreateCeremony, options.Response.Challenge)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestation),
+		},
+	})
+	require.NoError(t, err)
+	return response
+}
+
+// get answers navigator.credentials.get, signing authData || SHA-256(clientDataJSON)
+func (a *softwareAuthenticator) get(t *testing.T, options *protocol.CredentialAssertion) []byte {
+	authData := a.authData(t, false)
+	clientData := clientDataJSON(t, protocol.AssertCeremony, options.Response.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	response, err := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+	})
+	require.NoError(t, err)
+	return response
+}
+
+type memoryPasskeyRepo struct {
+	credentials []*domain.WebAuthnCredential
+}
+
+func (r *memoryPasskeyRepo) Create(credential *domain.WebAuthnCredential) error {
+	credential.ID = uint(len(r.credentials) + 1)
+	credential.CreatedAt = time.Now()
+	r.credentials = append(r.credentials, credential)
+	return nil
+}
+
+func (r *memoryPasskeyRepo) FindByCredentialID(credentialID []byte) (*domain.WebAuthnCredential, error) {
+	for _, credential := range r.credentials {
+		if bytes.Equal(credential.CredentialID, credentialID) {
+			copied := *credential
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("passkey not found")
+}
+
+func (r *memoryPasskeyRepo) FindByUserID(userID uint) ([]*domain.WebAuthnCredential, error) {
+	var credentials []*domain.WebAuthnCredential
+	for _, credential := range r.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *memoryPasskeyRepo) Update(credential *domain.WebAuthnCredential) error {
+	for i, existing := range r.credentials {
+		if existing.ID == credential.ID {
+			copied := *credential
+			r.credentials[i] = &copied
+			return nil
+		}
+	}
+	return fmt.Errorf("passkey not found")
+}
+
+func (r *memoryPasskeyRepo) Delete(userID, id uint) error {
+	for i, credential := range r.credentials {
+		if credential.ID == id && credential.UserID == userID {
+			r.credentials = append(r.credentials[:i], r.credentials[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("passkey not found")
+}
+
+type memoryChallengeRepo struct {
+	challenges map[string][]byte
+}
+
+func (r *memoryChallengeRepo) SaveChallenge(id string, data []byte, ttl time.Duration) error {
+	r.challenges[id] = data
+	return nil
+}
+
+func (r *memoryChallengeRepo) TakeChallenge(id string) ([]byte, error) {
+	data, ok := r.challenges[id]
+	if !ok {
+		return nil, fmt.Errorf("challenge not found")
+	}
+	delete(r.challenges, id)
+	return data, nil
+}
+
+func newTestPasskeyService(t *testing.T, authRepo *MockAuthRepo) (*memoryPasskeyRepo, *passkeyService) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Fowergram",
+		RPOrigins:     []string{testOrigin},
+	})
+	require.NoError(t, err)
+
+	passkeyRepo := &memoryPasskeyRepo{}
+	service := NewPasskeyService(authRepo, passkeyRepo, &memoryChallengeRepo{challenges: map[string][]byte{}}, wa)
+	return passkeyRepo, service.(*passkeyService)
+}
+
+func registerPasskey(t *testing.T, service *passkeyService, userID uint, authenticator *softwareAuthenticator) {
+	ceremony, err := service.BeginRegistration(userID)
+	require.NoError(t, err)
+
+	response := authenticator.create(t, ceremony.Options.(*protocol.CredentialCreation))
+	_, err = service.FinishRegistration(userID, ceremony.ID, "Test key", response)
+	require.NoError(t, err)
+}
+
+func loginWithPasskey(t *testing.T, service *passkeyService, authenticator *softwareAuthenticator) (*domain.User, error) {
+	ceremony, err := service.BeginLogin()
+	require.NoError(t, err)
+
+	return service.FinishLogin(ceremony.ID, authenticator.get(t, ceremony.Options.(*protocol.CredentialAssertion)))
+}
+
+func TestPasskeyService_RegisterAndLogin(t *testing.T) {
+	authRepo := NewMockAuthRepo()
+	user := &domain.User{ID: 7, Username: "alice", Email: "alice@example.com"}
+	authRepo.users[user.Email] = user
+	passkeyRepo, service := newTestPasskeyService(t, authRepo)
+
+	authenticator := newSoftwareAuthenticator(t)
+	registerPasskey(t, service, user.ID, authenticator)
+
+	if assert.Len(t, passkeyRepo.credentials, 1) {
+		stored := passkeyRepo.credentials[0]
+		assert.Equal(t, user.ID, stored.UserID)
+		assert.Equal(t, authenticator.credentialID, stored.CredentialID)
+		assert.Equal(t, "Test key", stored.Name)
+		assert.Equal(t, webAuthnUserID(user.ID), authenticator.userHandle)
+	}
+
+	authenticator.signCount = 1
+	loggedIn, err := loginWithPasskey(t, service, authenticator)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+	assert.Equal(t, uint32(1), passkeyRepo.credentials[0].SignCount)
+	assert.NotNil(t, passkeyRepo.credentials[0].LastUsedAt)
+
+	// Each ceremony can only be answered once
+	ceremony, err := service.BeginLogin()
+	require.NoError(t, err)
+	authenticator.signCount = 2
+	response := authenticator.get(t, ceremony.Options.(*protocol.CredentialAssertion))
+	_, err = service.FinishLogin(ceremony.ID, response)
+	assert.NoError(t, err)
+	_, err = service.FinishLogin(ceremony.ID, response)
+	assert.Equal(t, errors.ErrInvalidPasskey, err)
+
+	// A key that was never registered is rejected
+	_, err = loginWithPasskey(t, service, newSoftwareAuthenticator(t))
+	assert.Equal(t, errors.ErrInvalidPasskey, err)
+}
+
+func TestPasskeyService_CloneDetection(t *testing.T) {
+	authRepo := NewMockAuthRepo()
+	user := &domain.User{ID: 7, Username: "alice", Email: "alice@example.com"}
+	authRepo.users[user.Email] = user
+	passkeyRepo, service := newTestPasskeyService(t, authRepo)
+
+	authenticator := newSoftwareAuthenticator(t)
+	registerPasskey(t, service, user.ID, authenticator)
+
+	authenticator.signCount = 5
+	_, err := loginWithPasskey(t, service, authenticator)
+	require.NoError(t, err)
+
+	// A copy of the key replays an older counter
+	clone := *authenticator
+	clone.signCount = 3
+	_, err = loginWithPasskey(t, service, &clone)
+	assert.Equal(t, errors.ErrPasskeyCloned, err)
+	assert.True(t, passkeyRepo.credentials[0].CloneWarning)
+
+	// The passkey stays disabled even for the original authenticator
+	authenticator.signCount = 6
+	_, err = loginWithPasskey(t, service, authenticator)
+	assert.Equal(t, errors.ErrPasskeyCloned, err)
+}
+
+func TestAuthService_LoginWithPasskey(t *testing.T) {
+	mockRepo := NewMockAuthRepo()
+	mockEmail := new(MockEmailService)
+	mockGeo := new(MockGeoService)
+	user := &domain.User{ID: 7, Username: "alice", Email: "alice@example.com", TwoFactorEnabled: true}
+	mockRepo.users[user.Email] = user
+
+	_, passkeys := newTestPasskeyService(t, mockRepo)
+	service := NewAuthService(mockRepo, mockEmail, mockGeo, new(MockCacheRepo), new(MockRevocationRepo), nil, passkeys, nil, newTestAuditService(), newTestRateLimitService(), newTestKeyRing(t), security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
+
+	authenticator := newSoftwareAuthenticator(t)
+	registerPasskey(t, passkeys, user.ID, authenticator)
+
+	var session *domain.DeviceSession
+	var history *domain.LoginHistory
+	mockGeo.On("Lookup", mock.Anything).Return(&domain.GeoLocation{City: "Bangkok", Country: "Thailand"}, nil)
+	mockRepo.On("CreateDeviceSession", mock.AnythingOfType("*domain.DeviceSession")).
+		Run(func(args mock.Arguments) {
+			session = args.Get(0).(*domain.DeviceSession)
+			session.ID = 42
+		}).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.AnythingOfType("*domain.RefreshToken")).Return(nil)
+	mockRepo.On("LogLogin", mock.AnythingOfType("*domain.LoginHistory")).
+		Run(func(args mock.Arguments) { history = args.Get(0).(*domain.LoginHistory) }).Return(nil)
+	mockEmail.On("SendLoginNotification", user.Email, mock.AnythingOfType("*domain.DeviceSession")).Return(nil)
+
+	ceremony, err := passkeys.BeginLogin()
+	require.NoError(t, err)
+	authenticator.signCount = 1
+	response := authenticator.get(t, ceremony.Options.(*protocol.CredentialAssertion))
+
+	// A verified passkey satisfies two-factor on its own, so tokens are issued directly
+	result, err := service.LoginWithPasskey(ceremony.ID, response, &domain.DeviceSession{IPAddress: "127.0.0.1"})
+	require.NoError(t, err)
+	assert.Nil(t, result.Challenge)
+	assert.NotEmpty(t, result.Tokens.AccessToken)
+	assert.Equal(t, user.ID, session.UserID)
+
+	time.Sleep(50 * time.Millisecond)
+	if assert.NotNil(t, history) {
+		assert.Equal(t, session.DeviceID, history.DeviceID)
+		assert.Equal(t, "success", history.Status)
+	}
+}
@@ -1,38 +1,217 @@
 package services
 
 import (
+	"fmt"
+	"math"
+
 	"fowergram/internal/core/domain"
 	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/pagination"
 )
 
 type postService struct {
-	postRepo  ports.PostRepository
-	cacheRepo ports.CacheRepository
+	postRepo        ports.PostRepository
+	userRepo        ports.UserRepository
+	cacheRepo       ports.CacheRepository
+	mediaService    ports.MediaService
+	adminActionRepo ports.AdminActionRepository
+	auditService    ports.AuditService
 }
 
-func NewPostService(pr ports.PostRepository, cr ports.CacheRepository) ports.PostService {
+func NewPostService(pr ports.PostRepository, ur ports.UserRepository, cr ports.CacheRepository, ms ports.MediaService, aar ports.AdminActionRepository, aus ports.AuditService) ports.PostService {
 	return &postService{
-		postRepo:  pr,
-		cacheRepo: cr,
+		postRepo:        pr,
+		userRepo:        ur,
+		cacheRepo:       cr,
+		mediaService:    ms,
+		adminActionRepo: aar,
+		auditService:    aus,
 	}
 }
 
-func (s *postService) CreatePost(post *domain.Post) error {
-	return s.postRepo.Create(post)
+// CreatePost publishes media the author uploaded. The post is saved with all of its
+// items or not at all.
+func (s *postService) CreatePost(authorID uint, req *domain.CreatePostRequest) (*domain.Post, error) {
+	items, err := s.buildItems(authorID, req.Items, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	post := &domain.Post{
+		UserID:  authorID,
+		Caption: req.Caption,
+		Items:   items,
+	}
+	if err := s.postRepo.Create(post); err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+
+	// Reload to include the author
+	return s.GetPostByID(post.ID)
 }
 
 func (s *postService) GetPostByID(id uint) (*domain.Post, error) {
-	return s.postRepo.FindByID(id)
+	post, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	s.present(post)
+	return post, nil
+}
+
+func (s *postService) GetPosts(page pagination.Page) (*pagination.List[*domain.Post], error) {
+	posts, err := s.postRepo.FindAll(page)
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range posts.Data {
+		s.present(post)
+	}
+	return posts, nil
+}
+
+func (s *postService) GetComments(postID uint, page pagination.Page) (*pagination.List[*domain.Comment], error) {
+	if _, err := s.find(postID); err != nil {
+		return nil, err
+	}
+	return s.postRepo.FindComments(postID, page)
+}
+
+func (s *postService) find(id uint) (*domain.Post, error) {
+	post, err := s.postRepo.FindByID(id)
+	if err != nil {
+		return nil, errors.ErrPostNotFound
+	}
+	return post, nil
+}
+
+// buildItems checks the requested items and returns them in order. Items whose media
+// is in existing keep their ID, so reordering a post does not recreate its items.
+func (s *postService) buildItems(authorID uint, requests []domain.PostItemRequest, existing []domain.PostItem) ([]domain.PostItem, error) {
+	byMedia := make(map[uint]domain.PostItem)
+	for _, item := range existing {
+		if item.MediaID != nil {
+			byMedia[*item.MediaID] = item
+		}
+	}
+
+	taggable := make(map[uint]bool)
+	items := make([]domain.PostItem, 0, len(requests))
+	for i, req := range requests {
+		item, ok := byMedia[req.MediaID]
+		if !ok {
+			media, err := s.mediaService.Get(authorID, req.MediaID)
+			if err != nil {
+				return nil, err
+			}
+			// Photos still being processed can be posted, they show their
+			// placeholder until the renditions exist
+			if media.Status == domain.MediaFailed {
+				return nil, errors.ErrMediaProcessingFailed
+			}
+			item = domain.PostItem{MediaID: &media.ID}
+		}
+		delete(byMedia, req.MediaID)
+
+		item.Position = i
+		item.AltText = req.AltText
+		item.AspectRatio = req.AspectRatio
+		item.Tags = make([]domain.PostItemTag, 0, len(req.Tags))
+		for _, tag := range req.Tags {
+			if !taggable[tag.UserID] {
+				if _, err := s.userRepo.FindByID(tag.UserID); err != nil {
+					return nil, errors.ErrTaggedUserNotFound
+				}
+				taggable[tag.UserID] = true
+			}
+			item.Tags = append(item.Tags, domain.PostItemTag{UserID: tag.UserID, X: tag.X, Y: tag.Y})
+		}
+		items = append(items, item)
+	}
+	return items, nil
 }
 
-func (s *postService) GetAllPosts() ([]*domain.Post, error) {
-	return s.postRepo.FindAll()
+// present sets the URLs of the media and their renditions. Items without a crop take
+// the shape of their media once it is known.
+func (s *postService) present(post *domain.Post) {
+	for i := range post.Items {
+		item := &post.Items[i]
+		if item.Media == nil {
+			continue
+		}
+		s.mediaService.Present(item.Media)
+		if item.AspectRatio == 0 && item.Media.Height > 0 {
+			item.AspectRatio = math.Round(float64(item.Media.Width)/float64(item.Media.Height)*10000) / 10000
+		}
+	}
 }
 
-func (s *postService) UpdatePost(post *domain.Post) error {
-	return s.postRepo.Update(post)
+func (s *postService) UpdatePost(id uint, req *domain.UpdatePostRequest, actor *domain.Actor) (*domain.Post, error) {
+	post, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(post, actor, domain.AdminActionEditPost); err != nil {
+		return nil, err
+	}
+
+	if req.Caption != nil {
+		post.Caption = *req.Caption
+	}
+	if len(req.Items) > 0 {
+		// Media is checked against the author, also when staff edit the post
+		items, err := s.buildItems(post.UserID, req.Items, post.Items)
+		if err != nil {
+			return nil, err
+		}
+		post.Items = items
+	}
+	if err := s.postRepo.Update(post); err != nil {
+		return nil, fmt.Errorf("failed to update post: %w", err)
+	}
+
+	// Reload to include the media and tagged users of new items
+	return s.GetPostByID(post.ID)
 }
 
-func (s *postService) DeletePost(id uint) error {
-	return s.postRepo.Delete(id)
+func (s *postService) DeletePost(id uint, actor *domain.Actor) error {
+	post, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(post, actor, domain.AdminActionDeletePost); err != nil {
+		return err
+	}
+
+	if err := s.postRepo.Delete(post.ID); err != nil {
+		return fmt.Errorf("failed to delete post: %w", err)
+	}
+	return nil
+}
+
+// authorize lets the author change the post, and staff who may moderate posts. The
+// actor's role is only set on routes that loaded it from the database. Like every staff
+// action, moderation is not carried out unless it was recorded.
+func (s *postService) authorize(post *domain.Post, actor *domain.Actor, action string) error {
+	if actor.UserID == post.UserID {
+		return nil
+	}
+	if !actor.Role.Can(domain.PermissionPostsModerate) {
+		return errors.ErrPermissionDenied
+	}
+
+	details := fmt.Sprintf("post=%d", post.ID)
+	entry := &domain.AdminAction{
+		ActorID:      actor.UserID,
+		Action:       action,
+		TargetUserID: &post.UserID,
+		Details:      details,
+		IPAddress:    actor.IPAddress,
+		UserAgent:    actor.UserAgent,
+	}
+	if err := s.adminActionRepo.Create(entry); err != nil {
+		return fmt.Errorf("failed to record admin action: %w", err)
+	}
+	return s.auditService.Record(domain.AuditEventAdminPrefix+action, actor, post.UserID, details)
 }
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/pagination"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryPostRepo struct {
+	posts    map[uint]*domain.Post
+	comments []*domain.Comment
+	media    *memoryMediaRepo
+	itemID   uint
+}
+
+func (r *memoryPostRepo) Create(post *domain.Post) error {
+	post.ID = uint(len(r.posts) + 1)
+	return r.Update(post)
+}
+
+func (r *memoryPostRepo) FindByID(id uint) (*domain.Post, error) {
+	post, ok := r.posts[id]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	copied := *post
+	copied.User = domain.PublicProfile{ID: post.UserID, Username: fmt.Sprintf("user%d", post.UserID)}
+	copied.Items = make([]domain.PostItem, len(post.Items))
+	for i, item := range post.Items {
+		item.Media, _ = r.media.FindByID(*item.MediaID)
+		item.Tags = append([]domain.PostItemTag{}, item.Tags...)
+		for j := range item.Tags {
+			item.Tags[j].User = domain.PublicProfile{ID: item.Tags[j].UserID, Username: fmt.Sprintf("user%d", item.Tags[j].UserID)}
+		}
+		copied.Items[i] = item
+	}
+	return &copied, nil
+}
+
+func (r *memoryPostRepo) FindAll(page pagination.Page) (*pagination.List[*domain.Post], error) {
+	var posts []*domain.Post
+	for _, post := range r.posts {
+		posts = append(posts, post)
+	}
+	return pagination.NewList(posts, page, func(post *domain.Post) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}
+	}), nil
+}
+
+// FindComments expects the comments newest first, the page is only trimmed
+func (r *memoryPostRepo) FindComments(postID uint, page pagination.Page) (*pagination.List[*domain.Comment], error) {
+	var comments []*domain.Comment
+	for _, comment := range r.comments {
+		if comment.PostID == postID && len(comments) < page.Fetch() {
+			comments = append(comments, comment)
+		}
+	}
+	return pagination.NewList(comments, page, func(comment *domain.Comment) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}
+	}), nil
+}
+
+// Update numbers new items like the database would
+func (r *memoryPostRepo) Update(post *domain.Post) error {
+	for i := range post.Items {
+		if post.Items[i].ID == 0 {
+			r.itemID++
+			post.Items[i].ID = r.itemID
+		}
+		post.Items[i].Media = nil
+	}
+	r.posts[post.ID] = post
+	return nil
+}
+
+func (r *memoryPostRepo) Delete(id uint) error {
+	delete(r.posts, id)
+	return nil
+}
+
+func TestPostService_OwnershipAndModeration(t *testing.T) {
+	media, mediaRepo, _ := newTestMediaService(t)
+	repo := &memoryPostRepo{posts: make(map[uint]*domain.Post), media: mediaRepo}
+	actions := &memoryAdminActionRepo{}
+	audit := &memoryAuditRepo{}
+	service := NewPostService(repo, newPostTestUsers(), nil, media, actions, NewAuditService(audit))
+
+	content := testPNG(t, 100)
+	photo, err := media.Upload(1, bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	// Posts can only use the author's own uploads
+	_, err = service.CreatePost(2, &domain.CreatePostRequest{Caption: "Songkran", Items: []domain.PostItemRequest{{MediaID: photo.ID}}})
+	assert.Equal(t, errors.ErrMediaNotFound, err)
+
+	post, err := service.CreatePost(1, &domain.CreatePostRequest{Caption: "Songkran", Items: []domain.PostItemRequest{{MediaID: photo.ID}}})
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), post.UserID)
+	assert.Equal(t, "user1", post.User.Username)
+	require.Len(t, post.Items, 1)
+	assert.Equal(t, photo.URL, post.Items[0].Media.URL)
+
+	// Photos that could not be processed cannot be posted
+	mediaRepo.media[photo.ID].Status = domain.MediaFailed
+	_, err = service.CreatePost(1, &domain.CreatePostRequest{Caption: "Songkran", Items: []domain.PostItemRequest{{MediaID: photo.ID}}})
+	assert.Equal(t, errors.ErrMediaProcessingFailed, err)
+	mediaRepo.media[photo.ID].Status = domain.MediaPending
+
+	caption := "Songkran 2024"
+	author := &domain.Actor{UserID: 1, Role: domain.RoleUser}
+	updated, err := service.UpdatePost(post.ID, &domain.UpdatePostRequest{Caption: &caption}, author)
+	require.NoError(t, err)
+	assert.Equal(t, caption, updated.Caption)
+
+	// Other users, and staff without the permission, cannot touch the post
+	for _, other := range []*domain.Actor{{UserID: 2, Role: domain.RoleUser}, {UserID: 3, Role: domain.RoleSupport}} {
+		_, err = service.UpdatePost(post.ID, &domain.UpdatePostRequest{Caption: &caption}, other)
+		assert.Equal(t, errors.ErrPermissionDenied, err)
+		assert.Equal(t, errors.ErrPermissionDenied, service.DeletePost(post.ID, other))
+	}
+	_, err = service.GetPostByID(42)
+	assert.Equal(t, errors.ErrPostNotFound, err)
+	assert.Empty(t, actions.actions)
+
+	moderator := &domain.Actor{UserID: 4, Role: domain.RoleModerator, IPAddress: "10.0.0.1"}
+	// Nothing happens when the admin action log cannot be written
+	actions.err = fmt.Errorf("database is down")
+	assert.Error(t, service.DeletePost(post.ID, moderator))
+	assert.Len(t, repo.posts, 1)
+	actions.err = nil
+
+	require.NoError(t, service.DeletePost(post.ID, moderator))
+	assert.Empty(t, repo.posts)
+	require.Len(t, actions.actions, 1)
+	assert.Equal(t, domain.AdminActionDeletePost, actions.actions[0].Action)
+	assert.Equal(t, uint(1), *actions.actions[0].TargetUserID)
+	assert.Equal(t, []string{domain.AuditEventAdminPrefix + domain.AdminActionDeletePost}, events(audit))
+}
+
+func newPostTestUsers() *memoryUserRepo {
+	return &memoryUserRepo{users: map[string]*domain.User{
+		"nok@example.com":  {ID: 5, Username: "nok"},
+		"ploy@example.com": {ID: 6, Username: "ploy"},
+	}}
+}
+
+func TestPostService_Carousel(t *testing.T) {
+	media, mediaRepo, _ := newTestMediaService(t)
+	repo := &memoryPostRepo{posts: make(map[uint]*domain.Post), media: mediaRepo}
+	service := NewPostService(repo, newPostTestUsers(), nil, media, &memoryAdminActionRepo{}, newTestAuditService())
+
+	var photos []*domain.Media
+	for i := 0; i < 3; i++ {
+		content := testPNG(t, 100+i*50)
+		photo, err := media.Upload(1, bytes.NewReader(content), int64(len(content)))
+		require.NoError(t, err)
+		photos = append(photos, photo)
+	}
+	mediaRepo.media[photos[0].ID].Width = 1080
+	mediaRepo.media[photos[0].ID].Height = 1350
+
+	req := &domain.CreatePostRequest{
+		Caption: "Chiang Mai",
+		Items: []domain.PostItemRequest{
+			{MediaID: photos[0].ID, AltText: "Doi Suthep", Tags: []domain.PostItemTagRequest{{UserID: 5, X: 0.5, Y: 0.25}}},
+			{MediaID: photos[1].ID, AspectRatio: 1},
+			{MediaID: photos[2].ID},
+		},
+	}
+	// Nothing is saved when one item is wrong
+	req.Items[2].Tags = []domain.PostItemTagRequest{{UserID: 42}}
+	_, err := service.CreatePost(1, req)
+	assert.Equal(t, errors.ErrTaggedUserNotFound, err)
+	assert.Empty(t, repo.posts)
+	req.Items[2].Tags = nil
+
+	post, err := service.CreatePost(1, req)
+	require.NoError(t, err)
+	require.Len(t, post.Items, 3)
+	for i, item := range post.Items {
+		assert.Equal(t, i, item.Position)
+		assert.Equal(t, photos[i].ID, *item.MediaID)
+	}
+	assert.Equal(t, "Doi Suthep", post.Items[0].AltText)
+	// The shape of the photo, unless the author cropped it
+	assert.Equal(t, 0.8, post.Items[0].AspectRatio)
+	assert.Equal(t, 1.0, post.Items[1].AspectRatio)
+	assert.Equal(t, uint(5), post.Items[0].Tags[0].User.ID)
+
+	// Reordering keeps the items, removed items go and new tags replace the old ones
+	first, second := post.Items[0].ID, post.Items[1].ID
+	author := &domain.Actor{UserID: 1, Role: domain.RoleUser}
+	updated, err := service.UpdatePost(post.ID, &domain.UpdatePostRequest{Items: []domain.PostItemRequest{
+		{MediaID: photos[1].ID},
+		{MediaID: photos[0].ID, AltText: "Doi Suthep at sunrise", Tags: []domain.PostItemTagRequest{{UserID: 6, X: 0.1, Y: 0.9}}},
+	}}, author)
+	require.NoError(t, err)
+	require.Len(t, updated.Items, 2)
+	assert.Equal(t, second, updated.Items[0].ID)
+	assert.Equal(t, first, updated.Items[1].ID)
+	assert.Equal(t, 1, updated.Items[1].Position)
+	assert.Equal(t, "Doi Suthep at sunrise", updated.Items[1].AltText)
+	require.Len(t, updated.Items[1].Tags, 1)
+	assert.Equal(t, uint(6), updated.Items[1].Tags[0].UserID)
+	assert.Equal(t, "Chiang Mai", updated.Caption)
+
+	// Media of other users cannot be added
+	content := testPNG(t, 400)
+	other, err := media.Upload(2, bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	_, err = service.UpdatePost(post.ID, &domain.UpdatePostRequest{Items: []domain.PostItemRequest{{MediaID: other.ID}}}, author)
+	assert.Equal(t, errors.ErrMediaNotFound, err)
+	assert.Len(t, repo.posts[post.ID].Items, 2)
+}
+
+func TestPostService_GetComments(t *testing.T) {
+	media, mediaRepo, _ := newTestMediaService(t)
+	repo := &memoryPostRepo{posts: make(map[uint]*domain.Post), media: mediaRepo}
+	service := NewPostService(repo, newPostTestUsers(), nil, media, &memoryAdminActionRepo{}, NewAuditService(&memoryAuditRepo{}))
+
+	content := testPNG(t, 100)
+	photo, err := media.Upload(1, bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	post, err := service.CreatePost(1, &domain.CreatePostRequest{Items: []domain.PostItemRequest{{MediaID: photo.ID}}})
+	require.NoError(t, err)
+
+	now := time.Now()
+	for i := 3; i >= 1; i-- {
+		repo.comments = append(repo.comments, &domain.Comment{ID: uint(i), PostID: post.ID, Content: fmt.Sprint("comment ", i), CreatedAt: now.Add(time.Duration(i) * time.Minute)})
+	}
+
+	comments, err := service.GetComments(post.ID, pagination.Page{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, comments.Data, 2)
+	assert.Equal(t, uint(3), comments.Data[0].ID)
+	assert.True(t, comments.HasMore)
+	cursor, err := pagination.Decode(comments.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), cursor.ID)
+
+	_, err = service.GetComments(42, pagination.Page{Limit: 2})
+	assert.Equal(t, errors.ErrPostNotFound, err)
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+)
+
+var (
+	// accountLockout locks an account after five failed sign-in checks, for 15 minutes
+	// and twice as long for every further failure, until a day passes without one
+	accountLockout = domain.LockoutPolicy{
+		Name:        "account",
+		Threshold:   5,
+		Window:      24 * time.Hour,
+		BaseLockout: 15 * time.Minute,
+		MaxLockout:  24 * time.Hour,
+	}
+
+	// ipLockout stops an address that fails against many accounts, as in credential stuffing
+	ipLockout = domain.LockoutPolicy{
+		Name:        "ip",
+		Threshold:   20,
+		Window:      time.Hour,
+		BaseLockout: 5 * time.Minute,
+		MaxLockout:  6 * time.Hour,
+	}
+)
+
+type rateLimitService struct {
+	repo ports.RateLimitRepository
+}
+
+func NewRateLimitService(repo ports.RateLimitRepository) ports.RateLimitService {
+	return &rateLimitService{repo: repo}
+}
+
+func (s *rateLimitService) Allow(policy domain.RateLimitPolicy, identity string) (*domain.RateLimitResult, error) {
+	return s.repo.Hit(policyKey(policy.Name, identity), policy.Limit, policy.Window)
+}
+
+func (s *rateLimitService) Lockout(policy domain.LockoutPolicy, identity string) (*domain.LockoutStatus, error) {
+	return s.repo.Lockout(policyKey(policy.Name, identity))
+}
+
+func (s *rateLimitService) RegisterFailure(policy domain.LockoutPolicy, identity string) (*domain.LockoutStatus, error) {
+	key := policyKey(policy.Name, identity)
+	failures, err := s.repo.AddFailure(key, policy.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &domain.LockoutStatus{Failures: failures, LockedFor: policy.LockoutFor(failures)}
+	if status.Locked() {
+		if err := s.repo.Lock(key, status.LockedFor); err != nil {
+			return nil, fmt.Errorf("failed to lock out %s: %w", policy.Name, err)
+		}
+	}
+	return status, nil
+}
+
+func (s *rateLimitService) ClearLockout(policy domain.LockoutPolicy, identity string) error {
+	return s.repo.ClearLockout(policyKey(policy.Name, identity))
+}
+
+func policyKey(name, identity string) string {
+	return name + ":" + identity
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRateLimitRepo mirrors the Redis repository with a clock the test controls
+type memoryRateLimitRepo struct {
+	now      time.Time
+	hits     map[string][]time.Time
+	failures map[string]int64
+	locks    map[string]time.Time
+}
+
+func newMemoryRateLimitRepo() *memoryRateLimitRepo {
+	return &memoryRateLimitRepo{
+		now:      time.Now(),
+		hits:     make(map[string][]time.Time),
+		failures: make(map[string]int64),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (r *memoryRateLimitRepo) Hit(key string, limit int, window time.Duration) (*domain.RateLimitResult, error) {
+	var kept []time.Time
+	for _, hit := range r.hits[key] {
+		if hit.After(r.now.Add(-window)) {
+			kept = append(kept, hit)
+		}
+	}
+
+	allowed := len(kept) < limit
+	if allowed {
+		kept = append(kept, r.now)
+	}
+	r.hits[key] = kept
+	return &domain.RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: limit - len(kept),
+		Reset:     kept[0].Add(window).Sub(r.now),
+	}, nil
+}
+
+func (r *memoryRateLimitRepo) AddFailure(key string, window time.Duration) (int64, error) {
+	r.failures[key]++
+	return r.failures[key], nil
+}
+
+func (r *memoryRateLimitRepo) Lock(key string, duration time.Duration) error {
+	r.locks[key] = r.now.Add(duration)
+	return nil
+}
+
+func (r *memoryRateLimitRepo) Lockout(key string) (*domain.LockoutStatus, error) {
+	status := &domain.LockoutStatus{Failures: r.failures[key]}
+	if until, ok := r.locks[key]; ok && until.After(r.now) {
+		status.LockedFor = until.Sub(r.now)
+	}
+	return status, nil
+}
+
+func (r *memoryRateLimitRepo) ClearLockout(key string) error {
+	delete(r.failures, key)
+	delete(r.locks, key)
+	return nil
+}
+
+func newTestRateLimitService() ports.RateLimitService {
+	return NewRateLimitService(newMemoryRateLimitRepo())
+}
+
+func TestRateLimitService_SlidingWindow(t *testing.T) {
+	repo := newMemoryRateLimitRepo()
+	service := NewRateLimitService(repo)
+	policy := domain.RateLimitPolicy{Name: "login:ip", Limit: 3, Window: time.Minute}
+
+	for i := 2; i >= 0; i-- {
+		result, err := service.Allow(policy, "10.0.0.1")
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+		repo.now = repo.now.Add(10 * time.Second)
+	}
+
+	result, err := service.Allow(policy, "10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 30*time.Second, result.Reset)
+
+	// Other identities have their own window
+	result, err = service.Allow(policy, "10.0.0.2")
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// The first request leaves the window, the other two still count
+	repo.now = repo.now.Add(31 * time.Second)
+	result, err = service.Allow(policy, "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
+
+func TestRateLimitService_ExponentialLockout(t *testing.T) {
+	repo := newMemoryRateLimitRepo()
+	service := NewRateLimitService(repo)
+
+	for i := 0; i < 4; i++ {
+		status, err := service.RegisterFailure(accountLockout, "1")
+		require.NoError(t, err)
+		assert.False(t, status.Locked())
+	}
+
+	for _, want := range []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour} {
+		status, err := service.RegisterFailure(accountLockout, "1")
+		require.NoError(t, err)
+		assert.Equal(t, want, status.LockedFor)
+	}
+
+	status, err := service.Lockout(accountLockout, "1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), status.Failures)
+	assert.Equal(t, 2*time.Hour, status.LockedFor)
+
+	assert.Equal(t, 24*time.Hour, accountLockout.LockoutFor(20))
+
+	require.NoError(t, service.ClearLockout(accountLockout, "1"))
+	status, err = service.Lockout(accountLockout, "1")
+	require.NoError(t, err)
+	assert.False(t, status.Locked())
+	assert.Zero(t, status.Failures)
+}
+
+func TestAuthService_LocksOutFailingAddress(t *testing.T) {
+	env := newAdminTestEnv(t)
+	env.repo.On("FindUserByEmail", mock.Anything).Return(nil, fmt.Errorf("user not found"))
+	device := &domain.DeviceSession{IPAddress: "203.0.113.7"}
+
+	for i := int64(0); i < ipLockout.Threshold; i++ {
+		_, err := env.auth.Login(fmt.Sprintf("user%d@example.com", i), "password", device)
+		assert.Equal(t, "AUTH001", err.(*errors.AuthError).Code)
+	}
+
+	_, err := env.auth.Login("another@example.com", "password", device)
+	assert.Equal(t, errors.ErrTooManyRequests, err)
+
+	// Other addresses are unaffected
+	_, err = env.auth.Login("another@example.com", "password", &domain.DeviceSession{IPAddress: "203.0.113.8"})
+	assert.Equal(t, "AUTH001", err.(*errors.AuthError).Code)
+}
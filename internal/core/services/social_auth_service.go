@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/identity"
+	"fowergram/pkg/security"
+)
+
+const (
+	socialStateTTL    = 10 * time.Minute
+	socialStatePrefix = "oauth_state:"
+
+	// socialExchangeTimeout bounds the calls made to the provider on callback
+	socialExchangeTimeout = 15 * time.Second
+
+	socialUsernameAttempts = 3
+)
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-z0-9_.]`)
+
+// socialState is what is remembered between sending the user to the provider and the
+// callback. UserID is only set when a signed-in user is linking a provider.
+type socialState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	UserID   uint   `json:"user_id,omitempty"`
+}
+
+type socialAuthService struct {
+	authRepo      ports.AuthRepository
+	identityRepo  ports.IdentityRepository
+	challengeRepo ports.ChallengeRepository
+	providers     map[string]identity.Provider
+	hasher        security.PasswordHasher
+}
+
+func NewSocialAuthService(ar ports.AuthRepository, ir ports.IdentityRepository, chr ports.ChallengeRepository, providers map[string]identity.Provider, ph security.PasswordHasher) ports.SocialAuthService {
+	return &socialAuthService{
+		authRepo:      ar,
+		identityRepo:  ir,
+		challengeRepo: chr,
+		providers:     providers,
+		hasher:        ph,
+	}
+}
+
+func (s *socialAuthService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *socialAuthService) BeginLogin(provider string) (*domain.SocialLoginStart, error) {
+	return s.begin(provider, 0)
+}
+
+func (s *socialAuthService) BeginLink(userID uint, provider string) (*domain.SocialLoginStart, error) {
+	return s.begin(provider, userID)
+}
+
+// CompleteLogin resolves the identity returned by the provider to a user:
+//   - an identity seen before signs in its user
+//   - an email that matches an existing user is linked only when both the provider and
+//     the account have verified it, otherwise the user has to sign in and link it
+//   - anything else creates a new account
+func (s *socialAuthService) CompleteLogin(provider, state, code string) (*domain.User, error) {
+	saved, err := s.takeState(provider, state)
+	if err != nil {
+		return nil, err
+	}
+	// A state issued for linking cannot be used to sign in
+	if saved.UserID != 0 {
+		return nil, errors.ErrSocialLoginFailed
+	}
+
+	external, err := s.exchange(provider, code, saved)
+	if err != nil {
+		return nil, err
+	}
+
+	if linked, err := s.identityRepo.FindByProviderSubject(provider, external.Subject); err == nil {
+		user, err := s.authRepo.FindUserByID(linked.UserID)
+		if err != nil {
+			return nil, errors.ErrUserNotFound
+		}
+		s.touch(linked, external.Email)
+		return user, nil
+	}
+
+	if external.Email == "" {
+		return nil, errors.ErrProviderEmailMissing
+	}
+
+	now := time.Now()
+	newIdentity := &domain.UserIdentity{
+		Provider:    provider,
+		Subject:     external.Subject,
+		Email:       external.Email,
+		LastLoginAt: &now,
+	}
+
+	if user, err := s.authRepo.FindUserByEmail(external.Email); err == nil {
+		if !external.EmailVerified || !user.IsEmailVerified {
+			return nil, errors.ErrIdentityLinkRequired
+		}
+
+		newIdentity.UserID = user.ID
+		if err := s.identityRepo.Create(newIdentity); err != nil {
+			return nil, fmt.Errorf("failed to link identity: %w", err)
+		}
+		return user, nil
+	}
+
+	return s.createUser(external, newIdentity)
+}
+
+// CompleteLink attaches the provider account to a signed-in user. The email does not
+// have to match, the user has proven they own both accounts.
+func (s *socialAuthService) CompleteLink(userID uint, provider, state, code string) (*domain.UserIdentity, error) {
+	saved, err := s.takeState(provider, state)
+	if err != nil {
+		return nil, err
+	}
+	if saved.UserID != userID {
+		return nil, errors.ErrSocialLoginFailed
+	}
+
+	external, err := s.exchange(provider, code, saved)
+	if err != nil {
+		return nil, err
+	}
+
+	if linked, err := s.identityRepo.FindByProviderSubject(provider, external.Subject); err == nil {
+		if linked.UserID != userID {
+			return nil, errors.ErrIdentityAlreadyLinked
+		}
+		return linked, nil
+	}
+
+	// One account per provider keeps sign-in unambiguous
+	identities, err := s.identityRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identities: %w", err)
+	}
+	for _, existing := range identities {
+		if existing.Provider == provider {
+			return nil, errors.ErrIdentityAlreadyLinked
+		}
+	}
+
+	linked := &domain.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	}
+	if err := s.identityRepo.Create(linked); err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return linked, nil
+}
+
+func (s *socialAuthService) ListIdentities(userID uint) ([]*domain.UserIdentity, error) {
+	return s.identityRepo.FindByUserID(userID)
+}
+
+func (s *socialAuthService) Unlink(userID uint, provider string) error {
+	if err := s.identityRepo.Delete(userID, provider); err != nil {
+		return errors.ErrUnknownProvider
+	}
+	return nil
+}
+
+func (s *socialAuthService) begin(provider string, userID uint) (*domain.SocialLoginStart, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, errors.ErrUnknownProvider
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := identity.GenerateCodeVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(&socialState{
+		Provider: provider,
+		Verifier: verifier,
+		Nonce:    nonce,
+		UserID:   userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := s.challengeRepo.SaveChallenge(socialStatePrefix+state, data, socialStateTTL); err != nil {
+		return nil, fmt.Errorf("failed to store state: %w", err)
+	}
+
+	authURL, err := p.AuthCodeURL(state, nonce, identity.CodeChallengeS256(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build authorization URL: %w", err)
+	}
+
+	return &domain.SocialLoginStart{
+		Provider:         provider,
+		AuthorizationURL: authURL,
+		State:            state,
+	}, nil
+}
+
+// takeState loads and deletes the state so a callback can only be replayed once
+func (s *socialAuthService) takeState(provider, state string) (*socialState, error) {
+	if _, ok := s.providers[provider]; !ok {
+		return nil, errors.ErrUnknownProvider
+	}
+
+	data, err := s.challengeRepo.TakeChallenge(socialStatePrefix + state)
+	if err != nil {
+		return nil, errors.ErrSocialLoginFailed
+	}
+
+	var saved socialState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, errors.ErrSocialLoginFailed
+	}
+	if saved.Provider != provider {
+		return nil, errors.ErrSocialLoginFailed
+	}
+
+	return &saved, nil
+}
+
+func (s *socialAuthService) exchange(provider, code string, saved *socialState) (*identity.Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), socialExchangeTimeout)
+	defer cancel()
+
+	external, err := s.providers[provider].Exchange(ctx, code, saved.Verifier, saved.Nonce)
+	if err != nil {
+		fmt.Printf("%s sign in failed: %v\n", provider, err)
+		return nil, errors.ErrSocialLoginFailed
+	}
+	return external, nil
+}
+
+// touch records the login and keeps the email the provider reports up to date
+func (s *socialAuthService) touch(linked *domain.UserIdentity, email string) {
+	now := time.Now()
+	linked.LastLoginAt = &now
+	if email != "" {
+		linked.Email = email
+	}
+	if err := s.identityRepo.Update(linked); err != nil {
+		fmt.Printf("failed to update identity %d: %v\n", linked.ID, err)
+	}
+}
+
+// createUser signs up a new user from the provider's profile. The account gets a random
+// password nobody knows; the user can set one with a password reset later.
+func (s *socialAuthService) createUser(external *identity.Identity, newIdentity *domain.UserIdentity) (*domain.User, error) {
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	base := usernameFromEmail(external.Email)
+	username := base
+	for attempt := 0; ; attempt++ {
+		user := &domain.User{
+			Username:        username,
+			Email:           external.Email,
+			PasswordHash:    hash,
+			IsEmailVerified: external.EmailVerified,
+		}
+
+		err := s.identityRepo.CreateUserWithIdentity(user, newIdentity)
+		if err == nil {
+			return user, nil
+		}
+		if attempt+1 >= socialUsernameAttempts {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+
+		// Most likely the username is taken, try again with a suffix
+		suffix, err := security.GenerateRandomCode(4)
+		if err != nil {
+			return nil, err
+		}
+		username = base + "_" + suffix
+	}
+}
+
+// usernameFromEmail turns the local part of an email into a username that passes the
+// same length rules as registration
+func usernameFromEmail(email string) string {
+	local := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	username := usernameUnsafeChars.ReplaceAllString(local, "")
+	if len(username) > 24 {
+		username = username[:24]
+	}
+	for len(username) < 3 {
+		username += "_"
+	}
+	return username
+}
+
+func randomToken() (string, error) {
+	b, err := security.GenerateRandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
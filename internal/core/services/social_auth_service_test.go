@@ -0,0 +1,224 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/identity"
+	"fowergram/pkg/identity/identitytest"
+	"fowergram/pkg/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryIdentityRepo stores identities in memory and registers the users it creates with
+// the mock auth repository so they can be found by ID
+type memoryIdentityRepo struct {
+	authRepo   *MockAuthRepo
+	identities []*domain.UserIdentity
+	nextUserID uint
+}
+
+func (r *memoryIdentityRepo) Create(identity *domain.UserIdentity) error {
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return fmt.Errorf("duplicate identity")
+		}
+	}
+	identity.ID = uint(len(r.identities) + 1)
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *memoryIdentityRepo) CreateUserWithIdentity(user *domain.User, identity *domain.UserIdentity) error {
+	r.nextUserID++
+	user.ID = 100 + r.nextUserID
+	r.authRepo.users[user.Email] = user
+	identity.UserID = user.ID
+	return r.Create(identity)
+}
+
+func (r *memoryIdentityRepo) FindByProviderSubject(provider, subject string) (*domain.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, fmt.Errorf("identity not found")
+}
+
+func (r *memoryIdentityRepo) FindByUserID(userID uint) ([]*domain.UserIdentity, error) {
+	var identities []*domain.UserIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *memoryIdentityRepo) Update(identity *domain.UserIdentity) error {
+	return nil
+}
+
+func (r *memoryIdentityRepo) Delete(userID uint, provider string) error {
+	for i, identity := range r.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("identity not found")
+}
+
+func newTestSocialAuthService(t *testing.T, authRepo *MockAuthRepo) (*identitytest.Issuer, *memoryIdentityRepo, *socialAuthService) {
+	issuer := identitytest.NewIssuer("fowergram", "secret")
+	t.Cleanup(issuer.Close)
+
+	provider := identity.NewOIDCProvider(identity.OIDCConfig{
+		Name:         identity.ProviderGoogle,
+		Issuer:       issuer.URL,
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+		RedirectURL:  "https://fowergram.test/auth/callback/google",
+		Scopes:       []string{"openid", "email"},
+	})
+
+	identityRepo := &memoryIdentityRepo{authRepo: authRepo}
+	service := NewSocialAuthService(authRepo, identityRepo, &memoryChallengeRepo{challenges: map[string][]byte{}},
+		map[string]identity.Provider{identity.ProviderGoogle: provider}, security.DefaultPasswordHasher())
+	return issuer, identityRepo, service.(*socialAuthService)
+}
+
+// signInWithProvider sends the user through the mock issuer and completes the login
+func signInWithProvider(t *testing.T, issuer *identitytest.Issuer, service *socialAuthService, user identitytest.User) (*domain.User, error) {
+	start, err := service.BeginLogin(identity.ProviderGoogle)
+	require.NoError(t, err)
+
+	code, state, err := issuer.Authorize(start.AuthorizationURL, user)
+	require.NoError(t, err)
+	assert.Equal(t, start.State, state)
+
+	return service.CompleteLogin(identity.ProviderGoogle, state, code)
+}
+
+func TestSocialAuthService_CreatesUserAndSignsBackIn(t *testing.T) {
+	authRepo := NewMockAuthRepo()
+	authRepo.On("FindUserByEmail", "new.user@example.com").Return(nil, fmt.Errorf("user not found"))
+	issuer, identityRepo, service := newTestSocialAuthService(t, authRepo)
+
+	googleUser := identitytest.User{Subject: "g-1", Email: "New.User@example.com", EmailVerified: true}
+	user, err := signInWithProvider(t, issuer, service, googleUser)
+	require.NoError(t, err)
+	assert.Equal(t, "new.user", user.Username)
+	assert.Equal(t, "new.user@example.com", user.Email)
+	assert.True(t, user.IsEmailVerified)
+	// The unusable password is hashed like any other, with the configured algorithm
+	assert.False(t, security.DefaultPasswordHasher().NeedsRehash(user.PasswordHash))
+	require.Len(t, identityRepo.identities, 1)
+
+	// The same Google account signs in to the same user without looking at the email
+	again, err := signInWithProvider(t, issuer, service, googleUser)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Len(t, identityRepo.identities, 1)
+	authRepo.AssertNumberOfCalls(t, "FindUserByEmail", 1)
+}
+
+func TestSocialAuthService_LinksVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		localVerified bool
+		idpVerified   bool
+		wantErr       error
+	}{
+		{"both verified", true, true, nil},
+		{"provider email unverified", true, false, errors.ErrIdentityLinkRequired},
+		{"local email unverified", false, true, errors.ErrIdentityLinkRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authRepo := NewMockAuthRepo()
+			existing := &domain.User{ID: 7, Username: "alice", Email: "alice@example.com", IsEmailVerified: tt.localVerified}
+			authRepo.users[existing.Email] = existing
+			authRepo.On("FindUserByEmail", existing.Email).Return(existing, nil)
+			issuer, identityRepo, service := newTestSocialAuthService(t, authRepo)
+
+			user, err := signInWithProvider(t, issuer, service, identitytest.User{
+				Subject:       "g-7",
+				Email:         existing.Email,
+				EmailVerified: tt.idpVerified,
+			})
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				assert.Empty(t, identityRepo.identities)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, existing.ID, user.ID)
+			require.Len(t, identityRepo.identities, 1)
+			assert.Equal(t, existing.ID, identityRepo.identities[0].UserID)
+		})
+	}
+}
+
+func TestSocialAuthService_StateIsSingleUse(t *testing.T) {
+	authRepo := NewMockAuthRepo()
+	authRepo.On("FindUserByEmail", mock.Anything).Return(nil, fmt.Errorf("user not found"))
+	issuer, _, service := newTestSocialAuthService(t, authRepo)
+
+	start, err := service.BeginLogin(identity.ProviderGoogle)
+	require.NoError(t, err)
+	code, state, err := issuer.Authorize(start.AuthorizationURL, identitytest.User{Subject: "g-1", Email: "bob@example.com"})
+	require.NoError(t, err)
+
+	_, err = service.CompleteLogin(identity.ProviderGoogle, state, code)
+	require.NoError(t, err)
+
+	_, err = service.CompleteLogin(identity.ProviderGoogle, state, code)
+	assert.Equal(t, errors.ErrSocialLoginFailed, err)
+
+	_, err = service.BeginLogin("myspace")
+	assert.Equal(t, errors.ErrUnknownProvider, err)
+}
+
+func TestSocialAuthService_Link(t *testing.T) {
+	authRepo := NewMockAuthRepo()
+	alice := &domain.User{ID: 7, Username: "alice", Email: "alice@example.com"}
+	authRepo.users[alice.Email] = alice
+	issuer, identityRepo, service := newTestSocialAuthService(t, authRepo)
+
+	link := func(userID uint, googleUser identitytest.User) (*domain.UserIdentity, error) {
+		start, err := service.BeginLink(userID, identity.ProviderGoogle)
+		require.NoError(t, err)
+		code, state, err := issuer.Authorize(start.AuthorizationURL, googleUser)
+		require.NoError(t, err)
+		return service.CompleteLink(userID, identity.ProviderGoogle, state, code)
+	}
+
+	// A signed-in user can link an account with a different, unverified email
+	linked, err := link(alice.ID, identitytest.User{Subject: "g-7", Email: "alice.personal@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, linked.UserID)
+
+	// Another user cannot claim the same Google account
+	_, err = link(8, identitytest.User{Subject: "g-7"})
+	assert.Equal(t, errors.ErrIdentityAlreadyLinked, err)
+
+	// A link state cannot be used to sign in
+	start, err := service.BeginLink(alice.ID, identity.ProviderGoogle)
+	require.NoError(t, err)
+	code, state, err := issuer.Authorize(start.AuthorizationURL, identitytest.User{Subject: "g-7"})
+	require.NoError(t, err)
+	_, err = service.CompleteLogin(identity.ProviderGoogle, state, code)
+	assert.Equal(t, errors.ErrSocialLoginFailed, err)
+
+	require.NoError(t, service.Unlink(alice.ID, identity.ProviderGoogle))
+	assert.Empty(t, identityRepo.identities)
+}
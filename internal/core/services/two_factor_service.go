@@ -1,8 +1,221 @@
 package services
 
-type TwoFactorService interface {
-	GenerateTOTP(userID uint) (string, error)
-	ValidateTOTP(userID uint, code string) error
-	EnableTwoFactor(userID uint) error
-	DisableTwoFactor(userID uint) error
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+)
+
+const backupCodeCount = 10
+
+type twoFactorService struct {
+	authRepo      ports.AuthRepository
+	auditService  ports.AuditService
+	encryptionKey []byte
+	issuer        string
+}
+
+func NewTwoFactorService(ar ports.AuthRepository, aus ports.AuditService, encryptionKey []byte, issuer string) ports.TwoFactorService {
+	return &twoFactorService{
+		authRepo:      ar,
+		auditService:  aus,
+		encryptionKey: encryptionKey,
+		issuer:        issuer,
+	}
+}
+
+// GenerateTOTP creates a new pending secret. It only becomes active once EnableTwoFactor confirms it.
+func (s *twoFactorService) GenerateTOTP(userID uint) (*domain.TwoFactorSetup, error) {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, errors.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+
+	encrypted, err := security.Encrypt(secret, s.encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+
+	user.TwoFactorSecret = encrypted
+	user.TwoFactorLastStep = 0
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	return &domain.TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: security.TOTPProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// ValidateTOTP accepts either a current TOTP code or an unused backup code
+func (s *twoFactorService) ValidateTOTP(userID uint, code string) error {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return errors.ErrUserNotFound
+	}
+
+	if !user.TwoFactorEnabled {
+		return errors.ErrTwoFactorNotEnabled
+	}
+
+	return s.verifyCode(user, code)
+}
+
+// EnableTwoFactor confirms the pending secret and returns a fresh set of backup codes
+func (s *twoFactorService) EnableTwoFactor(userID uint, code string, actor *domain.Actor) ([]string, error) {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, errors.ErrTwoFactorAlreadyEnabled
+	}
+
+	if user.TwoFactorSecret == "" {
+		return nil, errors.ErrTwoFactorNotEnabled
+	}
+
+	if err := s.verifyTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	user.TwoFactorEnabled = true
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	s.audit(domain.AuditEventTwoFactorEnabled, user.ID, actor)
+
+	return s.issueBackupCodes(user.ID)
+}
+
+func (s *twoFactorService) DisableTwoFactor(userID uint, code string, actor *domain.Actor) error {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return errors.ErrUserNotFound
+	}
+
+	if !user.TwoFactorEnabled {
+		return errors.ErrTwoFactorNotEnabled
+	}
+
+	if err := s.verifyCode(user, code); err != nil {
+		return err
+	}
+
+	user.TwoFactorEnabled = false
+	user.TwoFactorSecret = ""
+	user.TwoFactorLastStep = 0
+	if err := s.authRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	s.audit(domain.AuditEventTwoFactorDisabled, user.ID, actor)
+
+	return s.authRepo.ReplaceBackupCodes(user.ID, nil)
+}
+
+func (s *twoFactorService) RegenerateBackupCodes(userID uint, code string, actor *domain.Actor) ([]string, error) {
+	user, err := s.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, errors.ErrUserNotFound
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, errors.ErrTwoFactorNotEnabled
+	}
+
+	if err := s.verifyTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.issueBackupCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(domain.AuditEventBackupCodesRegenerated, user.ID, actor)
+
+	return codes, nil
+}
+
+// audit records a change to the second factor. A failure is logged, the change stands.
+func (s *twoFactorService) audit(event string, userID uint, actor *domain.Actor) {
+	if err := s.auditService.Record(event, actor, userID, ""); err != nil {
+		fmt.Printf("failed to record %s audit event: %v\n", event, err)
+	}
+}
+
+func (s *twoFactorService) verifyCode(user *domain.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == security.TOTPDigits {
+		return s.verifyTOTP(user, code)
+	}
+
+	if err := s.authRepo.UseBackupCode(user.ID, security.HashToken(normalizeBackupCode(code))); err != nil {
+		return errors.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// verifyTOTP checks the code and records its step so the same code cannot be replayed
+func (s *twoFactorService) verifyTOTP(user *domain.User, code string) error {
+	secret, err := security.Decrypt(user.TwoFactorSecret, s.encryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+
+	step, ok := security.ValidateTOTPCode(secret, code, time.Now())
+	if !ok || step <= user.TwoFactorLastStep {
+		return errors.ErrInvalidTwoFactorCode
+	}
+
+	if err := s.authRepo.RecordTOTPStep(user.ID, step); err != nil {
+		if err == errors.ErrInvalidTwoFactorCode {
+			return err
+		}
+		return fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	user.TwoFactorLastStep = step
+	return nil
+}
+
+func (s *twoFactorService) issueBackupCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, backupCodeCount)
+	records := make([]*domain.BackupCode, 0, backupCodeCount)
+
+	for i := 0; i < backupCodeCount; i++ {
+		code, err := security.GenerateBackupCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate backup code: %w", err)
+		}
+		codes = append(codes, code)
+		records = append(records, &domain.BackupCode{
+			UserID:   userID,
+			CodeHash: security.HashToken(normalizeBackupCode(code)),
+		})
+	}
+
+	if err := s.authRepo.ReplaceBackupCodes(userID, records); err != nil {
+		return nil, fmt.Errorf("failed to store backup codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+func normalizeBackupCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
 }
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorService_EnableAndValidate(t *testing.T) {
+	mockRepo := NewMockAuthRepo()
+	service := NewTwoFactorService(mockRepo, newTestAuditService(), security.DeriveEncryptionKey("secret"), "Fowergram")
+
+	user := &domain.User{ID: 1, Email: "test@example.com"}
+	mockRepo.users[user.Email] = user
+	mockRepo.On("UpdateUser", mock.AnythingOfType("*domain.User")).Return(nil)
+	mockRepo.On("ReplaceBackupCodes", uint(1), mock.AnythingOfType("[]*domain.BackupCode")).Return(nil)
+
+	setup, err := service.GenerateTOTP(user.ID)
+	require.NoError(t, err)
+	assert.Contains(t, setup.ProvisioningURI, "otpauth://totp/Fowergram:test@example.com")
+	assert.NotEqual(t, setup.Secret, user.TwoFactorSecret, "secret must be stored encrypted")
+
+	code, err := security.GenerateTOTPCode(setup.Secret, security.TOTPStep(time.Now()))
+	require.NoError(t, err)
+
+	backupCodes, err := service.EnableTwoFactor(user.ID, code, nil)
+	require.NoError(t, err)
+	assert.Len(t, backupCodes, backupCodeCount)
+	assert.True(t, user.TwoFactorEnabled)
+
+	// The code used to enable 2FA must not be accepted a second time
+	assert.Equal(t, errors.ErrInvalidTwoFactorCode, service.ValidateTOTP(user.ID, code))
+
+	// Two requests that loaded the user before either recorded the code cannot both
+	// use it
+	stale := *user
+	next, err := security.GenerateTOTPCode(setup.Secret, security.TOTPStep(time.Now())+1)
+	require.NoError(t, err)
+	assert.NoError(t, service.ValidateTOTP(user.ID, next))
+	assert.Equal(t, errors.ErrInvalidTwoFactorCode, service.(*twoFactorService).verifyTOTP(&stale, next))
+
+	// Backup codes are accepted regardless of formatting and only once
+	hash := security.HashToken(normalizeBackupCode(backupCodes[0]))
+	mockRepo.On("UseBackupCode", uint(1), hash).Return(nil).Once()
+	mockRepo.On("UseBackupCode", uint(1), hash).Return(fmt.Errorf("invalid or used backup code"))
+	assert.NoError(t, service.ValidateTOTP(user.ID, backupCodes[0]))
+	assert.Equal(t, errors.ErrInvalidTwoFactorCode, service.ValidateTOTP(user.ID, backupCodes[0]))
+}
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 secret "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := security.GenerateTOTPCode(secret, security.TOTPStep(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, code)
+	}
+}
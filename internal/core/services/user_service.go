@@ -7,6 +7,7 @@ import (
 
 	"fowergram/internal/core/domain"
 	"fowergram/internal/core/ports"
+	"fowergram/pkg/pagination"
 )
 
 type userService struct {
@@ -92,29 +93,29 @@ func (s *userService) GetUserByEmail(email string) (*domain.User, error) {
 	return user, nil
 }
 
-func (s *userService) GetUsers(page, limit int) ([]*domain.User, error) {
-	return s.userRepo.FindAll(page, limit)
+func (s *userService) GetUsers(page pagination.Page) (*pagination.List[*domain.User], error) {
+	return s.userRepo.FindAll(page)
 }
 
-func (s *userService) GetUsersFromCache(cacheKey string) ([]*domain.User, error) {
+func (s *userService) GetUsersFromCache(cacheKey string) (*pagination.List[*domain.User], error) {
 	cached, err := s.cacheRepo.Get(cacheKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert cached data back to users array
+	// Convert cached data back to a page of users
 	if data, ok := cached.([]byte); ok {
-		var users []*domain.User
+		var users pagination.List[*domain.User]
 		if err := json.Unmarshal(data, &users); err != nil {
 			return nil, err
 		}
-		return users, nil
+		return &users, nil
 	}
 
 	return nil, fmt.Errorf("invalid cache data type")
 }
 
-func (s *userService) CacheUsers(cacheKey string, users []*domain.User) error {
+func (s *userService) CacheUsers(cacheKey string, users *pagination.List[*domain.User]) error {
 	// Cache for 5 minutes since user list might change frequently
 	return s.cacheRepo.Set(cacheKey, users, 5*time.Minute)
 }
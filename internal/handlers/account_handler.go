@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AccountHandler serves the account lifecycle endpoints
+type AccountHandler struct {
+	accountService ports.AccountService
+	validate       *validator.Validate
+}
+
+func NewAccountHandler(as ports.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: as,
+		validate:       validator.New(),
+	}
+}
+
+// Delete schedules the account for deletion. Signing in again before the returned
+// time cancels it.
+func (h *AccountHandler) Delete(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.AccountDeletionRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	deleteAt, err := h.accountService.RequestDeletion(user.ID, req, actor(c))
+	if err != nil {
+		return accountError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":               "Account scheduled for deletion, sign in again to cancel",
+		"deletion_scheduled_at": deleteAt,
+	})
+}
+
+// SendDeletionCode emails a code that confirms the deletion without the password
+func (h *AccountHandler) SendDeletionCode(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	if err := h.accountService.SendDeletionCode(user.ID); err != nil {
+		return accountError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "A confirmation code has been sent to your email",
+	})
+}
+
+func accountError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *errors.AuthError:
+		status := fiber.StatusBadRequest
+		switch e {
+		case errors.ErrInvalidCredentials, errors.ErrInvalidTwoFactorCode:
+			status = fiber.StatusUnauthorized
+		case errors.ErrStaffAccountDeletion:
+			status = fiber.StatusForbidden
+		case errors.ErrUserNotFound:
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": e.Message,
+			"code":  e.Code,
+		})
+	default:
+		fmt.Printf("account error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+}
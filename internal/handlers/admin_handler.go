@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminHandler serves the staff API. Routes are guarded by RequirePermission, which
+// stores the full staff account in the context.
+type AdminHandler struct {
+	adminService ports.AdminService
+	validate     *validator.Validate
+}
+
+func NewAdminHandler(as ports.AdminService) *AdminHandler {
+	return &AdminHandler{
+		adminService: as,
+		validate:     validator.New(),
+	}
+}
+
+func (h *AdminHandler) SearchUsers(c *fiber.Ctx) error {
+	page, err := listPage(c)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	users, err := h.adminService.SearchUsers(actor(c), c.Query("q"), page)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(users)
+}
+
+func (h *AdminHandler) GetUser(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	user, err := h.adminService.GetUser(actor(c), uint(id))
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+func (h *AdminHandler) LockUser(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	req := new(domain.AdminLockRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil || !req.Until.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	if err := h.adminService.LockUser(actor(c), uint(id), req.Until, req.Reason); err != nil {
+		return adminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User locked",
+	})
+}
+
+func (h *AdminHandler) UnlockUser(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := h.adminService.UnlockUser(actor(c), uint(id)); err != nil {
+		return adminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User unlocked",
+	})
+}
+
+func (h *AdminHandler) ForcePasswordReset(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := h.adminService.ForcePasswordReset(actor(c), uint(id)); err != nil {
+		return adminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password reset required, a reset code was sent to the user",
+	})
+}
+
+func (h *AdminHandler) GetLoginHistory(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	page, err := listPage(c)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	history, err := h.adminService.GetLoginHistory(actor(c), uint(id), page)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(history)
+}
+
+func (h *AdminHandler) ChangeRole(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	req := new(domain.AdminRoleRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	if err := h.adminService.ChangeRole(actor(c), uint(id), req.Role); err != nil {
+		return adminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Role changed",
+		"role":    req.Role,
+	})
+}
+
+func (h *AdminHandler) ListActions(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+
+	actions, err := h.adminService.ListActions(page, limit)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"actions": actions,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+func adminError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *errors.AuthError:
+		status := fiber.StatusBadRequest
+		switch e {
+		case errors.ErrUserNotFound:
+			status = fiber.StatusNotFound
+		case errors.ErrPermissionDenied:
+			status = fiber.StatusForbidden
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": e.Message,
+			"code":  e.Code,
+		})
+	default:
+		fmt.Printf("admin error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type APIKeyHandler struct {
+	apiKeyService ports.APIKeyService
+	validate      *validator.Validate
+}
+
+func NewAPIKeyHandler(aks ports.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: aks,
+		validate:      validator.New(),
+	}
+}
+
+// Create returns the new key. It is only shown in this response.
+func (h *APIKeyHandler) Create(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.APIKeyRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	credentials, err := h.apiKeyService.Create(user.ID, req, actor(c))
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+
+	response := apiKeyView(credentials.APIKey)
+	response["key"] = credentials.Key
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func (h *APIKeyHandler) List(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	keys, err := h.apiKeyService.List(user.ID)
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+
+	response := make([]fiber.Map, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, apiKeyView(key))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"api_keys": response,
+	})
+}
+
+func (h *APIKeyHandler) Revoke(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	if err := h.apiKeyService.Revoke(user.ID, uint(id), actor(c)); err != nil {
+		return apiKeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API key revoked",
+	})
+}
+
+func apiKeyView(key *domain.APIKey) fiber.Map {
+	return fiber.Map{
+		"id":           key.ID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"scopes":       key.ScopeList(),
+		"expires_at":   key.ExpiresAt,
+		"last_used_at": key.LastUsedAt,
+		"created_at":   key.CreatedAt,
+	}
+}
+
+func apiKeyError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *errors.AuthError:
+		status := fiber.StatusBadRequest
+		if e == errors.ErrAPIKeyNotFound {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": e.Message,
+			"code":  e.Code,
+		})
+	default:
+		fmt.Printf("api key error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditHandler struct {
+	auditService ports.AuditService
+}
+
+func NewAuditHandler(as ports.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: as,
+	}
+}
+
+// ListMine pages through the security events of the signed-in user
+func (h *AuditHandler) ListMine(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+
+	entries, err := h.auditService.ListForUser(user.ID, page, limit)
+	if err != nil {
+		fmt.Printf("audit log error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"entries": entries,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// Search filters the whole audit log by event, actor, target, IP address, request ID
+// and time range
+func (h *AuditHandler) Search(c *fiber.Ctx) error {
+	filter := &domain.AuditFilter{
+		Event:     c.Query("event"),
+		IPAddress: c.Query("ip_address"),
+		RequestID: c.Query("request_id"),
+		Page:      c.QueryInt("page", 1),
+		Limit:     c.QueryInt("limit", 50),
+	}
+
+	var err error
+	if filter.ActorID, err = queryUint(c, "actor_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid actor_id",
+		})
+	}
+	if filter.TargetUserID, err = queryUint(c, "target_user_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid target_user_id",
+		})
+	}
+	if filter.From, err = queryTime(c, "from"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid from, expected RFC 3339",
+		})
+	}
+	if filter.To, err = queryTime(c, "to"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid to, expected RFC 3339",
+		})
+	}
+
+	entries, err := h.auditService.Search(filter)
+	if err != nil {
+		fmt.Printf("audit log error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"entries": entries,
+		"page":    filter.Page,
+		"limit":   filter.Limit,
+	})
+}
+
+// Verify checks the hash chain of the whole log
+func (h *AuditHandler) Verify(c *fiber.Ctx) error {
+	result, err := h.auditService.VerifyChain()
+	if err != nil {
+		fmt.Printf("audit log error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func queryUint(c *fiber.Ctx, key string) (*uint, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	id := uint(parsed)
+	return &id, nil
+}
+
+func queryTime(c *fiber.Ctx, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
@@ -49,6 +49,8 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	if err := h.authService.Register(user); err != nil {
 		fmt.Printf("Register error: %v\n", err)
 		switch e := err.(type) {
+		case *errors.PasswordPolicyError:
+			return passwordPolicyResponse(c, e)
 		case *errors.AuthError:
 			if e.Code == "AUTH003" {
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -77,6 +79,192 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	})
 }
 
+// VerifyEmail confirms the address with the code sent at registration
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	req := new(domain.VerifyEmailRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	if err := h.authService.VerifyEmail(req.Email, req.Code); err != nil {
+		switch e := err.(type) {
+		case *errors.AuthError:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": e.Message,
+				"code":  e.Code,
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to verify email",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerification sends a new verification code if the address is registered and unverified
+func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	req := new(domain.ResendVerificationRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	if err := h.authService.ResendVerificationEmail(req.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send verification email",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "If the account exists and is unverified, a new code has been sent",
+	})
+}
+
+// ForgotPassword emails a reset code. The response is the same whether or not the email is registered.
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	req := new(domain.ForgotPasswordRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	if err := h.authService.InitiateAccountRecovery(req.Email); err != nil {
+		fmt.Printf("InitiateAccountRecovery error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start password reset",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "If the account exists, a password reset code has been sent",
+	})
+}
+
+// VerifyResetCode lets clients check a reset code before asking for the new password
+func (h *AuthHandler) VerifyResetCode(c *fiber.Ctx) error {
+	req := new(domain.VerifyResetCodeRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	if err := h.authService.ValidateRecoveryCode(req.Email, req.Code); err != nil {
+		return passwordResetError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Reset code is valid",
+	})
+}
+
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	req := new(domain.ResetPasswordRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	if err := h.authService.ResetPassword(req.Email, req.Code, req.NewPassword, actor(c)); err != nil {
+		return passwordResetError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password has been reset, please log in again",
+	})
+}
+
+// ChangePassword sets a new password and signs out every other device
+func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+	sessionID, _ := c.Locals("session_id").(uint)
+
+	req := new(domain.ChangePasswordRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	if err := h.authService.ChangePassword(user.ID, sessionID, req.CurrentPassword, req.NewPassword, actor(c)); err != nil {
+		return passwordResetError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password changed, other devices have been logged out",
+	})
+}
+
+func passwordPolicyResponse(c *fiber.Ctx, e *errors.PasswordPolicyError) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":      e.Error(),
+		"code":       e.Code,
+		"violations": e.Violations,
+	})
+}
+
+func passwordResetError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *errors.PasswordPolicyError:
+		return passwordPolicyResponse(c, e)
+	case *errors.AuthError:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": e.Message,
+			"code":  e.Code,
+		})
+	default:
+		fmt.Printf("Password reset error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset password",
+		})
+	}
+}
+
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	startTime := time.Now()
 
@@ -101,13 +289,15 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 
 	// Create device info from request
 	deviceInfo := &domain.DeviceSession{
+		DeviceID:   c.Get("Device-ID"),
 		DeviceType: c.Get("User-Agent"),
 		IPAddress:  c.IP(),
 		UserAgent:  c.Get("User-Agent"),
+		RequestID:  requestID(c),
 	}
 
 	loginStart := time.Now()
-	user, token, err := h.authService.Login(req.Email, req.Password, deviceInfo)
+	result, err := h.authService.Login(req.Email, req.Password, deviceInfo)
 	loginTime := time.Since(loginStart)
 	fmt.Printf("Auth service login took: %v\n", loginTime)
 
@@ -120,6 +310,18 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 					"code":  e.Code,
 				})
 			}
+			if e == errors.ErrTooManyRequests {
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+					"error": e.Message,
+					"code":  e.Code,
+				})
+			}
+			if e == errors.ErrLoginBlocked {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": e.Message,
+					"code":  e.Code,
+				})
+			}
 			if e.Code == "AUTH001" { // Invalid credentials
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 					"error": "Invalid email or password",
@@ -140,17 +342,225 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	totalTime := time.Since(startTime)
 	fmt.Printf("Total login process took: %v\n", totalTime)
 
+	return loginResponse(c, result)
+}
+
+// LoginTwoFactor completes a login that returned an mfa_pending challenge
+func (h *AuthHandler) LoginTwoFactor(c *fiber.Ctx) error {
+	req := new(domain.TwoFactorLoginRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	deviceInfo := &domain.DeviceSession{
+		DeviceID:   c.Get("Device-ID"),
+		DeviceType: c.Get("User-Agent"),
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		RequestID:  requestID(c),
+	}
+
+	result, err := h.authService.CompleteTwoFactorLogin(req.ChallengeToken, req.Code, deviceInfo)
+	if err != nil {
+		switch e := err.(type) {
+		case *errors.AuthError:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": e.Message,
+				"code":  e.Code,
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	return loginResponse(c, result)
+}
+
+// VerifyLogin finishes a login that was answered with a login_verification challenge,
+// using the code emailed to the user
+func (h *AuthHandler) VerifyLogin(c *fiber.Ctx) error {
+	req := new(domain.LoginVerificationRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	deviceInfo := &domain.DeviceSession{
+		DeviceID:   c.Get("Device-ID"),
+		DeviceType: c.Get("User-Agent"),
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		RequestID:  requestID(c),
+	}
+
+	result, err := h.authService.CompleteLoginVerification(req.ChallengeToken, req.Code, deviceInfo)
+	if err != nil {
+		switch e := err.(type) {
+		case *errors.AuthError:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": e.Message,
+				"code":  e.Code,
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	return loginResponse(c, result)
+}
+
+// RequestMagicLink emails a one-time login link. The response is the same for unknown emails.
+func (h *AuthHandler) RequestMagicLink(c *fiber.Ctx) error {
+	req := new(domain.MagicLinkRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	binding, err := h.authService.RequestMagicLink(req.Email, req.BindDevice)
+	if err != nil {
+		fmt.Printf("RequestMagicLink error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send login link",
+		})
+	}
+
+	response := fiber.Map{
+		"message": "If the account exists, a login link has been sent",
+	}
+	if binding != "" {
+		response["device_binding"] = binding
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// ConsumeMagicLink logs in with the token from a magic link
+func (h *AuthHandler) ConsumeMagicLink(c *fiber.Ctx) error {
+	req := new(domain.ConsumeMagicLinkRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	deviceInfo := &domain.DeviceSession{
+		DeviceID:   c.Get("Device-ID"),
+		DeviceType: c.Get("User-Agent"),
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		RequestID:  requestID(c),
+	}
+
+	result, err := h.authService.ConsumeMagicLink(req.Token, req.DeviceBinding, deviceInfo)
+	if err != nil {
+		switch e := err.(type) {
+		case *errors.AuthError:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": e.Message,
+				"code":  e.Code,
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	return loginResponse(c, result)
+}
+
+func loginResponse(c *fiber.Ctx, result *domain.LoginResult) error {
+	if result.Challenge != nil {
+		return c.Status(fiber.StatusOK).JSON(result.Challenge)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"token": token,
-		"user":  user,
+		"token":         result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"expires_in":    result.Tokens.ExpiresIn,
+		"user":          result.User,
 	})
 }
 
+// Refresh exchanges a refresh token for a new access/refresh pair
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	req := new(domain.RefreshTokenRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	tokens, err := h.authService.RefreshToken(req.RefreshToken)
+	if err != nil {
+		switch e := err.(type) {
+		case *errors.AuthError:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": e.Message,
+				"code":  e.Code,
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+// Logout revokes the device session the request is authenticated with
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
-	deviceID := c.Get("Device-ID")
 	user := c.Locals("user").(*domain.User)
+	sessionID, _ := c.Locals("session_id").(uint)
 
-	if err := h.authService.RevokeSession(user.ID, deviceID); err != nil {
+	// Tokens issued before sessions were embedded identify the device by header
+	var err error
+	if sessionID == 0 {
+		err = h.authService.RevokeSession(user.ID, c.Get("Device-ID"), actor(c))
+	} else {
+		err = h.authService.LogoutSession(user.ID, sessionID, actor(c))
+	}
+
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to logout",
 		})
@@ -161,6 +571,37 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	})
 }
 
+// LogoutOthers revokes every session of the user except the current one
+func (h *AuthHandler) LogoutOthers(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+	sessionID, _ := c.Locals("session_id").(uint)
+
+	if err := h.authService.RevokeOtherSessions(user.ID, sessionID, actor(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to logout other devices",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Logged out of all other devices",
+	})
+}
+
+// LogoutAll revokes every session of the user including the current one
+func (h *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	if err := h.authService.RevokeAllSessions(user.ID, actor(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to logout everywhere",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Logged out of all devices",
+	})
+}
+
 // ValidateToken handles token validation requests
 func (h *AuthHandler) ValidateToken(c *fiber.Ctx) error {
 	// Token validation is handled by the auth middleware
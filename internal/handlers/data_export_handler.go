@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DataExportHandler lets users download a copy of their personal data
+type DataExportHandler struct {
+	exportService ports.DataExportService
+}
+
+func NewDataExportHandler(des ports.DataExportService) *DataExportHandler {
+	return &DataExportHandler{
+		exportService: des,
+	}
+}
+
+// Request queues an export. The user is emailed a download link once it is ready.
+func (h *DataExportHandler) Request(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	export, err := h.exportService.Request(user.ID, actor(c))
+	if err != nil {
+		return dataExportError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(export)
+}
+
+// Status returns the latest export, with its download URL once it is ready
+func (h *DataExportHandler) Status(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	export, downloadURL, err := h.exportService.Latest(user.ID)
+	if err != nil {
+		return dataExportError(c, err)
+	}
+
+	response := fiber.Map{
+		"export": export,
+	}
+	if downloadURL != "" {
+		response["download_url"] = downloadURL
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// Download serves the archive of a signed link. The link is the only credential, it
+// is opened from the email.
+func (h *DataExportHandler) Download(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	expires := int64(c.QueryInt("expires"))
+	export, path, err := h.exportService.Open(uint(id), expires, c.Query("signature"), actor(c))
+	if err != nil {
+		return dataExportError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Download(path, fmt.Sprintf("fowergram-data-%s.zip", export.CreatedAt.Format("2006-01-02")))
+}
+
+func dataExportError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrDataExportTooSoon:
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": errors.ErrDataExportTooSoon.Message,
+			"code":  errors.ErrDataExportTooSoon.Code,
+		})
+	case errors.ErrDataExportNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": errors.ErrDataExportNotFound.Message,
+			"code":  errors.ErrDataExportNotFound.Code,
+		})
+	}
+
+	fmt.Printf("data export error: %v\n", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/useragent"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeviceHandler lets users see where they are signed in and manage those devices
+type DeviceHandler struct {
+	authService ports.AuthService
+	validate    *validator.Validate
+}
+
+func NewDeviceHandler(as ports.AuthService) *DeviceHandler {
+	return &DeviceHandler{
+		authService: as,
+		validate:    validator.New(),
+	}
+}
+
+func (h *DeviceHandler) List(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+	sessionID, _ := c.Locals("session_id").(uint)
+
+	sessions, err := h.authService.GetActiveSessions(user.ID, sessionID)
+	if err != nil {
+		return deviceError(c, err)
+	}
+
+	devices := make([]fiber.Map, 0, len(sessions))
+	for _, session := range sessions {
+		devices = append(devices, deviceView(session))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"devices": devices,
+	})
+}
+
+// Update renames a device or changes whether it is trusted
+func (h *DeviceHandler) Update(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	req := new(domain.DeviceUpdateRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	session, err := h.authService.UpdateDevice(user.ID, uint(id), req, actor(c))
+	if err != nil {
+		return deviceError(c, err)
+	}
+
+	sessionID, _ := c.Locals("session_id").(uint)
+	session.Current = session.ID == sessionID
+	return c.Status(fiber.StatusOK).JSON(deviceView(session))
+}
+
+// Revoke signs the device out
+func (h *DeviceHandler) Revoke(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	if err := h.authService.RevokeDevice(user.ID, uint(id), actor(c)); err != nil {
+		return deviceError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Device signed out",
+	})
+}
+
+func deviceView(session *domain.DeviceSession) fiber.Map {
+	agent := useragent.Parse(session.UserAgent)
+	return fiber.Map{
+		"id":          session.ID,
+		"device_id":   session.DeviceID,
+		"name":        session.DeviceName,
+		"os":          agent.OS,
+		"browser":     agent.Browser,
+		"app_version": agent.AppVersion,
+		"ip_address":  session.IPAddress,
+		"location":    session.GetLocation(),
+		"trusted":     session.Trusted,
+		"current":     session.Current,
+		"last_active": session.LastActive,
+		"created_at":  session.CreatedAt,
+	}
+}
+
+func deviceError(c *fiber.Ctx, err error) error {
+	if err == errors.ErrDeviceNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": errors.ErrDeviceNotFound.Message,
+			"code":  errors.ErrDeviceNotFound.Code,
+		})
+	}
+
+	fmt.Printf("device error: %v\n", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"fowergram/pkg/security"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type JWKSHandler struct {
+	keys *security.KeyRing
+}
+
+func NewJWKSHandler(keys *security.KeyRing) *JWKSHandler {
+	return &JWKSHandler{
+		keys: keys,
+	}
+}
+
+// GetJWKS publishes the public keys of every active and retired signing key
+func (h *JWKSHandler) GetJWKS(c *fiber.Ctx) error {
+	// Let verifiers cache the set, but pick up newly published keys well before they sign
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(h.keys.JWKS())
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// MediaHandler takes the files users upload for their posts
+type MediaHandler struct {
+	mediaService ports.MediaService
+	validate     *validator.Validate
+}
+
+func NewMediaHandler(ms ports.MediaService) *MediaHandler {
+	return &MediaHandler{
+		mediaService: ms,
+		validate:     validator.New(),
+	}
+}
+
+// Upload stores a file sent as the "file" field of a multipart form. Files larger
+// than the request body limit are sent with a resumable upload.
+func (h *MediaHandler) Upload(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Missing file",
+		})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return mediaError(c, err)
+	}
+	defer file.Close()
+
+	media, err := h.mediaService.Upload(user.ID, file, header.Size)
+	if err != nil {
+		return mediaError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(media)
+}
+
+// Get returns media the user uploaded
+func (h *MediaHandler) Get(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	media, err := h.mediaService.Get(user.ID, uint(id))
+	if err != nil {
+		return mediaError(c, err)
+	}
+	return c.JSON(media)
+}
+
+// StartUpload begins a resumable upload. The response tells the client the chunk size.
+func (h *MediaHandler) StartUpload(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.MediaUploadRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	upload, err := h.mediaService.StartUpload(user.ID, req)
+	if err != nil {
+		return mediaError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"upload":     upload,
+		"chunk_size": domain.MediaChunkSize,
+	})
+}
+
+// GetUpload returns how much of an upload arrived, to resume after a failed request
+func (h *MediaHandler) GetUpload(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	upload, err := h.mediaService.GetUpload(user.ID, c.Params("id"))
+	if err != nil {
+		return mediaError(c, err)
+	}
+	return c.JSON(fiber.Map{
+		"upload": upload,
+	})
+}
+
+// UploadChunk takes the raw bytes of the chunk that starts at the Upload-Offset header.
+// The response to the last chunk has the media.
+func (h *MediaHandler) UploadChunk(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Upload-Offset header",
+		})
+	}
+
+	upload, media, err := h.mediaService.AppendChunk(user.ID, c.Params("id"), offset, c.Body())
+	if err == errors.ErrUploadOffsetMismatch {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  errors.ErrUploadOffsetMismatch.Message,
+			"code":   errors.ErrUploadOffsetMismatch.Code,
+			"upload": upload,
+		})
+	}
+	if err != nil {
+		return mediaError(c, err)
+	}
+
+	response := fiber.Map{
+		"upload": upload,
+	}
+	if media != nil {
+		response["media"] = media
+	}
+	return c.JSON(response)
+}
+
+// Serve returns a stored file. Blobs are named by the hash of their content, so they
+// never change and can be cached for good.
+func (h *MediaHandler) Serve(c *fiber.Ctx) error {
+	content, blob, err := h.mediaService.Open(c.Params("hash"))
+	if err != nil {
+		return mediaError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, blob.ContentType)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.SendStream(content, int(blob.SizeBytes))
+}
+
+func mediaError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrMediaTooLarge:
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": errors.ErrMediaTooLarge.Message,
+			"code":  errors.ErrMediaTooLarge.Code,
+		})
+	case errors.ErrUnsupportedMediaType:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": errors.ErrUnsupportedMediaType.Message,
+			"code":  errors.ErrUnsupportedMediaType.Code,
+		})
+	case errors.ErrMediaNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": errors.ErrMediaNotFound.Message,
+			"code":  errors.ErrMediaNotFound.Code,
+		})
+	case errors.ErrUploadNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": errors.ErrUploadNotFound.Message,
+			"code":  errors.ErrUploadNotFound.Code,
+		})
+	case errors.ErrInvalidChunk:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errors.ErrInvalidChunk.Message,
+			"code":  errors.ErrInvalidChunk.Code,
+		})
+	}
+
+	fmt.Printf("media error: %v\n", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// OAuthHandler serves the authorization server for third-party apps. The endpoints used
+// by clients answer in the RFC 6749 error format so standard OAuth libraries work.
+type OAuthHandler struct {
+	oauthService ports.OAuthService
+	userService  ports.UserService
+	validate     *validator.Validate
+}
+
+func NewOAuthHandler(os ports.OAuthService, us ports.UserService) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: os,
+		userService:  us,
+		validate:     validator.New(),
+	}
+}
+
+// RegisterClient registers an app owned by the current user
+func (h *OAuthHandler) RegisterClient(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.OAuthClientRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	credentials, err := h.oauthService.RegisterClient(user.ID, req)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"client_id":     credentials.Client.ClientID,
+		"client_secret": credentials.ClientSecret,
+		"name":          credentials.Client.Name,
+		"redirect_uris": credentials.Client.RedirectURIList(),
+		"scopes":        credentials.Client.ScopeList(),
+		"public":        credentials.Client.Public,
+	})
+}
+
+func (h *OAuthHandler) ListClients(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	clients, err := h.oauthService.ListClients(user.ID)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	response := make([]fiber.Map, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, fiber.Map{
+			"client_id":     client.ClientID,
+			"name":          client.Name,
+			"redirect_uris": client.RedirectURIList(),
+			"scopes":        client.ScopeList(),
+			"public":        client.Public,
+			"created_at":    client.CreatedAt,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"clients": response,
+	})
+}
+
+func (h *OAuthHandler) DeleteClient(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	if err := h.oauthService.DeleteClient(user.ID, c.Params("client_id")); err != nil {
+		return oauthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Client deleted",
+	})
+}
+
+// Authorize validates the authorization request of the query string and returns what
+// the consent screen should show
+func (h *OAuthHandler) Authorize(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.OAuthAuthorizeRequest)
+	if err := c.QueryParser(req); err != nil {
+		return oauthError(c, errors.ErrOAuthInvalidRequest)
+	}
+
+	screen, err := h.oauthService.Authorize(user.ID, req)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(screen)
+}
+
+// Consent records the user's decision. The frontend sends the user to redirect_to,
+// which carries either the code or access_denied.
+func (h *OAuthHandler) Consent(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.OAuthConsentRequest)
+	if err := c.BodyParser(req); err != nil {
+		return oauthError(c, errors.ErrOAuthInvalidRequest)
+	}
+
+	redirectTo, err := h.oauthService.Consent(user.ID, req)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"redirect_to": redirectTo,
+	})
+}
+
+func (h *OAuthHandler) Token(c *fiber.Ctx) error {
+	req := new(domain.OAuthTokenRequest)
+	if err := c.BodyParser(req); err != nil {
+		return oauthError(c, errors.ErrOAuthInvalidRequest)
+	}
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	tokens, err := h.oauthService.Token(req)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+func (h *OAuthHandler) Introspect(c *fiber.Ctx) error {
+	req := new(domain.OAuthTokenActionRequest)
+	if err := c.BodyParser(req); err != nil || req.Token == "" {
+		return oauthError(c, errors.ErrOAuthInvalidRequest)
+	}
+	clientID, clientSecret := clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	introspection, err := h.oauthService.Introspect(clientID, clientSecret, req.Token)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(introspection)
+}
+
+func (h *OAuthHandler) Revoke(c *fiber.Ctx) error {
+	req := new(domain.OAuthTokenActionRequest)
+	if err := c.BodyParser(req); err != nil || req.Token == "" {
+		return oauthError(c, errors.ErrOAuthInvalidRequest)
+	}
+	clientID, clientSecret := clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	if err := h.oauthService.Revoke(clientID, clientSecret, req.Token); err != nil {
+		return oauthError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// UserInfo returns the profile of the user who authorized the app
+func (h *OAuthHandler) UserInfo(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	account, err := h.userService.GetUserByID(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"id":         account.ID,
+		"username":   account.Username,
+		"created_at": account.CreatedAt,
+	})
+}
+
+// clientCredentials prefers HTTP Basic authentication (client_secret_basic) and falls
+// back to the credentials in the body (client_secret_post)
+func clientCredentials(c *fiber.Ctx, clientID, clientSecret string) (string, string) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Basic ") {
+		return clientID, clientSecret
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return "", ""
+	}
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", ""
+	}
+
+	// Both parts are form encoded before being joined, RFC 6749 section 2.3.1
+	if id, err = url.QueryUnescape(id); err != nil {
+		return "", ""
+	}
+	if secret, err = url.QueryUnescape(secret); err != nil {
+		return "", ""
+	}
+	return id, secret
+}
+
+func oauthError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *errors.OAuthError:
+		if e.Status == fiber.StatusUnauthorized {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="fowergram"`)
+		}
+		return c.Status(e.Status).JSON(fiber.Map{
+			"error":             e.Code,
+			"error_description": e.Description,
+		})
+	default:
+		fmt.Printf("oauth error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "server_error",
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PasskeyHandler struct {
+	passkeyService ports.PasskeyService
+	authService    ports.AuthService
+	validate       *validator.Validate
+}
+
+func NewPasskeyHandler(pks ports.PasskeyService, as ports.AuthService) *PasskeyHandler {
+	return &PasskeyHandler{
+		passkeyService: pks,
+		authService:    as,
+		validate:       validator.New(),
+	}
+}
+
+// BeginRegistration returns the options for navigator.credentials.create
+func (h *PasskeyHandler) BeginRegistration(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	ceremony, err := h.passkeyService.BeginRegistration(user.ID)
+	if err != nil {
+		return passkeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(ceremony)
+}
+
+// FinishRegistration stores the passkey created by the authenticator
+func (h *PasskeyHandler) FinishRegistration(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.PasskeyRegistrationRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	credential, err := h.passkeyService.FinishRegistration(user.ID, req.CeremonyID, req.Name, req.Credential)
+	if err != nil {
+		return passkeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(credential)
+}
+
+// BeginLogin returns the options for navigator.credentials.get
+func (h *PasskeyHandler) BeginLogin(c *fiber.Ctx) error {
+	ceremony, err := h.passkeyService.BeginLogin()
+	if err != nil {
+		return passkeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(ceremony)
+}
+
+// FinishLogin verifies the assertion and logs the user in like a password login
+func (h *PasskeyHandler) FinishLogin(c *fiber.Ctx) error {
+	req := new(domain.PasskeyLoginRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	deviceInfo := &domain.DeviceSession{
+		DeviceID:   c.Get("Device-ID"),
+		DeviceType: c.Get("User-Agent"),
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		RequestID:  requestID(c),
+	}
+
+	result, err := h.authService.LoginWithPasskey(req.CeremonyID, req.Credential, deviceInfo)
+	if err != nil {
+		switch e := err.(type) {
+		case *errors.AuthError:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": e.Message,
+				"code":  e.Code,
+			})
+		default:
+			fmt.Printf("LoginWithPasskey error: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	return loginResponse(c, result)
+}
+
+func (h *PasskeyHandler) List(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	credentials, err := h.passkeyService.ListCredentials(user.ID)
+	if err != nil {
+		return passkeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"passkeys": credentials,
+	})
+}
+
+func (h *PasskeyHandler) Delete(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	if err := h.passkeyService.DeleteCredential(user.ID, uint(id)); err != nil {
+		if err == errors.ErrInvalidPasskey {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Passkey not found",
+			})
+		}
+		return passkeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkey removed",
+	})
+}
+
+func passkeyError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *errors.AuthError:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": e.Message,
+			"code":  e.Code,
+		})
+	default:
+		fmt.Printf("passkey error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+}
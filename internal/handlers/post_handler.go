@@ -1,24 +1,35 @@
 package handlers
 
 import (
+	"fmt"
+
 	"fowergram/internal/core/domain"
 	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 )
 
 type PostHandler struct {
 	postService ports.PostService
+	validate    *validator.Validate
 }
 
 func NewPostHandler(ps ports.PostService) *PostHandler {
 	return &PostHandler{
 		postService: ps,
+		validate:    validator.New(),
 	}
 }
 
 func (h *PostHandler) GetPosts(c *fiber.Ctx) error {
-	posts, err := h.postService.GetAllPosts()
+	page, err := listPage(c)
+	if err != nil {
+		return postError(c, err)
+	}
+
+	posts, err := h.postService.GetPosts(page)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to get posts",
@@ -27,19 +38,149 @@ func (h *PostHandler) GetPosts(c *fiber.Ctx) error {
 	return c.JSON(posts)
 }
 
+func (h *PostHandler) GetPost(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	post, err := h.postService.GetPostByID(uint(id))
+	if err != nil {
+		return postError(c, err)
+	}
+	return c.JSON(post)
+}
+
+func (h *PostHandler) GetComments(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	page, err := listPage(c)
+	if err != nil {
+		return postError(c, err)
+	}
+
+	comments, err := h.postService.GetComments(uint(id), page)
+	if err != nil {
+		return postError(c, err)
+	}
+	return c.JSON(comments)
+}
+
+// CreatePost publishes a post as the signed in user
 func (h *PostHandler) CreatePost(c *fiber.Ctx) error {
-	post := new(domain.Post)
-	if err := c.BodyParser(post); err != nil {
-		return c.Status(400).JSON(fiber.Map{
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.CreatePostRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
-	if err := h.postService.CreatePost(post); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create post",
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	post, err := h.postService.CreatePost(user.ID, req)
+	if err != nil {
+		return postError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(post)
+}
+
+// UpdatePost is used by authors, and by moderators through the admin API
+func (h *PostHandler) UpdatePost(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	req := new(domain.UpdatePostRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
 		})
 	}
 
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	post, err := h.postService.UpdatePost(uint(id), req, actor(c))
+	if err != nil {
+		return postError(c, err)
+	}
 	return c.JSON(post)
 }
+
+// DeletePost is used by authors, and by moderators through the admin API
+func (h *PostHandler) DeletePost(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	if err := h.postService.DeletePost(uint(id), actor(c)); err != nil {
+		return postError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Post deleted",
+	})
+}
+
+func postError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrPostNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": errors.ErrPostNotFound.Message,
+			"code":  errors.ErrPostNotFound.Code,
+		})
+	case errors.ErrMediaNotFound:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errors.ErrMediaNotFound.Message,
+			"code":  errors.ErrMediaNotFound.Code,
+		})
+	case errors.ErrMediaProcessingFailed:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errors.ErrMediaProcessingFailed.Message,
+			"code":  errors.ErrMediaProcessingFailed.Code,
+		})
+	case errors.ErrTaggedUserNotFound:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errors.ErrTaggedUserNotFound.Message,
+			"code":  errors.ErrTaggedUserNotFound.Code,
+		})
+	case errors.ErrPermissionDenied:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": errors.ErrPermissionDenied.Message,
+			"code":  errors.ErrPermissionDenied.Code,
+		})
+	case errors.ErrInvalidCursor:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errors.ErrInvalidCursor.Message,
+			"code":  errors.ErrInvalidCursor.Code,
+		})
+	}
+
+	fmt.Printf("post error: %v\n", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
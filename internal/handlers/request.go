@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/pagination"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// actor describes who is making the request, for the audit log. On routes without
+// authentication only the client details are set.
+func actor(c *fiber.Ctx) *domain.Actor {
+	a := &domain.Actor{
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		RequestID: requestID(c),
+	}
+	if user, ok := c.Locals("user").(*domain.User); ok {
+		a.UserID = user.ID
+		a.Role = user.Role
+	}
+	return a
+}
+
+// requestID returns the ID assigned by the requestid middleware
+func requestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestid").(string)
+	return id
+}
+
+// listPage reads the cursor and limit query parameters of a list endpoint. The
+// cursor is the next_cursor of the previous page.
+func listPage(c *fiber.Ctx) (pagination.Page, error) {
+	page, err := pagination.NewPage(c.Query("cursor"), c.QueryInt("limit"))
+	if err != nil {
+		return page, errors.ErrInvalidCursor
+	}
+	return page, nil
+}
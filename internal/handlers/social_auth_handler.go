@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type SocialAuthHandler struct {
+	socialService ports.SocialAuthService
+	authService   ports.AuthService
+	validate      *validator.Validate
+}
+
+func NewSocialAuthHandler(sas ports.SocialAuthService, as ports.AuthService) *SocialAuthHandler {
+	return &SocialAuthHandler{
+		socialService: sas,
+		authService:   as,
+		validate:      validator.New(),
+	}
+}
+
+// Providers lists the identity providers that are configured
+func (h *SocialAuthHandler) Providers(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"providers": h.socialService.Providers(),
+	})
+}
+
+// Start returns the URL the client sends the user to for signing in
+func (h *SocialAuthHandler) Start(c *fiber.Ctx) error {
+	start, err := h.socialService.BeginLogin(c.Params("provider"))
+	if err != nil {
+		return socialAuthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(start)
+}
+
+// Callback exchanges the code from the provider's redirect and logs the user in like a
+// password login
+func (h *SocialAuthHandler) Callback(c *fiber.Ctx) error {
+	req := new(domain.SocialCallbackRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	deviceInfo := &domain.DeviceSession{
+		DeviceID:   c.Get("Device-ID"),
+		DeviceType: c.Get("User-Agent"),
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		RequestID:  requestID(c),
+	}
+
+	result, err := h.authService.LoginWithProvider(c.Params("provider"), req.State, req.Code, deviceInfo)
+	if err != nil {
+		return socialAuthError(c, err)
+	}
+
+	return loginResponse(c, result)
+}
+
+// StartLink is Start for a signed-in user who wants to add a provider to their account
+func (h *SocialAuthHandler) StartLink(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	start, err := h.socialService.BeginLink(user.ID, c.Params("provider"))
+	if err != nil {
+		return socialAuthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(start)
+}
+
+func (h *SocialAuthHandler) Link(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req := new(domain.SocialCallbackRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request data",
+		})
+	}
+
+	linked, err := h.socialService.CompleteLink(user.ID, c.Params("provider"), req.State, req.Code)
+	if err != nil {
+		return socialAuthError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(linked)
+}
+
+func (h *SocialAuthHandler) ListIdentities(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	identities, err := h.socialService.ListIdentities(user.ID)
+	if err != nil {
+		return socialAuthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"identities": identities,
+	})
+}
+
+func (h *SocialAuthHandler) Unlink(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	if err := h.socialService.Unlink(user.ID, c.Params("provider")); err != nil {
+		return socialAuthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Provider unlinked",
+	})
+}
+
+func socialAuthError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *errors.AuthError:
+		status := fiber.StatusUnauthorized
+		switch e {
+		case errors.ErrUnknownProvider:
+			status = fiber.StatusNotFound
+		case errors.ErrIdentityLinkRequired, errors.ErrIdentityAlreadyLinked:
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": e.Message,
+			"code":  e.Code,
+		})
+	default:
+		fmt.Printf("social auth error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type TwoFactorHandler struct {
+	twoFactorService ports.TwoFactorService
+	validate         *validator.Validate
+}
+
+func NewTwoFactorHandler(tfs ports.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorService: tfs,
+		validate:         validator.New(),
+	}
+}
+
+// Setup generates a pending TOTP secret and its otpauth:// provisioning URI
+func (h *TwoFactorHandler) Setup(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	setup, err := h.twoFactorService.GenerateTOTP(user.ID)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(setup)
+}
+
+// Enable confirms the pending secret and returns one-time backup codes
+func (h *TwoFactorHandler) Enable(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req, err := h.parseCode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	codes, err := h.twoFactorService.EnableTwoFactor(user.ID, req.Code, actor(c))
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":      "Two-factor authentication enabled",
+		"backup_codes": codes,
+	})
+}
+
+func (h *TwoFactorHandler) Disable(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req, err := h.parseCode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.twoFactorService.DisableTwoFactor(user.ID, req.Code, actor(c)); err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func (h *TwoFactorHandler) RegenerateBackupCodes(c *fiber.Ctx) error {
+	user := c.Locals("user").(*domain.User)
+
+	req, err := h.parseCode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	codes, err := h.twoFactorService.RegenerateBackupCodes(user.ID, req.Code, actor(c))
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"backup_codes": codes,
+	})
+}
+
+func (h *TwoFactorHandler) parseCode(c *fiber.Ctx) (*domain.TwoFactorCodeRequest, error) {
+	req := new(domain.TwoFactorCodeRequest)
+	if err := c.BodyParser(req); err != nil {
+		return nil, fmt.Errorf("Invalid request format")
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return nil, fmt.Errorf("Invalid request data")
+	}
+
+	return req, nil
+}
+
+func twoFactorError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *errors.AuthError:
+		status := fiber.StatusBadRequest
+		if e == errors.ErrInvalidTwoFactorCode {
+			status = fiber.StatusUnauthorized
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": e.Message,
+			"code":  e.Code,
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -45,11 +46,16 @@ func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
 	startTime := time.Now()
 
 	// Get pagination params
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 10)
+	page, err := listPage(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errors.ErrInvalidCursor.Message,
+			"code":  errors.ErrInvalidCursor.Code,
+		})
+	}
 
 	// Try to get from cache first
-	cacheKey := fmt.Sprintf("users:page:%d:limit:%d", page, limit)
+	cacheKey := fmt.Sprintf("users:cursor:%s:limit:%d", c.Query("cursor"), page.Limit)
 	users, err := h.userService.GetUsersFromCache(cacheKey)
 	if err == nil {
 		totalTime := time.Since(startTime)
@@ -58,7 +64,7 @@ func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
 	}
 
 	// If not in cache, get from database
-	users, err = h.userService.GetUsers(page, limit)
+	users, err = h.userService.GetUsers(page)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get users",
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"fmt"
+	"fowergram/internal/core/ports"
+	"time"
+)
+
+func StartAccountPurge(accounts ports.AccountService) {
+	ticker := time.NewTicker(time.Hour)
+	for range ticker.C {
+		PurgeDeletedAccounts(accounts)
+	}
+}
+
+// PurgeDeletedAccounts deletes the accounts whose deletion grace period is over
+func PurgeDeletedAccounts(accounts ports.AccountService) {
+	purged, err := accounts.PurgeScheduledAccounts()
+	if err != nil {
+		fmt.Printf("failed to purge deleted accounts: %v\n", err)
+		return
+	}
+	if purged > 0 {
+		fmt.Printf("purged %d deleted accounts\n", purged)
+	}
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"fmt"
+	"fowergram/internal/core/ports"
+	"time"
+)
+
+func StartDataExports(exports ports.DataExportService) {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		ProcessDataExports(exports)
+	}
+}
+
+// ProcessDataExports builds the requested archives and removes the expired ones
+func ProcessDataExports(exports ports.DataExportService) {
+	if built, err := exports.ProcessPending(); err != nil {
+		fmt.Printf("failed to build data exports: %v\n", err)
+	} else if built > 0 {
+		fmt.Printf("built %d data exports\n", built)
+	}
+
+	if _, err := exports.PurgeExpired(); err != nil {
+		fmt.Printf("failed to purge data exports: %v\n", err)
+	}
+}
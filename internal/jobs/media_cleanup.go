@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"fmt"
+	"fowergram/internal/core/ports"
+	"time"
+)
+
+func StartMediaCleanup(media ports.MediaService) {
+	ticker := time.NewTicker(time.Hour)
+	for range ticker.C {
+		CleanupMedia(media)
+	}
+}
+
+// CleanupMedia removes abandoned uploads and files no post uses
+func CleanupMedia(media ports.MediaService) {
+	purged, err := media.PurgeUnused()
+	if err != nil {
+		fmt.Printf("failed to clean up media: %v\n", err)
+	}
+	if purged > 0 {
+		fmt.Printf("removed %d unused uploads and files\n", purged)
+	}
+}
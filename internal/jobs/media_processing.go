@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"fmt"
+	"fowergram/internal/core/ports"
+	"time"
+)
+
+// StartMediaProcessing runs often, a new post shows its placeholder until then
+func StartMediaProcessing(media ports.MediaService) {
+	ticker := time.NewTicker(5 * time.Second)
+	for range ticker.C {
+		ProcessMedia(media)
+	}
+}
+
+// ProcessMedia makes the renditions of uploaded photos
+func ProcessMedia(media ports.MediaService) {
+	processed, err := media.ProcessPending()
+	if err != nil {
+		fmt.Printf("failed to process media: %v\n", err)
+	}
+	if processed > 0 {
+		fmt.Printf("processed %d photos\n", processed)
+	}
+}
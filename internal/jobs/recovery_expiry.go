@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"fowergram/internal/core/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func StartRecoveryExpiry(db *gorm.DB) {
+	ticker := time.NewTicker(time.Hour)
+	for range ticker.C {
+		ExpireAccountRecoveries(db)
+	}
+}
+
+// ExpireAccountRecoveries closes recovery requests that were never completed in time
+func ExpireAccountRecoveries(db *gorm.DB) {
+	db.Model(&domain.AccountRecovery{}).
+		Where("status IN ? AND expires_at < ?",
+			[]string{domain.RecoveryStatusPending, domain.RecoveryStatusVerified}, time.Now()).
+		Update("status", domain.RecoveryStatusExpired)
+}
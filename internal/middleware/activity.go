@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TrackSessionActivity updates LastActive of the device session behind an authenticated
+// request. It wraps the route, so it sees the session ValidateAuth found and can be
+// registered once for a whole group. The update does not hold up the response.
+func TrackSessionActivity(sessions ports.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		if sessionID, ok := c.Locals("session_id").(uint); ok && sessionID != 0 {
+			go func() {
+				if err := sessions.TouchSession(sessionID); err != nil {
+					fmt.Printf("failed to track session activity: %v\n", err)
+				}
+			}()
+		}
+		return err
+	}
+}
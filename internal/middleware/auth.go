@@ -1,12 +1,21 @@
 package middleware
 
 import (
+	"fmt"
+	"strings"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
 	"fowergram/pkg/security"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func ValidateAuth(jwtSecret string) fiber.Handler {
+// ValidateAuth accepts an access token of a signed in session or, when apiKeys is not
+// nil, a personal API key. Requests made with a key carry it in the "api_key" local and
+// have no session ID; RequireScope and RequirePermission check what the key may do.
+func ValidateAuth(keys *security.KeyRing, revocations ports.SessionRevocationRepository, apiKeys ports.APIKeyService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		token := c.Get("Authorization")
 		if token == "" {
@@ -14,15 +23,62 @@ func ValidateAuth(jwtSecret string) fiber.Handler {
 				"error": "Authorization header required",
 			})
 		}
+		token = strings.TrimPrefix(token, "Bearer ")
+
+		if apiKeys != nil && domain.IsAPIKey(token) {
+			key, err := apiKeys.Authenticate(token)
+			if err != nil {
+				return apiKeyError(c, err)
+			}
+
+			c.Locals("user", &domain.User{ID: key.UserID})
+			c.Locals("api_key", key)
+			return c.Next()
+		}
 
-		user, err := security.ValidateToken(token, jwtSecret)
+		claims, err := security.ParseAccessToken(token, keys)
 		if err != nil {
 			return c.Status(401).JSON(fiber.Map{
 				"error": "Invalid token",
 			})
 		}
 
-		c.Locals("user", user)
+		// Reject tokens whose device session was logged out
+		if claims.SessionID != 0 {
+			revoked, err := revocations.IsSessionRevoked(claims.SessionID)
+			if err != nil {
+				// Fail open: the token still expires within the access token lifetime
+				fmt.Printf("failed to check session revocation: %v\n", err)
+			}
+			if revoked {
+				return c.Status(401).JSON(fiber.Map{
+					"error": "Session has been revoked",
+				})
+			}
+		}
+
+		c.Locals("user", &domain.User{ID: claims.UserID})
+		c.Locals("session_id", claims.SessionID)
 		return c.Next()
 	}
 }
+
+// RequireSession is ValidateAuth without API keys. Account and security settings use it,
+// so a leaked key cannot change the password, add credentials or mint more keys.
+func RequireSession(keys *security.KeyRing, revocations ports.SessionRevocationRepository) fiber.Handler {
+	return ValidateAuth(keys, revocations, nil)
+}
+
+func apiKeyError(c *fiber.Ctx, err error) error {
+	if e, ok := err.(*errors.AuthError); ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": e.Message,
+			"code":  e.Code,
+		})
+	}
+
+	fmt.Printf("failed to authenticate API key: %v\n", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePermission must run after ValidateAuth. The role is loaded from the database on
+// every request so a demotion takes effect immediately rather than when tokens expire.
+// The loaded user replaces the placeholder ValidateAuth stored in the context. API keys
+// also need the admin scope.
+func RequirePermission(us ports.UserService, permission domain.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals("user").(*domain.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authorization required",
+			})
+		}
+
+		if key, ok := c.Locals("api_key").(*domain.APIKey); ok && !key.HasScope(domain.ScopeAdmin) {
+			return insufficientScope(c, domain.ScopeAdmin)
+		}
+
+		account, err := us.GetUserByID(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+
+		if !account.Role.Can(permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":      errors.ErrPermissionDenied.Message,
+				"code":       errors.ErrPermissionDenied.Code,
+				"permission": permission,
+			})
+		}
+
+		c.Locals("user", account)
+		return c.Next()
+	}
+}
@@ -1,18 +1,108 @@
 package middleware
 
 import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 )
 
-func RateLimit() fiber.Handler {
-	return limiter.New(limiter.Config{
-		Max:        20,
-		Expiration: 30 * time.Second,
-		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP()
-		},
-	})
+// Route policies. The counters live in Redis, so every replica enforces the same limit.
+var (
+	APIPerIP = domain.RateLimitPolicy{Name: "api:ip", Limit: 300, Window: time.Minute}
+
+	LoginPerIP    = domain.RateLimitPolicy{Name: "login:ip", Limit: 20, Window: time.Minute}
+	LoginPerEmail = domain.RateLimitPolicy{Name: "login:email", Limit: 10, Window: 15 * time.Minute}
+	RegisterPerIP = domain.RateLimitPolicy{Name: "register:ip", Limit: 5, Window: time.Hour}
+
+	// Endpoints that send email to the address in the request
+	EmailPerIP      = domain.RateLimitPolicy{Name: "email:ip", Limit: 20, Window: time.Hour}
+	EmailPerAddress = domain.RateLimitPolicy{Name: "email:address", Limit: 5, Window: time.Hour}
+
+	// Endpoints that check a short code or a challenge response
+	CodePerIP = domain.RateLimitPolicy{Name: "code:ip", Limit: 10, Window: time.Minute}
+
+	// Account security settings of a signed in user
+	SecurityPerUser = domain.RateLimitPolicy{Name: "security:user", Limit: 10, Window: 15 * time.Minute}
+)
+
+// RateLimitKey returns the identity a request is counted against. An empty identity
+// skips the policy for that request.
+type RateLimitKey func(c *fiber.Ctx) string
+
+// ByIP counts requests per client address
+func ByIP(c *fiber.Ctx) string {
+	return c.IP()
+}
+
+// ByEmail counts requests per email address in the request body, however it is cased
+func ByEmail(c *fiber.Ctx) string {
+	body := struct {
+		Email string `json:"email" form:"email"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(body.Email))
+}
+
+// ByUser counts requests per signed in user and must run after ValidateAuth
+func ByUser(c *fiber.Ctx) string {
+	user, ok := c.Locals("user").(*domain.User)
+	if !ok {
+		return ""
+	}
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+// RateLimit rejects requests over the policy limit with 429 and reports the state of the
+// window in RateLimit-* headers. When several policies apply to a route the headers
+// describe the one closest to its limit. Requests are let through if Redis is unavailable.
+func RateLimit(limiter ports.RateLimitService, policy domain.RateLimitPolicy, key RateLimitKey) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity := key(c)
+		if identity == "" {
+			return c.Next()
+		}
+
+		result, err := limiter.Allow(policy, identity)
+		if err != nil {
+			fmt.Printf("rate limit %s unavailable: %v\n", policy.Name, err)
+			return c.Next()
+		}
+
+		setRateLimitHeaders(c, policy, result)
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, seconds(result.Reset))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": errors.ErrTooManyRequests.Message,
+				"code":  errors.ErrTooManyRequests.Code,
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+func setRateLimitHeaders(c *fiber.Ctx, policy domain.RateLimitPolicy, result *domain.RateLimitResult) {
+	if current, err := strconv.Atoi(c.GetRespHeader("RateLimit-Remaining")); err == nil && current <= result.Remaining {
+		return
+	}
+
+	c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Set("RateLimit-Reset", seconds(result.Reset))
+	c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", policy.Limit, seconds(policy.Window)))
+}
+
+// seconds rounds up so clients never retry a moment too early
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
 }
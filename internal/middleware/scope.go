@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/security"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireScope authenticates like ValidateAuth and also accepts access tokens issued to
+// third-party apps. Apps and API keys must have been granted every listed scope. Tokens
+// of Fowergram's own clients are not limited by scopes.
+//
+// ValidateAuth itself never accepts third-party tokens, so routes are only reachable
+// by apps once they are explicitly put behind RequireScope.
+func RequireScope(keys *security.KeyRing, revocations ports.SessionRevocationRepository, apiKeys ports.APIKeyService, oauth ports.OAuthService, scopes ...string) fiber.Handler {
+	validateAuth := ValidateAuth(keys, revocations, nil)
+
+	return func(c *fiber.Ctx) error {
+		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+
+		if domain.IsAPIKey(token) {
+			key, err := apiKeys.Authenticate(token)
+			if err != nil {
+				return apiKeyError(c, err)
+			}
+			for _, scope := range scopes {
+				if !key.HasScope(scope) {
+					return insufficientScope(c, scopes...)
+				}
+			}
+
+			c.Locals("user", &domain.User{ID: key.UserID})
+			c.Locals("api_key", key)
+			return c.Next()
+		}
+
+		if _, err := security.ParseOAuthAccessToken(token, keys); err != nil {
+			return validateAuth(c)
+		}
+
+		grant, err := oauth.ValidateAccessToken(token)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid token",
+			})
+		}
+
+		for _, scope := range scopes {
+			if !grant.HasScope(scope) {
+				return insufficientScope(c, scopes...)
+			}
+		}
+
+		c.Locals("user", &domain.User{ID: grant.UserID})
+		c.Locals("oauth_client_id", grant.ClientID)
+		return c.Next()
+	}
+}
+
+// insufficientScope responds as RFC 6750 section 3.1 describes
+func insufficientScope(c *fiber.Ctx, scopes ...string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+	return c.Status(errors.ErrOAuthInsufficientScope.Status).JSON(fiber.Map{
+		"error": errors.ErrOAuthInsufficientScope.Description,
+		"code":  errors.ErrOAuthInsufficientScope.Code,
+	})
+}
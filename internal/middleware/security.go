@@ -5,7 +5,6 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 )
 
 // SecurityMiddleware contains security-related middleware configurations
@@ -16,24 +15,6 @@ func NewSecurityMiddleware() *SecurityMiddleware {
 	return &SecurityMiddleware{}
 }
 
-// RateLimiter returns rate limiting middleware
-func (m *SecurityMiddleware) RateLimiter() fiber.Handler {
-	return limiter.New(limiter.Config{
-		Max:        5,               // 5 requests
-		Expiration: 1 * time.Minute, // per 1 minute
-		KeyGenerator: func(c *fiber.Ctx) string {
-			// Use IP address and path as key
-			return c.IP() + ":" + c.Path()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Too many attempts, please try again later",
-			})
-		},
-		SkipFailedRequests: false, // Count failed requests towards the limit
-	})
-}
-
 // CORS returns CORS middleware
 func (m *SecurityMiddleware) CORS() fiber.Handler {
 	return cors.New(cors.Config{
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"fowergram/internal/core/domain"
+	"fowergram/internal/core/ports"
+	"fowergram/pkg/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Actions that can be restricted until the account's email address is verified
+const (
+	ActionPost    = "post"
+	ActionComment = "comment"
+	ActionMessage = "message"
+)
+
+// VerificationPolicy decides which actions unverified accounts may perform
+type VerificationPolicy struct {
+	userService ports.UserService
+	restricted  map[string]bool
+}
+
+func NewVerificationPolicy(us ports.UserService, restrictedActions []string) *VerificationPolicy {
+	restricted := make(map[string]bool, len(restrictedActions))
+	for _, action := range restrictedActions {
+		restricted[action] = true
+	}
+
+	return &VerificationPolicy{
+		userService: us,
+		restricted:  restricted,
+	}
+}
+
+// Restricts reports whether unverified accounts are blocked from the action
+func (p *VerificationPolicy) Restricts(action string) bool {
+	return p.restricted[action]
+}
+
+// RequireVerifiedEmail must run after ValidateAuth. Actions the policy does not
+// restrict pass through without loading the user.
+func (p *VerificationPolicy) RequireVerifiedEmail(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !p.Restricts(action) {
+			return c.Next()
+		}
+
+		user, ok := c.Locals("user").(*domain.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authorization required",
+			})
+		}
+
+		account, err := p.userService.GetUserByID(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+
+		if !account.IsEmailVerified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  errors.ErrEmailNotVerified.Message,
+				"code":   errors.ErrEmailNotVerified.Code,
+				"action": action,
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,28 @@
+package postgres
+
+import (
+	"fowergram/internal/core/domain"
+
+	"gorm.io/gorm"
+)
+
+type adminActionRepository struct {
+	db *gorm.DB
+}
+
+func NewAdminActionRepository(db *gorm.DB) *adminActionRepository {
+	return &adminActionRepository{db: db}
+}
+
+func (r *adminActionRepository) Create(action *domain.AdminAction) error {
+	return r.db.Create(action).Error
+}
+
+func (r *adminActionRepository) FindAll(page, limit int) ([]*domain.AdminAction, error) {
+	var actions []*domain.AdminAction
+	err := r.db.Order("created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&actions).Error
+	return actions, err
+}
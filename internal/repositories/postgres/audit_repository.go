@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"fowergram/internal/core/domain"
+
+	"gorm.io/gorm"
+)
+
+// auditChainLock is the advisory lock key that serializes appends to the audit log, so
+// two entries can never link to the same predecessor
+const auditChainLock = 7_402_117
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *auditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Append(entry *domain.AuditEntry) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLock).Error; err != nil {
+			return err
+		}
+
+		var last []*domain.AuditEntry
+		if err := tx.Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+
+		var prev *domain.AuditEntry
+		if len(last) > 0 {
+			prev = last[0]
+		}
+		entry.Link(prev)
+
+		return tx.Create(entry).Error
+	})
+}
+
+func (r *auditRepository) FindByTarget(userID uint, page, limit int) ([]*domain.AuditEntry, error) {
+	var entries []*domain.AuditEntry
+	err := r.db.Where("target_user_id = ?", userID).
+		Order("id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&entries).Error
+	return entries, err
+}
+
+func (r *auditRepository) Search(filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	query := r.db.Model(&domain.AuditEntry{})
+	if filter.Event != "" {
+		query = query.Where("event = ?", filter.Event)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.TargetUserID != nil {
+		query = query.Where("target_user_id = ?", *filter.TargetUserID)
+	}
+	if filter.IPAddress != "" {
+		query = query.Where("ip_address = ?", filter.IPAddress)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var entries []*domain.AuditEntry
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&entries).Error
+	return entries, err
+}
+
+// FindAfter returns entries in chain order, starting after the given ID
+func (r *auditRepository) FindAfter(id uint, limit int) ([]*domain.AuditEntry, error) {
+	var entries []*domain.AuditEntry
+	err := r.db.Where("id > ?", id).
+		Order("id ASC").
+		Limit(limit).
+		Find(&entries).Error
+	return entries, err
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+	"fowergram/pkg/pagination"
 
 	"gorm.io/gorm"
 )
@@ -34,13 +36,38 @@ func (r *authRepository) UpdateUser(user *domain.User) error {
 }
 
 func (r *authRepository) CreateDeviceSession(session *domain.DeviceSession) error {
-	// Deactivate other sessions if this is a new device
-	if err := r.db.Model(&domain.DeviceSession{}).
-		Where("user_id = ? AND device_id != ?", session.UserID, session.DeviceID).
-		Update("is_current", false).Error; err != nil {
-		return err
-	}
-	return r.db.Create(session).Error
+	// A new login from the same device replaces its previous session and keeps the name
+	// and trust the user gave the device
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var active domain.DeviceSession
+		if err := tx.Where("user_id = ? AND device_id = ? AND is_current = ?", session.UserID, session.DeviceID, true).
+			Order("id DESC").Limit(1).Find(&active).Error; err != nil {
+			return err
+		}
+		if active.ID != 0 {
+			if session.DeviceName == "" {
+				session.DeviceName = active.DeviceName
+			}
+			session.Trusted = active.Trusted
+		}
+
+		previous := tx.Model(&domain.DeviceSession{}).Select("id").
+			Where("user_id = ? AND device_id = ?", session.UserID, session.DeviceID)
+
+		if err := tx.Model(&domain.RefreshToken{}).
+			Where("revoked_at IS NULL AND device_session_id IN (?)", previous).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&domain.DeviceSession{}).
+			Where("user_id = ? AND device_id = ?", session.UserID, session.DeviceID).
+			Update("is_current", false).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(session).Error
+	})
 }
 
 func (r *authRepository) GetActiveSessions(userID uint) ([]*domain.DeviceSession, error) {
@@ -49,16 +76,65 @@ func (r *authRepository) GetActiveSessions(userID uint) ([]*domain.DeviceSession
 	return sessions, err
 }
 
-func (r *authRepository) RevokeSession(userID uint, deviceID string) error {
+func (r *authRepository) UpdateDeviceSession(session *domain.DeviceSession) error {
+	return r.db.Model(session).
+		Select("device_name", "trusted").
+		Updates(session).Error
+}
+
+func (r *authRepository) TouchDeviceSession(sessionID uint, at time.Time) error {
 	return r.db.Model(&domain.DeviceSession{}).
-		Where("user_id = ? AND device_id = ?", userID, deviceID).
-		Update("is_current", false).Error
+		Where("id = ?", sessionID).
+		Update("last_active", at).Error
+}
+
+func (r *authRepository) RevokeSession(userID uint, deviceID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.DeviceSession{}).
+			Where("user_id = ? AND device_id = ?", userID, deviceID).
+			Update("is_current", false).Error; err != nil {
+			return err
+		}
+
+		// Revoke the refresh token family bound to the device
+		return tx.Model(&domain.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL AND device_session_id IN (?)", userID,
+				tx.Model(&domain.DeviceSession{}).Select("id").Where("user_id = ? AND device_id = ?", userID, deviceID)).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+func (r *authRepository) RevokeSessionsByID(userID uint, sessionIDs []uint) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.DeviceSession{}).
+			Where("user_id = ? AND id IN ?", userID, sessionIDs).
+			Update("is_current", false).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&domain.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL AND device_session_id IN ?", userID, sessionIDs).
+			Update("revoked_at", time.Now()).Error
+	})
 }
 
 func (r *authRepository) LogLogin(history *domain.LoginHistory) error {
 	return r.db.Create(history).Error
 }
 
+// CountFailedLoginsFromIP counts failed logins from the address across all accounts
+func (r *authRepository) CountFailedLoginsFromIP(ip string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.LoginHistory{}).
+		Where("ip_address = ? AND status = ? AND created_at > ?", ip, domain.LoginStatusFailed, since).
+		Count(&count).Error
+	return count, err
+}
+
 func (r *authRepository) GetLoginHistory(userID uint) ([]*domain.LoginHistory, error) {
 	var history []*domain.LoginHistory
 	err := r.db.Where("user_id = ?", userID).
@@ -68,6 +144,36 @@ func (r *authRepository) GetLoginHistory(userID uint) ([]*domain.LoginHistory, e
 	return history, err
 }
 
+func (r *authRepository) FindLoginHistory(userID uint, page pagination.Page) (*pagination.List[*domain.LoginHistory], error) {
+	var history []*domain.LoginHistory
+	err := r.db.Where("user_id = ?", userID).Scopes(paginate(page)).Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewList(history, page, func(login *domain.LoginHistory) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: login.CreatedAt, ID: login.ID}
+	}), nil
+}
+
+// FindSuccessfulLogins returns the user's latest successful logins, newest first.
+// Challenged, blocked and failed attempts are left out so they cannot push real
+// logins out of the result.
+func (r *authRepository) FindSuccessfulLogins(userID uint, limit int) ([]*domain.LoginHistory, error) {
+	var history []*domain.LoginHistory
+	err := r.db.Where("user_id = ? AND status = ?", userID, domain.LoginStatusSuccess).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&history).Error
+	return history, err
+}
+
+// CountLoginAttempts counts every recorded login of the user, whatever its outcome
+func (r *authRepository) CountLoginAttempts(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.LoginHistory{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
 func (r *authRepository) CreateAuthCode(code *domain.AuthCode) error {
 	// Invalidate existing codes for the same purpose
 	if err := r.db.Model(&domain.AuthCode{}).
@@ -78,28 +184,87 @@ func (r *authRepository) CreateAuthCode(code *domain.AuthCode) error {
 	return r.db.Create(code).Error
 }
 
+// ValidateAuthCode consumes the code. The conditional update makes it single-use even
+// when two requests race to redeem it.
 func (r *authRepository) ValidateAuthCode(userID uint, code, purpose string) error {
+	result := r.db.Model(&domain.AuthCode{}).
+		Where("user_id = ? AND code = ? AND purpose = ? AND is_used = ? AND expires_at > ?",
+			userID, code, purpose, false, time.Now()).
+		Update("is_used", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("invalid or expired code")
+	}
+	return nil
+}
+
+// FindAuthCode checks a code without consuming it
+func (r *authRepository) FindAuthCode(userID uint, code, purpose string) (*domain.AuthCode, error) {
 	var authCode domain.AuthCode
 	if err := r.db.Where("user_id = ? AND code = ? AND purpose = ? AND is_used = ? AND expires_at > ?",
 		userID, code, purpose, false, time.Now()).First(&authCode).Error; err != nil {
-		return fmt.Errorf("invalid or expired code")
+		return nil, fmt.Errorf("invalid or expired code")
+	}
+	return &authCode, nil
+}
+
+// ConsumeAuthCode redeems a code that identifies its user on its own, such as a hashed
+// magic link token
+func (r *authRepository) ConsumeAuthCode(code, purpose string) (*domain.AuthCode, error) {
+	var authCode domain.AuthCode
+	if err := r.db.Where("code = ? AND purpose = ? AND is_used = ? AND expires_at > ?",
+		code, purpose, false, time.Now()).First(&authCode).Error; err != nil {
+		return nil, fmt.Errorf("invalid or expired code")
+	}
+
+	result := r.db.Model(&domain.AuthCode{}).
+		Where("id = ? AND is_used = ?", authCode.ID, false).
+		Update("is_used", true)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("invalid or expired code")
 	}
 
-	// Mark code as used
 	authCode.IsUsed = true
-	return r.db.Save(&authCode).Error
+	return &authCode, nil
+}
+
+// CountAuthCodesSince counts every code issued for the purpose, used or not
+func (r *authRepository) CountAuthCodesSince(userID uint, purpose string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.AuthCode{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, since).
+		Count(&count).Error
+	return count, err
 }
 
 func (r *authRepository) CreateAccountRecovery(recovery *domain.AccountRecovery) error {
 	// Cancel existing recovery requests
 	if err := r.db.Model(&domain.AccountRecovery{}).
-		Where("user_id = ? AND status = ?", recovery.UserID, "pending").
-		Update("status", "cancelled").Error; err != nil {
+		Where("user_id = ? AND request_type = ? AND status IN ?", recovery.UserID, recovery.RequestType,
+			[]string{domain.RecoveryStatusPending, domain.RecoveryStatusVerified}).
+		Update("status", domain.RecoveryStatusCancelled).Error; err != nil {
 		return err
 	}
 	return r.db.Create(recovery).Error
 }
 
+// FindActiveAccountRecovery returns the latest pending or verified request
+func (r *authRepository) FindActiveAccountRecovery(userID uint, requestType string) (*domain.AccountRecovery, error) {
+	var recovery domain.AccountRecovery
+	if err := r.db.Where("user_id = ? AND request_type = ? AND status IN ?", userID, requestType,
+		[]string{domain.RecoveryStatusPending, domain.RecoveryStatusVerified}).
+		Order("initiated_at DESC").
+		First(&recovery).Error; err != nil {
+		return nil, err
+	}
+	return &recovery, nil
+}
+
 func (r *authRepository) UpdateAccountRecovery(recovery *domain.AccountRecovery) error {
 	return r.db.Save(recovery).Error
 }
@@ -112,3 +277,79 @@ func (r *authRepository) FindUserByID(id uint) (*domain.User, error) {
 	}
 	return &user, nil
 }
+
+func (r *authRepository) CreateRefreshToken(token *domain.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *authRepository) FindRefreshToken(tokenID string) (*domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	if err := r.db.Where("token_id = ?", tokenID).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken marks the old token as rotated and stores its successor atomically.
+// It returns errors.ErrRefreshTokenReused if the old token was already rotated or revoked.
+func (r *authRepository) RotateRefreshToken(oldTokenID string, next *domain.RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.RefreshToken{}).
+			Where("token_id = ? AND rotated_at IS NULL AND revoked_at IS NULL", oldTokenID).
+			Update("rotated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.ErrRefreshTokenReused
+		}
+		return tx.Create(next).Error
+	})
+}
+
+func (r *authRepository) RevokeRefreshTokenFamily(familyID string) error {
+	return r.db.Model(&domain.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// ReplaceBackupCodes discards any previous backup codes and stores a fresh set
+func (r *authRepository) ReplaceBackupCodes(userID uint, codes []*domain.BackupCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.BackupCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// RecordTOTPStep only moves the stored step forward, so two requests racing with the
+// same code cannot both be accepted
+func (r *authRepository) RecordTOTPStep(userID uint, step int64) error {
+	result := r.db.Model(&domain.User{}).
+		Where("id = ? AND two_factor_last_step < ?", userID, step).
+		Update("two_factor_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (r *authRepository) UseBackupCode(userID uint, codeHash string) error {
+	result := r.db.Model(&domain.BackupCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("invalid or used backup code")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"time"
+
+	"fowergram/internal/core/domain"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type dataExportRepository struct {
+	db *gorm.DB
+}
+
+func NewDataExportRepository(db *gorm.DB) *dataExportRepository {
+	return &dataExportRepository{db: db}
+}
+
+func (r *dataExportRepository) Create(export *domain.DataExport) error {
+	return r.db.Create(export).Error
+}
+
+func (r *dataExportRepository) FindByID(id uint) (*domain.DataExport, error) {
+	var export domain.DataExport
+	if err := r.db.First(&export, id).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) FindLatestByUserID(userID uint) (*domain.DataExport, error) {
+	var export domain.DataExport
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) ClaimPending(limit int, staleBefore time.Time) ([]*domain.DataExport, error) {
+	var exports []*domain.DataExport
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// SKIP LOCKED lets several API instances run the job without building an archive twice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND updated_at < ?)", domain.DataExportPending, domain.DataExportProcessing, staleBefore).
+			Order("created_at").
+			Limit(limit).
+			Find(&exports).Error; err != nil {
+			return err
+		}
+		if len(exports) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(exports))
+		for i, export := range exports {
+			ids[i] = export.ID
+			export.Status = domain.DataExportProcessing
+		}
+		return tx.Model(&domain.DataExport{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{"status": domain.DataExportProcessing, "updated_at": time.Now()}).Error
+	})
+	return exports, err
+}
+
+func (r *dataExportRepository) Update(export *domain.DataExport) error {
+	return r.db.Save(export).Error
+}
+
+func (r *dataExportRepository) FindPurgeable(now time.Time) ([]*domain.DataExport, error) {
+	var exports []*domain.DataExport
+	users := r.db.Model(&domain.User{}).Select("id")
+	err := r.db.Where("expires_at < ? OR user_id NOT IN (?)", now, users).Find(&exports).Error
+	return exports, err
+}
+
+func (r *dataExportRepository) Delete(id uint) error {
+	return r.db.Delete(&domain.DataExport{}, id).Error
+}
+
+func (r *dataExportRepository) FindPersonalData(userID uint) (*domain.PersonalData, error) {
+	data := &domain.PersonalData{}
+
+	var user domain.User
+	if err := r.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	data.User = &user
+
+	if err := r.db.Scopes(withPostItems).Where("user_id = ?", userID).Order("created_at").Find(&data.Posts).Error; err != nil {
+		return nil, err
+	}
+
+	// Inactive sessions and revoked keys are part of the user's history too
+	queries := []struct {
+		dest  interface{}
+		order string
+	}{
+		{&data.Media, "created_at"},
+		{&data.Comments, "created_at"},
+		{&data.LoginHistory, "created_at DESC"},
+		{&data.Devices, "last_active DESC"},
+		{&data.Identities, "created_at"},
+		{&data.Passkeys, "created_at"},
+		{&data.APIKeys, "created_at"},
+	}
+	for _, query := range queries {
+		if err := r.db.Where("user_id = ?", userID).Order(query.order).Find(query.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
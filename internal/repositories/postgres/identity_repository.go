@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+
+	"gorm.io/gorm"
+)
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) *identityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) Create(identity *domain.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *identityRepository) CreateUserWithIdentity(user *domain.User, identity *domain.UserIdentity) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
+
+func (r *identityRepository) FindByProviderSubject(provider, subject string) (*domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) FindByUserID(userID uint) ([]*domain.UserIdentity, error) {
+	var identities []*domain.UserIdentity
+	err := r.db.Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&identities).Error
+	return identities, err
+}
+
+func (r *identityRepository) Update(identity *domain.UserIdentity) error {
+	return r.db.Save(identity).Error
+}
+
+func (r *identityRepository) Delete(userID uint, provider string) error {
+	result := r.db.Where("user_id = ? AND provider = ?", userID, provider).Delete(&domain.UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("identity not found")
+	}
+	return nil
+}
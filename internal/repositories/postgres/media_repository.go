@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"time"
+
+	"fowergram/internal/core/domain"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type mediaRepository struct {
+	db *gorm.DB
+}
+
+func NewMediaRepository(db *gorm.DB) *mediaRepository {
+	return &mediaRepository{db: db}
+}
+
+func (r *mediaRepository) Create(media *domain.Media, blob *domain.MediaBlob) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := upsertBlobs(tx, []*domain.MediaBlob{blob}); err != nil {
+			return err
+		}
+		return tx.Create(media).Error
+	})
+}
+
+// upsertBlobs touches last_used_at of blobs that exist, which keeps the cleanup job
+// from removing a blob that was unused until now
+func upsertBlobs(tx *gorm.DB, blobs []*domain.MediaBlob) error {
+	now := time.Now()
+	for _, blob := range blobs {
+		blob.LastUsedAt = now
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "hash"}},
+			DoUpdates: clause.AssignmentColumns([]string{"last_used_at"}),
+		}).Create(blob).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *mediaRepository) FindByID(id uint) (*domain.Media, error) {
+	var media domain.Media
+	if err := r.db.Preload("Renditions").First(&media, id).Error; err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (r *mediaRepository) FindBlob(hash string) (*domain.MediaBlob, error) {
+	var blob domain.MediaBlob
+	if err := r.db.Where("hash = ?", hash).First(&blob).Error; err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *mediaRepository) CreateUpload(upload *domain.MediaUpload) error {
+	return r.db.Create(upload).Error
+}
+
+func (r *mediaRepository) FindUpload(id string) (*domain.MediaUpload, error) {
+	var upload domain.MediaUpload
+	if err := r.db.Where("id = ?", id).First(&upload).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (r *mediaRepository) UpdateUpload(upload *domain.MediaUpload) error {
+	return r.db.Save(upload).Error
+}
+
+func (r *mediaRepository) DeleteUpload(id string) error {
+	return r.db.Where("id = ?", id).Delete(&domain.MediaUpload{}).Error
+}
+
+func (r *mediaRepository) FindExpiredUploads(now time.Time, limit int) ([]*domain.MediaUpload, error) {
+	var uploads []*domain.MediaUpload
+	err := r.db.Where("expires_at < ?", now).Order("expires_at").Limit(limit).Find(&uploads).Error
+	return uploads, err
+}
+
+func (r *mediaRepository) ClaimPendingMedia(limit int, staleBefore time.Time) ([]*domain.Media, error) {
+	var media []*domain.Media
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// SKIP LOCKED lets several API instances run the job without processing a photo twice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND updated_at < ?)", domain.MediaPending, domain.MediaProcessing, staleBefore).
+			Order("created_at").
+			Limit(limit).
+			Find(&media).Error; err != nil {
+			return err
+		}
+		if len(media) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(media))
+		for i, m := range media {
+			ids[i] = m.ID
+			m.Status = domain.MediaProcessing
+		}
+		return tx.Model(&domain.Media{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{"status": domain.MediaProcessing, "updated_at": time.Now()}).Error
+	})
+	return media, err
+}
+
+func (r *mediaRepository) SaveProcessed(media *domain.Media, blobs []*domain.MediaBlob) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := upsertBlobs(tx, blobs); err != nil {
+			return err
+		}
+		// A photo claimed again after a crash may have some renditions already
+		if err := tx.Where("media_id = ?", media.ID).Delete(&domain.MediaRendition{}).Error; err != nil {
+			return err
+		}
+		for i := range media.Renditions {
+			media.Renditions[i].ID = 0
+			media.Renditions[i].MediaID = media.ID
+		}
+		if len(media.Renditions) > 0 {
+			if err := tx.Create(&media.Renditions).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Renditions").Save(media).Error
+	})
+}
+
+func (r *mediaRepository) Update(media *domain.Media) error {
+	return r.db.Omit("Renditions").Save(media).Error
+}
+
+func (r *mediaRepository) DeleteUnattached(before time.Time) (int64, error) {
+	used := r.db.Model(&domain.PostItem{}).Select("media_id").Where("media_id IS NOT NULL")
+	result := r.db.Where("created_at < ? AND id NOT IN (?)", before, used).Delete(&domain.Media{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *mediaRepository) FindUnusedBlobs(before time.Time, limit int) ([]*domain.MediaBlob, error) {
+	var blobs []*domain.MediaBlob
+	err := r.db.Where("last_used_at < ? AND hash NOT IN (?) AND hash NOT IN (?)", before, r.usedHashes(), r.renditionHashes()).
+		Order("last_used_at").
+		Limit(limit).
+		Find(&blobs).Error
+	return blobs, err
+}
+
+func (r *mediaRepository) DeleteBlobIfUnused(hash string, before time.Time) (bool, error) {
+	result := r.db.Where("hash = ? AND last_used_at < ? AND hash NOT IN (?) AND hash NOT IN (?)", hash, before, r.usedHashes(), r.renditionHashes()).
+		Delete(&domain.MediaBlob{})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *mediaRepository) usedHashes() *gorm.DB {
+	return r.db.Model(&domain.Media{}).Select("hash")
+}
+
+func (r *mediaRepository) renditionHashes() *gorm.DB {
+	return r.db.Model(&domain.MediaRendition{}).Select("hash")
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+type oauthRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthRepository(db *gorm.DB) *oauthRepository {
+	return &oauthRepository{db: db}
+}
+
+func (r *oauthRepository) CreateClient(client *domain.OAuthClient) error {
+	return r.db.Create(client).Error
+}
+
+func (r *oauthRepository) FindClientByClientID(clientID string) (*domain.OAuthClient, error) {
+	var client domain.OAuthClient
+	if err := r.db.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *oauthRepository) FindClientsByOwner(ownerID uint) ([]*domain.OAuthClient, error) {
+	var clients []*domain.OAuthClient
+	err := r.db.Where("owner_id = ?", ownerID).
+		Order("created_at").
+		Find(&clients).Error
+	return clients, err
+}
+
+func (r *oauthRepository) DeleteClient(ownerID uint, clientID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("owner_id = ? AND client_id = ?", ownerID, clientID).Delete(&domain.OAuthClient{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("client not found")
+		}
+
+		return tx.Model(&domain.OAuthToken{}).
+			Where("client_id = ? AND revoked_at IS NULL", clientID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+func (r *oauthRepository) CreateToken(token *domain.OAuthToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *oauthRepository) FindTokenByTokenID(tokenID string) (*domain.OAuthToken, error) {
+	var token domain.OAuthToken
+	if err := r.db.Where("token_id = ?", tokenID).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *oauthRepository) FindTokenByRefreshHash(hash string) (*domain.OAuthToken, error) {
+	var token domain.OAuthToken
+	if err := r.db.Where("refresh_token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *oauthRepository) RevokeToken(id uint) error {
+	return r.db.Model(&domain.OAuthToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RotateToken revokes the old token and stores its successor. The conditional update
+// lets only one of two concurrent refreshes with the same token through.
+func (r *oauthRepository) RotateToken(id uint, next *domain.OAuthToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&domain.OAuthToken{}).
+			Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", id).
+			Updates(map[string]interface{}{"rotated_at": now, "revoked_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.ErrRefreshTokenReused
+		}
+		return tx.Create(next).Error
+	})
+}
+
+func (r *oauthRepository) RevokeTokenFamily(familyID string) error {
+	return r.db.Model(&domain.OAuthToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,18 @@
+package postgres
+
+import (
+	"fowergram/pkg/pagination"
+
+	"gorm.io/gorm"
+)
+
+// paginate orders newest first and loads the rows after the cursor. The id breaks
+// ties between rows created in the same microsecond.
+func paginate(page pagination.Page) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if page.Cursor != nil {
+			db = db.Where("(created_at, id) < (?, ?)", page.Cursor.CreatedAt, page.Cursor.ID)
+		}
+		return db.Order("created_at DESC, id DESC").Limit(page.Fetch())
+	}
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"fmt"
+
+	"fowergram/internal/core/domain"
+
+	"gorm.io/gorm"
+)
+
+type passkeyRepository struct {
+	db *gorm.DB
+}
+
+func NewPasskeyRepository(db *gorm.DB) *passkeyRepository {
+	return &passkeyRepository{db: db}
+}
+
+func (r *passkeyRepository) Create(credential *domain.WebAuthnCredential) error {
+	return r.db.Create(credential).Error
+}
+
+func (r *passkeyRepository) FindByCredentialID(credentialID []byte) (*domain.WebAuthnCredential, error) {
+	var credential domain.WebAuthnCredential
+	if err := r.db.Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *passkeyRepository) FindByUserID(userID uint) ([]*domain.WebAuthnCredential, error) {
+	var credentials []*domain.WebAuthnCredential
+	err := r.db.Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *passkeyRepository) Update(credential *domain.WebAuthnCredential) error {
+	return r.db.Save(credential).Error
+}
+
+func (r *passkeyRepository) Delete(userID, id uint) error {
+	result := r.db.Where("user_id = ?", userID).Delete(&domain.WebAuthnCredential{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("passkey not found")
+	}
+	return nil
+}
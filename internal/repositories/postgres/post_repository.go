@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"fowergram/internal/core/domain"
+	"fowergram/pkg/pagination"
 
 	"gorm.io/gorm"
 )
@@ -14,32 +15,112 @@ func NewPostRepository(db *gorm.DB) *postRepository {
 	return &postRepository{db: db}
 }
 
+// The author, media and tagged users are read-only here, saving a post must never
+// write to them. Items are saved with the post, in one transaction.
 func (r *postRepository) Create(post *domain.Post) error {
-	return r.db.Create(post).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User", "Items").Create(post).Error; err != nil {
+			return err
+		}
+		return saveItems(tx, post)
+	})
 }
 
 func (r *postRepository) FindByID(id uint) (*domain.Post, error) {
 	var post domain.Post
-	err := r.db.First(&post, id).Error
+	err := r.db.Preload("User").Scopes(withPostItems).First(&post, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &post, nil
 }
 
-func (r *postRepository) FindAll() ([]*domain.Post, error) {
+func (r *postRepository) FindAll(page pagination.Page) (*pagination.List[*domain.Post], error) {
 	var posts []*domain.Post
-	err := r.db.Find(&posts).Error
+	err := r.db.Preload("User").Scopes(withPostItems, paginate(page)).Find(&posts).Error
 	if err != nil {
 		return nil, err
 	}
-	return posts, nil
+	return pagination.NewList(posts, page, func(post *domain.Post) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}
+	}), nil
+}
+
+func (r *postRepository) FindComments(postID uint, page pagination.Page) (*pagination.List[*domain.Comment], error) {
+	var comments []*domain.Comment
+	err := r.db.Preload("User").Where("post_id = ?", postID).Scopes(paginate(page)).Find(&comments).Error
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewList(comments, page, func(comment *domain.Comment) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}
+	}), nil
 }
 
 func (r *postRepository) Update(post *domain.Post) error {
-	return r.db.Save(post).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User", "Items").Save(post).Error; err != nil {
+			return err
+		}
+		return saveItems(tx, post)
+	})
 }
 
 func (r *postRepository) Delete(id uint) error {
-	return r.db.Delete(&domain.Post{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("post_id = ?", id).Delete(&domain.Comment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Post{}, id).Error
+	})
+}
+
+// withPostItems loads the items of posts in order, with their media and tagged users
+func withPostItems(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).
+		Preload("Items.Media.Renditions").
+		Preload("Items.Tags.User")
+}
+
+// saveItems makes the items of the post what post.Items holds. Items with an ID are
+// updated, the tags of every item are replaced.
+func saveItems(tx *gorm.DB, post *domain.Post) error {
+	var kept []uint
+	for _, item := range post.Items {
+		if item.ID != 0 {
+			kept = append(kept, item.ID)
+		}
+	}
+	removed := tx.Where("post_id = ?", post.ID)
+	if len(kept) > 0 {
+		removed = removed.Where("id NOT IN ?", kept)
+	}
+	if err := removed.Delete(&domain.PostItem{}).Error; err != nil {
+		return err
+	}
+
+	for i := range post.Items {
+		item := &post.Items[i]
+		item.PostID = post.ID
+		if err := tx.Omit("Media", "Tags").Save(item).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("post_item_id = ?", item.ID).Delete(&domain.PostItemTag{}).Error; err != nil {
+			return err
+		}
+		if len(item.Tags) == 0 {
+			continue
+		}
+		for j := range item.Tags {
+			item.Tags[j].ID = 0
+			item.Tags[j].PostItemID = item.ID
+		}
+		if err := tx.Omit("User").Create(&item.Tags).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
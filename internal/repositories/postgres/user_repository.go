@@ -1,9 +1,15 @@
 package postgres
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"fowergram/internal/core/domain"
+	"fowergram/pkg/pagination"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type userRepository struct {
@@ -40,18 +46,114 @@ func (r *userRepository) Update(user *domain.User) error {
 	return r.db.Save(user).Error
 }
 
+// Delete removes the user with their posts, comments, sessions, login history and
+// credentials. The audit log is kept, it has no foreign keys to users.
 func (r *userRepository) Delete(id uint) error {
-	return r.db.Delete(&domain.User{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return purgeUser(tx, id)
+	})
+}
+
+func (r *userRepository) FindScheduledForDeletion(now time.Time, limit int) ([]*domain.User, error) {
+	var users []*domain.User
+	err := r.db.Where("deletion_scheduled_at <= ?", now).
+		Order("deletion_scheduled_at").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+func (r *userRepository) DeleteIfScheduled(id uint, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// The row lock makes a login that cancels the deletion wait for the purge to finish
+		var user domain.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deletion_scheduled_at <= ?", id, now).
+			First(&user).Error; err != nil {
+			return fmt.Errorf("deletion is no longer scheduled: %w", err)
+		}
+
+		return purgeUser(tx, id)
+	})
+}
+
+func purgeUser(tx *gorm.DB, id uint) error {
+	// Comments on the user's posts go with the posts
+	posts := tx.Model(&domain.Post{}).Select("id").Where("user_id = ?", id)
+	if err := tx.Where("user_id = ? OR post_id IN (?)", id, posts).Delete(&domain.Comment{}).Error; err != nil {
+		return err
+	}
+
+	// Tokens issued to the user's OAuth clients stop working for everyone
+	clients := tx.Model(&domain.OAuthClient{}).Select("client_id").Where("owner_id = ?", id)
+	if err := tx.Model(&domain.OAuthToken{}).
+		Where("client_id IN (?) AND revoked_at IS NULL", clients).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("owner_id = ?", id).Delete(&domain.OAuthClient{}).Error; err != nil {
+		return err
+	}
+
+	// Children before parents, not every table cascades
+	owned := []interface{}{
+		&domain.PostItemTag{},
+		&domain.Post{},
+		&domain.Media{},
+		&domain.RefreshToken{},
+		&domain.DeviceSession{},
+		&domain.LoginHistory{},
+		&domain.AuthCode{},
+		&domain.AccountRecovery{},
+		&domain.BackupCode{},
+		&domain.WebAuthnCredential{},
+		&domain.UserIdentity{},
+		&domain.OAuthToken{},
+		&domain.APIKey{},
+	}
+	for _, model := range owned {
+		if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	result := tx.Delete(&domain.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+func (r *userRepository) FindAll(page pagination.Page) (*pagination.List[*domain.User], error) {
+	var users []*domain.User
+	if err := r.db.Scopes(paginate(page)).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return pagination.NewList(users, page, userCursor), nil
 }
 
-func (r *userRepository) FindAll(page, limit int) ([]*domain.User, error) {
+func (r *userRepository) Search(query string, page pagination.Page) (*pagination.List[*domain.User], error) {
 	var users []*domain.User
-	offset := (page - 1) * limit
+	pattern := "%" + escapeLike(query) + "%"
 
-	err := r.db.Offset(offset).Limit(limit).Find(&users).Error
+	err := r.db.Where("username ILIKE ? OR email ILIKE ?", pattern, pattern).
+		Scopes(paginate(page)).
+		Find(&users).Error
 	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	return pagination.NewList(users, page, userCursor), nil
+}
+
+func userCursor(user *domain.User) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+}
+
+// escapeLike stops user input from adding wildcards to a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
 }
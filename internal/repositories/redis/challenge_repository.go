@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const challengeKeyPrefix = "challenge:"
+
+type ChallengeRepository struct {
+	client *redis.Client
+}
+
+func NewChallengeRepository(client *redis.Client) *ChallengeRepository {
+	return &ChallengeRepository{
+		client: client,
+	}
+}
+
+func (r *ChallengeRepository) SaveChallenge(id string, data []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	return r.client.Set(ctx, challengeKeyPrefix+id, data, ttl).Err()
+}
+
+// TakeChallenge reads and deletes the challenge in one step so it cannot be replayed
+func (r *ChallengeRepository) TakeChallenge(id string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	data, err := r.client.GetDel(ctx, challengeKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("challenge not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load challenge: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,130 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/security"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	rateLimitKeyPrefix = "ratelimit:"
+	failuresKeyPrefix  = "lockout:failures:"
+	lockoutKeyPrefix   = "lockout:lock:"
+)
+
+// slidingWindowScript keeps one sorted set entry per counted request, scored by the
+// time it was made. Timestamps come from the Redis clock so replicas with skewed
+// clocks still share one window. Rejected requests are not counted.
+var slidingWindowScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], math.ceil(window / 1000))
+
+local reset = 0
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if #oldest > 0 then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, count, reset}
+`)
+
+type RateLimitRepository struct {
+	client *redis.Client
+}
+
+func NewRateLimitRepository(client *redis.Client) *RateLimitRepository {
+	return &RateLimitRepository{
+		client: client,
+	}
+}
+
+func (r *RateLimitRepository) Hit(key string, limit int, window time.Duration) (*domain.RateLimitResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	member, err := security.GenerateRandomString(12)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := slidingWindowScript.Run(ctx, r.client, []string{rateLimitKeyPrefix + key}, window.Microseconds(), limit, member).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count request: %w", err)
+	}
+
+	remaining := limit - int(values[1])
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &domain.RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Duration(values[2]) * time.Microsecond,
+	}, nil
+}
+
+func (r *RateLimitRepository) AddFailure(key string, window time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	pipe := r.client.TxPipeline()
+	failures := pipe.Incr(ctx, failuresKeyPrefix+key)
+	pipe.PExpire(ctx, failuresKeyPrefix+key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count failure: %w", err)
+	}
+	return failures.Val(), nil
+}
+
+func (r *RateLimitRepository) Lock(key string, duration time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	return r.client.Set(ctx, lockoutKeyPrefix+key, 1, duration).Err()
+}
+
+func (r *RateLimitRepository) Lockout(key string) (*domain.LockoutStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	pipe := r.client.Pipeline()
+	failures := pipe.Get(ctx, failuresKeyPrefix+key)
+	lockedFor := pipe.PTTL(ctx, lockoutKeyPrefix+key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to load lockout: %w", err)
+	}
+
+	status := &domain.LockoutStatus{}
+	if count, err := failures.Int64(); err == nil {
+		status.Failures = count
+	}
+	// PTTL is negative when the key does not exist
+	if lockedFor.Val() > 0 {
+		status.LockedFor = lockedFor.Val()
+	}
+	return status, nil
+}
+
+func (r *RateLimitRepository) ClearLockout(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	return r.client.Del(ctx, failuresKeyPrefix+key, lockoutKeyPrefix+key).Err()
+}
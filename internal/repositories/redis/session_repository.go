@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// revokedSessionsKey is a sorted set of session IDs scored by the time their revocation can be forgotten
+const revokedSessionsKey = "sessions:revoked"
+
+type SessionRevocationRepository struct {
+	client *redis.Client
+}
+
+func NewSessionRevocationRepository(client *redis.Client) *SessionRevocationRepository {
+	return &SessionRevocationRepository{
+		client: client,
+	}
+}
+
+// RevokeSession adds the session to the revocation set for ttl, which should cover
+// the lifetime of any access token already issued for it
+func (r *SessionRevocationRepository) RevokeSession(sessionID uint, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	now := time.Now()
+	pipe := r.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, revokedSessionsKey, "-inf", strconv.FormatInt(now.Unix(), 10))
+	pipe.ZAdd(ctx, revokedSessionsKey, redis.Z{
+		Score:  float64(now.Add(ttl).Unix()),
+		Member: strconv.FormatUint(uint64(sessionID), 10),
+	})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *SessionRevocationRepository) IsSessionRevoked(sessionID uint) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	score, err := r.client.ZScore(ctx, revokedSessionsKey, strconv.FormatUint(uint64(sessionID), 10)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check session revocation: %w", err)
+	}
+
+	return int64(score) > time.Now().Unix(), nil
+}
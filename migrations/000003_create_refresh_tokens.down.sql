@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_device_session_id;
+DROP INDEX IF EXISTS idx_refresh_tokens_family_id;
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_backup_codes_user_id;
+DROP TABLE IF EXISTS backup_codes;
+
+ALTER TABLE users
+DROP COLUMN two_factor_enabled,
+DROP COLUMN two_factor_secret,
+DROP COLUMN two_factor_last_step;
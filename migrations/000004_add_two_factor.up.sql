@@ -0,0 +1,14 @@
+ALTER TABLE users
+ADD COLUMN two_factor_enabled BOOLEAN DEFAULT false,
+ADD COLUMN two_factor_secret TEXT,
+ADD COLUMN two_factor_last_step BIGINT DEFAULT 0;
+
+CREATE TABLE backup_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id),
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_backup_codes_user_id ON backup_codes(user_id);
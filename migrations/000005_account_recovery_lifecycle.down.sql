@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_account_recovery_user_status;
+DROP INDEX IF EXISTS idx_auth_codes_user_purpose;
+
+ALTER TABLE account_recovery
+DROP COLUMN verified_at;
+
+DELETE FROM auth_codes WHERE LENGTH(code) > 6;
+
+ALTER TABLE auth_codes
+ALTER COLUMN code TYPE VARCHAR(6);
@@ -0,0 +1,9 @@
+-- Password reset codes are stored as SHA-256 hashes
+ALTER TABLE auth_codes
+ALTER COLUMN code TYPE VARCHAR(64);
+
+ALTER TABLE account_recovery
+ADD COLUMN verified_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_auth_codes_user_purpose ON auth_codes(user_id, purpose);
+CREATE INDEX idx_account_recovery_user_status ON account_recovery(user_id, status);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_oauth_tokens_user_id;
+DROP INDEX IF EXISTS idx_oauth_tokens_client_id;
+DROP TABLE IF EXISTS oauth_tokens;
+DROP INDEX IF EXISTS idx_oauth_clients_owner_id;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_admin_actions_created_at;
+DROP INDEX IF EXISTS idx_admin_actions_target_user_id;
+DROP INDEX IF EXISTS idx_admin_actions_actor_id;
+DROP TABLE IF EXISTS admin_actions;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS password_reset_required,
+    DROP COLUMN IF EXISTS lock_reason,
+    DROP COLUMN IF EXISTS role;
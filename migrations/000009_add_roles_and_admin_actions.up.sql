@@ -0,0 +1,19 @@
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user',
+    ADD COLUMN lock_reason VARCHAR(255),
+    ADD COLUMN password_reset_required BOOLEAN DEFAULT false;
+
+CREATE TABLE admin_actions (
+    id SERIAL PRIMARY KEY,
+    actor_id INT NOT NULL REFERENCES users(id),
+    action VARCHAR(64) NOT NULL,
+    target_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    details TEXT,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_admin_actions_actor_id ON admin_actions(actor_id);
+CREATE INDEX idx_admin_actions_target_user_id ON admin_actions(target_user_id);
+CREATE INDEX idx_admin_actions_created_at ON admin_actions(created_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_login_history_ip_address_created_at;
+DROP INDEX IF EXISTS idx_login_history_user_id_created_at;
+
+ALTER TABLE login_history
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude,
+    DROP COLUMN IF EXISTS country_code;
@@ -0,0 +1,7 @@
+ALTER TABLE login_history
+    ADD COLUMN country_code VARCHAR(2),
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION;
+
+CREATE INDEX idx_login_history_user_id_created_at ON login_history(user_id, created_at);
+CREATE INDEX idx_login_history_ip_address_created_at ON login_history(ip_address, created_at);
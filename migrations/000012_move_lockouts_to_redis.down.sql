@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN failed_login_attempts INT DEFAULT 0,
+    ADD COLUMN last_failed_login TIMESTAMP;
@@ -0,0 +1,6 @@
+-- Automatic lockouts are kept in Redis, the row only holds locks placed by staff
+UPDATE users SET account_locked_until = NULL WHERE lock_reason IS NULL OR lock_reason = '';
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS failed_login_attempts,
+    DROP COLUMN IF EXISTS last_failed_login;
@@ -0,0 +1 @@
+ALTER TABLE device_sessions DROP COLUMN IF EXISTS trusted;
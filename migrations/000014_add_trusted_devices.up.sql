@@ -0,0 +1 @@
+ALTER TABLE device_sessions ADD COLUMN trusted BOOLEAN DEFAULT false;
@@ -0,0 +1,9 @@
+-- Posts made from uploads keep their row but lose the image
+UPDATE posts SET image_url = '' WHERE image_url IS NULL;
+ALTER TABLE posts ALTER COLUMN image_url SET NOT NULL;
+DROP INDEX IF EXISTS idx_posts_media_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS media_id;
+
+DROP TABLE IF EXISTS media_uploads;
+DROP TABLE IF EXISTS media;
+DROP TABLE IF EXISTS media_blobs;
@@ -0,0 +1,40 @@
+-- Stored files, keyed by the SHA-256 of their content
+CREATE TABLE media_blobs (
+    hash CHAR(64) PRIMARY KEY,
+    content_type VARCHAR(64) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE media (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    hash CHAR(64) NOT NULL REFERENCES media_blobs(hash),
+    content_type VARCHAR(64) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_media_user_id ON media(user_id);
+CREATE INDEX idx_media_hash ON media(hash);
+
+-- No foreign key on user_id: uploads of a deleted account expire like any other, which
+-- removes their chunks from the blob store
+CREATE TABLE media_uploads (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    received_bytes BIGINT NOT NULL DEFAULT 0,
+    media_id INT REFERENCES media(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_media_uploads_expires_at ON media_uploads(expires_at);
+
+-- Posts refer to uploaded media, image_url is only kept for older posts
+ALTER TABLE posts ADD COLUMN media_id INT REFERENCES media(id);
+ALTER TABLE posts ALTER COLUMN image_url DROP NOT NULL;
+CREATE INDEX idx_posts_media_id ON posts(media_id);
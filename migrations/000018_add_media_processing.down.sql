@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS media_renditions;
+
+DROP INDEX IF EXISTS idx_media_pending;
+ALTER TABLE media DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE media DROP COLUMN IF EXISTS error;
+ALTER TABLE media DROP COLUMN IF EXISTS dominant_color;
+ALTER TABLE media DROP COLUMN IF EXISTS blurhash;
+ALTER TABLE media DROP COLUMN IF EXISTS height;
+ALTER TABLE media DROP COLUMN IF EXISTS width;
+ALTER TABLE media DROP COLUMN IF EXISTS status;
@@ -0,0 +1,27 @@
+-- Videos and GIFs are ready as uploaded, photos once their renditions exist
+ALTER TABLE media ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'ready';
+ALTER TABLE media ADD COLUMN width INT;
+ALTER TABLE media ADD COLUMN height INT;
+ALTER TABLE media ADD COLUMN blurhash VARCHAR(64);
+ALTER TABLE media ADD COLUMN dominant_color CHAR(7);
+ALTER TABLE media ADD COLUMN error TEXT;
+ALTER TABLE media ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- Photos uploaded so far are processed too, which also strips their metadata
+UPDATE media SET status = 'pending' WHERE content_type IN ('image/jpeg', 'image/png', 'image/webp');
+
+CREATE INDEX idx_media_pending ON media(created_at) WHERE status IN ('pending', 'processing');
+
+CREATE TABLE media_renditions (
+    id SERIAL PRIMARY KEY,
+    media_id INT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    format VARCHAR(8) NOT NULL,
+    hash CHAR(64) NOT NULL REFERENCES media_blobs(hash),
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_media_renditions_media_id ON media_renditions(media_id);
+CREATE INDEX idx_media_renditions_hash ON media_renditions(hash);
@@ -0,0 +1,15 @@
+-- Posts keep their first item, the others are lost
+ALTER TABLE posts ADD COLUMN media_id INT REFERENCES media(id);
+ALTER TABLE posts ADD COLUMN image_url VARCHAR(255);
+CREATE INDEX idx_posts_media_id ON posts(media_id);
+
+UPDATE posts SET media_id = first.media_id, image_url = first.image_url
+FROM (
+    SELECT DISTINCT ON (post_id) post_id, media_id, image_url
+    FROM post_items
+    ORDER BY post_id, position
+) AS first
+WHERE posts.id = first.post_id;
+
+DROP TABLE IF EXISTS post_item_tags;
+DROP TABLE IF EXISTS post_items;
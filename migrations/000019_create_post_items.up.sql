@@ -0,0 +1,40 @@
+-- Posts hold up to 10 photos and videos, each with its own alt text, shape and tags
+CREATE TABLE post_items (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL,
+    media_id INT REFERENCES media(id),
+    image_url VARCHAR(255),
+    alt_text TEXT,
+    aspect_ratio NUMERIC(6, 4),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    -- Deferred, so reordering can move items through each other's positions
+    CONSTRAINT uq_post_items_position UNIQUE (post_id, position) DEFERRABLE INITIALLY DEFERRED,
+    CONSTRAINT uq_post_items_media UNIQUE (post_id, media_id),
+    CONSTRAINT chk_post_items_content CHECK (media_id IS NOT NULL OR image_url IS NOT NULL)
+);
+
+CREATE INDEX idx_post_items_media_id ON post_items(media_id);
+
+CREATE TABLE post_item_tags (
+    id SERIAL PRIMARY KEY,
+    post_item_id INT NOT NULL REFERENCES post_items(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    x REAL NOT NULL,
+    y REAL NOT NULL,
+    CONSTRAINT uq_post_item_tags_user UNIQUE (post_item_id, user_id)
+);
+
+CREATE INDEX idx_post_item_tags_user_id ON post_item_tags(user_id);
+
+-- Every existing post becomes a post with one item. Posts made before uploads keep
+-- their image URL on the item.
+INSERT INTO post_items (post_id, position, media_id, image_url, created_at, updated_at)
+SELECT id, 0, media_id, CASE WHEN media_id IS NULL THEN image_url END, created_at, updated_at
+FROM posts
+WHERE media_id IS NOT NULL OR COALESCE(image_url, '') <> '';
+
+DROP INDEX IF EXISTS idx_posts_media_id;
+ALTER TABLE posts DROP COLUMN media_id;
+ALTER TABLE posts DROP COLUMN image_url;
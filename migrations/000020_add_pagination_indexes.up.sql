@@ -0,0 +1,5 @@
+-- List endpoints page newest first with a cursor over (created_at, id)
+CREATE INDEX idx_users_created_at_id ON users(created_at DESC, id DESC);
+CREATE INDEX idx_posts_created_at_id ON posts(created_at DESC, id DESC);
+CREATE INDEX idx_comments_post_id_created_at_id ON comments(post_id, created_at DESC, id DESC);
+CREATE INDEX idx_login_history_user_id_created_at_id ON login_history(user_id, created_at DESC, id DESC);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_oauth_tokens_family_id;
+
+ALTER TABLE oauth_tokens
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS family_id;
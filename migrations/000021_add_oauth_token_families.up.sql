@@ -0,0 +1,10 @@
+-- Refresh rotation keeps the tokens of one authorization together, so reusing a
+-- rotated refresh token can revoke everything issued from it
+ALTER TABLE oauth_tokens
+    ADD COLUMN family_id VARCHAR(64),
+    ADD COLUMN rotated_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE oauth_tokens SET family_id = token_id WHERE family_id IS NULL;
+ALTER TABLE oauth_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX idx_oauth_tokens_family_id ON oauth_tokens(family_id);
@@ -3,6 +3,7 @@ package email
 import (
 	"fmt"
 	"fowergram/internal/core/domain"
+	"net/url"
 	"time"
 
 	"github.com/sendgrid/sendgrid-go"
@@ -13,20 +14,29 @@ type Service interface {
 	SendVerificationEmail(to, code string) error
 	SendLoginNotification(to string, device *domain.DeviceSession) error
 	SendPasswordResetEmail(to, code string) error
+	SendMagicLinkEmail(to, token string) error
+	SendLoginVerificationEmail(to, code string, device *domain.DeviceSession) error
+	SendLoginBlockedEmail(to string, device *domain.DeviceSession) error
+	SendAccountDeletionCodeEmail(to, code string) error
+	SendAccountDeletionScheduledEmail(to string, deleteAt time.Time) error
+	SendAccountDeletedEmail(to string) error
+	SendDataExportReadyEmail(to, downloadURL string, expiresAt time.Time) error
 }
 
 type emailService struct {
-	client      *sendgrid.Client
-	senderEmail string
-	senderName  string
-	templateIDs map[string]string
+	client       *sendgrid.Client
+	senderEmail  string
+	senderName   string
+	magicLinkURL string
+	templateIDs  map[string]string
 }
 
-func NewEmailService(apiKey, senderEmail, senderName string) Service {
+func NewEmailService(apiKey, senderEmail, senderName, magicLinkURL string) Service {
 	return &emailService{
-		client:      sendgrid.NewSendClient(apiKey),
-		senderEmail: senderEmail,
-		senderName:  senderName,
+		client:       sendgrid.NewSendClient(apiKey),
+		senderEmail:  senderEmail,
+		senderName:   senderName,
+		magicLinkURL: magicLinkURL,
 		templateIDs: map[string]string{
 			"verification": "d-xxx",
 			"login":        "d-yyy",
@@ -71,4 +81,90 @@ func (s *emailService) SendPasswordResetEmail(to, code string) error {
 	return err
 }
 
+func (s *emailService) SendMagicLinkEmail(to, token string) error {
+	link := fmt.Sprintf("%s?token=%s", s.magicLinkURL, url.QueryEscape(token))
+
+	from := mail.NewEmail(s.senderName, s.senderEmail)
+	subject := "Your login link"
+	toEmail := mail.NewEmail("", to)
+	plainTextContent := fmt.Sprintf("Open this link to log in: %s\nThe link can be used once and expires in 15 minutes.", link)
+	htmlContent := fmt.Sprintf("<p><a href=\"%s\">Log in to Fowergram</a></p><p>The link can be used once and expires in 15 minutes.</p>", link)
+
+	message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
+	_, err := s.client.Send(message)
+	return err
+}
+
+func (s *emailService) SendLoginVerificationEmail(to, code string, device *domain.DeviceSession) error {
+	from := mail.NewEmail(s.senderName, s.senderEmail)
+	subject := "Confirm it's you"
+	toEmail := mail.NewEmail("", to)
+	plainTextContent := fmt.Sprintf("Someone is signing in to your account from %s using %s. If this is you, enter this code: %s\nThe code expires in 10 minutes. If this is not you, change your password.", device.GetLocation(), device.DeviceType, code)
+	htmlContent := fmt.Sprintf("<p>Someone is signing in to your account from <strong>%s</strong> using <strong>%s</strong>.</p><p>If this is you, enter this code: <strong>%s</strong></p><p>The code expires in 10 minutes. If this is not you, change your password.</p>", device.GetLocation(), device.DeviceType, code)
+
+	message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
+	_, err := s.client.Send(message)
+	return err
+}
+
+func (s *emailService) SendLoginBlockedEmail(to string, device *domain.DeviceSession) error {
+	from := mail.NewEmail(s.senderName, s.senderEmail)
+	subject := "We blocked a login to your account"
+	toEmail := mail.NewEmail("", to)
+	plainTextContent := fmt.Sprintf("We blocked a login to your account from %s using %s because it looked unusual. The password was correct, so change it now if this was not you.", device.GetLocation(), device.DeviceType)
+	htmlContent := fmt.Sprintf("<p>We blocked a login to your account from <strong>%s</strong> using <strong>%s</strong> because it looked unusual.</p><p>The password was correct, so change it now if this was not you.</p>", device.GetLocation(), device.DeviceType)
+
+	message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
+	_, err := s.client.Send(message)
+	return err
+}
+
+func (s *emailService) SendAccountDeletionCodeEmail(to, code string) error {
+	from := mail.NewEmail(s.senderName, s.senderEmail)
+	subject := "Confirm deleting your account"
+	toEmail := mail.NewEmail("", to)
+	plainTextContent := fmt.Sprintf("Enter this code to confirm deleting your Fowergram account: %s\nThe code expires in 15 minutes. If you did not ask for this, change your password.", code)
+	htmlContent := fmt.Sprintf("<p>Enter this code to confirm deleting your Fowergram account: <strong>%s</strong></p><p>The code expires in 15 minutes. If you did not ask for this, change your password.</p>", code)
+
+	message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
+	_, err := s.client.Send(message)
+	return err
+}
+
+func (s *emailService) SendAccountDeletionScheduledEmail(to string, deleteAt time.Time) error {
+	from := mail.NewEmail(s.senderName, s.senderEmail)
+	subject := "Your account will be deleted"
+	toEmail := mail.NewEmail("", to)
+	plainTextContent := fmt.Sprintf("Your Fowergram account and everything in it will be deleted on %s. You have been signed out everywhere. Sign in before then if you want to keep your account.", deleteAt.Format(time.RFC1123))
+	htmlContent := fmt.Sprintf("<p>Your Fowergram account and everything in it will be deleted on <strong>%s</strong>. You have been signed out everywhere.</p><p>Sign in before then if you want to keep your account.</p>", deleteAt.Format(time.RFC1123))
+
+	message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
+	_, err := s.client.Send(message)
+	return err
+}
+
+func (s *emailService) SendAccountDeletedEmail(to string) error {
+	from := mail.NewEmail(s.senderName, s.senderEmail)
+	subject := "Your account has been deleted"
+	toEmail := mail.NewEmail("", to)
+	plainTextContent := "Your Fowergram account, posts and comments have been deleted. Thank you for being part of Fowergram."
+	htmlContent := "<p>Your Fowergram account, posts and comments have been deleted.</p><p>Thank you for being part of Fowergram.</p>"
+
+	message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
+	_, err := s.client.Send(message)
+	return err
+}
+
+func (s *emailService) SendDataExportReadyEmail(to, downloadURL string, expiresAt time.Time) error {
+	from := mail.NewEmail(s.senderName, s.senderEmail)
+	subject := "Your Fowergram data is ready to download"
+	toEmail := mail.NewEmail("", to)
+	plainTextContent := fmt.Sprintf("The copy of your Fowergram data you asked for is ready. Download it before %s: %s", expiresAt.Format(time.RFC1123), downloadURL)
+	htmlContent := fmt.Sprintf("<p>The copy of your Fowergram data you asked for is ready.</p><p><a href=\"%s\">Download your data</a></p><p>The link works until %s. If you did not ask for this, change your password.</p>", downloadURL, expiresAt.Format(time.RFC1123))
+
+	message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
+	_, err := s.client.Send(message)
+	return err
+}
+
 // ... implement other methods similarly
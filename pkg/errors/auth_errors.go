@@ -1,5 +1,7 @@
 package errors
 
+import "strings"
+
 type AuthError struct {
 	Code    string
 	Message string
@@ -30,4 +32,177 @@ var (
 		Code:    "AUTH005",
 		Message: "User not found",
 	}
+	ErrRefreshTokenReused = &AuthError{
+		Code:    "AUTH006",
+		Message: "Refresh token has already been used",
+	}
+	ErrInvalidTwoFactorCode = &AuthError{
+		Code:    "AUTH007",
+		Message: "Invalid two-factor authentication code",
+	}
+	ErrTwoFactorAlreadyEnabled = &AuthError{
+		Code:    "AUTH008",
+		Message: "Two-factor authentication is already enabled",
+	}
+	ErrTwoFactorNotEnabled = &AuthError{
+		Code:    "AUTH009",
+		Message: "Two-factor authentication is not enabled",
+	}
+	ErrInvalidVerificationCode = &AuthError{
+		Code:    "AUTH010",
+		Message: "Invalid or expired verification code",
+	}
+	ErrTooManyRequests = &AuthError{
+		Code:    "AUTH011",
+		Message: "Too many requests, please try again later",
+	}
+	ErrEmailNotVerified = &AuthError{
+		Code:    "AUTH012",
+		Message: "Email address has not been verified",
+	}
+	ErrInvalidResetCode = &AuthError{
+		Code:    "AUTH013",
+		Message: "Invalid or expired password reset code",
+	}
+	ErrInvalidMagicLink = &AuthError{
+		Code:    "AUTH015",
+		Message: "Invalid or expired login link",
+	}
+	ErrInvalidPasskey = &AuthError{
+		Code:    "AUTH016",
+		Message: "Passkey could not be verified",
+	}
+	ErrPasskeyCloned = &AuthError{
+		Code:    "AUTH017",
+		Message: "Passkey has been disabled because it may have been cloned",
+	}
+	ErrSocialLoginFailed = &AuthError{
+		Code:    "AUTH018",
+		Message: "Sign in with the identity provider failed",
+	}
+	ErrIdentityLinkRequired = &AuthError{
+		Code:    "AUTH019",
+		Message: "An account with this email already exists, sign in to it and link the provider from your account",
+	}
+	ErrIdentityAlreadyLinked = &AuthError{
+		Code:    "AUTH020",
+		Message: "This provider account is already linked to a user",
+	}
+	ErrUnknownProvider = &AuthError{
+		Code:    "AUTH021",
+		Message: "Unknown identity provider",
+	}
+	ErrProviderEmailMissing = &AuthError{
+		Code:    "AUTH022",
+		Message: "The identity provider did not share an email address",
+	}
+	ErrPasswordResetRequired = &AuthError{
+		Code:    "AUTH023",
+		Message: "A password reset is required, check your email for a reset code",
+	}
+	ErrAccountSuspended = &AuthError{
+		Code:    "AUTH024",
+		Message: "Account has been locked by Fowergram staff",
+	}
+	ErrPermissionDenied = &AuthError{
+		Code:    "AUTH025",
+		Message: "You do not have permission to perform this action",
+	}
+	ErrLoginBlocked = &AuthError{
+		Code:    "AUTH026",
+		Message: "This login looked unusual and was blocked, check your email for details",
+	}
+	ErrInvalidLoginCode = &AuthError{
+		Code:    "AUTH027",
+		Message: "Invalid or expired login verification code",
+	}
+	ErrInvalidAPIKey = &AuthError{
+		Code:    "AUTH028",
+		Message: "Invalid, expired or revoked API key",
+	}
+	ErrInvalidAPIKeyScope = &AuthError{
+		Code:    "AUTH029",
+		Message: "Unknown API key scope",
+	}
+	ErrTooManyAPIKeys = &AuthError{
+		Code:    "AUTH030",
+		Message: "Too many active API keys, revoke one first",
+	}
+	ErrAPIKeyNotFound = &AuthError{
+		Code:    "AUTH031",
+		Message: "API key not found",
+	}
+	ErrDeviceNotFound = &AuthError{
+		Code:    "AUTH032",
+		Message: "Device not found",
+	}
+	ErrStaffAccountDeletion = &AuthError{
+		Code:    "AUTH033",
+		Message: "Staff accounts cannot be deleted, ask an admin to change your role first",
+	}
+	ErrDataExportTooSoon = &AuthError{
+		Code:    "AUTH034",
+		Message: "A copy of your data was already made in the last 24 hours",
+	}
+	ErrDataExportNotFound = &AuthError{
+		Code:    "AUTH035",
+		Message: "Data export not found or the link has expired",
+	}
+	ErrPostNotFound = &AuthError{
+		Code:    "AUTH036",
+		Message: "Post not found",
+	}
+	ErrMediaTooLarge = &AuthError{
+		Code:    "AUTH037",
+		Message: "File is too large",
+	}
+	ErrUnsupportedMediaType = &AuthError{
+		Code:    "AUTH038",
+		Message: "Only JPEG, PNG, GIF and WebP images and MP4 videos can be uploaded",
+	}
+	ErrMediaNotFound = &AuthError{
+		Code:    "AUTH039",
+		Message: "Media not found",
+	}
+	ErrUploadNotFound = &AuthError{
+		Code:    "AUTH040",
+		Message: "Upload not found or expired",
+	}
+	ErrUploadOffsetMismatch = &AuthError{
+		Code:    "AUTH041",
+		Message: "Chunk does not start where the upload left off",
+	}
+	ErrInvalidChunk = &AuthError{
+		Code:    "AUTH042",
+		Message: "Chunk has the wrong size",
+	}
+	ErrMediaProcessingFailed = &AuthError{
+		Code:    "AUTH043",
+		Message: "The photo could not be processed",
+	}
+	ErrTaggedUserNotFound = &AuthError{
+		Code:    "AUTH044",
+		Message: "Tagged user not found",
+	}
+	ErrInvalidCursor = &AuthError{
+		Code:    "AUTH045",
+		Message: "Invalid pagination cursor",
+	}
 )
+
+// PasswordPolicyError lists every password policy rule a new password breaks
+type PasswordPolicyError struct {
+	Code       string
+	Violations []string
+}
+
+func NewPasswordPolicyError(violations []string) *PasswordPolicyError {
+	return &PasswordPolicyError{
+		Code:       "AUTH014",
+		Violations: violations,
+	}
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "Password " + strings.Join(e.Violations, ", ")
+}
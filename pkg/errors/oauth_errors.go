@@ -0,0 +1,67 @@
+package errors
+
+// OAuthError is an error response of the OAuth2 endpoints. Code is one of the error
+// codes defined by RFC 6749 so that client libraries understand it.
+type OAuthError struct {
+	Code        string
+	Description string
+	// Status is the HTTP status the token endpoint responds with
+	Status int
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+var (
+	ErrOAuthInvalidRequest = &OAuthError{
+		Code:        "invalid_request",
+		Description: "The request is missing a parameter or is malformed",
+		Status:      400,
+	}
+	ErrOAuthInvalidClient = &OAuthError{
+		Code:        "invalid_client",
+		Description: "Client authentication failed",
+		Status:      401,
+	}
+	ErrOAuthInvalidGrant = &OAuthError{
+		Code:        "invalid_grant",
+		Description: "The authorization code or refresh token is invalid, expired or revoked",
+		Status:      400,
+	}
+	ErrOAuthInvalidRedirectURI = &OAuthError{
+		Code:        "invalid_request",
+		Description: "The redirect URI is not registered for this client",
+		Status:      400,
+	}
+	ErrOAuthInvalidScope = &OAuthError{
+		Code:        "invalid_scope",
+		Description: "The requested scope is invalid or not allowed for this client",
+		Status:      400,
+	}
+	ErrOAuthUnsupportedGrantType = &OAuthError{
+		Code:        "unsupported_grant_type",
+		Description: "The grant type is not supported",
+		Status:      400,
+	}
+	ErrOAuthUnsupportedResponseType = &OAuthError{
+		Code:        "unsupported_response_type",
+		Description: "Only the code response type is supported",
+		Status:      400,
+	}
+	ErrOAuthPKCERequired = &OAuthError{
+		Code:        "invalid_request",
+		Description: "PKCE with the S256 method is required",
+		Status:      400,
+	}
+	ErrOAuthClientNotFound = &OAuthError{
+		Code:        "invalid_client",
+		Description: "Client not found",
+		Status:      404,
+	}
+	ErrOAuthInsufficientScope = &OAuthError{
+		Code:        "insufficient_scope",
+		Description: "The access token does not have the required scope",
+		Status:      403,
+	}
+)
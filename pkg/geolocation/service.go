@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"fowergram/internal/core/domain"
 )
 
 type Service interface {
 	GetLocation(ip string) (string, error)
+	// Lookup returns the location with coordinates, used to score login risk
+	Lookup(ip string) (*domain.GeoLocation, error)
 }
 
 type geoService struct {
@@ -19,21 +23,38 @@ func NewGeoService(apiKey string) Service {
 }
 
 func (s *geoService) GetLocation(ip string) (string, error) {
+	location, err := s.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return location.String(), nil
+}
+
+func (s *geoService) Lookup(ip string) (*domain.GeoLocation, error) {
 	url := fmt.Sprintf("https://api.ipstack.com/%s?access_key=%s", ip, s.apiKey)
 	resp, err := http.Get(url)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var result struct {
-		City    string `json:"city"`
-		Country string `json:"country_name"`
+		City        string   `json:"city"`
+		Country     string   `json:"country_name"`
+		CountryCode string   `json:"country_code"`
+		Latitude    *float64 `json:"latitude"`
+		Longitude   *float64 `json:"longitude"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return fmt.Sprintf("%s, %s", result.City, result.Country), nil
+	return &domain.GeoLocation{
+		City:        result.City,
+		Country:     result.Country,
+		CountryCode: result.CountryCode,
+		Latitude:    result.Latitude,
+		Longitude:   result.Longitude,
+	}, nil
 }
@@ -0,0 +1,131 @@
+package identity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"fowergram/pkg/identity/identitytest"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProvider(issuer *identitytest.Issuer) *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:         "test",
+		Issuer:       issuer.URL,
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+		RedirectURL:  "https://fowergram.test/auth/callback/test",
+		Scopes:       []string{"openid", "email"},
+	})
+}
+
+// signIn runs the whole authorization code flow and returns the verified identity
+func signIn(t *testing.T, issuer *identitytest.Issuer, provider *OIDCProvider, user identitytest.User) (*Identity, error) {
+	verifier, err := GenerateCodeVerifier()
+	require.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL("state-123", "nonce-456", CodeChallengeS256(verifier))
+	require.NoError(t, err)
+
+	code, state, err := issuer.Authorize(authURL, user)
+	require.NoError(t, err)
+	assert.Equal(t, "state-123", state)
+
+	return provider.Exchange(context.Background(), code, verifier, "nonce-456")
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	issuer := identitytest.NewIssuer("fowergram", "secret")
+	defer issuer.Close()
+	provider := newTestProvider(issuer)
+
+	identity, err := signIn(t, issuer, provider, identitytest.User{
+		Subject:       "10769150350006150715113082367",
+		Email:         "Alice@Example.com",
+		EmailVerified: true,
+		Name:          "Alice",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test", identity.Provider)
+	assert.Equal(t, "10769150350006150715113082367", identity.Subject)
+	assert.Equal(t, "alice@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+}
+
+func TestOIDCProvider_RejectsWrongVerifier(t *testing.T) {
+	issuer := identitytest.NewIssuer("fowergram", "secret")
+	defer issuer.Close()
+	provider := newTestProvider(issuer)
+
+	verifier, err := GenerateCodeVerifier()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL("state", "nonce", CodeChallengeS256(verifier))
+	require.NoError(t, err)
+	code, _, err := issuer.Authorize(authURL, identitytest.User{Subject: "1"})
+	require.NoError(t, err)
+
+	other, err := GenerateCodeVerifier()
+	require.NoError(t, err)
+	_, err = provider.Exchange(context.Background(), code, other, "nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCProvider_VerifiesIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+	}{
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"missing subject", func(c jwt.MapClaims) { c["sub"] = "" }},
+		{"other audience as azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{"fowergram", "someone-else"}
+			c["azp"] = "someone-else"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := identitytest.NewIssuer("fowergram", "secret")
+			defer issuer.Close()
+			issuer.ModifyClaims = tt.modify
+
+			_, err := signIn(t, issuer, newTestProvider(issuer), identitytest.User{Subject: "1"})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOIDCProvider_RejectsForeignSignature(t *testing.T) {
+	issuer := identitytest.NewIssuer("fowergram", "secret")
+	defer issuer.Close()
+	provider := newTestProvider(issuer)
+
+	// An HS256 token signed with the client secret must not be accepted from a
+	// provider that publishes asymmetric keys
+	claims := jwt.MapClaims{
+		"iss": issuer.URL, "sub": "1", "aud": "fowergram", "nonce": "n",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	_, err = provider.VerifyIDToken(context.Background(), forged, "n")
+	assert.Error(t, err)
+}
+
+func TestOIDCProvider_AppleEmailVerifiedString(t *testing.T) {
+	issuer := identitytest.NewIssuer("fowergram", "secret")
+	defer issuer.Close()
+	issuer.ModifyClaims = func(c jwt.MapClaims) { c["email_verified"] = "true" }
+
+	identity, err := signIn(t, issuer, newTestProvider(issuer), identitytest.User{Subject: "1", Email: "a@privaterelay.appleid.com"})
+	require.NoError(t, err)
+	assert.True(t, identity.EmailVerified)
+}
@@ -0,0 +1,102 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"fowergram/pkg/security"
+)
+
+// Provider signs users in with an external account using the authorization code flow
+// with PKCE
+type Provider interface {
+	Name() string
+	// AuthCodeURL is where the user is sent to sign in. state and nonce are echoed back
+	// by the provider, codeChallenge is the S256 challenge of the PKCE verifier.
+	AuthCodeURL(state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems the authorization code and returns the verified identity
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// Identity is the account at the provider as asserted by its ID token or user API
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+	// EmailVerified is only true when the provider asserts it owns or checked the address
+	EmailVerified bool
+	Name          string
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// GenerateCodeVerifier returns a PKCE code verifier (RFC 7636 section 4.1). Padding is
+// not allowed in verifiers, so it uses unpadded base64url.
+func GenerateCodeVerifier() (string, error) {
+	b, err := security.GenerateRandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallengeS256 derives the code challenge sent with the authorization request
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// flexibleBool accepts JSON booleans and the "true"/"false" strings Apple sends
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = flexibleBool(v == "true")
+	case nil:
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean: %s", data)
+	}
+	return nil
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return doJSON(req, v)
+}
+
+func doJSON(req *http.Request, v interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("%s returned %d: %s %s", req.URL.Host, resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
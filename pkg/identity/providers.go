@@ -0,0 +1,84 @@
+package identity
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	ProviderGoogle   = "google"
+	ProviderApple    = "apple"
+	ProviderLINE     = "line"
+	ProviderFacebook = "facebook"
+)
+
+func NewGoogleProvider(clientID, clientSecret, redirectURL string) Provider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:          ProviderGoogle,
+		Issuer:        "https://accounts.google.com",
+		IssuerAliases: []string{"accounts.google.com"},
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		RedirectURL:   redirectURL,
+		Scopes:        []string{"openid", "email", "profile"},
+	})
+}
+
+// NewLINEProvider uses the channel ID and secret of a LINE Login channel. The email
+// scope only returns an address if the channel has been approved for it.
+func NewLINEProvider(channelID, channelSecret, redirectURL string) Provider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:         ProviderLINE,
+		Issuer:       "https://access.line.me",
+		ClientID:     channelID,
+		ClientSecret: channelSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "profile", "email"},
+		HMACIDTokens: true,
+	})
+}
+
+// appleClientSecretTTL is well below the six months Apple allows, the secret is built
+// for every token request anyway
+const appleClientSecretTTL = 5 * time.Minute
+
+// NewAppleProvider signs in with Apple using the Services ID as client ID and the .p8
+// key downloaded from the developer account to sign client secrets
+func NewAppleProvider(servicesID, teamID, keyID, privateKeyPath, redirectURL string) (Provider, error) {
+	pemData, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Apple private key: %w", err)
+	}
+
+	key, err := jwt.ParseECPrivateKeyFromPEM(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Apple private key: %w", err)
+	}
+
+	clientSecret := func() (string, error) {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+			Issuer:    teamID,
+			Subject:   servicesID,
+			Audience:  "https://appleid.apple.com",
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(appleClientSecretTTL).Unix(),
+		})
+		token.Header["kid"] = keyID
+		return token.SignedString(key)
+	}
+
+	return NewOIDCProvider(OIDCConfig{
+		Name:             ProviderApple,
+		Issuer:           "https://appleid.apple.com",
+		ClientID:         servicesID,
+		ClientSecretFunc: clientSecret,
+		RedirectURL:      redirectURL,
+		Scopes:           []string{"name", "email"},
+		// Apple requires form_post whenever name or email is requested
+		AuthParams: map[string]string{"response_mode": "form_post"},
+	}), nil
+}
@@ -0,0 +1,75 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	// Registered with image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// ErrTooManyPixels is returned for images larger than MaxPixels
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// Decode reads the size from the header first, and only decodes images of at most
+// MaxPixels. WebP is decoded with webp, images of other types with the standard
+// library.
+func Decode(data []byte, webp WebPCodec) (image.Image, error) {
+	if isWebP(data) {
+		width, height, err := webpSize(data)
+		if err != nil {
+			return nil, err
+		}
+		if width*height > MaxPixels {
+			return nil, ErrTooManyPixels
+		}
+		if webp == nil {
+			return nil, fmt.Errorf("no WebP decoder")
+		}
+		return webp.Decode(data)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// webpSize reads the canvas size from the first chunk
+func webpSize(data []byte) (int, int, error) {
+	if len(data) < 30 {
+		return 0, 0, fmt.Errorf("invalid WebP")
+	}
+	chunk := data[20:]
+	switch string(data[12:16]) {
+	case "VP8X":
+		width := int(chunk[4]) | int(chunk[5])<<8 | int(chunk[6])<<16
+		height := int(chunk[7]) | int(chunk[8])<<8 | int(chunk[9])<<16
+		return width + 1, height + 1, nil
+	case "VP8 ":
+		// After the frame tag and the start code
+		width := int(binary.LittleEndian.Uint16(chunk[6:]) & 0x3FFF)
+		height := int(binary.LittleEndian.Uint16(chunk[8:]) & 0x3FFF)
+		return width, height, nil
+	case "VP8L":
+		if chunk[0] != 0x2F {
+			return 0, 0, fmt.Errorf("invalid WebP")
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:])
+		return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1, nil
+	}
+	return 0, 0, fmt.Errorf("invalid WebP")
+}
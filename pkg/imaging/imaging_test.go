@@ -0,0 +1,220 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func solid(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// exifWithGPS is an APP1 segment as a phone writes it: orientation, then a GPS
+// position
+func exifWithGPS(orientation int) []byte {
+	tiff := []byte{'I', 'I', 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00, 0x02, 0x00}
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], uint16(orientation))
+	tiff = append(tiff, entry...)
+	binary.LittleEndian.PutUint16(entry[0:], 0x8825)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, []byte("GPS 13.7563N 100.5018E")...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestStripMetadata_JPEG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, solid(16, 8, color.RGBA{200, 10, 10, 255}), nil))
+	comment := []byte{0xFF, 0xFE, 0x00, 0x0B, 'i', 'P', 'h', 'o', 'n', 'e', ' ', '1', '5'}
+	original := append(append(append([]byte{0xFF, 0xD8}, exifWithGPS(6)...), comment...), buf.Bytes()[2:]...)
+	assert.Equal(t, 6, Orientation(original))
+
+	stripped, err := StripMetadata("image/jpeg", original)
+	require.NoError(t, err)
+	assert.NotContains(t, string(stripped), "GPS")
+	assert.NotContains(t, string(stripped), "iPhone")
+	// The orientation stays, or the photo would show sideways
+	assert.Equal(t, 6, Orientation(stripped))
+	img, err := jpeg.Decode(bytes.NewReader(stripped))
+	require.NoError(t, err)
+	assert.Equal(t, 16, img.Bounds().Dx())
+
+	_, err = StripMetadata("image/jpeg", []byte("not a jpeg"))
+	assert.Error(t, err)
+}
+
+func TestStripMetadata_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, solid(4, 4, color.RGBA{0, 0, 255, 255})))
+	data := buf.Bytes()
+
+	text := []byte("tEXtLocation\x00Bangkok")
+	chunk := make([]byte, 4, 4+len(text)+4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+	// After the signature and IHDR
+	withText := append(append(append([]byte{}, data[:33]...), chunk...), data[33:]...)
+	_, err := png.Decode(bytes.NewReader(withText))
+	require.NoError(t, err)
+
+	stripped, err := StripMetadata("image/png", withText)
+	require.NoError(t, err)
+	assert.NotContains(t, string(stripped), "Bangkok")
+	assert.Equal(t, data, stripped)
+}
+
+func TestStripMetadata_WebP(t *testing.T) {
+	chunk := func(fourcc string, data []byte) []byte {
+		out := append([]byte(fourcc), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(out[4:], uint32(len(data)))
+		out = append(out, data...)
+		if len(data)%2 == 1 {
+			out = append(out, 0)
+		}
+		return out
+	}
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 3, 0, 0, 3, 0, 0})...)
+	body = append(body, chunk("VP8 ", []byte("image data"))...)
+	body = append(body, chunk("EXIF", []byte("GPS 13.7563N"))...)
+	body = append(body, chunk("XMP ", []byte("<x:xmpmeta/>"))...)
+	original := append([]byte("RIFF\x00\x00\x00\x00"), body...)
+	binary.LittleEndian.PutUint32(original[4:], uint32(len(body)))
+
+	stripped, err := StripMetadata("image/webp", original)
+	require.NoError(t, err)
+	assert.NotContains(t, string(stripped), "GPS")
+	assert.NotContains(t, string(stripped), "xmpmeta")
+	assert.Contains(t, string(stripped), "image data")
+	assert.Equal(t, byte(0x10), stripped[20])
+	assert.Equal(t, uint32(len(stripped)-8), binary.LittleEndian.Uint32(stripped[4:]))
+}
+
+func TestAutoOrient(t *testing.T) {
+	// A on the left, B on the right
+	a, b := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, a)
+	img.SetRGBA(1, 0, b)
+
+	cases := map[int][]color.RGBA{
+		1: {a, b},
+		2: {b, a},
+		6: {a, b}, // rotated clockwise: A on top
+		8: {b, a}, // rotated counter-clockwise: B on top
+	}
+	for orientation, want := range cases {
+		oriented := AutoOrient(img, orientation)
+		if orientation >= 5 {
+			require.Equal(t, image.Rect(0, 0, 1, 2), oriented.Rect, "orientation %d", orientation)
+			assert.Equal(t, want, []color.RGBA{oriented.RGBAAt(0, 0), oriented.RGBAAt(0, 1)}, "orientation %d", orientation)
+		} else {
+			assert.Equal(t, want, []color.RGBA{oriented.RGBAAt(0, 0), oriented.RGBAAt(1, 0)}, "orientation %d", orientation)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		img.SetRGBA(0, y, color.RGBA{0, 0, 0, 255})
+		img.SetRGBA(1, y, color.RGBA{200, 0, 0, 255})
+		img.SetRGBA(2, y, color.RGBA{0, 100, 0, 255})
+		img.SetRGBA(3, y, color.RGBA{0, 100, 0, 255})
+	}
+
+	small := Resize(img, 2)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), small.Rect)
+	assert.Equal(t, color.RGBA{100, 0, 0, 255}, small.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{0, 100, 0, 255}, small.RGBAAt(1, 0))
+
+	// Never scaled up
+	assert.Same(t, img, Resize(img, 10))
+	// Widths that do not divide evenly keep the aspect ratio
+	assert.Equal(t, image.Rect(0, 0, 320, 213), Resize(solid(1080, 720, color.RGBA{1, 2, 3, 255}), 320).Rect)
+}
+
+func TestBlurhash(t *testing.T) {
+	// 4x3 components, then the average colour
+	hash := Blurhash(solid(32, 24, color.RGBA{255, 0, 0, 255}), 4, 3)
+	assert.Len(t, hash, 28)
+	assert.Equal(t, "L", hash[:1])
+	assert.Equal(t, "TI:j", hash[2:6])
+
+	gradient := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			gradient.SetRGBA(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), 128, 255})
+		}
+	}
+	hash = Blurhash(gradient, 4, 3)
+	assert.Len(t, hash, 28)
+	assert.NotEqual(t, "0", hash[1:2])
+}
+
+func TestDominantColor(t *testing.T) {
+	img := solid(10, 10, color.RGBA{20, 60, 200, 255})
+	for x := 0; x < 10; x++ {
+		img.SetRGBA(x, 0, color.RGBA{250, 0, 0, 255})
+		// Transparent pixels do not count
+		img.SetRGBA(x, 1, color.RGBA{0, 0, 0, 0})
+		img.SetRGBA(x, 2, color.RGBA{0, 0, 0, 0})
+	}
+	assert.Equal(t, "#143cc8", DominantColor(img))
+	assert.Equal(t, "#000000", DominantColor(image.NewRGBA(image.Rect(0, 0, 2, 2))))
+}
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, solid(3, 2, color.RGBA{0, 255, 0, 255})))
+	img, err := Decode(buf.Bytes(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 3, 2), img.Bounds())
+
+	// A few bytes claiming 10000x10000 pixels
+	bomb := append([]byte{}, buf.Bytes()...)
+	binary.BigEndian.PutUint32(bomb[16:], 10000)
+	binary.BigEndian.PutUint32(bomb[20:], 10000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+	_, err = Decode(bomb, nil)
+	assert.ErrorIs(t, err, ErrTooManyPixels)
+
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00")
+	webp = append(webp, 0x0F, 0x27, 0x00, 0x0F, 0x27, 0x00) // 10000x10000
+	_, err = Decode(webp, nil)
+	assert.ErrorIs(t, err, ErrTooManyPixels)
+}
+
+func TestFlatten(t *testing.T) {
+	img := solid(2, 1, color.RGBA{255, 0, 0, 255})
+	assert.Same(t, img, Flatten(img))
+
+	img.SetRGBA(1, 0, color.RGBA{})
+	flat := Flatten(img)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, flat.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, flat.RGBAAt(1, 0))
+}
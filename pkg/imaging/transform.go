@@ -0,0 +1,152 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// MaxPixels is the largest image that is decoded. A small file can describe a huge
+// image, decoding it would take gigabytes of memory.
+const MaxPixels = 50_000_000
+
+// AutoOrient turns the image upright according to its EXIF orientation
+func AutoOrient(img image.Image, orientation int) *image.RGBA {
+	src := toRGBA(img)
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// Resize scales the image down to the given width, keeping the aspect ratio. Each
+// output pixel is the average of the area it covers, which keeps fine detail from
+// turning into noise. Images are never scaled up.
+func Resize(img *image.RGBA, width int) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if width >= w {
+		return img
+	}
+	height := int(math.Round(float64(h) * float64(width) / float64(w)))
+	if height < 1 {
+		height = 1
+	}
+
+	columns := areaWeights(w, width)
+	rows := areaWeights(h, height)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Source rows are scaled horizontally once and added to the output rows they cover
+	scaled := make([]float64, width*4)
+	sum := make([]float64, width*4)
+	cachedRow := -1
+	for y, rowWeights := range rows {
+		for i := range sum {
+			sum[i] = 0
+		}
+		for _, rw := range rowWeights {
+			if rw.index != cachedRow {
+				scaleRow(img, rw.index, columns, scaled)
+				cachedRow = rw.index
+			}
+			for i, v := range scaled {
+				sum[i] += v * rw.weight
+			}
+		}
+		out := dst.Pix[dst.PixOffset(0, y):]
+		for i, v := range sum {
+			out[i] = uint8(math.Min(255, math.Max(0, math.Round(v))))
+		}
+	}
+	return dst
+}
+
+type weight struct {
+	index  int
+	weight float64
+}
+
+// areaWeights maps every output index to the source indexes it covers and how much
+// of each
+func areaWeights(srcLen, dstLen int) [][]weight {
+	scale := float64(srcLen) / float64(dstLen)
+	weights := make([][]weight, dstLen)
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < srcLen && float64(j) < end; j++ {
+			overlap := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if overlap > 0 {
+				weights[i] = append(weights[i], weight{index: j, weight: overlap / scale})
+			}
+		}
+	}
+	return weights
+}
+
+func scaleRow(img *image.RGBA, y int, columns [][]weight, out []float64) {
+	row := img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):]
+	for x, columnWeights := range columns {
+		var r, g, b, a float64
+		for _, cw := range columnWeights {
+			p := row[cw.index*4 : cw.index*4+4]
+			r += float64(p[0]) * cw.weight
+			g += float64(p[1]) * cw.weight
+			b += float64(p[2]) * cw.weight
+			a += float64(p[3]) * cw.weight
+		}
+		out[x*4], out[x*4+1], out[x*4+2], out[x*4+3] = r, g, b, a
+	}
+}
+
+// toRGBA copies the image into premultiplied RGBA starting at 0,0, which averaging
+// needs to weigh transparent pixels correctly
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// Flatten puts the image on a white background, for formats without transparency.
+// Opaque images are returned as they are.
+func Flatten(img *image.RGBA) *image.RGBA {
+	if img.Opaque() {
+		return img
+	}
+	dst := image.NewRGBA(img.Rect)
+	draw.Draw(dst, dst.Rect, image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Rect, img, img.Rect.Min, draw.Over)
+	return dst
+}
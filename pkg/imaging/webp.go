@@ -0,0 +1,88 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// WebPCodec encodes and decodes WebP, which Go's standard library cannot
+type WebPCodec interface {
+	Encode(img image.Image, quality int) ([]byte, error)
+	Decode(data []byte) (image.Image, error)
+}
+
+// WebPTools converts with the cwebp and dwebp command line tools from libwebp
+type WebPTools struct {
+	cwebp string
+	dwebp string
+}
+
+// FindWebPTools looks the tools up in dir, or on the PATH when dir is empty
+func FindWebPTools(dir string) (*WebPTools, error) {
+	find := func(name string) (string, error) {
+		if dir != "" {
+			name = filepath.Join(dir, name)
+		}
+		return exec.LookPath(name)
+	}
+	cwebp, err := find("cwebp")
+	if err != nil {
+		return nil, err
+	}
+	dwebp, err := find("dwebp")
+	if err != nil {
+		return nil, err
+	}
+	return &WebPTools{cwebp: cwebp, dwebp: dwebp}, nil
+}
+
+// Encode writes the image as a lossy WebP without metadata
+func (t *WebPTools) Encode(img image.Image, quality int) ([]byte, error) {
+	var input bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&input, img); err != nil {
+		return nil, err
+	}
+	return t.run(input.Bytes(), "in.png", "out.webp", func(in, out string) []string {
+		return []string{t.cwebp, "-quiet", "-q", fmt.Sprint(quality), "-metadata", "none", in, "-o", out}
+	})
+}
+
+func (t *WebPTools) Decode(data []byte) (image.Image, error) {
+	output, err := t.run(data, "in.webp", "out.png", func(in, out string) []string {
+		return []string{t.dwebp, "-quiet", in, "-png", "-o", out}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(output))
+}
+
+// run passes the files through a temporary directory, the tools do not all support
+// pipes
+func (t *WebPTools) run(input []byte, inName, outName string, args func(in, out string) []string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "fowergram-webp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, inName), filepath.Join(dir, outName)
+	if err := os.WriteFile(in, input, 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	command := args(in, out)
+	if output, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", filepath.Base(command[0]), err, output)
+	}
+	return os.ReadFile(out)
+}
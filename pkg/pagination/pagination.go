@@ -0,0 +1,111 @@
+// Package pagination pages through lists newest first with opaque cursors over
+// (created_at, id). Unlike offsets, a cursor costs the same on every page and rows
+// added meanwhile do not shift the next page.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of the last row of a page
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"id"`
+}
+
+// Encode returns the cursor as a URL safe string. Clients must not rely on what is
+// inside.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode reads a cursor returned by Encode
+func Decode(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 || cursor.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// Page asks for the rows after Cursor, or the first rows when it is nil
+type Page struct {
+	Cursor *Cursor
+	Limit  int
+}
+
+// NewPage reads the cursor and limit query parameters. An empty cursor is the first
+// page, limits out of range fall back to DefaultLimit or MaxLimit.
+func NewPage(cursor string, limit int) (Page, error) {
+	page := Page{Limit: limit}
+	switch {
+	case limit <= 0:
+		page.Limit = DefaultLimit
+	case limit > MaxLimit:
+		page.Limit = MaxLimit
+	}
+	if cursor != "" {
+		c, err := Decode(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		page.Cursor = c
+	}
+	return page, nil
+}
+
+// Fetch is how many rows to load, one more than the limit tells whether there are
+// more
+func (p Page) Fetch() int {
+	return p.Limit + 1
+}
+
+// List is one page of results, as every list endpoint returns them
+type List[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// NewList turns the rows loaded with Page.Fetch into a page. key returns the
+// position of a row.
+func NewList[T any](rows []T, page Page, key func(T) Cursor) *List[T] {
+	list := &List[T]{Data: rows}
+	if list.Data == nil {
+		list.Data = []T{}
+	}
+	if len(rows) > page.Limit {
+		list.Data = rows[:page.Limit]
+		list.HasMore = true
+		list.NextCursor = key(list.Data[len(list.Data)-1]).Encode()
+	}
+	return list
+}
+
+// Map converts the rows of a page, keeping its cursor
+func Map[T, U any](list *List[T], fn func(T) U) *List[U] {
+	out := &List[U]{
+		Data:       make([]U, len(list.Data)),
+		NextCursor: list.NextCursor,
+		HasMore:    list.HasMore,
+	}
+	for i, row := range list.Data {
+		out.Data[i] = fn(row)
+	}
+	return out
+}
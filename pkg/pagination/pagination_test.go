@@ -0,0 +1,75 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type row struct {
+	id        uint
+	createdAt time.Time
+}
+
+func key(r row) Cursor {
+	return Cursor{CreatedAt: r.createdAt, ID: r.id}
+}
+
+func TestCursor(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 123456000, time.UTC), ID: 42}
+	decoded, err := Decode(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, uint(42), decoded.ID)
+
+	for _, value := range []string{"not base64!", "bm90IGpzb24", Cursor{ID: 1}.Encode()} {
+		_, err := Decode(value)
+		assert.ErrorIs(t, err, ErrInvalidCursor, value)
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	page, err := NewPage("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, Page{Limit: DefaultLimit}, page)
+
+	page, err = NewPage("", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, MaxLimit, page.Limit)
+	assert.Equal(t, MaxLimit+1, page.Fetch())
+
+	page, err = NewPage(Cursor{CreatedAt: time.Now(), ID: 7}.Encode(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), page.Cursor.ID)
+	assert.Equal(t, 5, page.Limit)
+
+	_, err = NewPage("garbage", 5)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestNewList(t *testing.T) {
+	now := time.Now().UTC()
+	rows := []row{{3, now}, {2, now}, {1, now.Add(-time.Hour)}}
+	page := Page{Limit: 2}
+
+	list := NewList(rows, page, key)
+	assert.Equal(t, rows[:2], list.Data)
+	assert.True(t, list.HasMore)
+	next, err := Decode(list.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), next.ID)
+
+	list = NewList(rows[2:], page, key)
+	assert.False(t, list.HasMore)
+	assert.Empty(t, list.NextCursor)
+
+	// An empty page is still a JSON array
+	list = NewList[row](nil, page, key)
+	assert.NotNil(t, list.Data)
+
+	ids := Map(NewList(rows, page, key), func(r row) uint { return r.id })
+	assert.Equal(t, []uint{3, 2}, ids.Data)
+	assert.True(t, ids.HasMore)
+}
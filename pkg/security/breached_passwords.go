@@ -0,0 +1,117 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// breachPrefixBits is the size of the lookup index: one entry per 5-hex-digit SHA-1 prefix,
+// the same bucketing Have I Been Pwned uses for its range API
+const breachPrefixBits = 20
+
+// BreachedPasswords looks passwords up in a local copy of a breached-password corpus.
+//
+// The file holds one upper or lower case SHA-1 hash per line, optionally followed by
+// ":<count>", sorted by hash (the "ordered by hash" Pwned Passwords download). Only an
+// offset per prefix is kept in memory; each lookup reads a single prefix range from disk.
+type BreachedPasswords struct {
+	file    *os.File
+	offsets []int64
+}
+
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password corpus: %w", err)
+	}
+
+	offsets, err := indexBreachedPasswords(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &BreachedPasswords{file: file, offsets: offsets}, nil
+}
+
+// indexBreachedPasswords records where each prefix starts. offsets[p+1]-offsets[p] is
+// the byte range holding every hash with prefix p.
+func indexBreachedPasswords(r io.Reader) ([]int64, error) {
+	offsets := make([]int64, 1<<breachPrefixBits+1)
+	reader := bufio.NewReaderSize(r, 1<<16)
+
+	var offset int64
+	next := 0
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			hash := strings.TrimSpace(line)
+			if hash != "" {
+				if len(hash) < 40 {
+					return nil, fmt.Errorf("invalid hash on line %d of breached password corpus", lineNumber)
+				}
+
+				prefix, perr := strconv.ParseUint(hash[:5], 16, 32)
+				if perr != nil {
+					return nil, fmt.Errorf("invalid hash on line %d of breached password corpus", lineNumber)
+				}
+				if int(prefix) < next-1 {
+					return nil, fmt.Errorf("breached password corpus is not sorted by hash (line %d)", lineNumber)
+				}
+
+				for ; next <= int(prefix); next++ {
+					offsets[next] = offset
+				}
+			}
+			offset += int64(len(line))
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read breached password corpus: %w", err)
+		}
+	}
+
+	for ; next < len(offsets); next++ {
+		offsets[next] = offset
+	}
+	return offsets, nil
+}
+
+// Contains reports whether the password appears in the corpus
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+
+	prefix, _ := strconv.ParseUint(string(hash[:5]), 16, 32)
+	start, end := b.offsets[prefix], b.offsets[prefix+1]
+	if start == end {
+		return false, nil
+	}
+
+	chunk := make([]byte, end-start)
+	if _, err := b.file.ReadAt(chunk, start); err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read breached password corpus: %w", err)
+	}
+
+	for _, line := range bytes.Split(chunk, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) >= 40 && bytes.Equal(bytes.ToUpper(line[:40]), hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b *BreachedPasswords) Close() error {
+	return b.file.Close()
+}
@@ -0,0 +1,339 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmHS256 = "HS256"
+)
+
+type KeyStatus string
+
+const (
+	// KeyStatusActive keys are published and may be promoted to sign new tokens
+	KeyStatusActive KeyStatus = "active"
+	// KeyStatusRetired keys only verify tokens issued before a rotation
+	KeyStatusRetired KeyStatus = "retired"
+)
+
+// SigningKey is a single JWT key identified by the kid header
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	Status     KeyStatus
+	privateKey crypto.PrivateKey
+	publicKey  crypto.PublicKey
+}
+
+// KeyRing holds every key needed to sign new tokens and verify outstanding ones
+type KeyRing struct {
+	mu           sync.RWMutex
+	keys         map[string]*SigningKey
+	signingKeyID string
+	legacySecret []byte
+}
+
+// JSONWebKey is the public part of a signing key as published in the JWKS document
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		keys: make(map[string]*SigningKey),
+	}
+}
+
+// LoadKeyRing reads every <kid>.pem file in dir. Files holding a private key are active,
+// files holding only a public key are retired. Without a directory tokens are signed with
+// the shared HS256 secret; with one, the secret only verifies tokens that carry no kid.
+func LoadKeyRing(dir, signingKeyID, legacySecret string) (*KeyRing, error) {
+	ring := NewKeyRing()
+	if legacySecret != "" {
+		ring.legacySecret = []byte(legacySecret)
+	}
+
+	if dir == "" {
+		if legacySecret == "" {
+			return nil, fmt.Errorf("either a JWT key directory or a JWT secret is required")
+		}
+		return ring, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list JWT keys: %w", err)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT key %s: %w", file, err)
+		}
+
+		key, err := ParseSigningKeyPEM(strings.TrimSuffix(filepath.Base(file), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ring.AddKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ring.SetSigningKey(signingKeyID); err != nil {
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// GenerateSigningKey creates a new RS256 or EdDSA key pair
+func GenerateSigningKey(kid, algorithm string) (*SigningKey, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		return &SigningKey{ID: kid, Algorithm: algorithm, Status: KeyStatusActive, privateKey: private, publicKey: &private.PublicKey}, nil
+	case AlgorithmEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		return &SigningKey{ID: kid, Algorithm: algorithm, Status: KeyStatusActive, privateKey: private, publicKey: public}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+// ParseSigningKeyPEM loads a PKCS#8/PKCS#1 private key or a PKIX public key
+func ParseSigningKeyPEM(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT key %s is not PEM encoded", kid)
+	}
+
+	key := &SigningKey{ID: kid}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT key %s: %w", kid, err)
+		}
+		key.privateKey = parsed
+		key.Status = KeyStatusActive
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT key %s: %w", kid, err)
+		}
+		key.privateKey = parsed
+		key.Status = KeyStatusActive
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT key %s: %w", kid, err)
+		}
+		key.publicKey = parsed
+		key.Status = KeyStatusRetired
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in JWT key %s", block.Type, kid)
+	}
+
+	switch k := key.privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.publicKey = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.publicKey = k.Public()
+	}
+
+	switch key.publicKey.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = AlgorithmRS256
+	case ed25519.PublicKey:
+		key.Algorithm = AlgorithmEdDSA
+	default:
+		return nil, fmt.Errorf("JWT key %s must be an RSA or Ed25519 key", kid)
+	}
+
+	return key, nil
+}
+
+// MarshalPrivateKeyPEM encodes the private key as PKCS#8
+func (k *SigningKey) MarshalPrivateKeyPEM() ([]byte, error) {
+	if k.privateKey == nil {
+		return nil, fmt.Errorf("JWT key %s has no private key", k.ID)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// MarshalPublicKeyPEM encodes the public key as PKIX, the format used for retired keys
+func (k *SigningKey) MarshalPublicKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(k.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+func (r *KeyRing) AddKey(key *SigningKey) error {
+	if key.ID == "" {
+		return fmt.Errorf("JWT key ID is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate JWT key ID: %s", key.ID)
+	}
+	r.keys[key.ID] = key
+	return nil
+}
+
+// SetSigningKey promotes an active key to sign all new tokens
+func (r *KeyRing) SetSigningKey(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown JWT signing key: %q", kid)
+	}
+	if key.Status != KeyStatusActive || key.privateKey == nil {
+		return fmt.Errorf("JWT key %s cannot sign tokens", kid)
+	}
+
+	r.signingKeyID = kid
+	return nil
+}
+
+// Retire keeps a key for verification only. The signing key cannot be retired.
+func (r *KeyRing) Retire(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown JWT key: %q", kid)
+	}
+	if kid == r.signingKeyID {
+		return fmt.Errorf("cannot retire the current signing key %s", kid)
+	}
+
+	key.Status = KeyStatusRetired
+	key.privateKey = nil
+	return nil
+}
+
+// Sign signs the claims with the current signing key, falling back to the shared secret
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.signingKeyID == "" {
+		if r.legacySecret == nil {
+			return "", fmt.Errorf("no JWT signing key configured")
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.legacySecret)
+	}
+
+	key := r.keys[r.signingKeyID]
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.privateKey)
+}
+
+// Parse verifies a token against the key named by its kid header
+func (r *KeyRing) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, r.keyFunc)
+}
+
+func (r *KeyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// Tokens issued before asymmetric signing was enabled
+		if r.legacySecret == nil || token.Method.Alg() != AlgorithmHS256 {
+			return nil, fmt.Errorf("token has no key ID")
+		}
+		return r.legacySecret, nil
+	}
+
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID: %s", kid)
+	}
+
+	// Never let the token choose a different algorithm than the key was issued for
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+
+	return key.publicKey, nil
+}
+
+// JWKS returns the public keys other services need to verify tokens
+func (r *KeyRing) JWKS() JSONWebKeySet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range r.keys {
+		jwk := JSONWebKey{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+		switch public := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+	return set
+}
@@ -0,0 +1,102 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRing_RotationKeepsOutstandingTokensValid(t *testing.T) {
+	dir := t.TempDir()
+
+	oldKey, err := GenerateSigningKey("2026-01", AlgorithmRS256)
+	require.NoError(t, err)
+	newKey, err := GenerateSigningKey("2026-02", AlgorithmEdDSA)
+	require.NoError(t, err)
+	writePrivateKey(t, dir, oldKey)
+	writePrivateKey(t, dir, newKey)
+
+	// Step 1: the new key is published but the old one still signs
+	ring, err := LoadKeyRing(dir, "2026-01", "")
+	require.NoError(t, err)
+	assert.Len(t, ring.JWKS().Keys, 2)
+
+	oldToken, err := GenerateJWT(1, 10, ring, time.Hour)
+	require.NoError(t, err)
+
+	// Step 2: promote the new key and retire the old one to its public half
+	public, err := oldKey.MarshalPublicKeyPEM()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2026-01.pem"), public, 0o644))
+
+	ring, err = LoadKeyRing(dir, "2026-02", "")
+	require.NoError(t, err)
+
+	claims, err := ParseAccessToken(oldToken, ring)
+	require.NoError(t, err)
+	assert.Equal(t, uint(10), claims.SessionID)
+
+	newToken, err := GenerateJWT(1, 11, ring, time.Hour)
+	require.NoError(t, err)
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2026-02", parsed.Header["kid"])
+	assert.Equal(t, AlgorithmEdDSA, parsed.Method.Alg())
+
+	// A retired key can no longer be promoted to sign
+	assert.Error(t, ring.SetSigningKey("2026-01"))
+}
+
+func TestKeyRing_RejectsAlgorithmMismatch(t *testing.T) {
+	key, err := GenerateSigningKey("rsa", AlgorithmRS256)
+	require.NoError(t, err)
+
+	ring := NewKeyRing()
+	require.NoError(t, ring.AddKey(key))
+	require.NoError(t, ring.SetSigningKey("rsa"))
+
+	// An HS256 token claiming the RSA kid must not be verified with the public key bytes
+	public, err := key.MarshalPublicKeyPEM()
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: 1})
+	forged.Header["kid"] = "rsa"
+	signed, err := forged.SignedString(public)
+	require.NoError(t, err)
+
+	_, err = ParseAccessToken(signed, ring)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_LegacySecret(t *testing.T) {
+	legacy, err := LoadKeyRing("", "", "secret")
+	require.NoError(t, err)
+	token, err := GenerateJWT(1, 0, legacy, time.Hour)
+	require.NoError(t, err)
+
+	// After switching to asymmetric keys, kid-less HS256 tokens verify until they expire
+	dir := t.TempDir()
+	key, err := GenerateSigningKey("k1", AlgorithmEdDSA)
+	require.NoError(t, err)
+	writePrivateKey(t, dir, key)
+
+	ring, err := LoadKeyRing(dir, "k1", "secret")
+	require.NoError(t, err)
+	_, err = ParseAccessToken(token, ring)
+	assert.NoError(t, err)
+
+	ring, err = LoadKeyRing(dir, "k1", "")
+	require.NoError(t, err)
+	_, err = ParseAccessToken(token, ring)
+	assert.Error(t, err)
+}
+
+func writePrivateKey(t *testing.T, dir string, key *SigningKey) {
+	data, err := key.MarshalPrivateKeyPEM()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, key.ID+".pem"), data, 0o600))
+}
@@ -1,23 +1,230 @@
 package security
 
 import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	// VerifyCost is used for password verification (lower for better performance)
-	VerifyCost = 10
-	// HashCost is used for password hashing (higher for better security)
+	// HashCost is the bcrypt cost for hashes that are still verified with bcrypt
 	HashCost = bcrypt.DefaultCost
 )
 
-// HashPassword creates a bcrypt hash of the password using the higher cost
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), HashCost)
+// PasswordHasher hashes and verifies passwords for one or more algorithms. Hashes are
+// self-describing: argon2id uses the PHC string format and bcrypt its modular crypt prefix.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// Identifies reports whether the hash was produced by an algorithm this hasher supports
+	Identifies(encoded string) bool
+	// NeedsRehash reports whether the hash should be replaced on the next successful login
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idParams follow the OWASP minimum recommendation by default
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+const argon2idPrefix = "$argon2id$"
+
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) PasswordHasher {
+	return &argon2idHasher{params: params}
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt, err := GenerateRandomBytes(int(h.params.SaltLength))
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (h *argon2idHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (h *argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.Parallelism < h.params.Parallelism ||
+		uint32(len(salt)) < h.params.SaltLength ||
+		uint32(len(key)) < h.params.KeyLength
+}
+
+// decodeArgon2id parses $argon2id$v=19$m=...,t=...,p=...$<salt>$<key>
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) PasswordHasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
 	return string(bytes), err
 }
 
-// VerifyPassword checks if the provided password matches the hashed password using the lower cost
+func (h *bcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *bcryptHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *bcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.cost
+}
+
+// multiHasher hashes with the preferred algorithm and still verifies the others
+type multiHasher struct {
+	preferred PasswordHasher
+	hashers   []PasswordHasher
+}
+
+// NewPasswordHasher hashes new passwords with preferred and accepts hashes from any of
+// the legacy hashers. Legacy hashes always need a rehash.
+func NewPasswordHasher(preferred PasswordHasher, legacy ...PasswordHasher) PasswordHasher {
+	return &multiHasher{
+		preferred: preferred,
+		hashers:   append([]PasswordHasher{preferred}, legacy...),
+	}
+}
+
+// DefaultPasswordHasher uses argon2id and keeps accepting existing bcrypt hashes
+func DefaultPasswordHasher() PasswordHasher {
+	return NewPasswordHasher(NewArgon2idHasher(DefaultArgon2idParams), NewBcryptHasher(HashCost))
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h *multiHasher) Verify(password, encoded string) (bool, error) {
+	for _, hasher := range h.hashers {
+		if hasher.Identifies(encoded) {
+			return hasher.Verify(password, encoded)
+		}
+	}
+	return false, fmt.Errorf("unrecognised password hash format")
+}
+
+func (h *multiHasher) Identifies(encoded string) bool {
+	for _, hasher := range h.hashers {
+		if hasher.Identifies(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *multiHasher) NeedsRehash(encoded string) bool {
+	if !h.preferred.Identifies(encoded) {
+		return true
+	}
+	return h.preferred.NeedsRehash(encoded)
+}
+
+// HashPassword hashes the password with the default algorithm
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHasher().Hash(password)
+}
+
+// VerifyPassword checks the password against a hash produced by any supported algorithm
 func VerifyPassword(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	ok, err := DefaultPasswordHasher().Verify(password, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("password does not match")
+	}
+	return nil
 }
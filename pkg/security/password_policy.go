@@ -0,0 +1,92 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"fowergram/pkg/errors"
+)
+
+// BreachChecker reports whether a password is known from a data breach
+type BreachChecker interface {
+	Contains(password string) (bool, error)
+}
+
+// PasswordPolicy is the single place that decides whether a new password is acceptable.
+// Register, ResetPassword and ChangePassword all go through Validate.
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	MinEntropyBits float64
+	// Breached is optional; without a corpus the breach check is skipped
+	Breached BreachChecker
+}
+
+func NewPasswordPolicy(minLength int, minEntropyBits float64, breached BreachChecker) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:      minLength,
+		MaxLength:      128,
+		MinEntropyBits: minEntropyBits,
+		Breached:       breached,
+	}
+}
+
+// Validate checks the password against every rule and returns a *errors.PasswordPolicyError
+// listing all violations. personal holds values the password must not contain, such as
+// the username and email address.
+func (p *PasswordPolicy) Validate(password string, personal ...string) error {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+
+	if containsPersonalInfo(password, personal) {
+		violations = append(violations, "must not contain your username or email address")
+	}
+
+	if EstimatePasswordEntropy(password) < p.MinEntropyBits {
+		violations = append(violations, "is too easy to guess")
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			// A broken corpus must not block every signup
+			fmt.Printf("failed to check breached passwords: %v\n", err)
+		}
+		if breached {
+			violations = append(violations, "has appeared in a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return errors.NewPasswordPolicyError(violations)
+	}
+	return nil
+}
+
+func containsPersonalInfo(password string, personal []string) bool {
+	lower := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		candidates := []string{value}
+		// Also reject the mailbox name on its own
+		if at := strings.Index(value, "@"); at > 0 {
+			candidates = append(candidates, value[:at])
+		}
+
+		for _, candidate := range candidates {
+			if len(candidate) >= 3 && strings.Contains(lower, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
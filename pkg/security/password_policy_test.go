@@ -0,0 +1,101 @@
+package security
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"fowergram/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCorpus(t *testing.T, passwords ...string) string {
+	t.Helper()
+
+	lines := make([]string, 0, len(passwords))
+	for i, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":"+strings.Repeat("1", i+1))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600))
+	return path
+}
+
+func TestEstimatePasswordEntropy(t *testing.T) {
+	weak := []string{"password", "Password123!", "qwertyuiop", "aaaaaaaaaaaa", "abcdefghijkl", "summer2024", "P@ssw0rd"}
+	for _, password := range weak {
+		assert.Less(t, EstimatePasswordEntropy(password), 28.0, password)
+	}
+
+	strong := []string{"Vq7#mLp2!xR9", "Fl0wer-Garden-42", "correct horse battery staple"}
+	for _, password := range strong {
+		assert.GreaterOrEqual(t, EstimatePasswordEntropy(password), 28.0, password)
+	}
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	corpus, err := LoadBreachedPasswords(writeCorpus(t, "Tr0ub4dor&3-horse", "hunter2", "123456"))
+	require.NoError(t, err)
+	defer corpus.Close()
+
+	policy := NewPasswordPolicy(8, 28, corpus)
+
+	assert.NoError(t, policy.Validate("Vq7#mLp2!xR9", "alice", "alice@example.com"))
+
+	tests := []struct {
+		name      string
+		password  string
+		violation string
+	}{
+		{name: "too short", password: "x7#Q", violation: "must be at least 8 characters"},
+		{name: "too long", password: strings.Repeat("Vq7#mLp2!xR9", 11), violation: "must be at most 128 characters"},
+		{name: "contains username", password: "xX-Alice-Q7#v", violation: "must not contain your username or email address"},
+		{name: "contains mailbox name", password: "alice.example!9Q", violation: "must not contain your username or email address"},
+		{name: "guessable", password: "Password123!", violation: "is too easy to guess"},
+		{name: "breached", password: "Tr0ub4dor&3-horse", violation: "has appeared in a data breach"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, "alice", "alice.example@example.com")
+			var policyErr *errors.PasswordPolicyError
+			require.ErrorAs(t, err, &policyErr)
+			assert.Equal(t, "AUTH014", policyErr.Code)
+			assert.Contains(t, policyErr.Violations, tt.violation)
+		})
+	}
+}
+
+func TestBreachedPasswords_Lookup(t *testing.T) {
+	corpus, err := LoadBreachedPasswords(writeCorpus(t, "hunter2", "123456", "letmein"))
+	require.NoError(t, err)
+	defer corpus.Close()
+
+	for _, password := range []string{"hunter2", "123456", "letmein"} {
+		found, err := corpus.Contains(password)
+		require.NoError(t, err)
+		assert.True(t, found, password)
+	}
+
+	found, err := corpus.Contains("Vq7#mLp2!xR9")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestBreachedPasswords_RejectsUnsortedCorpus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	content := "FFFFF00000000000000000000000000000000000:1\n00000FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	_, err := LoadBreachedPasswords(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,252 @@
+package security
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords is ranked by frequency; the rank is used as the guess count for a match
+var commonPasswords = []string{
+	"password", "123456", "qwerty", "admin", "welcome", "letmein", "monkey", "dragon",
+	"iloveyou", "football", "baseball", "master", "sunshine", "princess", "shadow",
+	"superman", "michael", "login", "abc", "starwars", "whatever", "trustno1", "hello",
+	"freedom", "charlie", "jordan", "hunter", "ashley", "jessica", "pokemon", "soccer",
+	"batman", "thomas", "killer", "secret", "summer", "winter", "spring", "autumn",
+	"flower", "love", "family", "computer", "internet", "changeme", "default", "guest",
+	"root", "user", "test", "pass", "access", "mustang", "cookie", "pepper", "ginger",
+	"cheese", "orange", "banana", "purple", "silver", "golden", "tiger", "lucky",
+	"angel", "happy", "friend", "forever", "blessed", "jesus", "money", "bailey",
+	"maggie", "buster", "daniel", "andrew", "joshua", "matrix", "hockey", "ranger",
+	"fowergram", "instagram", "facebook", "google", "apple", "samsung", "thailand",
+	"bangkok", "qazwsx", "zaq", "asdf", "zxcv", "biteme", "hello123",
+}
+
+var commonPasswordRank = func() map[string]int {
+	ranks := make(map[string]int, len(commonPasswords))
+	for i, word := range commonPasswords {
+		ranks[word] = i + 1
+	}
+	return ranks
+}()
+
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1qaz2wsx3edc", "qazwsxedc"}
+
+var leetSubstitutions = strings.NewReplacer(
+	"4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t",
+)
+
+type strengthMatch struct {
+	start, end int // password[start:end]
+	guesses    float64
+}
+
+// EstimatePasswordEntropy returns log2 of the estimated number of guesses an attacker
+// needs. Like zxcvbn it looks for the cheapest way to build the password out of common
+// passwords, sequences, repeats, keyboard walks, years and brute-forced characters.
+func EstimatePasswordEntropy(password string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return 0
+	}
+
+	matches := findStrengthMatches(runes)
+	cardinality := charsetCardinality(runes)
+
+	// best[i] is the cheapest guess count for the first i characters
+	best := make([]float64, n+1)
+	best[0] = 1
+	for i := 1; i <= n; i++ {
+		best[i] = best[i-1] * cardinality
+		for _, m := range matches {
+			if m.end == i {
+				best[i] = math.Min(best[i], best[m.start]*m.guesses)
+			}
+		}
+	}
+
+	return math.Log2(best[n])
+}
+
+func findStrengthMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	matches = append(matches, dictionaryMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+	return matches
+}
+
+func dictionaryMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i < len(runes); i++ {
+		for j := i + 3; j <= len(runes); j++ {
+			original := string(runes[i:j])
+			lower := strings.ToLower(original)
+			unleeted := leetSubstitutions.Replace(lower)
+
+			rank, ok := commonPasswordRank[lower]
+			leet := false
+			if !ok {
+				rank, ok = commonPasswordRank[unleeted]
+				leet = ok
+			}
+			if !ok {
+				continue
+			}
+
+			guesses := float64(rank)
+			if original != lower {
+				// Capitalised or all upper case words are tried early, other mixes are not
+				if original == strings.ToUpper(lower) || original == strings.ToUpper(lower[:1])+lower[1:] {
+					guesses *= 2
+				} else {
+					guesses *= 16
+				}
+			}
+			if leet {
+				guesses *= 4
+			}
+			matches = append(matches, strengthMatch{start: i, end: j, guesses: math.Max(guesses, 10)})
+		}
+	}
+	return matches
+}
+
+// sequenceMatches finds runs like abcd, 4321 or xyz
+func sequenceMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i < len(runes)-2; {
+		delta := runes[i+1] - runes[i]
+		if delta != 1 && delta != -1 {
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && runes[j]-runes[j-1] == delta {
+			j++
+		}
+
+		if j-i >= 3 {
+			base := 26.0
+			if unicode.IsDigit(runes[i]) {
+				base = 10
+			}
+			if strings.ContainsRune("aAzZ019", runes[i]) {
+				base = 4
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, strengthMatch{start: i, end: j, guesses: base * float64(j-i)})
+		}
+		i = j
+	}
+	return matches
+}
+
+// repeatMatches finds runs of the same character such as aaaa or 1111
+func repeatMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		if j-i >= 3 {
+			guesses := charsetCardinality(runes[i:i+1]) * float64(j-i)
+			matches = append(matches, strengthMatch{start: i, end: j, guesses: guesses})
+		}
+		i = j
+	}
+	return matches
+}
+
+// keyboardMatches finds walks along a keyboard row such as qwerty or lkjh
+func keyboardMatches(runes []rune) []strengthMatch {
+	lower := []rune(strings.ToLower(string(runes)))
+
+	var matches []strengthMatch
+	for i := 0; i < len(lower); i++ {
+		for j := i + 4; j <= len(lower); j++ {
+			walk := string(lower[i:j])
+			for _, row := range keyboardRows {
+				if strings.Contains(row, walk) || strings.Contains(reverse(row), walk) {
+					// Starting key times a couple of directions per step
+					guesses := 47 * 4 * float64(j-i-1)
+					matches = append(matches, strengthMatch{start: i, end: j, guesses: guesses})
+					break
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// yearMatches finds years between 1900 and 2039
+func yearMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i+4 <= len(runes); i++ {
+		year := string(runes[i : i+4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && isDigits(year) && year < "2040" {
+			matches = append(matches, strengthMatch{start: i, end: i + 4, guesses: 140})
+		}
+	}
+	return matches
+}
+
+func charsetCardinality(runes []rune) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	cardinality := 0.0
+	if lower {
+		cardinality += 26
+	}
+	if upper {
+		cardinality += 26
+	}
+	if digit {
+		cardinality += 10
+	}
+	if symbol {
+		cardinality += 33
+	}
+	if other {
+		cardinality += 100
+	}
+	return cardinality
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
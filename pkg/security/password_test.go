@@ -0,0 +1,58 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher_Argon2id(t *testing.T) {
+	hasher := DefaultPasswordHasher()
+
+	hash, err := hasher.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+
+	ok, err := hasher.Verify("correct horse battery staple", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify("wrong password", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.False(t, hasher.NeedsRehash(hash))
+}
+
+func TestPasswordHasher_LegacyBcrypt(t *testing.T) {
+	hasher := DefaultPasswordHasher()
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	ok, err := hasher.Verify("secret-password", string(legacy))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, hasher.NeedsRehash(string(legacy)))
+}
+
+func TestPasswordHasher_WeakerParametersNeedRehash(t *testing.T) {
+	weak := NewArgon2idHasher(Argon2idParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	hash, err := weak.Hash("secret-password")
+	require.NoError(t, err)
+
+	hasher := DefaultPasswordHasher()
+	ok, err := hasher.Verify("secret-password", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, hasher.NeedsRehash(hash))
+}
+
+func TestPasswordHasher_UnknownFormat(t *testing.T) {
+	ok, err := DefaultPasswordHasher().Verify("password", "plaintext")
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
@@ -2,9 +2,11 @@ package security
 
 import (
 	"crypto/rand"
+	"encoding/base32"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"strings"
 )
 
 // GenerateRandomBytes generates a random byte array of specified length
@@ -33,3 +35,13 @@ func GenerateRandomCode(length int) (string, error) {
 	}
 	return hex.EncodeToString(b)[:length], nil
 }
+
+// GenerateBackupCode generates a one-time recovery code formatted as xxxxx-xxxxx
+func GenerateBackupCode() (string, error) {
+	b, err := GenerateRandomBytes(10)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
@@ -14,60 +14,144 @@ import (
 )
 
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID    uint   `json:"user_id"`
+	SessionID uint   `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateJWT(userID uint, secret string, expiration time.Duration) (string, error) {
+// oauthTokenSubject marks access tokens issued to third-party apps
+const oauthTokenSubject = "oauth"
+
+// GenerateJWT signs an access token bound to the device session it was issued for
+func GenerateJWT(userID uint, sessionID uint, keys *KeyRing, expiration time.Duration) (string, error) {
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(expiration).Unix(),
 			IssuedAt:  time.Now().Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.Sign(claims)
 }
 
-func GenerateRefreshToken(userID uint, secret string, expiration time.Duration) (string, error) {
+// GenerateRefreshToken signs a refresh token whose jti identifies its persisted row
+func GenerateRefreshToken(userID uint, tokenID string, keys *KeyRing, expiration time.Duration) (string, error) {
 	claims := &Claims{
 		UserID: userID,
 		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
 			ExpiresAt: time.Now().Add(expiration).Unix(),
 			IssuedAt:  time.Now().Unix(),
 			Subject:   "refresh",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.Sign(claims)
+}
+
+func ValidateJWT(tokenString string, keys *KeyRing) (uint, error) {
+	claims, err := ParseAccessToken(tokenString, keys)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
 }
 
-func ValidateJWT(tokenString string, secret string) (uint, error) {
+// ParseAccessToken verifies an access token and returns its claims
+func ParseAccessToken(tokenString string, keys *KeyRing) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+	token, err := keys.Parse(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
 
-	if err != nil || !token.Valid {
-		return 0, err
+	// Refresh and challenge tokens must never be accepted as access tokens
+	if !token.Valid || claims.Subject != "" {
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
 
-func ValidateRefreshToken(tokenString string, secret string) (uint, error) {
+// ValidateRefreshToken verifies a refresh token and returns its claims
+func ValidateRefreshToken(tokenString string, keys *KeyRing) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+	token, err := keys.Parse(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.Subject != "refresh" || claims.Id == "" {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	return claims, nil
+}
+
+// GenerateOAuthAccessToken signs an access token for a third-party client. Its jti
+// identifies the grant so it can be introspected and revoked.
+func GenerateOAuthAccessToken(userID uint, tokenID, clientID, scope string, keys *KeyRing, expiration time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:   userID,
+		ClientID: clientID,
+		Scope:    scope,
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Subject:   oauthTokenSubject,
+		},
+	}
 
-	if err != nil || !token.Valid || claims.Subject != "refresh" {
+	return keys.Sign(claims)
+}
+
+// ParseOAuthAccessToken verifies an access token issued to a third-party client. These
+// are never accepted by ParseAccessToken, so they only work on scoped routes.
+func ParseOAuthAccessToken(tokenString string, keys *KeyRing) (*Claims, error) {
+	claims := &Claims{}
+	token, err := keys.Parse(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.Subject != oauthTokenSubject || claims.Id == "" || claims.ClientID == "" {
+		return nil, fmt.Errorf("invalid OAuth access token")
+	}
+
+	return claims, nil
+}
+
+// GenerateChallengeToken signs a short-lived token that only proves a pending login step
+func GenerateChallengeToken(userID uint, purpose string, keys *KeyRing, expiration time.Duration) (string, error) {
+	claims := &Claims{
+		UserID: userID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Subject:   purpose,
+		},
+	}
+
+	return keys.Sign(claims)
+}
+
+// ValidateChallengeToken verifies a challenge token issued for the given purpose
+func ValidateChallengeToken(tokenString string, purpose string, keys *KeyRing) (uint, error) {
+	claims := &Claims{}
+	token, err := keys.Parse(tokenString, claims)
+	if err != nil {
 		return 0, err
 	}
 
+	if !token.Valid || claims.Subject != purpose {
+		return 0, fmt.Errorf("invalid challenge token")
+	}
+
 	return claims.UserID, nil
 }
 
@@ -79,18 +163,11 @@ func GenerateDeviceID() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-func ValidateToken(tokenString string, secret string) (*domain.User, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
-
+func ValidateToken(tokenString string, keys *KeyRing) (*domain.User, error) {
+	claims, err := ParseAccessToken(tokenString, keys)
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return &domain.User{ID: claims.UserID}, nil
-	}
-
-	return nil, fmt.Errorf("invalid token")
+	return &domain.User{ID: claims.UserID}, nil
 }
@@ -0,0 +1,94 @@
+// Package useragent reads the operating system, browser and Fowergram app version
+// from a User-Agent header, well enough to tell a user's devices apart
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// AppName is the product token of the Fowergram apps, e.g. "Fowergram/2.4.1 (iOS 17.2)"
+const AppName = "Fowergram"
+
+// Info is what could be read from a User-Agent. Unknown parts are empty.
+type Info struct {
+	OS         string `json:"os"`
+	Browser    string `json:"browser"`
+	AppVersion string `json:"app_version"`
+}
+
+var (
+	appPattern     = regexp.MustCompile(AppName + `/([\d.]+)`)
+	windowsPattern = regexp.MustCompile(`Windows NT ([\d.]+)`)
+	iosPattern     = regexp.MustCompile(`(?:iPhone OS|CPU OS|iOS) ([\d_.]+)`)
+	androidPattern = regexp.MustCompile(`Android ([\d.]+)`)
+	macPattern     = regexp.MustCompile(`Mac OS X ([\d_.]+)`)
+)
+
+// Browsers built on another engine go first, they also send the token of that engine
+var browsers = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/(\d+)`)},
+	{"Opera", regexp.MustCompile(`OPR/(\d+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/(\d+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)},
+	{"Safari", regexp.MustCompile(`Version/(\d+)[\d.]* (?:Mobile/\S+ )?Safari/`)},
+}
+
+// Windows 11 still reports NT 10.0
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+}
+
+func Parse(ua string) Info {
+	info := Info{OS: parseOS(ua)}
+
+	if match := appPattern.FindStringSubmatch(ua); match != nil {
+		info.AppVersion = match[1]
+		// The apps are not browsers, even if they embed a web view
+		return info
+	}
+
+	for _, browser := range browsers {
+		if match := browser.pattern.FindStringSubmatch(ua); match != nil {
+			info.Browser = browser.name + " " + match[1]
+			break
+		}
+	}
+	return info
+}
+
+func parseOS(ua string) string {
+	if match := windowsPattern.FindStringSubmatch(ua); match != nil {
+		if version, ok := windowsVersions[match[1]]; ok {
+			return "Windows " + version
+		}
+		return "Windows"
+	}
+	if match := iosPattern.FindStringSubmatch(ua); match != nil {
+		name := "iOS"
+		if strings.Contains(ua, "iPad") {
+			name = "iPadOS"
+		}
+		return name + " " + strings.ReplaceAll(match[1], "_", ".")
+	}
+	if match := androidPattern.FindStringSubmatch(ua); match != nil {
+		return "Android " + match[1]
+	}
+	if match := macPattern.FindStringSubmatch(ua); match != nil {
+		return "macOS " + strings.ReplaceAll(match[1], "_", ".")
+	}
+	if strings.Contains(ua, "CrOS") {
+		return "ChromeOS"
+	}
+	if strings.Contains(ua, "Linux") {
+		return "Linux"
+	}
+	return ""
+}
@@ -7,6 +7,9 @@ import (
 	"strings"
 	"testing"
 
+	"fowergram/internal/core/domain"
+	"fowergram/pkg/security"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,7 +23,7 @@ func TestAuthFlow(t *testing.T) {
 	req := httptest.NewRequest("POST", "/api/v1/auth/register", strings.NewReader(`{
 		"username": "testuser1",
 		"email": "test1@example.com",
-		"password": "Password123!"
+		"password": "Fl0wer-Garden-42"
 	}`))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := app.Test(req, -1)
@@ -30,7 +33,7 @@ func TestAuthFlow(t *testing.T) {
 	// Login with the registered user
 	req = httptest.NewRequest("POST", "/api/v1/auth/login", strings.NewReader(`{
 		"email": "test1@example.com",
-		"password": "Password123!"
+		"password": "Fl0wer-Garden-42"
 	}`))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err = app.Test(req, -1)
@@ -61,7 +64,7 @@ func TestAuthFlow_TokenValidation(t *testing.T) {
 	req := httptest.NewRequest("POST", "/api/v1/auth/register", strings.NewReader(`{
 		"username": "testuser2",
 		"email": "test2@example.com",
-		"password": "Password123!"
+		"password": "Fl0wer-Garden-42"
 	}`))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := app.Test(req, -1)
@@ -71,7 +74,7 @@ func TestAuthFlow_TokenValidation(t *testing.T) {
 	// Login to get a token
 	req = httptest.NewRequest("POST", "/api/v1/auth/login", strings.NewReader(`{
 		"email": "test2@example.com",
-		"password": "Password123!"
+		"password": "Fl0wer-Garden-42"
 	}`))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err = app.Test(req, -1)
@@ -123,7 +126,7 @@ func TestAuthFlow_AccountLocking(t *testing.T) {
 	// Register a test user first
 	registerReq := httptest.NewRequest("POST", "/api/v1/auth/register", strings.NewReader(`{
 		"email": "test2@example.com",
-		"password": "Password123!",
+		"password": "Fl0wer-Garden-42",
 		"username": "test2"
 	}`))
 	registerReq.Header.Set("Content-Type", "application/json")
@@ -157,7 +160,7 @@ func TestAuthFlow_AccountLocking(t *testing.T) {
 	// Try with correct password after account is locked
 	loginReq := httptest.NewRequest("POST", "/api/v1/auth/login", strings.NewReader(`{
 		"email": "test2@example.com",
-		"password": "Password123!"
+		"password": "Fl0wer-Garden-42"
 	}`))
 	loginReq.Header.Set("Content-Type", "application/json")
 	resp, err = app.Test(loginReq, -1)
@@ -168,3 +171,70 @@ func TestAuthFlow_AccountLocking(t *testing.T) {
 	require.NoError(t, err)
 	require.Contains(t, string(body), "Account is locked")
 }
+
+func TestAuthFlow_TwoFactorLoginReplacesDeviceSession(t *testing.T) {
+	app := setupTestApp()
+	cleanupTestDB(testDB)
+
+	req := httptest.NewRequest("POST", "/api/v1/auth/register", strings.NewReader(`{
+		"username": "testuser3",
+		"email": "test3@example.com",
+		"password": "Fl0wer-Garden-42"
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var user domain.User
+	require.NoError(t, testDB.Where("email = ?", "test3@example.com").First(&user).Error)
+	secret, err := security.Encrypt("JBSWY3DPEHPK3PXP", security.DeriveEncryptionKey("test-2fa-key"))
+	require.NoError(t, err)
+	require.NoError(t, testDB.Model(&user).Updates(map[string]interface{}{"two_factor_enabled": true, "two_factor_secret": secret}).Error)
+	require.NoError(t, testDB.Create(&[]*domain.BackupCode{
+		{UserID: user.ID, CodeHash: security.HashToken("aaaa1111")},
+		{UserID: user.ID, CodeHash: security.HashToken("bbbb2222")},
+	}).Error)
+
+	// Both logins come from the same device, each finished with a backup code
+	for _, code := range []string{"aaaa1111", "bbbb2222"} {
+		req = httptest.NewRequest("POST", "/api/v1/auth/login", strings.NewReader(`{
+			"email": "test3@example.com",
+			"password": "Fl0wer-Garden-42"
+		}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Device-ID", "phone-1")
+		resp, err = app.Test(req, -1)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var challenge domain.LoginChallenge
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&challenge))
+		require.Equal(t, "mfa_pending", challenge.Type)
+
+		req = httptest.NewRequest("POST", "/api/v1/auth/login/2fa", strings.NewReader(`{
+			"challenge_token": "`+challenge.Token+`",
+			"code": "`+code+`"
+		}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Device-ID", "phone-1")
+		resp, err = app.Test(req, -1)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+	}
+
+	// The second login replaced the first session instead of adding another
+	var sessions []*domain.DeviceSession
+	require.NoError(t, testDB.Where("user_id = ?", user.ID).Order("id").Find(&sessions).Error)
+	require.Len(t, sessions, 2)
+	for _, session := range sessions {
+		assert.Equal(t, "phone-1", session.DeviceID)
+	}
+	assert.False(t, sessions[0].Active)
+	assert.True(t, sessions[1].Active)
+
+	var live int64
+	require.NoError(t, testDB.Model(&domain.RefreshToken{}).
+		Where("device_session_id = ? AND revoked_at IS NULL", sessions[0].ID).Count(&live).Error)
+	assert.Zero(t, live)
+}
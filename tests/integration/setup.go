@@ -12,13 +12,13 @@ import (
 	redisrepo "fowergram/internal/repositories/redis"
 	"fowergram/pkg/email"
 	"fowergram/pkg/geolocation"
+	"fowergram/pkg/security"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/redis/go-redis/v9"
 	pgdriver "gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -53,6 +53,71 @@ func (m *mockCacheRepo) Delete(key string) error {
 	return nil
 }
 
+type mockRevocationRepo struct{}
+
+func (m *mockRevocationRepo) RevokeSession(sessionID uint, ttl time.Duration) error {
+	return nil
+}
+
+func (m *mockRevocationRepo) IsSessionRevoked(sessionID uint) (bool, error) {
+	return false, nil
+}
+
+// mockRateLimitRepo keeps limiter state in memory so it does not carry over between tests
+type mockRateLimitRepo struct {
+	hits     map[string][]time.Time
+	failures map[string]int64
+	locks    map[string]time.Time
+}
+
+func newMockRateLimitRepo() *mockRateLimitRepo {
+	return &mockRateLimitRepo{
+		hits:     make(map[string][]time.Time),
+		failures: make(map[string]int64),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (m *mockRateLimitRepo) Hit(key string, limit int, window time.Duration) (*domain.RateLimitResult, error) {
+	now := time.Now()
+	var kept []time.Time
+	for _, hit := range m.hits[key] {
+		if hit.After(now.Add(-window)) {
+			kept = append(kept, hit)
+		}
+	}
+	allowed := len(kept) < limit
+	if allowed {
+		kept = append(kept, now)
+	}
+	m.hits[key] = kept
+	return &domain.RateLimitResult{Allowed: allowed, Limit: limit, Remaining: limit - len(kept), Reset: kept[0].Add(window).Sub(now)}, nil
+}
+
+func (m *mockRateLimitRepo) AddFailure(key string, window time.Duration) (int64, error) {
+	m.failures[key]++
+	return m.failures[key], nil
+}
+
+func (m *mockRateLimitRepo) Lock(key string, duration time.Duration) error {
+	m.locks[key] = time.Now().Add(duration)
+	return nil
+}
+
+func (m *mockRateLimitRepo) Lockout(key string) (*domain.LockoutStatus, error) {
+	status := &domain.LockoutStatus{Failures: m.failures[key]}
+	if until, ok := m.locks[key]; ok && until.After(time.Now()) {
+		status.LockedFor = time.Until(until)
+	}
+	return status, nil
+}
+
+func (m *mockRateLimitRepo) ClearLockout(key string) error {
+	delete(m.failures, key)
+	delete(m.locks, key)
+	return nil
+}
+
 func setupTestApp() *fiber.App {
 	// Initialize test database
 	db := setupTestDB()
@@ -62,6 +127,20 @@ func setupTestApp() *fiber.App {
 		&domain.LoginHistory{},
 		&domain.AuthCode{},
 		&domain.AccountRecovery{},
+		&domain.RefreshToken{},
+		&domain.BackupCode{},
+		&domain.WebAuthnCredential{},
+		&domain.UserIdentity{},
+		&domain.OAuthClient{},
+		&domain.OAuthToken{},
+		&domain.AdminAction{},
+		&domain.AuditEntry{},
+		&domain.APIKey{},
+		&domain.DataExport{},
+		&domain.MediaBlob{},
+		&domain.Media{},
+		&domain.MediaUpload{},
+		&domain.MediaRendition{},
 	); err != nil {
 		panic(err)
 	}
@@ -77,18 +156,28 @@ func setupTestApp() *fiber.App {
 
 	// Initialize repositories and services
 	authRepo := postgres.NewAuthRepository(db)
-	emailService := email.NewEmailService("test-key", "test@example.com", "Test")
+	emailService := email.NewEmailService("test-key", "test@example.com", "Test", "http://localhost:3000/auth/magic")
 	geoService := geolocation.NewGeoService("test-key")
 
 	var cacheRepo ports.CacheRepository
+	var revocationRepo ports.SessionRevocationRepository
 	if err := redisClient.Ping(context.Background()).Err(); err != nil {
 		// If Redis is not available, use mock implementation
 		cacheRepo = &mockCacheRepo{}
+		revocationRepo = &mockRevocationRepo{}
 	} else {
 		cacheRepo = redisrepo.NewCacheRepository(redisClient)
+		revocationRepo = redisrepo.NewSessionRevocationRepository(redisClient)
 	}
 
-	authService := services.NewAuthService(authRepo, emailService, geoService, cacheRepo, "test-secret")
+	auditService := services.NewAuditService(postgres.NewAuditRepository(db))
+	twoFactorService := services.NewTwoFactorService(authRepo, auditService, security.DeriveEncryptionKey("test-2fa-key"), "Fowergram")
+	jwtKeys, err := security.LoadKeyRing("", "", "test-secret")
+	if err != nil {
+		panic(err)
+	}
+	rateLimits := services.NewRateLimitService(newMockRateLimitRepo())
+	authService := services.NewAuthService(authRepo, emailService, geoService, cacheRepo, revocationRepo, twoFactorService, nil, nil, auditService, rateLimits, jwtKeys, security.DefaultPasswordHasher(), security.NewPasswordPolicy(8, 28, nil))
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
@@ -107,97 +196,20 @@ func setupTestApp() *fiber.App {
 	v1 := api.Group("/v1")
 	auth := v1.Group("/auth")
 
-	// Add security middleware
-	securityMiddleware := middleware.NewSecurityMiddleware()
-
-	// Create rate limiter for login endpoint
-	loginLimiter := limiter.New(limiter.Config{
-		Max:        5,               // 5 requests
-		Expiration: 1 * time.Minute, // per 1 minute
-		KeyGenerator: func(c *fiber.Ctx) string {
-			// Parse request body to get email
-			req := new(domain.LoginRequest)
-			if err := c.BodyParser(req); err != nil {
-				return c.IP() + ":" + c.Path()
-			}
-
-			// Check if user exists and get user data for login
-			user, err := authRepo.FindUserByEmail(req.Email)
-			if err != nil {
-				return c.IP() + ":" + c.Path()
-			}
-
-			// Check if account is locked
-			if user.AccountLockedUntil != nil && user.AccountLockedUntil.After(time.Now()) {
-				return "locked:" + req.Email
-			}
-
-			return c.IP() + ":" + c.Path()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			// Parse request body to get email
-			req := new(domain.LoginRequest)
-			if err := c.BodyParser(req); err != nil {
-				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-					"error": "Too many attempts, please try again later",
-				})
-			}
-
-			// Check if user exists and get user data for login
-			user, err := authRepo.FindUserByEmail(req.Email)
-			if err != nil {
-				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-					"error": "Too many attempts, please try again later",
-				})
-			}
-
-			// Check if account is locked
-			if user.AccountLockedUntil != nil && user.AccountLockedUntil.After(time.Now()) {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Account is locked due to too many failed attempts",
-				})
-			}
-
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Too many attempts, please try again later",
-			})
-		},
+	// Unknown addresses are limited to five attempts a minute. Known accounts are left to
+	// the account lockout in the auth service.
+	loginLimiter := middleware.RateLimit(rateLimits, domain.RateLimitPolicy{Name: "login:email", Limit: 5, Window: time.Minute}, func(c *fiber.Ctx) string {
+		email := middleware.ByEmail(c)
+		if _, err := authRepo.FindUserByEmail(email); err == nil {
+			return ""
+		}
+		return email
 	})
 
-	// Apply rate limiting to other endpoints
-	auth.Group("/register").Use(securityMiddleware.RateLimiter())
-	auth.Group("/validate").Use(securityMiddleware.RateLimiter())
-
 	// Setup auth routes
-	auth.Post("/register", authHandler.Register)
-	auth.Post("/login", loginLimiter, func(c *fiber.Ctx) error {
-		// Parse request body
-		req := new(domain.LoginRequest)
-		if err := c.BodyParser(req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request format",
-			})
-		}
-
-		// Check if user exists and get user data for login
-		user, err := authRepo.FindUserByEmail(req.Email)
-		if err != nil {
-			// If user doesn't exist, return unauthorized with error message
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid email or password",
-			})
-		}
-
-		// Check if account is locked
-		if user.AccountLockedUntil != nil && user.AccountLockedUntil.After(time.Now()) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Account is locked due to too many failed attempts",
-			})
-		}
-
-		// If user exists and not locked, proceed with normal login flow
-		return authHandler.Login(c)
-	})
+	auth.Post("/register", middleware.RateLimit(rateLimits, middleware.RegisterPerIP, middleware.ByIP), authHandler.Register)
+	auth.Post("/login", loginLimiter, authHandler.Login)
+	auth.Post("/login/2fa", authHandler.LoginTwoFactor)
 	auth.Get("/validate", func(c *fiber.Ctx) error {
 		auth := c.Get("Authorization")
 		if auth == "" || !strings.HasPrefix(auth, "Bearer ") {